@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AccessTokenController struct {
+	accessTokenUsecase usecases.AccessTokenUsecase
+}
+
+func NewAccessTokenController(accessTokenUsecase usecases.AccessTokenUsecase) *AccessTokenController {
+	return &AccessTokenController{accessTokenUsecase: accessTokenUsecase}
+}
+
+type accessTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 for a token that does not expire
+}
+
+// CreateToken answers with the token itself only this once, it is stored hashed
+func (ac *AccessTokenController) CreateToken(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var req accessTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, rawToken, err := ac.accessTokenUsecase.CreateToken(ctx, userID, userID, req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		ctx.JSON(accessTokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"message":      "Copy the token now, it can not be shown again",
+		"token":        rawToken,
+		"access_token": token,
+	})
+}
+
+func (ac *AccessTokenController) GetMyTokens(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	tokens, err := ac.accessTokenUsecase.GetUserTokens(ctx, userID)
+	if err != nil {
+		ctx.JSON(accessTokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"access_tokens": tokens})
+}
+
+func (ac *AccessTokenController) RevokeToken(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	tokenID, err := primitive.ObjectIDFromHex(ctx.Param("token_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID format"})
+		return
+	}
+
+	if err := ac.accessTokenUsecase.RevokeToken(ctx, userID, tokenID, userID); err != nil {
+		ctx.JSON(accessTokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Access token revoked"})
+}
+
+func accessTokenErrorStatus(err error) int {
+	switch err {
+	case repository.ErrAccessTokenName, repository.ErrAccessTokenScopes, repository.ErrAccessTokenExpiry, repository.ErrBotName:
+		return http.StatusBadRequest
+	case repository.ErrAccessTokenNotFound, repository.ErrBotNotFound, repository.ErrUserNotFound:
+		return http.StatusNotFound
+	}
+	fmt.Println("Access token error:", err)
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AccountController struct {
+	accountUsecase usecases.AccountUsecase
+}
+
+func NewAccountController(accountUsecase usecases.AccountUsecase) *AccountController {
+	return &AccountController{accountUsecase: accountUsecase}
+}
+
+// DeleteMe schedules the deletion of the account, it is purged once the grace period is over
+func (ac *AccountController) DeleteMe(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var body struct {
+		Password string `json:"password"` // not needed for google accounts without a password
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil && ctx.Request.ContentLength > 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scheduledAt, err := ac.accountUsecase.ScheduleDeletion(ctx, userID, body.Password)
+	if err != nil {
+		ctx.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"message":               "Your account will be deleted, log in and cancel before the date to keep it",
+		"deletion_scheduled_at": scheduledAt,
+	})
+}
+
+func (ac *AccountController) CancelDeletion(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	if err := ac.accountUsecase.CancelDeletion(ctx, userID); err != nil {
+		ctx.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+}
+
+// ExportMe downloads everything stored about the user, as a zip with one
+// json file per section or as a single json document with ?format=json
+func (ac *AccountController) ExportMe(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	format := ctx.DefaultQuery("format", "zip")
+	if format != "zip" && format != "json" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "format must be zip or json"})
+		return
+	}
+
+	export, err := ac.accountUsecase.ExportUserData(ctx, userID)
+	if err != nil {
+		ctx.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("iknow-export-%s", export.ExportedAt.Format("20060102150405"))
+	if format == "json" {
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".json"))
+		ctx.JSON(http.StatusOK, export)
+		return
+	}
+
+	archive, err := exportArchive(export)
+	if err != nil {
+		fmt.Println("Could not build the export archive:", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build the export archive"})
+		return
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".zip"))
+	ctx.Data(http.StatusOK, "application/zip", archive)
+}
+
+func exportArchive(export interface{}) ([]byte, error) {
+	raw, err := json.Marshal(export)
+	if err != nil {
+		return nil, err
+	}
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &sections); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, name := range names {
+		file, err := archive.Create(name + ".json")
+		if err != nil {
+			return nil, err
+		}
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, sections[name], "", "  "); err != nil {
+			return nil, err
+		}
+		if _, err := file.Write(indented.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func accountErrorStatus(err error) int {
+	switch err {
+	case repository.ErrWrongCredentials:
+		return http.StatusUnauthorized
+	case repository.ErrUserNotFound:
+		return http.StatusNotFound
+	case repository.ErrDeletionScheduled, repository.ErrDeletionNotScheduled:
+		return http.StatusConflict
+	}
+	fmt.Println("Account error:", err)
+	return http.StatusInternalServerError
+}
@@ -2,74 +2,229 @@ package controller
 
 import (
 	"fmt"
+	"io"
+	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/chera-mihiretu/IKnow/delivery/helpers"
 	"github.com/chera-mihiretu/IKnow/domain/models"
 	"github.com/chera-mihiretu/IKnow/infrastructure/hashing"
 	"github.com/chera-mihiretu/IKnow/infrastructure/middleware"
+	"github.com/chera-mihiretu/IKnow/infrastructure/oauth"
 	"github.com/chera-mihiretu/IKnow/infrastructure/validation"
+	"github.com/chera-mihiretu/IKnow/repository"
 	"github.com/chera-mihiretu/IKnow/usecases"
 	"github.com/gin-gonic/gin"
 	"github.com/markbates/goth/gothic"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type AuthController struct {
-	authUseCase usecases.AuthUseCase
+	authUseCase    usecases.AuthUseCase
+	sessionUsecase usecases.SessionUsecase
 }
 
-func NewAuthController(authUseCase usecases.AuthUseCase) *AuthController {
+func NewAuthController(authUseCase usecases.AuthUseCase, sessionUsecase usecases.SessionUsecase) *AuthController {
 	return &AuthController{
-		authUseCase: authUseCase,
+		authUseCase:    authUseCase,
+		sessionUsecase: sessionUsecase,
 	}
 }
 
-func (auth *AuthController) LoginWithGoogle(c *gin.Context) {
+// refreshTokenCookie holds the refresh token of a provider login, it is only sent to the
+// auth routes that refresh and end the session
+const (
+	refreshTokenCookie     = "refresh_token"
+	refreshTokenCookiePath = "/api/auth"
+)
 
-	gothic.BeginAuthHandler(c.Writer, c.Request)
+func setRefreshCookie(c *gin.Context, token string) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    token,
+		Path:     refreshTokenCookiePath,
+		MaxAge:   int(repository.RefreshTokenTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		// only the front end, allowed by the cors origin, can make the browser send it; a
+		// request another site starts never carries it
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func clearRefreshCookie(c *gin.Context) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Path:     refreshTokenCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// providerLinkState starts the state of a provider link, the rest is the nonce of the link.
+// The random state of a login is url safe base64, it never has a dot
+const providerLinkState = "link."
+
+func (auth *AuthController) LoginWithProvider(c *gin.Context) {
+	// gothic takes the state from the query when there is one, it must stay random
+	q := c.Request.URL.Query()
+	q.Del("state")
+	c.Request.URL.RawQuery = q.Encode()
 
+	gothic.BeginAuthHandler(c.Writer, c.Request)
 }
 
 func (auth *AuthController) HandleCallback(c *gin.Context) {
+	provider := c.Param("provider")
+
 	// Complete the OAuth2 authentication
 	user, err := gothic.CompleteUserAuth(c.Writer, c.Request)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to authenticate with Google: " + err.Error()})
+		c.JSON(500, gin.H{"error": "Failed to authenticate with " + provider + ": " + err.Error()})
 		return
 	}
 
-	verified := helpers.VerifyCallback(user)
-	if !verified {
+	if provider == "google" && !helpers.VerifyCallback(user) {
 		c.JSON(400, gin.H{"error": "Google authentication failed"})
 		return
 	}
 
-	user_email := user.Email
-	if user_email == "" {
-		c.JSON(400, gin.H{"error": "Email not provided by Google"})
+	identity, err := oauth.Identity(user)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	var myUser models.User
-
-	myUser.Email = user.Email
-	myUser.Name = user.Name
-	myUser.ProfileImageURL = user.AvatarURL
+	// gothic checked the state against its session cookie, a link can only be finished
+	// by the browser that started it
+	if nonce, ok := strings.CutPrefix(c.Query("state"), providerLinkState); ok {
+		auth.finishProviderLink(c, nonce, identity)
+		return
+	}
 
-	token, err := auth.authUseCase.SignInWithGoogle(c, myUser)
+	result, err := auth.authUseCase.SignInWithProvider(c, identity, helpers.SessionDevice(c))
 
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to register user with Google: " + err.Error()})
+		c.JSON(providerErrorStatus(err), gin.H{"error": "Failed to sign in with " + provider + ": " + err.Error()})
 		return
 	}
-	redirectURL := fmt.Sprintf("%s/auth/callback?token=%s", os.Getenv("FRONT_BASE_URL"), url.QueryEscape(token))
-	fmt.Println("Redirecting to:", redirectURL)
+
+	var redirectURL string
+	if result.Challenge != nil {
+		// the front end finishes the login on the two factor page
+		redirectURL = fmt.Sprintf("%s/auth/callback?mfa_token=%s&enrollment_required=%t",
+			os.Getenv("FRONT_BASE_URL"),
+			url.QueryEscape(result.Challenge.Token),
+			result.Challenge.EnrollmentRequired,
+		)
+	} else {
+		// a url ends up in the history, referers and proxy logs, the long lived refresh
+		// token only goes out in a cookie scripts can not read
+		setRefreshCookie(c, result.Tokens.RefreshToken)
+		redirectURL = fmt.Sprintf("%s/auth/callback?token=%s",
+			os.Getenv("FRONT_BASE_URL"),
+			url.QueryEscape(result.Tokens.AccessToken),
+		)
+	}
 
 	c.Redirect(http.StatusFound, redirectURL)
 }
 
+func (auth *AuthController) finishProviderLink(c *gin.Context, nonce string, identity models.UserIdentities) {
+	if _, err := auth.authUseCase.FinishProviderLink(c, nonce, identity); err != nil {
+		c.JSON(providerErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusFound, fmt.Sprintf("%s/settings/linked-accounts?linked=%s",
+		os.Getenv("FRONT_BASE_URL"), url.QueryEscape(identity.Provider)))
+}
+
+// StartProviderLink returns the url of the provider the browser opens to link it to the
+// logged in user. The nonce of the link is the oauth state, so the gothic session cookie
+// of this response is needed to finish it
+func (auth *AuthController) StartProviderLink(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	nonce, err := auth.authUseCase.StartProviderLink(ctx, userID, ctx.Param("provider"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start linking: " + err.Error()})
+		return
+	}
+
+	q := ctx.Request.URL.Query()
+	q.Set("state", providerLinkState+nonce)
+	ctx.Request.URL.RawQuery = q.Encode()
+	authURL, err := gothic.GetAuthURL(ctx.Writer, ctx.Request)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start linking: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"url":        authURL,
+		"expires_in": int(repository.ProviderLinkTTL.Seconds()),
+	})
+}
+
+func (auth *AuthController) UnlinkProvider(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	if err := auth.authUseCase.UnlinkProvider(ctx, userID, ctx.Param("provider")); err != nil {
+		ctx.JSON(providerErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Provider unlinked"})
+}
+
+func (auth *AuthController) GetLinkedAccounts(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	identities, err := auth.authUseCase.GetLinkedAccounts(ctx, userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch linked accounts: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"linked_accounts": identities})
+}
+
+func providerErrorStatus(err error) int {
+	switch err {
+	case repository.ErrEmailDomainNotAllowed, repository.ErrProviderEmailUnverified:
+		return http.StatusForbidden
+	case repository.ErrIdentityLinked, repository.ErrProviderAlreadyLinked, repository.ErrLastLoginMethod, repository.ErrUserExists:
+		return http.StatusConflict
+	case repository.ErrIdentityNotFound, repository.ErrUserNotFound:
+		return http.StatusNotFound
+	case repository.ErrInvalidProviderLink:
+		return http.StatusUnauthorized
+	}
+	log.Println("Provider login error:", err)
+	return http.StatusInternalServerError
+}
+
 func (auth *AuthController) LoginWithEmail(ctx *gin.Context) {
 	var user models.User
 
@@ -85,14 +240,246 @@ func (auth *AuthController) LoginWithEmail(ctx *gin.Context) {
 		return
 	}
 
-	token, err := auth.authUseCase.LoginWithEmail(ctx, user)
+	result, err := auth.authUseCase.LoginWithEmail(ctx, user, helpers.SessionDevice(ctx))
+
+	if respondThrottled(ctx, err) {
+		return
+	}
+	if err == repository.ErrPasswordResetRequired {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondLogin(ctx, result)
+}
+
+// SendMagicLink answers the same whether the account exists or not, so it can
+// not be used to find out which emails are registered
+func (auth *AuthController) SendMagicLink(ctx *gin.Context) {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Email == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
+		return
+	}
+
+	err := auth.authUseCase.SendMagicLink(ctx, body.Email, ctx.ClientIP())
+	if respondThrottled(ctx, err) {
+		return
+	}
+	if err != nil && err != repository.ErrUserNotFound {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "If the email has an account, a login link was sent"})
+}
+
+// LoginWithMagicLink is posted by the front end with the token of the emailed link,
+// it is not a GET so mail scanners opening the link do not use it up
+func (auth *AuthController) LoginWithMagicLink(ctx *gin.Context) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Token == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		return
+	}
 
+	result, err := auth.authUseCase.LoginWithMagicLink(ctx, body.Token, helpers.SessionDevice(ctx))
+	if respondThrottled(ctx, err) {
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"token": token})
+	respondLogin(ctx, result)
+}
+
+// respondLogin answers with the session tokens, or with the mfa challenge when a second factor is needed
+func respondLogin(ctx *gin.Context, result models.LoginResult) {
+	if result.Challenge != nil {
+		ctx.JSON(http.StatusOK, gin.H{
+			"mfa_required":        true,
+			"mfa_token":           result.Challenge.Token,
+			"enrollment_required": result.Challenge.EnrollmentRequired,
+			"expires_at":          result.Challenge.ExpiresAt,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"token":         result.Tokens.AccessToken,
+		"refresh_token": result.Tokens.RefreshToken,
+		"expires_at":    result.Tokens.ExpiresAt,
+	})
+}
+
+// RefreshToken rotates the refresh token of the body, or of the cookie a provider login set.
+// A token that came in the cookie goes back in the cookie only
+func (auth *AuthController) RefreshToken(ctx *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fromCookie := false
+	if req.RefreshToken == "" {
+		req.RefreshToken, _ = ctx.Cookie(refreshTokenCookie)
+		fromCookie = req.RefreshToken != ""
+	}
+	if req.RefreshToken == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token is required"})
+		return
+	}
+
+	tokens, err := auth.sessionUsecase.RefreshSession(ctx, req.RefreshToken, helpers.SessionDevice(ctx))
+
+	if err != nil {
+		if fromCookie {
+			clearRefreshCookie(ctx)
+		}
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if fromCookie {
+		setRefreshCookie(ctx, tokens.RefreshToken)
+		ctx.JSON(http.StatusOK, gin.H{
+			"token":      tokens.AccessToken,
+			"expires_at": tokens.ExpiresAt,
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
+	})
+}
+
+func (auth *AuthController) Logout(ctx *gin.Context) {
+	userID, sessionID, ok := sessionFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	if err := auth.authUseCase.Logout(ctx, userID, sessionID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout: " + err.Error()})
+		return
+	}
+
+	// clear the gothic and refresh token cookies as well for users that came through a login provider
+	gothic.Logout(ctx.Writer, ctx.Request)
+	clearRefreshCookie(ctx)
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+func (auth *AuthController) LogoutOtherSessions(ctx *gin.Context) {
+	userID, sessionID, ok := sessionFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	count, err := auth.authUseCase.LogoutAllSessions(ctx, userID, sessionID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout other sessions: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Logged out from other devices", "revoked": count})
+}
+
+func (auth *AuthController) LogoutEverywhere(ctx *gin.Context) {
+	userID, _, ok := sessionFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	count, err := auth.authUseCase.LogoutAllSessions(ctx, userID, primitive.NilObjectID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout everywhere: " + err.Error()})
+		return
+	}
+
+	gothic.Logout(ctx.Writer, ctx.Request)
+	clearRefreshCookie(ctx)
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Logged out from all devices", "revoked": count})
+}
+
+func (auth *AuthController) GetMySessions(ctx *gin.Context) {
+	userID, sessionID, ok := sessionFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	sessions, err := auth.sessionUsecase.GetUserSessions(ctx, userID, sessionID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (auth *AuthController) RevokeMySession(ctx *gin.Context) {
+	userID, _, ok := sessionFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	targetID, err := primitive.ObjectIDFromHex(ctx.Param("session_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := auth.sessionUsecase.RevokeUserSession(ctx, userID, targetID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// sessionFromContext reads the ids set by AuthUserMiddleware, it writes the error response itself
+func sessionFromContext(ctx *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	sessionID, err := primitive.ObjectIDFromHex(ctx.GetString("session_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID format"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	return userID, sessionID, true
 }
 
 func (auth *AuthController) RegisterWithEmail(ctx *gin.Context) {
@@ -124,6 +511,15 @@ func (auth *AuthController) RegisterWithEmail(ctx *gin.Context) {
 
 	err = auth.authUseCase.RegisterUserEmail(ctx, user)
 
+	if err == repository.ErrEmailDomainNotAllowed {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	switch err {
+	case repository.ErrInvalidInvitation, repository.ErrInvitationEmail, repository.ErrInvitationUniversity:
+		ctx.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
@@ -154,6 +550,10 @@ func (auth *AuthController) VerifyEmail(ctx *gin.Context) {
 
 	err = auth.authUseCase.VerifyEmail(ctx, tokenModel)
 
+	if err == repository.ErrUserExists {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -175,8 +575,11 @@ func (auth *AuthController) ForgotPassword(ctx *gin.Context) {
 		return
 	}
 
-	err := auth.authUseCase.ForgotPassword(ctx, user)
+	err := auth.authUseCase.ForgotPassword(ctx, user, ctx.ClientIP())
 
+	if respondThrottled(ctx, err) {
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send reset password email: " + err.Error()})
 		return
@@ -185,6 +588,71 @@ func (auth *AuthController) ForgotPassword(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"message": "Reset password email sent successfully"})
 }
 
+// ResendVerificationEmail answers the same whether a pending signup exists or not,
+// so it can not be used to find out which emails are registered
+func (auth *AuthController) ResendVerificationEmail(ctx *gin.Context) {
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Email == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
+		return
+	}
+
+	err := auth.authUseCase.ResendVerificationEmail(ctx, body.Email, ctx.ClientIP())
+	if respondThrottled(ctx, err) {
+		return
+	}
+	if err != nil && err != repository.ErrUserNotFound {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "If the email is waiting for verification, a new link was sent"})
+}
+
+// UnlockAccount is the link of the account locked email
+func (auth *AuthController) UnlockAccount(ctx *gin.Context) {
+	token := ctx.DefaultQuery("token", "")
+	front_url, exist := os.LookupEnv("FRONT_BASE_URL")
+	if !exist {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Front Url Token is required"})
+		return
+	}
+
+	err := auth.authUseCase.UnlockAccount(ctx, token)
+	if err == repository.ErrInvalidUnlockToken {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account: " + err.Error()})
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, front_url+"/auth/unlocked")
+}
+
+// respondThrottled answers with 429, or 423 for a locked account, when the brute force
+// protection rejected the request
+func respondThrottled(ctx *gin.Context, err error) bool {
+	throttled, ok := err.(*repository.ThrottledError)
+	if !ok {
+		return false
+	}
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	status := http.StatusTooManyRequests
+	if throttled.Locked {
+		status = http.StatusLocked
+	}
+	ctx.JSON(status, gin.H{"error": throttled.Error()})
+	return true
+}
+
 func (auth *AuthController) ResetPassword(ctx *gin.Context) {
 	token := ctx.DefaultQuery("token", "")
 
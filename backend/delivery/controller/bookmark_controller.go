@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type BookmarkController struct {
+	bookmarkUsecase usecases.BookmarkUsecase
+	postUsecase     usecases.PostUseCase
+	jobUsecase      usecases.JobUsecase
+	materialUsecase usecases.MaterialUseCase
+}
+
+func NewBookmarkController(
+	bookmark usecases.BookmarkUsecase,
+	post usecases.PostUseCase,
+	job usecases.JobUsecase,
+	material usecases.MaterialUseCase) *BookmarkController {
+
+	return &BookmarkController{
+		bookmarkUsecase: bookmark,
+		postUsecase:     post,
+		jobUsecase:      job,
+		materialUsecase: material,
+	}
+}
+
+// AddBookmark saves a post, job or material, saving it again moves it to another folder
+func (bc *BookmarkController) AddBookmark(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	var bookmark models.Bookmarks
+	if err := ctx.ShouldBindJSON(&bookmark); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	bookmark.UserID = userID
+	if bookmark.TargetType == constants.BookmarkTypePost && !postVisible(ctx, bc.postUsecase, bookmark.TargetID) {
+		return
+	}
+
+	saved, err := bc.bookmarkUsecase.AddBookmark(ctx, bookmark)
+	if err != nil {
+		ctx.JSON(bookmarkErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"bookmark": saved})
+}
+
+func (bc *BookmarkController) RemoveBookmark(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	targetID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	if err := bc.bookmarkUsecase.RemoveBookmark(ctx, userID, ctx.Param("type"), targetID); err != nil {
+		ctx.JSON(bookmarkErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Bookmark removed"})
+}
+
+// GetBookmarks lists the saved content of the user, filtered by ?type= and ?folder_id=
+func (bc *BookmarkController) GetBookmarks(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number"})
+		return
+	}
+	var folderID *primitive.ObjectID
+	if folder := ctx.Query("folder_id"); folder != "" {
+		id, err := primitive.ObjectIDFromHex(folder)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder ID format"})
+			return
+		}
+		folderID = &id
+	}
+
+	bookmarks, err := bc.bookmarkUsecase.GetBookmarks(ctx, userID, ctx.Query("type"), folderID, page)
+	if err != nil {
+		ctx.JSON(bookmarkErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	next := len(bookmarks) > repository.Pagesize
+
+	views, err := bc.GetBookmarksWithTargets(ctx, userID, bookmarks[:min(len(bookmarks), repository.Pagesize)])
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"bookmarks": views, "page": page, "next": next})
+}
+
+// GetBookmarksWithTargets fetches what the bookmarks point to, one query for each type, a
+// post or job that is blocked since it was saved, or a post the user is no longer in the
+// audience of, is left out
+func (bc *BookmarkController) GetBookmarksWithTargets(ctx context.Context, userID primitive.ObjectID, bookmarks []models.Bookmarks) ([]models.BookmarkView, error) {
+	ids := map[string][]primitive.ObjectID{}
+	for _, bookmark := range bookmarks {
+		ids[bookmark.TargetType] = append(ids[bookmark.TargetType], bookmark.TargetID)
+	}
+
+	posts := map[primitive.ObjectID]*models.Posts{}
+	if len(ids[constants.BookmarkTypePost]) > 0 {
+		list, err := bc.postUsecase.GetPostsWithListOfId(ctx, ids[constants.BookmarkTypePost])
+		if err != nil {
+			return nil, err
+		}
+		visible, err := bc.postUsecase.GetVisiblePostIDs(ctx, userID, ids[constants.BookmarkTypePost])
+		if err != nil {
+			return nil, err
+		}
+		for i := range list {
+			if list[i].IsValidated && visible[list[i].ID] {
+				posts[list[i].ID] = &list[i]
+			}
+		}
+	}
+	jobs := map[primitive.ObjectID]*models.Opportunities{}
+	if len(ids[constants.BookmarkTypeJob]) > 0 {
+		list, err := bc.jobUsecase.GetJobsWithListOfId(ctx, ids[constants.BookmarkTypeJob])
+		if err != nil {
+			return nil, err
+		}
+		for i := range list {
+			if list[i].IsValidated {
+				jobs[list[i].ID] = &list[i]
+			}
+		}
+	}
+	materials := map[primitive.ObjectID]*models.Materials{}
+	if len(ids[constants.BookmarkTypeMaterial]) > 0 {
+		list, err := bc.materialUsecase.GetMaterialsWithListOfId(ctx, ids[constants.BookmarkTypeMaterial])
+		if err != nil {
+			return nil, err
+		}
+		for i := range list {
+			materials[list[i].ID] = &list[i]
+		}
+	}
+
+	views := make([]models.BookmarkView, 0, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		view := models.BookmarkView{
+			ID:         bookmark.ID,
+			TargetType: bookmark.TargetType,
+			TargetID:   bookmark.TargetID,
+			FolderID:   bookmark.FolderID,
+			CreatedAt:  bookmark.CreatedAt,
+		}
+		switch bookmark.TargetType {
+		case constants.BookmarkTypePost:
+			view.Post = posts[bookmark.TargetID]
+		case constants.BookmarkTypeJob:
+			view.Job = jobs[bookmark.TargetID]
+		case constants.BookmarkTypeMaterial:
+			view.Material = materials[bookmark.TargetID]
+		}
+		if view.Post == nil && view.Job == nil && view.Material == nil {
+			continue
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+func (bc *BookmarkController) GetFolders(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	folders, err := bc.bookmarkUsecase.GetFolders(ctx, userID)
+	if err != nil {
+		ctx.JSON(bookmarkErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"folders": folders})
+}
+
+func (bc *BookmarkController) CreateFolder(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	var folder models.BookmarkFolders
+	if err := ctx.ShouldBindJSON(&folder); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	folder.UserID = userID
+
+	folder, err = bc.bookmarkUsecase.CreateFolder(ctx, folder)
+	if err != nil {
+		ctx.JSON(bookmarkErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"folder": folder})
+}
+
+func (bc *BookmarkController) RenameFolder(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	folderID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder ID format"})
+		return
+	}
+	var body struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	folder, err := bc.bookmarkUsecase.RenameFolder(ctx, userID, folderID, body.Name)
+	if err != nil {
+		ctx.JSON(bookmarkErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"folder": folder})
+}
+
+// DeleteFolder removes the folder, what was saved in it stays saved
+func (bc *BookmarkController) DeleteFolder(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	folderID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder ID format"})
+		return
+	}
+
+	if err := bc.bookmarkUsecase.DeleteFolder(ctx, userID, folderID); err != nil {
+		ctx.JSON(bookmarkErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Folder deleted"})
+}
+
+func bookmarkErrorStatus(err error) int {
+	switch err {
+	case repository.ErrInvalidBookmarkType, repository.ErrBookmarkFolderName, repository.ErrTooManyBookmarkFolders:
+		return http.StatusBadRequest
+	case repository.ErrBookmarkTargetNotFound, repository.ErrBookmarkNotFound, repository.ErrBookmarkFolderNotFound:
+		return http.StatusNotFound
+	case repository.ErrBookmarkFolderExists:
+		return http.StatusConflict
+	}
+	fmt.Println("Bookmark error:", err)
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type BotController struct {
+	botUsecase usecases.BotUsecase
+}
+
+func NewBotController(botUsecase usecases.BotUsecase) *BotController {
+	return &BotController{botUsecase: botUsecase}
+}
+
+func (bc *BotController) CreateBot(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bot, err := bc.botUsecase.CreateBot(ctx, userID, body.Name)
+	if err != nil {
+		ctx.JSON(accessTokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"bot": bot})
+}
+
+func (bc *BotController) GetBots(ctx *gin.Context) {
+	pageStr := ctx.Query("page")
+	if pageStr == "" {
+		pageStr = "1"
+	}
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number"})
+		return
+	}
+
+	bots, err := bc.botUsecase.GetBots(ctx, page)
+	if err != nil {
+		ctx.JSON(accessTokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	next := len(bots) > repository.Pagesize
+	bots = bots[:min(len(bots), repository.Pagesize)]
+
+	ctx.JSON(http.StatusOK, gin.H{"bots": bots, "next": next})
+}
+
+// DeleteBot revokes the tokens of the bot right away, the account is purged in the background
+func (bc *BotController) DeleteBot(ctx *gin.Context) {
+	userID, botID, ok := botFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	if err := bc.botUsecase.DeleteBot(ctx, botID, userID); err != nil {
+		ctx.JSON(accessTokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Bot deleted"})
+}
+
+func (bc *BotController) CreateBotToken(ctx *gin.Context) {
+	userID, botID, ok := botFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	var req accessTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, rawToken, err := bc.botUsecase.CreateBotToken(ctx, botID, userID, req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		ctx.JSON(accessTokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"message":      "Copy the token now, it can not be shown again",
+		"token":        rawToken,
+		"access_token": token,
+	})
+}
+
+func (bc *BotController) GetBotTokens(ctx *gin.Context) {
+	_, botID, ok := botFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	tokens, err := bc.botUsecase.GetBotTokens(ctx, botID)
+	if err != nil {
+		ctx.JSON(accessTokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"access_tokens": tokens})
+}
+
+func (bc *BotController) RevokeBotToken(ctx *gin.Context) {
+	userID, botID, ok := botFromContext(ctx)
+	if !ok {
+		return
+	}
+	tokenID, err := primitive.ObjectIDFromHex(ctx.Param("token_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID format"})
+		return
+	}
+
+	if err := bc.botUsecase.RevokeBotToken(ctx, botID, tokenID, userID); err != nil {
+		ctx.JSON(accessTokenErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Access token revoked"})
+}
+
+func botFromContext(ctx *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	botID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bot ID format"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	return userID, botID, true
+}
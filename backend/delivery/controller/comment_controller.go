@@ -32,6 +32,9 @@ func (c *CommentController) GetComments(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID" + err.Error()})
 		return
 	}
+	if !postVisible(ctx, c.postUsecase, postID) {
+		return
+	}
 
 	page := ctx.Query("page")
 	if page == "" {
@@ -88,6 +91,9 @@ func (c *CommentController) AddComment(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Post ID is required"})
 		return
 	}
+	if !postVisible(ctx, c.postUsecase, req.PostID) {
+		return
+	}
 	req.UserID = userID
 	req.ReplyCount = 0
 	req.Like = 0
@@ -209,6 +215,15 @@ func (c *CommentController) GetReplies(ctx *gin.Context) {
 		return
 	}
 
+	comment, err := c.usecase.GetCommentByID(ctx, commentID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+	if !postVisible(ctx, c.postUsecase, comment.PostID) {
+		return
+	}
+
 	replies, err := c.usecase.GetReply(ctx, commentID, pageInt)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -250,6 +265,16 @@ func (c *CommentController) AddReply(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Post ID and Comment ID are required"})
 		return
 	}
+	// the reply goes on the post of its comment, whatever post id came with it
+	parent, err := c.usecase.GetCommentByID(ctx, *req.ParentCommentID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "parent comment not found"})
+		return
+	}
+	if !postVisible(ctx, c.postUsecase, parent.PostID) {
+		return
+	}
+	req.PostID = parent.PostID
 	req.UserID = userID
 	req.ReplyCount = 0 // Replies do not have replies
 	req.Like = 0
@@ -286,6 +311,9 @@ func (c *CommentController) GetCommentsWithUsers(ctx context.Context, comments [
 	userIDSet := make(map[string]struct{})
 	for _, comment := range comments {
 		userIDSet[comment.UserID.Hex()] = struct{}{}
+		for _, mention := range comment.Mentions {
+			userIDSet[mention.UserID.Hex()] = struct{}{}
+		}
 	}
 	userIDs := make([]primitive.ObjectID, 0, len(userIDSet))
 	for id := range userIDSet {
@@ -319,6 +347,7 @@ func (c *CommentController) GetCommentsWithUsers(ctx context.Context, comments [
 			ReplyCount: comment.ReplyCount,
 			Like:       comment.Like,
 			Content:    comment.Content,
+			Mentions:   usecases.NewMentionViews(comment.Mentions, userMap),
 			CreatedAt:  comment.CreatedAt,
 		})
 	}
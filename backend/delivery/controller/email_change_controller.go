@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/chera-mihiretu/IKnow/infrastructure/validation"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EmailChangeController struct {
+	emailChangeUsecase usecases.EmailChangeUsecase
+}
+
+func NewEmailChangeController(emailChangeUsecase usecases.EmailChangeUsecase) *EmailChangeController {
+	return &EmailChangeController{emailChangeUsecase: emailChangeUsecase}
+}
+
+type emailChangeRequest struct {
+	NewEmail string `json:"new_email"`
+	Password string `json:"password"` // not needed for google accounts without a password
+}
+
+func (ec *EmailChangeController) RequestEmailChange(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var req emailChangeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	newEmail, err := validation.NormalizeEmail(req.NewEmail)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, err := ec.emailChangeUsecase.RequestEmailChange(ctx, userID, newEmail, req.Password)
+	if err != nil {
+		ctx.JSON(emailChangeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"message":    "We sent a confirmation link to the new email address",
+		"new_email":  change.NewEmail,
+		"expires_at": change.ExpiresAt,
+	})
+}
+
+// ConfirmEmailChange is the link sent to the new address
+func (ec *EmailChangeController) ConfirmEmailChange(ctx *gin.Context) {
+	token := ctx.DefaultQuery("token", "")
+	front_url, exist := os.LookupEnv("FRONT_BASE_URL")
+	if !exist {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Front Url Token is required"})
+		return
+	}
+
+	if _, err := ec.emailChangeUsecase.ConfirmEmailChange(ctx, token); err != nil {
+		ctx.JSON(emailChangeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, front_url+"/auth/email-changed")
+}
+
+// RevertEmailChange is the link sent to the old address
+func (ec *EmailChangeController) RevertEmailChange(ctx *gin.Context) {
+	token := ctx.DefaultQuery("token", "")
+	front_url, exist := os.LookupEnv("FRONT_BASE_URL")
+	if !exist {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Front Url Token is required"})
+		return
+	}
+
+	if _, err := ec.emailChangeUsecase.RevertEmailChange(ctx, token); err != nil {
+		ctx.JSON(emailChangeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, front_url+"/auth/email-reverted")
+}
+
+func emailChangeErrorStatus(err error) int {
+	switch err {
+	case repository.ErrWrongCredentials:
+		return http.StatusUnauthorized
+	case repository.ErrEmailDomainNotAllowed, repository.ErrEmailUniversityMismatch, repository.ErrGoogleAccountNotLinked:
+		return http.StatusForbidden
+	case repository.ErrEmailTaken:
+		return http.StatusConflict
+	case repository.ErrSameEmail, repository.ErrInvalidEmailChangeToken:
+		return http.StatusBadRequest
+	case repository.ErrUserNotFound:
+		return http.StatusNotFound
+	}
+	fmt.Println("Email change error:", err)
+	return http.StatusInternalServerError
+}
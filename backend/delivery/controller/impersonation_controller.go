@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/chera-mihiretu/IKnow/delivery/helpers"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ImpersonationController struct {
+	impersonationUsecase usecases.ImpersonationUsecase
+}
+
+func NewImpersonationController(impersonationUsecase usecases.ImpersonationUsecase) *ImpersonationController {
+	return &ImpersonationController{impersonationUsecase: impersonationUsecase}
+}
+
+// StartImpersonation returns a token to use the platform as the user, every request made
+// with it is recorded in the audit logs
+func (ic *ImpersonationController) StartImpersonation(ctx *gin.Context) {
+	adminID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var body struct {
+		UserID      string `json:"user_id" binding:"required"`
+		Reason      string `json:"reason" binding:"required"`
+		Minutes     int    `json:"minutes"` // defaults to 30, at most 120
+		AllowWrites bool   `json:"allow_writes"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(body.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	session, err := ic.impersonationUsecase.StartImpersonation(ctx, adminID, userID, body.Reason, body.Minutes, body.AllowWrites, helpers.SessionDevice(ctx))
+	if err != nil {
+		ctx.JSON(impersonationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"impersonation": session})
+}
+
+func (ic *ImpersonationController) GetActiveImpersonations(ctx *gin.Context) {
+	sessions, err := ic.impersonationUsecase.GetActiveImpersonations(ctx)
+	if err != nil {
+		ctx.JSON(impersonationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"impersonations": sessions})
+}
+
+func (ic *ImpersonationController) EndImpersonation(ctx *gin.Context) {
+	adminID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	sessionID, err := primitive.ObjectIDFromHex(ctx.Param("session_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID format"})
+		return
+	}
+
+	if err := ic.impersonationUsecase.EndImpersonation(ctx, adminID, sessionID); err != nil {
+		ctx.JSON(impersonationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Impersonation ended"})
+}
+
+func impersonationErrorStatus(err error) int {
+	switch err {
+	case usecases.ErrImpersonationReason, usecases.ErrImpersonationDuration, usecases.ErrImpersonateSelf:
+		return http.StatusBadRequest
+	case usecases.ErrImpersonateAdmin:
+		return http.StatusForbidden
+	case repository.ErrUserNotFound, repository.ErrImpersonationNotFound:
+		return http.StatusNotFound
+	}
+	fmt.Println("Impersonation error:", err)
+	return http.StatusInternalServerError
+}
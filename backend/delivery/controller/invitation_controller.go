@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/chera-mihiretu/IKnow/delivery/helpers"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/email"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type InvitationController struct {
+	invitationUsecase usecases.InvitationUsecase
+}
+
+func NewInvitationController(invitationUsecase usecases.InvitationUsecase) *InvitationController {
+	return &InvitationController{invitationUsecase: invitationUsecase}
+}
+
+// invitationRequest is where the invited users are placed, the bulk invite takes the same
+// fields as form values next to the CSV file
+type invitationRequest struct {
+	UniversityID  string `json:"university_id" form:"university_id" binding:"required"`
+	SchoolID      string `json:"school_id" form:"school_id"`
+	DepartmentID  string `json:"department_id" form:"department_id"`
+	AcedemicYear  int    `json:"acedemic_year" form:"acedemic_year"`
+	Email         string `json:"email"`
+	MaxUses       int    `json:"max_uses"`
+	ExpiresInDays int    `json:"expires_in_days" form:"expires_in_days"`
+}
+
+func (r invitationRequest) invitation() (models.Invitations, error) {
+	universityID, err := primitive.ObjectIDFromHex(r.UniversityID)
+	if err != nil {
+		return models.Invitations{}, fmt.Errorf("invalid university ID format")
+	}
+	invitation := models.Invitations{
+		UniversityID: universityID,
+		AcedemicYear: r.AcedemicYear,
+		Email:        r.Email,
+		MaxUses:      r.MaxUses,
+	}
+	if r.SchoolID != "" {
+		schoolID, err := primitive.ObjectIDFromHex(r.SchoolID)
+		if err != nil {
+			return models.Invitations{}, fmt.Errorf("invalid school ID format")
+		}
+		invitation.SchoolID = &schoolID
+	}
+	if r.DepartmentID != "" {
+		departmentID, err := primitive.ObjectIDFromHex(r.DepartmentID)
+		if err != nil {
+			return models.Invitations{}, fmt.Errorf("invalid department ID format")
+		}
+		invitation.DepartmentID = &departmentID
+	}
+	return invitation, nil
+}
+
+func (ic *InvitationController) CreateInvitation(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var req invitationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	invitation, err := req.invitation()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation, err = ic.invitationUsecase.CreateInvitation(ctx, userID, invitation, req.ExpiresInDays, helpers.AccessScope(ctx))
+	if err != nil {
+		ctx.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"invitation": invitation, "link": email.InvitationLink(invitation.Code)})
+}
+
+// BulkInvite takes a multipart form with the CSV as "file", one invitation is emailed per address
+func (ic *InvitationController) BulkInvite(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var req invitationRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	template, err := req.invitation()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "A CSV file is required"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Could not read the file"})
+		return
+	}
+	defer file.Close()
+
+	result, err := ic.invitationUsecase.BulkInvite(ctx, userID, template, req.ExpiresInDays, file, helpers.AccessScope(ctx))
+	if err != nil {
+		ctx.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, result)
+}
+
+func (ic *InvitationController) GetInvitations(ctx *gin.Context) {
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number"})
+		return
+	}
+
+	invitations, err := ic.invitationUsecase.GetInvitations(ctx, page, helpers.AccessScope(ctx))
+	if err != nil {
+		ctx.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	next := len(invitations) > repository.Pagesize
+	invitations = invitations[:min(len(invitations), repository.Pagesize)]
+
+	ctx.JSON(http.StatusOK, gin.H{"invitations": invitations, "next": next})
+}
+
+func (ic *InvitationController) RevokeInvitation(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	invitationID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID format"})
+		return
+	}
+
+	if err := ic.invitationUsecase.RevokeInvitation(ctx, userID, invitationID, helpers.AccessScope(ctx)); err != nil {
+		ctx.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
+
+func (ic *InvitationController) GetRedemptions(ctx *gin.Context) {
+	invitationID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID format"})
+		return
+	}
+
+	redemptions, err := ic.invitationUsecase.GetRedemptions(ctx, invitationID, helpers.AccessScope(ctx))
+	if err != nil {
+		ctx.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"redemptions": redemptions})
+}
+
+// PreviewInvitation lets the sign up page show where the code places the user
+func (ic *InvitationController) PreviewInvitation(ctx *gin.Context) {
+	preview, err := ic.invitationUsecase.PreviewInvitation(ctx, ctx.Param("code"))
+	if err != nil {
+		ctx.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"invitation": preview})
+}
+
+func (ic *InvitationController) RedeemInvitation(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var body struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation, err := ic.invitationUsecase.RedeemInvitation(ctx, userID, body.Code)
+	if err != nil {
+		ctx.JSON(invitationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":       "Invitation accepted",
+		"university_id": invitation.UniversityID,
+		"school_id":     invitation.SchoolID,
+		"department_id": invitation.DepartmentID,
+		"acedemic_year": invitation.AcedemicYear,
+	})
+}
+
+func invitationErrorStatus(err error) int {
+	switch err {
+	case repository.ErrInvitationUses, repository.ErrInvitationExpiry, repository.ErrInvitationYear,
+		repository.ErrInvitationBinding, repository.ErrInvitationCSV, repository.ErrInvitationAddress:
+		return http.StatusBadRequest
+	case repository.ErrInvitationOutOfScope, repository.ErrInvitationEmail, repository.ErrInvitationUniversity:
+		return http.StatusForbidden
+	case repository.ErrInvitationNotFound, repository.ErrInvalidInvitation, repository.ErrUserNotFound:
+		return http.StatusNotFound
+	}
+	fmt.Println("Invitation error:", err)
+	return http.StatusInternalServerError
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/chera-mihiretu/IKnow/domain/constants"
 	"github.com/chera-mihiretu/IKnow/domain/models"
 	"github.com/chera-mihiretu/IKnow/usecases"
 	"github.com/gin-gonic/gin"
@@ -12,13 +13,14 @@ import (
 )
 
 type JobController struct {
-	usecase        usecases.JobUsecase
-	userUsecase    usecases.UserUseCase
-	jobLikeUsecase usecases.JobLikeUsecase
+	usecase         usecases.JobUsecase
+	userUsecase     usecases.UserUseCase
+	jobLikeUsecase  usecases.JobLikeUsecase
+	bookmarkUsecase usecases.BookmarkUsecase
 }
 
-func NewJobController(usecase usecases.JobUsecase, users usecases.UserUseCase, jobLike usecases.JobLikeUsecase) *JobController {
-	return &JobController{usecase: usecase, userUsecase: users, jobLikeUsecase: jobLike}
+func NewJobController(usecase usecases.JobUsecase, users usecases.UserUseCase, jobLike usecases.JobLikeUsecase, bookmark usecases.BookmarkUsecase) *JobController {
+	return &JobController{usecase: usecase, userUsecase: users, jobLikeUsecase: jobLike, bookmarkUsecase: bookmark}
 }
 
 func (c *JobController) CreateJob(ctx *gin.Context) {
@@ -212,6 +214,17 @@ func (c *JobController) AppendUserInfoToJobs(ctx *gin.Context, jobs []models.Opp
 	if err != nil {
 		return nil, err
 	}
+	saved := map[primitive.ObjectID]bool{}
+	if viewerID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id")); err == nil {
+		jobIDs := make([]primitive.ObjectID, 0, len(jobs))
+		for _, job := range jobs {
+			jobIDs = append(jobIDs, job.ID)
+		}
+		saved, err = c.bookmarkUsecase.CheckListOfBookmarks(ctx, viewerID, constants.BookmarkTypeJob, jobIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
 	for _, job := range jobs {
 		userView, ok := userMap[job.PostedBy.Hex()]
 		if !ok {
@@ -232,6 +245,7 @@ func (c *JobController) AppendUserInfoToJobs(ctx *gin.Context, jobs []models.Opp
 			Description:   job.Description,
 			Link:          job.Link,
 			Liked:         liked,
+			Saved:         saved[job.ID],
 			Type:          job.Type,
 			PostedBy:      userView,
 			CreatedAt:     job.CreatedAt,
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/chera-mihiretu/IKnow/delivery/helpers"
 	"github.com/chera-mihiretu/IKnow/domain/models"
 	"github.com/chera-mihiretu/IKnow/usecases"
 	"github.com/gin-gonic/gin"
@@ -133,6 +134,10 @@ func (mc *MaterialController) CreateMaterial(ctx *gin.Context) {
 		return
 	}
 	material.DepartmentID = depId
+	if !helpers.AccessScope(ctx).AllowsDepartment(depId) {
+		ctx.JSON(403, gin.H{"error": "Forbidden: department is outside of your scope"})
+		return
+	}
 
 	title := form.Value["title"]
 	if len(title) == 0 {
@@ -245,6 +250,10 @@ func (mc *MaterialController) UpdateMaterial(ctx *gin.Context) {
 		return
 	}
 	material.ID = materialIDPrimitive
+	if !material.DepartmentID.IsZero() && !helpers.AccessScope(ctx).AllowsDepartment(material.DepartmentID) {
+		ctx.JSON(403, gin.H{"error": "Forbidden: department is outside of your scope"})
+		return
+	}
 	userID, exist := ctx.Get("user_id")
 	if !exist {
 		ctx.JSON(400, gin.H{"error": "User ID not found in context"})
@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/chera-mihiretu/IKnow/delivery/helpers"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MFAController struct {
+	mfaUsecase usecases.MFAUsecase
+}
+
+func NewMFAController(mfaUsecase usecases.MFAUsecase) *MFAController {
+	return &MFAController{mfaUsecase: mfaUsecase}
+}
+
+type mfaRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// VerifyChallenge is the second step of the login for users with two factor enabled
+func (mc *MFAController) VerifyChallenge(ctx *gin.Context) {
+	var req mfaRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "mfa_token and a code or recovery_code are required"})
+		return
+	}
+
+	tokens, err := mc.mfaUsecase.VerifyChallenge(ctx, req.MFAToken, req.Code, req.RecoveryCode, helpers.SessionDevice(ctx))
+	if err != nil {
+		ctx.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
+	})
+}
+
+// BeginChallengeEnrollment starts the mandatory enrollment of admins in the middle of a login
+func (mc *MFAController) BeginChallengeEnrollment(ctx *gin.Context) {
+	var req mfaRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.MFAToken == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "mfa_token is required"})
+		return
+	}
+
+	enrollment, err := mc.mfaUsecase.BeginChallengeEnrollment(ctx, req.MFAToken)
+	if err != nil {
+		ctx.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"enrollment": enrollment})
+}
+
+func (mc *MFAController) ConfirmChallengeEnrollment(ctx *gin.Context) {
+	var req mfaRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "mfa_token and code are required"})
+		return
+	}
+
+	codes, tokens, err := mc.mfaUsecase.ConfirmChallengeEnrollment(ctx, req.MFAToken, req.Code, helpers.SessionDevice(ctx))
+	if err != nil {
+		ctx.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+		"token":          tokens.AccessToken,
+		"refresh_token":  tokens.RefreshToken,
+		"expires_at":     tokens.ExpiresAt,
+	})
+}
+
+func (mc *MFAController) BeginEnrollment(ctx *gin.Context) {
+	userID, ok := mfaUserFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	enrollment, err := mc.mfaUsecase.BeginEnrollment(ctx, userID)
+	if err != nil {
+		ctx.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"enrollment": enrollment})
+}
+
+func (mc *MFAController) ConfirmEnrollment(ctx *gin.Context) {
+	userID, ok := mfaUserFromContext(ctx)
+	if !ok {
+		return
+	}
+	var req mfaRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	codes, err := mc.mfaUsecase.ConfirmEnrollment(ctx, userID, req.Code)
+	if err != nil {
+		ctx.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":        "Two factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+func (mc *MFAController) DisableTwoFactor(ctx *gin.Context) {
+	userID, ok := mfaUserFromContext(ctx)
+	if !ok {
+		return
+	}
+	var req mfaRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	if err := mc.mfaUsecase.DisableTwoFactor(ctx, userID, req.Code); err != nil {
+		ctx.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Two factor authentication disabled"})
+}
+
+func (mc *MFAController) RegenerateRecoveryCodes(ctx *gin.Context) {
+	userID, ok := mfaUserFromContext(ctx)
+	if !ok {
+		return
+	}
+	var req mfaRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	codes, err := mc.mfaUsecase.RegenerateRecoveryCodes(ctx, userID, req.Code)
+	if err != nil {
+		ctx.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func mfaUserFromContext(ctx *gin.Context) (primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return primitive.NilObjectID, false
+	}
+	return userID, true
+}
+
+func mfaErrorStatus(err error) int {
+	switch err {
+	case repository.ErrInvalidMFAChallenge, repository.ErrInvalidMFACode:
+		return http.StatusUnauthorized
+	case repository.ErrMFAEnrollmentRequired, repository.ErrMFAMandatory:
+		return http.StatusForbidden
+	case repository.ErrMFANotEnabled, repository.ErrMFAAlreadyEnabled, repository.ErrMFANoPendingSetup:
+		return http.StatusBadRequest
+	}
+	fmt.Println("Two factor error:", err)
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PollController struct {
+	pollUsecase usecases.PollUsecase
+	userUseCase usecases.UserUseCase
+	postUseCase usecases.PostUseCase
+}
+
+func NewPollController(pollUsecase usecases.PollUsecase, userUseCase usecases.UserUseCase, postUseCase usecases.PostUseCase) *PollController {
+	return &PollController{pollUsecase: pollUsecase, userUseCase: userUseCase, postUseCase: postUseCase}
+}
+
+// Vote takes the indexes of the chosen options, a user votes once on a poll
+func (pc *PollController) Vote(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	postID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Post ID format"})
+		return
+	}
+	if !postVisible(ctx, pc.postUseCase, postID) {
+		return
+	}
+
+	var body struct {
+		Options []int `json:"options" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	poll, err := pc.pollUsecase.Vote(ctx, postID, userID, body.Options)
+	if err != nil {
+		ctx.JSON(pollErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"poll": poll})
+}
+
+// GetPollVoters lists who chose each option, only for polls that are not anonymous
+func (pc *PollController) GetPollVoters(ctx *gin.Context) {
+	postID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Post ID format"})
+		return
+	}
+	if !postVisible(ctx, pc.postUseCase, postID) {
+		return
+	}
+
+	votes, err := pc.pollUsecase.GetPollVotes(ctx, postID)
+	if err != nil {
+		ctx.JSON(pollErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	userIDs := make([]primitive.ObjectID, 0, len(votes))
+	for _, vote := range votes {
+		userIDs = append(userIDs, vote.UserID)
+	}
+	users, err := pc.userUseCase.GetListOfUsers(ctx, userIDs)
+	if err != nil {
+		fmt.Println("Error: Failed to get poll voters:", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get poll voters " + err.Error()})
+		return
+	}
+	userMap := make(map[primitive.ObjectID]models.UserView, len(users))
+	for _, user := range users {
+		userMap[user.ID] = user
+	}
+
+	byOption := map[int][]models.UserView{}
+	options := []int{}
+	for _, vote := range votes {
+		user, ok := userMap[vote.UserID]
+		if !ok {
+			continue
+		}
+		for _, option := range vote.Options {
+			if _, ok := byOption[option]; !ok {
+				options = append(options, option)
+			}
+			byOption[option] = append(byOption[option], user)
+		}
+	}
+	voters := make([]models.PollVoters, 0, len(options))
+	for _, option := range options {
+		voters = append(voters, models.PollVoters{Option: option, Users: byOption[option]})
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"voters": voters})
+}
+
+func pollErrorStatus(err error) int {
+	switch err {
+	case repository.ErrInvalidPollVote:
+		return http.StatusBadRequest
+	case repository.ErrPollAnonymous:
+		return http.StatusForbidden
+	case repository.ErrPollNotFound:
+		return http.StatusNotFound
+	case repository.ErrAlreadyVoted, repository.ErrPollClosed:
+		return http.StatusConflict
+	}
+	fmt.Println("Poll error:", err)
+	return http.StatusInternalServerError
+}
@@ -2,18 +2,21 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/chera-mihiretu/IKnow/delivery/helpers"
 	"github.com/chera-mihiretu/IKnow/domain/constants"
 	"github.com/chera-mihiretu/IKnow/domain/models"
 	"github.com/chera-mihiretu/IKnow/repository"
 	"github.com/chera-mihiretu/IKnow/usecases"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type PostController struct {
@@ -23,6 +26,9 @@ type PostController struct {
 	storage             usecases.StorageUseCase
 	PostlikeUseCase     usecases.PostLikeUsecase
 	notificationUsecase usecases.NotificationUsecase
+	pollUsecase         usecases.PollUsecase
+	bookmarkUsecase     usecases.BookmarkUsecase
+	repostUsecase       usecases.RepostUsecase
 }
 
 func NewPostController(
@@ -31,7 +37,10 @@ func NewPostController(
 	department usecases.DepartmentUseCase,
 	storage usecases.StorageUseCase,
 	liked usecases.PostLikeUsecase,
-	notification usecases.NotificationUsecase) *PostController {
+	notification usecases.NotificationUsecase,
+	poll usecases.PollUsecase,
+	bookmark usecases.BookmarkUsecase,
+	repost usecases.RepostUsecase) *PostController {
 
 	return &PostController{
 		postUseCase:         post,
@@ -40,6 +49,9 @@ func NewPostController(
 		storage:             storage,
 		PostlikeUseCase:     liked,
 		notificationUsecase: notification,
+		pollUsecase:         poll,
+		bookmarkUsecase:     bookmark,
+		repostUsecase:       repost,
 	}
 }
 
@@ -78,7 +90,7 @@ func (p *PostController) SearchPosts(ctx *gin.Context) {
 		return
 	}
 
-	posts, err := p.postUseCase.SearchPosts(ctx, query, page)
+	posts, err := p.postUseCase.SearchPosts(ctx, query, userIDPrimitive, page)
 	if err != nil {
 		fmt.Println("Error searching posts:", err)
 		ctx.JSON(500, gin.H{"error": "Failed to search posts: " + err.Error()})
@@ -197,6 +209,15 @@ func (p *PostController) GetPostByID(ctx *gin.Context) {
 		return
 	}
 
+	// drafts and scheduled posts are only seen by their author
+	if (post.Status == constants.PostStatusDraft || post.Status == constants.PostStatusScheduled) && post.UserID.Hex() != ctx.GetString("user_id") {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	if !postVisible(ctx, p.postUseCase, post.ID) {
+		return
+	}
+
 	postView, err := p.GetPostWithUsers(ctx, []models.Posts{post})
 
 	if err != nil {
@@ -263,7 +284,17 @@ func (p *PostController) CreatePost(ctx *gin.Context) {
 		return
 	}
 
-	if post.Content == "" {
+	// a poll comes as a json form field next to the content
+	if pollJSON := ctx.PostForm("poll"); pollJSON != "" {
+		var poll models.Polls
+		if err := json.Unmarshal([]byte(pollJSON), &poll); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll", "details": err.Error()})
+			return
+		}
+		post.Poll = &poll
+	}
+
+	if post.Content == "" && post.Poll == nil {
 		fmt.Println("Content is required")
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"error": "Content is required",
@@ -298,6 +329,12 @@ func (p *PostController) CreatePost(ctx *gin.Context) {
 
 	uploadedPost, err := p.postUseCase.CreatePost(ctx, post)
 
+	if err == repository.ErrPublishAtPast || err == repository.ErrInvalidPoll || err == repository.ErrPollClosingTime ||
+		err == repository.ErrInvalidAudience || err == repository.ErrAudienceUnavailable || err == repository.ErrAudienceDepartments {
+		p.storage.DeleteFile(urls)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		p.storage.DeleteFile(urls) // Clean up uploaded files if creation fails
 		fmt.Println("Failed to create post:", err)
@@ -308,7 +345,7 @@ func (p *PostController) CreatePost(ctx *gin.Context) {
 		return
 	}
 
-	if !uploadedPost.IsValidated {
+	if uploadedPost.Status == constants.PostStatusPublished && !uploadedPost.IsValidated {
 		notification := &models.Notifications{
 			ID:        primitive.NewObjectID(),
 			UserID:    obId,
@@ -346,6 +383,10 @@ func (p *PostController) VerifyPost(ctx *gin.Context) {
 		return
 	}
 
+	if !p.postInScope(ctx, postID) {
+		return
+	}
+
 	postUserID, err := p.postUseCase.VerifyPosts(ctx, postIDPrimitive)
 	if err != nil {
 		fmt.Println("Error: Failed to verify post:", err)
@@ -386,6 +427,10 @@ func (p *PostController) RemoveUnverifiedPost(ctx *gin.Context) {
 		return
 	}
 
+	if !p.postInScope(ctx, postID) {
+		return
+	}
+
 	postUserID, err := p.postUseCase.RemoveUnverifiedPost(ctx, postIDPrimitive)
 
 	if err != nil {
@@ -469,15 +514,45 @@ func (p *PostController) UpdatePost(ctx *gin.Context) {
 		return
 	}
 
+	if post.Content == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Content is required"})
+		return
+	}
+
 	post.UserID = userIDPrimitive
-	post, err = p.postUseCase.UpdatePost(ctx, post)
+	post, remoderated, err := p.postUseCase.UpdatePost(ctx, post)
 
+	if err == mongo.ErrNoDocuments {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	if err == repository.ErrPostEditConflict || err == repository.ErrRepostNotEditable {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		fmt.Println("Error: Failed to update post:", err)
 		ctx.JSON(500, gin.H{"error": "Failed to get post " + err.Error()})
 		return
 	}
 
+	// an edit that left the content as it was is not moderated again
+	if remoderated && !post.IsValidated {
+		notification := &models.Notifications{
+			ID:        primitive.NewObjectID(),
+			UserID:    userIDPrimitive,
+			To:        post.UserID,
+			Type:      string(constants.PostBlocked),
+			Content:   constants.PostBlockedMessage,
+			ContentID: &post.ID,
+			IsRead:    false,
+			CreatedAt: time.Now(),
+		}
+		go func() {
+			p.notificationUsecase.SendNotification(context.Background(), notification)
+		}()
+	}
+
 	postView, err := p.GetPostWithUsers(ctx, []models.Posts{post})
 
 	if err != nil {
@@ -490,6 +565,209 @@ func (p *PostController) UpdatePost(ctx *gin.Context) {
 
 }
 
+func (p *PostController) GetPostsByTag(ctx *gin.Context) {
+	tag := repository.NormalizeTags([]string{ctx.Param("tag")})
+	if len(tag) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag"})
+		return
+	}
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number"})
+		return
+	}
+
+	viewerID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	posts, err := p.postUseCase.GetPostsByTag(ctx, tag[0], viewerID, page)
+	if err != nil {
+		fmt.Println("Error: Failed to get posts by tag:", err)
+		ctx.JSON(500, gin.H{"error": "Failed to get posts " + err.Error()})
+		return
+	}
+
+	nextPage := len(posts) > repository.Pagesize
+
+	postViews, err := p.GetPostWithUsers(ctx, posts[:min(len(posts), repository.Pagesize)])
+	if err != nil {
+		fmt.Println("Error: Failed to get posts (user view):", err)
+		ctx.JSON(500, gin.H{"error": "Failed to get posts " + err.Error()})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"tag":   tag[0],
+		"posts": postViews,
+		"page":  page,
+		"next":  nextPage,
+	})
+}
+
+func (p *PostController) GetDrafts(ctx *gin.Context) {
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number"})
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	posts, err := p.postUseCase.GetDrafts(ctx, userID, page)
+	if err != nil {
+		fmt.Println("Error: Failed to get drafts:", err)
+		ctx.JSON(500, gin.H{"error": "Failed to get drafts " + err.Error()})
+		return
+	}
+
+	nextPage := len(posts) > repository.Pagesize
+
+	postViews, err := p.GetPostWithUsers(ctx, posts[:min(len(posts), repository.Pagesize)])
+	if err != nil {
+		fmt.Println("Error: Failed to get drafts (user view):", err)
+		ctx.JSON(500, gin.H{"error": "Failed to get drafts " + err.Error()})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"posts": postViews,
+		"page":  page,
+		"next":  nextPage,
+	})
+}
+
+// SchedulePost schedules a draft, or moves a scheduled post to another time
+func (p *PostController) SchedulePost(ctx *gin.Context) {
+	userID, postID, ok := p.draftIDs(ctx)
+	if !ok {
+		return
+	}
+	var body struct {
+		PublishAt time.Time `json:"publish_at" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	post, err := p.postUseCase.SchedulePost(ctx, userID, postID, body.PublishAt)
+	if err != nil {
+		ctx.JSON(draftErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, gin.H{"message": "Post scheduled", "post": post})
+}
+
+// CancelSchedule keeps the scheduled post as a draft
+func (p *PostController) CancelSchedule(ctx *gin.Context) {
+	userID, postID, ok := p.draftIDs(ctx)
+	if !ok {
+		return
+	}
+
+	post, err := p.postUseCase.CancelSchedule(ctx, userID, postID)
+	if err != nil {
+		ctx.JSON(draftErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, gin.H{"message": "Schedule cancelled", "post": post})
+}
+
+// PublishPost publishes a draft or a scheduled post now
+func (p *PostController) PublishPost(ctx *gin.Context) {
+	userID, postID, ok := p.draftIDs(ctx)
+	if !ok {
+		return
+	}
+
+	post, err := p.postUseCase.PublishPost(ctx, userID, postID)
+	if err != nil {
+		ctx.JSON(draftErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(200, gin.H{"message": "Post published", "post": post})
+}
+
+func (p *PostController) draftIDs(ctx *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	postID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Post ID format"})
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+	return userID, postID, true
+}
+
+func draftErrorStatus(err error) int {
+	switch err {
+	case repository.ErrPublishAtPast:
+		return http.StatusBadRequest
+	case repository.ErrPostNotDraft, repository.ErrPostNotScheduled, repository.ErrPostEditConflict:
+		return http.StatusConflict
+	case mongo.ErrNoDocuments:
+		return http.StatusNotFound
+	}
+	fmt.Println("Draft error:", err)
+	return http.StatusInternalServerError
+}
+
+// GetPostRevisions lists what the post said before each edit, the latest edit first. Content
+// the moderation blocked is only shown to the author and to moderators of the post
+func (p *PostController) GetPostRevisions(ctx *gin.Context) {
+	postID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Post ID format"})
+		return
+	}
+
+	post, err := p.postUseCase.GetPostByID(ctx, postID.Hex())
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			return
+		}
+		fmt.Println("Error: Failed to get post:", err)
+		ctx.JSON(500, gin.H{"error": "Failed to get post " + err.Error()})
+		return
+	}
+	if !postVisible(ctx, p.postUseCase, postID) {
+		return
+	}
+
+	revisions, err := p.postUseCase.GetPostRevisions(ctx, postID)
+	if err != nil {
+		fmt.Println("Error: Failed to get post revisions:", err)
+		ctx.JSON(500, gin.H{"error": "Failed to get post revisions " + err.Error()})
+		return
+	}
+
+	moderator := helpers.AccessScope(ctx).AllowsAnyDepartment(post.Departements)
+	if post.UserID.Hex() != ctx.GetString("user_id") && !moderator {
+		validated := make([]models.PostRevisions, 0, len(revisions))
+		for _, revision := range revisions {
+			if revision.IsValidated {
+				validated = append(validated, revision)
+			}
+		}
+		revisions = validated
+	}
+
+	ctx.JSON(200, gin.H{"revisions": revisions})
+}
+
 func (p *PostController) DeletePost(ctx *gin.Context) {
 
 	postID := ctx.Query("id")
@@ -547,7 +825,14 @@ func (p *PostController) GetMyPosts(ctx *gin.Context) {
 		return
 	}
 
-	posts, err := p.postUseCase.GetPostsByUserID(ctx, userIDStr, page)
+	userIDPrimitive, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		ctx.JSON(400, gin.H{"error": "Invalid User ID format"})
+		return
+	}
+
+	// the author sees all of their posts, whatever their audience
+	posts, err := p.postUseCase.GetPostsByUserID(ctx, userIDStr, userIDPrimitive, page)
 	if err != nil {
 		fmt.Println("Error: Failed to get posts:", err)
 		ctx.JSON(500, gin.H{"error": "Failed to get posts" + err.Error()})
@@ -581,7 +866,13 @@ func (p *PostController) GetPostsByUserID(ctx *gin.Context) {
 		return
 	}
 
-	posts, err := p.postUseCase.GetPostsByUserID(ctx, userID, page)
+	viewerID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	posts, err := p.postUseCase.GetPostsByUserID(ctx, userID, viewerID, page)
 	if err != nil {
 		fmt.Println("Error: Failed to get posts:", err)
 		ctx.JSON(500, gin.H{"error": "Failed to get posts " + err.Error()})
@@ -614,7 +905,7 @@ func (p *PostController) GetUnverifiedPosts(ctx *gin.Context) {
 		return
 	}
 
-	posts, err := p.postUseCase.GetUnverifiedPosts(ctx, page)
+	posts, err := p.postUseCase.GetUnverifiedPosts(ctx, page, helpers.AccessScope(ctx))
 	if err != nil {
 		fmt.Println("Error: Failed to get unverified posts:", err)
 		ctx.JSON(500, gin.H{"error": "Failed to get unverified posts " + err.Error()})
@@ -636,14 +927,145 @@ func (p *PostController) GetUnverifiedPosts(ctx *gin.Context) {
 	})
 }
 
+// postInScope makes sure a scoped moderator only acts on posts of their departments,
+// it writes the error response itself
+func (p *PostController) postInScope(ctx *gin.Context, postID string) bool {
+	scope := helpers.AccessScope(ctx)
+	if scope.Global {
+		return true
+	}
+	post, err := p.postUseCase.GetPostByID(ctx, postID)
+	if err != nil {
+		fmt.Println("Error: Failed to get post:", err)
+		ctx.JSON(404, gin.H{"error": "Post not found"})
+		return false
+	}
+	if !scope.AllowsAnyDepartment(post.Departements) {
+		ctx.JSON(403, gin.H{"error": "Forbidden: post is outside of your scope"})
+		return false
+	}
+	return true
+}
+
+// Repost reposts the post, the optional content makes it a quote
+func (p *PostController) Repost(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	postID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Post ID format"})
+		return
+	}
+	var body struct {
+		Content string `json:"content"`
+	}
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	repost, err := p.repostUsecase.Repost(ctx, userID, postID, body.Content)
+	if err != nil {
+		ctx.JSON(repostErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	postView, err := p.GetPostWithUsers(ctx, []models.Posts{repost})
+	if err != nil {
+		fmt.Println("Error: Failed to get repost (user view):", err)
+		ctx.JSON(500, gin.H{"error": "Failed to get post " + err.Error()})
+		return
+	}
+	if len(postView) == 0 {
+		// the reposted post was deleted in the meantime
+		ctx.JSON(http.StatusCreated, gin.H{"message": "Post reposted", "post": repost})
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"message": "Post reposted", "post": postView[0]})
+}
+
+// Unrepost takes back a repost without content, a quote is deleted like a post
+func (p *PostController) Unrepost(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	postID, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Post ID format"})
+		return
+	}
+
+	if err := p.repostUsecase.Unrepost(ctx, userID, postID); err != nil {
+		ctx.JSON(repostErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Repost removed"})
+}
+
+func repostErrorStatus(err error) int {
+	switch err {
+	case repository.ErrRepostNotFound, repository.ErrNotReposted:
+		return http.StatusNotFound
+	case repository.ErrAlreadyReposted:
+		return http.StatusConflict
+	}
+	fmt.Println("Repost error:", err)
+	return http.StatusInternalServerError
+}
+
+// GetPostWithUsers builds the views of the posts, a repost carries the view of the post it
+// reposts and a plain repost of a post that is gone is left out
 func (p *PostController) GetPostWithUsers(ctx *gin.Context, posts []models.Posts) ([]models.PostView, error) {
+	return p.postViews(ctx, posts, true)
+}
+
+func (p *PostController) postViews(ctx *gin.Context, posts []models.Posts, embed bool) ([]models.PostView, error) {
 	if len(posts) == 0 {
 		return []models.PostView{}, nil
 	}
+	// a quote of a quote shows the quoted post without what it quotes
+	originals := map[primitive.ObjectID]models.PostView{}
+	if embed {
+		originalIDs := make([]primitive.ObjectID, 0)
+		for _, post := range posts {
+			if post.RepostOf != nil {
+				originalIDs = append(originalIDs, *post.RepostOf)
+			}
+		}
+		if len(originalIDs) > 0 {
+			list, err := p.postUseCase.GetPostsWithListOfId(ctx, originalIDs)
+			if err != nil {
+				return nil, err
+			}
+			visible := make([]models.Posts, 0, len(list))
+			for _, post := range list {
+				if post.IsValidated && post.Status != constants.PostStatusDraft && post.Status != constants.PostStatusScheduled {
+					visible = append(visible, post)
+				}
+			}
+			views, err := p.postViews(ctx, visible, false)
+			if err != nil {
+				return nil, err
+			}
+			for _, view := range views {
+				originals[view.ID] = view
+			}
+		}
+	}
 	// Collect user IDs
 	userIDSet := make(map[string]struct{})
 	for _, post := range posts {
 		userIDSet[post.UserID.Hex()] = struct{}{}
+		for _, mention := range post.Mentions {
+			userIDSet[mention.UserID.Hex()] = struct{}{}
+		}
 	}
 	userIDs := make([]primitive.ObjectID, 0, len(userIDSet))
 	for id := range userIDSet {
@@ -669,6 +1091,40 @@ func (p *PostController) GetPostWithUsers(ctx *gin.Context, posts []models.Posts
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check likes " + err.Error()})
 		return nil, err
 	}
+
+	// the options the viewer chose on the polls among the posts
+	pollIDs := make([]primitive.ObjectID, 0)
+	for _, post := range posts {
+		if post.Poll != nil {
+			pollIDs = append(pollIDs, post.ID)
+		}
+	}
+	voted := map[primitive.ObjectID][]int{}
+	if viewerID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id")); err == nil && len(pollIDs) > 0 {
+		voted, err = p.pollUsecase.GetVotes(ctx, viewerID, pollIDs)
+		if err != nil {
+			fmt.Println("Error checking poll votes:", err)
+			return nil, err
+		}
+	}
+	saved := map[primitive.ObjectID]bool{}
+	reposted := map[primitive.ObjectID]bool{}
+	if viewerID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id")); err == nil {
+		postIDs := make([]primitive.ObjectID, 0, len(posts))
+		for _, post := range posts {
+			postIDs = append(postIDs, post.ID)
+		}
+		saved, err = p.bookmarkUsecase.CheckListOfBookmarks(ctx, viewerID, constants.BookmarkTypePost, postIDs)
+		if err != nil {
+			fmt.Println("Error checking bookmarks:", err)
+			return nil, err
+		}
+		reposted, err = p.repostUsecase.GetReposted(ctx, viewerID, postIDs)
+		if err != nil {
+			fmt.Println("Error checking reposts:", err)
+			return nil, err
+		}
+	}
 	// Pair posts with user info
 	postViews := make([]models.PostView, 0, len(posts))
 	for _, post := range posts {
@@ -677,6 +1133,14 @@ func (p *PostController) GetPostWithUsers(ctx *gin.Context, posts []models.Posts
 		if !ok {
 			continue // or handle missing user
 		}
+		var repostOf *models.PostView
+		if post.RepostOf != nil {
+			if original, ok := originals[*post.RepostOf]; ok {
+				repostOf = &original
+			} else if embed && post.IsPlainRepost() {
+				continue
+			}
+		}
 		thisLiked := false
 
 		for _, like := range likes {
@@ -695,7 +1159,19 @@ func (p *PostController) GetPostWithUsers(ctx *gin.Context, posts []models.Posts
 			IsFlagged:       post.IsFlagged,
 			Likes:           post.Likes,
 			Liked:           thisLiked,
+			Saved:           saved[post.ID],
 			Comments:        post.Comments,
+			Tags:            post.Tags,
+			Edited:          post.EditedAt != nil,
+			Status:          post.Status,
+			PublishAt:       post.PublishAt,
+			EditedAt:        post.EditedAt,
+			Poll:            usecases.NewPollView(post.Poll, voted[post.ID]),
+			Mentions:        usecases.NewMentionViews(post.Mentions, userMap),
+			Audience:        audienceOf(post),
+			Reposts:         post.Reposts,
+			Reposted:        reposted[post.ID],
+			RepostOf:        repostOf,
 			CreatedAt:       post.CreatedAt,
 		})
 
@@ -703,6 +1179,36 @@ func (p *PostController) GetPostWithUsers(ctx *gin.Context, posts []models.Posts
 	return postViews, nil
 }
 
+// audienceOf is the audience of the post, the posts from before audiences are public
+func audienceOf(post models.Posts) string {
+	if post.Audience == "" {
+		return constants.PostAudiencePublic
+	}
+	return post.Audience
+}
+
+// postVisible makes sure the post is published and for the viewer before they see it or
+// interact with it, it writes the error response itself
+func postVisible(ctx *gin.Context, posts usecases.PostUseCase, postID primitive.ObjectID) bool {
+	viewerID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return false
+	}
+	visible, err := posts.CanView(ctx, viewerID, postID)
+	if err != nil {
+		fmt.Println("Error: Failed to check the audience of the post:", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get post " + err.Error()})
+		return false
+	}
+	if !visible {
+		// the post is not for the viewer, as far as they know it does not exist
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return false
+	}
+	return true
+}
+
 func (p *PostController) GetPostAndUserPairList(post []models.Posts) [][]primitive.ObjectID {
 	var listOfLikes [][]primitive.ObjectID
 	for _, post := range post {
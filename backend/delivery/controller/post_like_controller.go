@@ -46,6 +46,9 @@ func (c *PostLikeController) AddLike(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !postVisible(ctx, c.postUsecase, postID) {
+		return
+	}
 	err = c.usecase.AddLike(ctx, postID, userID)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
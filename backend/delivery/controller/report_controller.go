@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/chera-mihiretu/IKnow/delivery/helpers"
 	"github.com/chera-mihiretu/IKnow/domain/constants"
 	"github.com/chera-mihiretu/IKnow/domain/models"
 	"github.com/chera-mihiretu/IKnow/repository"
@@ -219,6 +220,10 @@ func (p *ReportController) TakeActionOnReport(ctx *gin.Context) {
 		return
 	}
 
+	if !p.reportInScope(ctx, action.ReportID) {
+		return
+	}
+
 	log.Println("Action is sent to the usecase")
 
 	actionTaken, err := p.reportUsecase.TakeActionOnReport(ctx, action.ReportID, action)
@@ -259,6 +264,47 @@ func (p *ReportController) TakeActionOnReport(ctx *gin.Context) {
 
 }
 
+// reportInScope makes sure a scoped moderator only acts on reports of posts and jobs of
+// their departments, it writes the error response itself
+func (p *ReportController) reportInScope(ctx *gin.Context, reportID primitive.ObjectID) bool {
+	scope := helpers.AccessScope(ctx)
+	if scope.Global {
+		return true
+	}
+	report, err := p.reportUsecase.GetReportByID(ctx, reportID)
+	if err != nil {
+		if err == repository.ErrReportNotFound {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+			return false
+		}
+		fmt.Println("Error fetching report:", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report"})
+		return false
+	}
+
+	allowed := false
+	switch report.Type {
+	case constants.ReportTypePost:
+		post, err := p.postUsecase.GetPostByID(ctx, report.ReportedPostID.Hex())
+		allowed = err == nil && scope.AllowsAnyDepartment(post.Departements)
+	case constants.ReportTypeJob:
+		job, err := p.jobUseCase.GetJobByID(ctx, report.ReportedPostID)
+		if err == nil {
+			for _, departmentID := range job.DepartmentIDs {
+				if scope.AllowsDepartment(departmentID) {
+					allowed = true
+					break
+				}
+			}
+		}
+	}
+	if !allowed {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: the reported content is outside of your scope"})
+		return false
+	}
+	return true
+}
+
 func (p *ReportController) GetReportedJobs(ctx *gin.Context) {
 	pageStr := ctx.Query("page")
 	if pageStr == "" {
@@ -273,7 +319,7 @@ func (p *ReportController) GetReportedJobs(ctx *gin.Context) {
 		})
 		return
 	}
-	reports, err := p.reportUsecase.GetReportedJobs(ctx, page)
+	reports, err := p.reportUsecase.GetReportedJobs(ctx, page, helpers.AccessScope(ctx))
 
 	if err != nil {
 		fmt.Println("Error fetching reported jobs:", err)
@@ -313,7 +359,7 @@ func (p *ReportController) GetReportedPosts(ctx *gin.Context) {
 		})
 		return
 	}
-	reports, err := p.reportUsecase.GetReportedPosts(ctx, page)
+	reports, err := p.reportUsecase.GetReportedPosts(ctx, page, helpers.AccessScope(ctx))
 
 	if err != nil {
 		fmt.Println("Error fetching reported posts:", err)
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type RoleController struct {
+	roleUsecase usecases.RoleUsecase
+}
+
+func NewRoleController(roleUsecase usecases.RoleUsecase) *RoleController {
+	return &RoleController{roleUsecase: roleUsecase}
+}
+
+func (rc *RoleController) GetRoles(ctx *gin.Context) {
+	roles, err := rc.roleUsecase.GetRoles(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if roles == nil {
+		roles = []models.Roles{}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+func (rc *RoleController) GetPermissions(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"permissions": constants.AllPermissions})
+}
+
+func (rc *RoleController) SaveRole(ctx *gin.Context) {
+	var role models.Roles
+	if err := ctx.ShouldBindJSON(&role); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saved, err := rc.roleUsecase.SaveRole(ctx, role)
+	if err == repository.ErrInvalidPermission {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error saving role:", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save role"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"role": saved})
+}
+
+func (rc *RoleController) DeleteRole(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	err := rc.roleUsecase.DeleteRole(ctx, name)
+	switch err {
+	case nil:
+		ctx.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+	case repository.ErrRoleNotFound:
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case repository.ErrDefaultRole:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		fmt.Println("Error deleting role:", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+	}
+}
+
+func (rc *RoleController) GetUserAssignments(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.Query("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	assignments, err := rc.roleUsecase.GetUserAssignments(ctx, userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if assignments == nil {
+		assignments = []models.RoleAssignments{}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"assignments": assignments})
+}
+
+func (rc *RoleController) AssignRole(ctx *gin.Context) {
+	adminID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var assignment models.RoleAssignments
+	if err := ctx.ShouldBindJSON(&assignment); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	assignment.AssignedBy = adminID
+
+	saved, err := rc.roleUsecase.AssignRole(ctx, assignment)
+	if err == repository.ErrRoleNotFound {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error assigning role:", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"assignment": saved})
+}
+
+func (rc *RoleController) RemoveAssignment(ctx *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+		return
+	}
+
+	err = rc.roleUsecase.RemoveAssignment(ctx, id)
+	if err == mongo.ErrNoDocuments {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Assignment removed successfully"})
+}
@@ -5,9 +5,12 @@ import (
 	"net/http"
 
 	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/validation"
+	"github.com/chera-mihiretu/IKnow/repository"
 	"github.com/chera-mihiretu/IKnow/usecases"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type UniversityController struct {
@@ -137,3 +140,52 @@ func (c *UniversityController) DeleteUniversity(ctx *gin.Context) {
 	}
 	ctx.JSON(http.StatusOK, gin.H{"message": "University deleted"})
 }
+
+func (c *UniversityController) AddEmailDomain(ctx *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid university ID"})
+		return
+	}
+	var req struct {
+		Domain string `json:"domain" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	university, err := c.usecase.AddEmailDomain(ctx, id, req.Domain)
+	if err != nil {
+		ctx.JSON(emailDomainErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"university": university})
+}
+
+func (c *UniversityController) RemoveEmailDomain(ctx *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid university ID"})
+		return
+	}
+
+	university, err := c.usecase.RemoveEmailDomain(ctx, id, ctx.Param("domain"))
+	if err != nil {
+		ctx.JSON(emailDomainErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"university": university})
+}
+
+func emailDomainErrorStatus(err error) int {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		return http.StatusNotFound
+	case err == repository.ErrEmailDomainTaken:
+		return http.StatusConflict
+	case err == validation.ErrInvalidEmailDomain:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
+	"github.com/chera-mihiretu/IKnow/domain/constants"
 	"github.com/chera-mihiretu/IKnow/domain/models"
 	"github.com/chera-mihiretu/IKnow/usecases"
 	"github.com/gin-gonic/gin"
@@ -13,12 +16,13 @@ import (
 )
 
 type UserController struct {
-	usecase usecases.UserUseCase
-	storage usecases.StorageUseCase
+	usecase       usecases.UserUseCase
+	storage       usecases.StorageUseCase
+	handleUsecase usecases.HandleUsecase
 }
 
-func NewUserController(usecase usecases.UserUseCase, storage usecases.StorageUseCase) *UserController {
-	return &UserController{usecase: usecase, storage: storage}
+func NewUserController(usecase usecases.UserUseCase, storage usecases.StorageUseCase, handle usecases.HandleUsecase) *UserController {
+	return &UserController{usecase: usecase, storage: storage, handleUsecase: handle}
 }
 
 func (c *UserController) UpdateMe(ctx *gin.Context) {
@@ -120,6 +124,16 @@ func (c *UserController) UpdateMe(ctx *gin.Context) {
 		return
 	}
 
+	if mentionsFrom := form.Value["mentions_from"]; len(mentionsFrom) == 1 {
+		switch mentionsFrom[0] {
+		case constants.MentionsFromEveryone, constants.MentionsFromConnections, constants.MentionsFromNobody:
+			user.MentionsFrom = mentionsFrom[0]
+		default:
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "mentions_from must be everyone, connections or nobody"})
+			return
+		}
+	}
+
 	files := form.File["file"]
 	if len(files) > 1 {
 		fmt.Println("You can only upload a maximum of 1 file")
@@ -157,6 +171,11 @@ func (c *UserController) UpdateMe(ctx *gin.Context) {
 	log.Println("Up here all is good ")
 
 	prevUser, err := c.usecase.UpdateMe(ctx, user)
+	if status := placementErrorStatus(err); status != 0 {
+		c.storage.DeleteFile([]string{user.ProfileImageURL})
+		ctx.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		fmt.Println("Failed to update user:", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
@@ -182,7 +201,7 @@ func (c *UserController) Me(ctx *gin.Context) {
 		return
 	}
 
-	user, err := c.usecase.GetUserById(ctx, userIDStr)
+	user, err := c.usecase.GetMe(ctx, userIDStr)
 	if err != nil {
 		fmt.Println("Error fetching user:", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user details"})
@@ -305,6 +324,11 @@ func (c *UserController) CompleteUser(ctx *gin.Context) {
 
 	uploadedUser, err := c.usecase.CompleteUser(ctx, user)
 
+	if status := placementErrorStatus(err); status != 0 {
+		c.storage.DeleteFile([]string{user.ProfileImageURL})
+		ctx.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.storage.DeleteFile([]string{user.ProfileImageURL}) // Clean up if user creation fails
 		fmt.Println("Failed to complete user:", err)
@@ -350,3 +374,73 @@ func (c *UserController) GetUserByID(ctx *gin.Context) {
 	}
 	ctx.JSON(http.StatusOK, gin.H{"user": user})
 }
+
+// GetUserByHandle finds a user by their handle, an old handle redirects to the current one
+func (c *UserController) GetUserByHandle(ctx *gin.Context) {
+	handle := strings.TrimPrefix(ctx.Param("handle"), "@")
+	if handle == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Handle is required"})
+		return
+	}
+
+	user, err := c.handleUsecase.GetUserByHandle(ctx, handle)
+	if err != nil {
+		ctx.JSON(handleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !strings.EqualFold(user.Handle, handle) {
+		ctx.Header("Location", "/api/users/by-handle/"+url.PathEscape(user.Handle))
+		ctx.JSON(http.StatusFound, gin.H{"user": user, "redirect": user.Handle})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+func (c *UserController) ChangeHandle(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+	var req struct {
+		Handle string `json:"handle" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := c.handleUsecase.ChangeHandle(ctx, userID, strings.TrimPrefix(strings.TrimSpace(req.Handle), "@"))
+	if err != nil {
+		ctx.JSON(handleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// placementErrorStatus answers the university, school and department the user can not
+// pick, 0 is returned for any other error
+func placementErrorStatus(err error) int {
+	switch err {
+	case usecases.ErrUniversityReadOnly:
+		return http.StatusForbidden
+	case usecases.ErrSchoolNotInUniversity, usecases.ErrDepartmentNotInSchool:
+		return http.StatusBadRequest
+	}
+	return 0
+}
+
+func handleErrorStatus(err error) int {
+	switch err {
+	case usecases.ErrInvalidHandle, usecases.ErrHandleReserved:
+		return http.StatusBadRequest
+	case usecases.ErrHandleTaken:
+		return http.StatusConflict
+	case usecases.ErrHandleCooldown:
+		return http.StatusTooManyRequests
+	case usecases.ErrHandleNotFound, usecases.ErrUserNotFound:
+		return http.StatusNotFound
+	}
+	log.Println("Handle error:", err)
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxEvidenceFiles = 5
+
+var evidenceContentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+}
+
+type VerificationController struct {
+	verificationUsecase usecases.VerificationRequestUsecase
+	storage             usecases.StorageUseCase
+	userUsecase         usecases.UserUseCase
+	notificationUsecase usecases.NotificationUsecase
+}
+
+func NewVerificationController(
+	verificationUsecase usecases.VerificationRequestUsecase,
+	storage usecases.StorageUseCase,
+	userUsecase usecases.UserUseCase,
+	notificationUsecase usecases.NotificationUsecase,
+) *VerificationController {
+	return &VerificationController{
+		verificationUsecase: verificationUsecase,
+		storage:             storage,
+		userUsecase:         userUsecase,
+		notificationUsecase: notificationUsecase,
+	}
+}
+
+// CreateRequest takes a multipart form with the type, an optional message and the evidence files
+func (vc *VerificationController) CreateRequest(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, 20<<20) // 20 MB limit
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Failed to parse multipart form",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	request := models.VerificationRequests{UserID: userID}
+	if value := form.Value["type"]; len(value) > 0 {
+		request.Type = value[0]
+	}
+	if request.Type != constants.VerificationTypeTeacher && request.Type != constants.VerificationTypeBlueBadge {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": repository.ErrInvalidVerificationType.Error()})
+		return
+	}
+	if value := form.Value["message"]; len(value) > 0 {
+		request.Message = value[0]
+	}
+
+	files := form.File["file"]
+	if len(files) == 0 || len(files) > maxEvidenceFiles {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Upload between 1 and %d evidence files", maxEvidenceFiles)})
+		return
+	}
+	for _, file := range files {
+		if !evidenceContentTypes[file.Header.Get("Content-Type")] {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Only PDF and image files are allowed"})
+			return
+		}
+	}
+
+	urls, err := vc.storage.UploadFile(files)
+	if err != nil {
+		fmt.Println("Failed to upload evidence:", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload files"})
+		return
+	}
+	request.EvidenceURLs = urls
+
+	created, err := vc.verificationUsecase.CreateRequest(ctx, request)
+	if err != nil {
+		vc.storage.DeleteFile(urls) // Clean up uploaded files if creation fails
+		ctx.JSON(verificationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"request": created})
+}
+
+func (vc *VerificationController) GetMyRequests(ctx *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	requests, err := vc.verificationUsecase.GetUserRequests(ctx, userID)
+	if err != nil {
+		ctx.JSON(verificationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if requests == nil {
+		requests = []models.VerificationRequests{}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"requests": requests})
+}
+
+// GetRequests is the admin review queue, pending requests unless ?status= says otherwise
+func (vc *VerificationController) GetRequests(ctx *gin.Context) {
+	pageStr := ctx.Query("page")
+	if pageStr == "" {
+		pageStr = "1"
+	}
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number"})
+		return
+	}
+
+	status := ctx.Query("status")
+	switch status {
+	case "", constants.VerificationStatusPending, constants.VerificationStatusApproved, constants.VerificationStatusRejected:
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	requests, err := vc.verificationUsecase.GetRequests(ctx, page, status)
+	if err != nil {
+		ctx.JSON(verificationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	next := len(requests) > repository.Pagesize
+	requests = requests[:min(len(requests), repository.Pagesize)]
+
+	views, err := vc.prepareRequestsForView(ctx, requests)
+	if err != nil {
+		fmt.Println("Error preparing verification requests for view:", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare requests for view"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"requests": views,
+		"next":     next,
+	})
+}
+
+func (vc *VerificationController) ApproveRequest(ctx *gin.Context) {
+	vc.reviewRequest(ctx, true)
+}
+
+func (vc *VerificationController) RejectRequest(ctx *gin.Context) {
+	vc.reviewRequest(ctx, false)
+}
+
+func (vc *VerificationController) reviewRequest(ctx *gin.Context, approve bool) {
+	id, err := primitive.ObjectIDFromHex(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID format"})
+		return
+	}
+	reviewerID, err := primitive.ObjectIDFromHex(ctx.GetString("user_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
+
+	var body struct {
+		Notes string `json:"notes"`
+	}
+	if err := ctx.ShouldBindJSON(&body); err != nil && ctx.Request.ContentLength > 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !approve && body.Notes == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Notes are required to reject a request"})
+		return
+	}
+
+	request, err := vc.verificationUsecase.ReviewRequest(ctx, id, reviewerID, approve, body.Notes)
+	if err != nil {
+		ctx.JSON(verificationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	notification := models.Notifications{
+		UserID:    reviewerID,
+		To:        request.UserID,
+		Type:      string(constants.VerificationRejected),
+		Content:   constants.VerificationRejectedMessage,
+		ContentID: &request.ID,
+	}
+	if approve {
+		notification.Type = string(constants.VerificationApproved)
+		notification.Content = constants.VerificationApprovedMessage
+	}
+	go func() {
+		vc.notificationUsecase.SendNotification(context.Background(), &notification)
+	}()
+
+	ctx.JSON(http.StatusOK, gin.H{"request": request})
+}
+
+func (vc *VerificationController) prepareRequestsForView(ctx *gin.Context, requests []models.VerificationRequests) ([]models.VerificationRequestView, error) {
+	userIDs := make([]primitive.ObjectID, 0, len(requests))
+	for _, request := range requests {
+		userIDs = append(userIDs, request.UserID)
+	}
+	users, err := vc.userUsecase.GetListOfUsers(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	userMap := make(map[primitive.ObjectID]models.UserView, len(users))
+	for _, user := range users {
+		userMap[user.ID] = user
+	}
+
+	views := make([]models.VerificationRequestView, 0, len(requests))
+	for _, request := range requests {
+		views = append(views, models.VerificationRequestView{
+			ID:           request.ID,
+			User:         userMap[request.UserID],
+			Type:         request.Type,
+			Message:      request.Message,
+			EvidenceURLs: request.EvidenceURLs,
+			Status:       request.Status,
+			ReviewNotes:  request.ReviewNotes,
+			ReviewedBy:   request.ReviewedBy,
+			ReviewedAt:   request.ReviewedAt,
+			CreatedAt:    request.CreatedAt,
+		})
+	}
+	return views, nil
+}
+
+func verificationErrorStatus(err error) int {
+	switch err {
+	case repository.ErrVerificationNotFound:
+		return http.StatusNotFound
+	case repository.ErrInvalidVerificationType:
+		return http.StatusBadRequest
+	case repository.ErrVerificationPending, repository.ErrAlreadyVerified, repository.ErrVerificationReviewed:
+		return http.StatusConflict
+	}
+	fmt.Println("Verification request error:", err)
+	return http.StatusInternalServerError
+}
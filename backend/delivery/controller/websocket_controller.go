@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
 
@@ -66,10 +67,26 @@ func (c *WebSocketController) Connect(ctx *gin.Context) {
 
 	c.webSocketUsecase.AddConnection(connection)
 
+	// the client asks for the live updates of the posts on its screen
 	for {
-		if _, _, err := conn.ReadMessage(); err != nil {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
 			break
 		}
+		var subscription models.SocketSubscription
+		if err := json.Unmarshal(message, &subscription); err != nil {
+			continue
+		}
+		postID, err := primitive.ObjectIDFromHex(subscription.PostID)
+		if err != nil {
+			continue
+		}
+		switch subscription.Action {
+		case "subscribe":
+			c.webSocketUsecase.Subscribe(userID.Hex(), usecases.PostTopic(postID))
+		case "unsubscribe":
+			c.webSocketUsecase.Unsubscribe(userID.Hex(), usecases.PostTopic(postID))
+		}
 	}
 
 	log.Println("Connection closed for user:", userID)
@@ -0,0 +1,20 @@
+package helpers
+
+import (
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/gin-gonic/gin"
+)
+
+// AccessScope returns the scope resolved by middleware.RequireScopedPermission,
+// routes behind RequirePermission only let global grants through so they get a global scope
+func AccessScope(c *gin.Context) models.AccessScope {
+	value, exists := c.Get("access_scope")
+	if !exists {
+		return models.AccessScope{Global: true}
+	}
+	scope, ok := value.(models.AccessScope)
+	if !ok {
+		return models.AccessScope{}
+	}
+	return scope
+}
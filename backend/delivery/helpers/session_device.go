@@ -0,0 +1,48 @@
+package helpers
+
+import (
+	"strings"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/gin-gonic/gin"
+)
+
+// SessionDevice collects the client information stored with a session,
+// the mobile app can name itself through the X-Device-Name header
+func SessionDevice(c *gin.Context) models.SessionDevice {
+	userAgent := c.Request.UserAgent()
+
+	device := c.GetHeader("X-Device-Name")
+	if device == "" {
+		device = deviceFromUserAgent(userAgent)
+	}
+
+	return models.SessionDevice{
+		Device:    device,
+		UserAgent: userAgent,
+		IPAddress: c.ClientIP(),
+	}
+}
+
+func deviceFromUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return "Unknown device"
+	case strings.Contains(ua, "iphone"):
+		return "iPhone"
+	case strings.Contains(ua, "ipad"):
+		return "iPad"
+	case strings.Contains(ua, "android"):
+		return "Android"
+	case strings.Contains(ua, "dart"):
+		return "Mobile app"
+	case strings.Contains(ua, "windows"):
+		return "Windows"
+	case strings.Contains(ua, "mac os"):
+		return "Mac"
+	case strings.Contains(ua, "linux"):
+		return "Linux"
+	}
+	return "Unknown device"
+}
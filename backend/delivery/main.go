@@ -4,14 +4,19 @@ import (
 	"context"
 	"log"
 	"os"
+	"time"
 
 	"github.com/chera-mihiretu/IKnow/delivery/controller"
 	"github.com/chera-mihiretu/IKnow/delivery/router"
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/infrastructure/email"
+	"github.com/chera-mihiretu/IKnow/infrastructure/middleware"
 	"github.com/chera-mihiretu/IKnow/infrastructure/mongodb"
 	"github.com/chera-mihiretu/IKnow/infrastructure/my_websocket"
 	"github.com/chera-mihiretu/IKnow/infrastructure/redis"
 	"github.com/chera-mihiretu/IKnow/repository"
 	"github.com/chera-mihiretu/IKnow/usecases"
+	"github.com/hibiken/asynq"
 	"github.com/joho/godotenv"
 )
 
@@ -22,6 +27,12 @@ func main() {
 		panic("Error loading .env file")
 	}
 
+	keyRing, err := middleware.LoadKeyRing()
+	if err != nil {
+		log.Fatal("Failed to load the JWT signing keys:", err)
+	}
+	middleware.UseKeyRing(keyRing)
+
 	GothSetup()
 	client, err := mongodb.NewMongoClient()
 
@@ -31,6 +42,15 @@ func main() {
 
 	// redis.RateLimiter()
 
+	// queue client, admin emails go on the emails queue, bulk invitations on the invitations
+	// queue and scheduled posts on the posts queue
+	redisClient := redis.RedisClient()
+	if redisClient == nil {
+		log.Fatal("Failed to connect to Redis")
+	}
+	log.Println("✅✅✅✅ Connected to Redis successfully")
+	defer redisClient.Close()
+
 	myDatabase := client.Database("lazyme")
 	geminiClient, err := GeminiClient(context.Background())
 	if err != nil {
@@ -42,11 +62,23 @@ func main() {
 	postsStorageUseCase := StorageInstances(os.Getenv("SUPABASE_BUCKET_NAME"), "posts")
 	profileStorageUseCase := StorageInstances(os.Getenv("SUPABASE_BUCKET_NAME"), "profile")
 	materialsStorageUseCase := StorageInstances(os.Getenv("SUPABASE_BUCKET_NAME"), "materials")
+	verificationsStorageUseCase := StorageInstances(os.Getenv("SUPABASE_BUCKET_NAME"), "verifications")
 
 	// user dependencies
 	userRepository := repository.NewUserRepository(myDatabase)
 	userUseCase := usecases.NewUserUseCase(userRepository)
-	userController := controller.NewUserController(userUseCase, profileStorageUseCase)
+	handleRepository := repository.NewHandleRepository(myDatabase)
+	handleUsecase := usecases.NewHandleUsecase(handleRepository)
+	if err := handleUsecase.EnsureIndexes(context.Background()); err != nil {
+		log.Println("Failed to create the handle indexes:", err)
+	}
+	// users who signed up before handles existed get one made from their name
+	if generated, err := handleUsecase.GenerateMissingHandles(context.Background()); err != nil {
+		log.Println("Failed to generate the missing handles:", err)
+	} else if generated > 0 {
+		log.Println("Generated handles for", generated, "users")
+	}
+	userController := controller.NewUserController(userUseCase, profileStorageUseCase, handleUsecase)
 
 	// department dependencies
 	departmentRepository := repository.NewDepartmentRepository(myDatabase)
@@ -74,22 +106,58 @@ func main() {
 		connectionRepository,
 		*userRepository,
 		geminiRepository,
+		redisClient,
 	)
-	postUseCase := usecases.NewPostUseCase(postRepository)
+	// tags come from the text_extractor service, or from the words of the post without it
+	tagExtractorRepository := repository.NewTagExtractorRepository(os.Getenv("TAG_EXTRACTOR_URL"), nil, repository.NewLocalTagExtractor())
+	mentionUsecase := usecases.NewMentionUsecase(userRepository, connectionRepository, notificationUsecase)
+	postUseCase := usecases.NewPostUseCase(postRepository, connectionRepository, notificationUsecase, tagExtractorRepository, mentionUsecase)
+	if err := postUseCase.EnsureIndexes(context.Background()); err != nil {
+		log.Println("Failed to create the post indexes:", err)
+	}
+	postWorker, err := redis.StartWorker(constants.PostsQueue, map[string]asynq.HandlerFunc{
+		constants.TypePublishPost: postUseCase.HandlePublishPostTask,
+	})
+	if err != nil {
+		log.Fatal("Failed to start the scheduled posts worker:", err)
+	}
+	defer postWorker.Shutdown()
 	// like dependencies
 	postLikeRepository := repository.NewPostLikeRepository(myDatabase)
 	postLikeUsecase := usecases.NewPostLikeUsecase(postLikeRepository)
 	postLikeController := controller.NewPostLikeController(postLikeUsecase, notificationUsecase, postUseCase)
 
+	// poll dependencies
+	pollRepository := repository.NewPollRepository(myDatabase)
+	pollUsecase := usecases.NewPollUsecase(pollRepository, webSocketUsecase)
+	if err := pollUsecase.EnsureIndexes(context.Background()); err != nil {
+		log.Println("Failed to create the poll indexes:", err)
+	}
+	pollController := controller.NewPollController(pollUsecase, userUseCase, postUseCase)
+
+	// bookmark dependencies
+	bookmarkRepository := repository.NewBookmarkRepository(myDatabase)
+	bookmarkUsecase := usecases.NewBookmarkUsecase(bookmarkRepository)
+	if err := bookmarkUsecase.EnsureIndexes(context.Background()); err != nil {
+		log.Println("Failed to create the bookmark indexes:", err)
+	}
+
+	// repost dependencies
+	repostRepository := repository.NewRepostRepository(myDatabase, geminiRepository)
+	repostUsecase := usecases.NewRepostUsecase(repostRepository, postRepository, notificationUsecase, mentionUsecase, tagExtractorRepository)
+	if err := repostUsecase.EnsureIndexes(context.Background()); err != nil {
+		log.Println("Failed to create the repost indexes:", err)
+	}
+
 	// dependecy crumble
-	PostController := controller.NewPostController(postUseCase, userUseCase, departmentUsecase, postsStorageUseCase, postLikeUsecase, notificationUsecase)
+	PostController := controller.NewPostController(postUseCase, userUseCase, departmentUsecase, postsStorageUseCase, postLikeUsecase, notificationUsecase, pollUsecase, bookmarkUsecase, repostUsecase)
 
 	jobLikeRepository := repository.NewJobLikeRepository(myDatabase)
 	jobLikeUsecase := usecases.NewJobLikeUsecase(jobLikeRepository)
 	jobLikeController := controller.NewJobLikeController(jobLikeUsecase)
 	// comment dependencies
 	commentRepository := repository.NewCommentRepository(myDatabase)
-	commentUsecase := usecases.NewCommentUsecase(commentRepository)
+	commentUsecase := usecases.NewCommentUsecase(commentRepository, postRepository, mentionUsecase)
 	commentController := controller.NewCommentController(commentUsecase, userUseCase, postUseCase, notificationUsecase)
 	// gemini dependencies
 
@@ -105,25 +173,96 @@ func main() {
 	universityRepository := repository.NewUniversityRepository(myDatabase)
 	universityUseCase := usecases.NewUniversityUsecase(universityRepository)
 	universityController := controller.NewUniversityController(universityUseCase)
+	// session dependencies
+	sessionRepository := repository.NewSessionRepository(myDatabase)
+	sessionUsecase := usecases.NewSessionUsecase(sessionRepository)
+	middleware.UseSessionChecker(sessionUsecase)
+	// role dependencies
+	roleRepository := repository.NewRoleRepository(myDatabase)
+	roleUsecase := usecases.NewRoleUsecase(roleRepository)
+	if err := roleUsecase.SeedDefaultRoles(context.Background()); err != nil {
+		log.Fatal("Failed to seed default roles:", err)
+	}
+	middleware.UsePermissionResolver(roleUsecase)
+	roleController := controller.NewRoleController(roleUsecase)
+	// two factor dependencies
+	mfaRepository := repository.NewMFARepository(myDatabase, sessionRepository)
+	mfaUsecase := usecases.NewMFAUsecase(mfaRepository)
+	mfaController := controller.NewMFAController(mfaUsecase)
+	// verification request dependencies
+	verificationRequestRepository := repository.NewVerificationRequestRepository(myDatabase)
+	verificationRequestUsecase := usecases.NewVerificationRequestUsecase(verificationRequestRepository)
+	verificationController := controller.NewVerificationController(verificationRequestUsecase, verificationsStorageUseCase, userUseCase, notificationUsecase)
+	auditLogRepository := repository.NewAuditLogRepository(myDatabase)
+	// invitation dependencies
+	invitationRepository := repository.NewInvitationRepository(myDatabase, universityRepository, redisClient)
+	invitationUsecase := usecases.NewInvitationUsecase(invitationRepository, userRepository, auditLogRepository)
+	if err := invitationUsecase.EnsureIndexes(context.Background()); err != nil {
+		log.Println("Failed to create the invitation indexes:", err)
+	}
+	invitationController := controller.NewInvitationController(invitationUsecase)
+	invitationWorker, err := redis.StartWorker(constants.InvitationsQueue, map[string]asynq.HandlerFunc{
+		constants.TypeSendInvitationEmail: email.HandleInvitationEmailTask,
+	})
+	if err != nil {
+		log.Fatal("Failed to start the invitation email worker:", err)
+	}
+	defer invitationWorker.Shutdown()
 	// auth dependecies
-	authRepository := repository.NewAuthRepository(myDatabase, universityRepository)
-	authUseCase := usecases.NewAuthUseCase(authRepository)
-	AuthController := controller.NewAuthController(authUseCase)
+	identityRepository := repository.NewIdentityRepository(myDatabase)
+	authRepository := repository.NewAuthRepository(myDatabase, universityRepository, sessionRepository, mfaRepository, identityRepository)
+	loginAttemptRepository := repository.NewLoginAttemptRepository(redis.RedisStore())
+	authUseCase := usecases.NewAuthUseCase(authRepository, loginAttemptRepository, auditLogRepository, identityRepository, invitationRepository)
+	if err := authUseCase.EnsureIndexes(context.Background()); err != nil {
+		log.Println("Failed to create the auth indexes:", err)
+	}
+	AuthController := controller.NewAuthController(authUseCase, sessionUsecase)
+	// account deletion and export dependencies, deleting storage files works from any folder
+	accountRepository := repository.NewAccountRepository(myDatabase, sessionRepository)
+	accountUsecase := usecases.NewAccountUsecase(accountRepository, auditLogRepository, postsStorageUseCase)
+	accountController := controller.NewAccountController(accountUsecase)
+	accountWorker, err := redis.StartWorker(constants.AccountsQueue, map[string]asynq.HandlerFunc{
+		constants.TypePurgeAccounts: accountUsecase.HandlePurgeAccountsTask,
+	})
+	if err != nil {
+		log.Fatal("Failed to start the account purge worker:", err)
+	}
+	defer accountWorker.Shutdown()
+	// a purge is idempotent, the lock only keeps the replicas from queueing the same hour twice
+	accountPurge, err := redis.StartScheduler(constants.AccountPurgeCronSpec, asynq.NewTask(constants.TypePurgeAccounts, nil), constants.AccountsQueue, 30*time.Minute)
+	if err != nil {
+		log.Fatal("Failed to schedule the account purge:", err)
+	}
+	defer accountPurge.Shutdown()
+	// personal access token and bot dependencies
+	accessTokenRepository := repository.NewAccessTokenRepository(myDatabase)
+	accessTokenUsecase := usecases.NewAccessTokenUsecase(accessTokenRepository, auditLogRepository)
+	if err := accessTokenUsecase.EnsureIndexes(context.Background()); err != nil {
+		log.Println("Failed to create the access token indexes:", err)
+	}
+	middleware.UseTokenAuthenticator(accessTokenUsecase)
+	// email change dependencies, a reverted change signs out and removes the access tokens
+	emailChangeRepository := repository.NewEmailChangeRepository(myDatabase, universityRepository, sessionRepository, accessTokenRepository)
+	emailChangeUsecase := usecases.NewEmailChangeUsecase(emailChangeRepository, authRepository)
+	emailChangeController := controller.NewEmailChangeController(emailChangeUsecase)
+	accessTokenController := controller.NewAccessTokenController(accessTokenUsecase)
+	botRepository := repository.NewBotRepository(myDatabase, accessTokenRepository)
+	botUsecase := usecases.NewBotUsecase(botRepository, accessTokenUsecase, auditLogRepository)
+	botController := controller.NewBotController(botUsecase)
+	// impersonation dependencies
+	impersonationUsecase := usecases.NewImpersonationUsecase(sessionRepository, userRepository, auditLogRepository)
+	middleware.UseImpersonationRecorder(impersonationUsecase)
+	impersonationController := controller.NewImpersonationController(impersonationUsecase)
 	// job dependencies
 	jobRepository := repository.NewJobRepository(myDatabase, departmentRepository, geminiRepository)
 	jobUsecase := usecases.NewJobUsecase(jobRepository)
-	jobController := controller.NewJobController(jobUsecase, userUseCase, jobLikeUsecase)
+	jobController := controller.NewJobController(jobUsecase, userUseCase, jobLikeUsecase, bookmarkUsecase)
+	bookmarkController := controller.NewBookmarkController(bookmarkUsecase, postUseCase, jobUsecase, materialUseCase)
 	// report dependencies
 	reportRepository := repository.NewReportRepository(myDatabase)
 	reportUseCase := usecases.NewReportUseCase(reportRepository)
 	reportController := controller.NewReportController(reportUseCase, userUseCase, postUseCase, jobUsecase, notificationUsecase)
 	// admin dependencies
-	redisClient := redis.RedisClient()
-	if redisClient == nil {
-		log.Fatal("Failed to connect to Redis")
-	}
-	log.Println("✅✅✅✅ Connected to Redis successfully")
-	defer redisClient.Close()
 	adminRepository := repository.NewAdminRepository(
 		geminiRepository,
 		userRepository,
@@ -149,6 +288,17 @@ func main() {
 		adminController,
 		webSocketController,
 		notificationController,
+		roleController,
+		mfaController,
+		verificationController,
+		emailChangeController,
+		accountController,
+		accessTokenController,
+		botController,
+		impersonationController,
+		invitationController,
+		pollController,
+		bookmarkController,
 	)
 
 	if err := router.Run(":8080"); err != nil {
@@ -5,19 +5,12 @@ import (
 	"os"
 
 	"github.com/chera-mihiretu/IKnow/delivery/controller"
+	"github.com/chera-mihiretu/IKnow/domain/constants"
 	"github.com/chera-mihiretu/IKnow/infrastructure/middleware"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-const (
-	SuperAdmin  = 4
-	RoleAdmin   = 3
-	RoleTeacher = 2
-	RoleStudent = 1
-	RoleAll     = 0
-)
-
 func SetupRoutes(
 	authController *controller.AuthController,
 	postController *controller.PostController,
@@ -35,102 +28,149 @@ func SetupRoutes(
 	adminController *controller.AdminController,
 	websocketController *controller.WebSocketController,
 	notificationController *controller.NotificationController,
+	roleController *controller.RoleController,
+	mfaController *controller.MFAController,
+	verificationController *controller.VerificationController,
+	emailChangeController *controller.EmailChangeController,
+	accountController *controller.AccountController,
+	accessTokenController *controller.AccessTokenController,
+	botController *controller.BotController,
+	impersonationController *controller.ImpersonationController,
+	invitationController *controller.InvitationController,
+	pollController *controller.PollController,
+	bookmarkController *controller.BookmarkController,
 ) *gin.Engine {
 	fmt.Println("FRONT_BASE_URL:", os.Getenv("FRONT_BASE_URL"))
 	r := gin.New()
 	r.Use(gin.Logger(), gin.Recovery())
 	corsConfig := cors.Config{
-		AllowOrigins:     []string{"*"}, //[]string{os.Getenv("FRONT_BASE_URL")},
+		// credentials, the refresh token cookie, are only accepted from the front end
+		AllowOrigins:     []string{os.Getenv("FRONT_BASE_URL")},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", middleware.ImpersonatedByHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * 60 * 60,
 	}
 
 	r.Use(cors.New(corsConfig))
 
-	googleAuth := r.Group("/api/auth/google")
+	providerAuth := r.Group("/api/auth/:provider", middleware.OAuthProvider)
 	{
-		googleAuth.GET("/login", middleware.GoogleProvider, authController.LoginWithGoogle)
-		googleAuth.GET("/logout", middleware.GoogleProvider, func(c *gin.Context) {})
+		providerAuth.GET("/login", authController.LoginWithProvider)
+		providerAuth.GET("/logout", middleware.AuthUserMiddleware(), authController.Logout)
+		providerAuth.GET("/callback", authController.HandleCallback)
+		providerAuth.POST("/link", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), authController.StartProviderLink)
+		providerAuth.DELETE("/link", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), authController.UnlinkProvider)
+	}
 
-		googleAuth.GET("/callback", authController.HandleCallback)
+	auth := r.Group("/api/auth")
+	{
+		auth.POST("/refresh", authController.RefreshToken)
+		auth.POST("/logout", middleware.AuthUserMiddleware(), authController.Logout)
+		auth.POST("/logout/others", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), authController.LogoutOtherSessions)
+		auth.POST("/logout/all", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), authController.LogoutEverywhere)
+		auth.GET("/linked-accounts", middleware.AuthUserMiddleware(), authController.GetLinkedAccounts)
+	}
 
+	twoFactor := r.Group("/api/auth/2fa")
+	{
+		twoFactor.POST("/verify", mfaController.VerifyChallenge)
+		twoFactor.POST("/challenge/enroll", mfaController.BeginChallengeEnrollment)
+		twoFactor.POST("/challenge/enroll/confirm", mfaController.ConfirmChallengeEnrollment)
+		twoFactor.POST("/enroll", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), mfaController.BeginEnrollment)
+		twoFactor.POST("/enroll/confirm", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), mfaController.ConfirmEnrollment)
+		twoFactor.POST("/disable", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), mfaController.DisableTwoFactor)
+		twoFactor.POST("/recovery-codes", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), mfaController.RegenerateRecoveryCodes)
 	}
 
 	emailAuth := r.Group("/api/auth/email")
 	{
 		emailAuth.POST("/register", authController.RegisterWithEmail)
 		emailAuth.POST("/login", authController.LoginWithEmail)
+		emailAuth.POST("/magic-link", authController.SendMagicLink)
+		emailAuth.POST("/magic-link/login", authController.LoginWithMagicLink)
 		emailAuth.GET("/verify-email", authController.VerifyEmail)
+		emailAuth.POST("/resend-verification", authController.ResendVerificationEmail)
 		emailAuth.POST("/forgot-password", authController.ForgotPassword)
 		emailAuth.POST("/reset-password", authController.ResetPassword)
+		emailAuth.GET("/unlock", authController.UnlockAccount)
+		emailAuth.GET("/change/confirm", emailChangeController.ConfirmEmailChange)
+		emailAuth.GET("/change/revert", emailChangeController.RevertEmailChange)
 	}
 
 	postsInfo := r.Group("/api/posts")
 
 	{
-
-		postsInfo.Use(middleware.AuthUserMiddleware(RoleAll))
-		postsInfo.GET("/", postController.GetPosts)
-		postsInfo.GET("/user/", postController.GetPostsByUserID)
-		postsInfo.GET("/me", postController.GetMyPosts)
-		postsInfo.GET("/post", postController.GetPostByID)
-		postsInfo.POST("/", postController.CreatePost)
-		postsInfo.PUT("/:id", postController.UpdatePost)
-		postsInfo.DELETE("/", postController.DeletePost)
-		postsInfo.GET("/search", postController.SearchPosts)
-		postsInfo.GET("/unverified", middleware.AuthUserMiddleware(RoleAdmin), postController.GetUnverifiedPosts)
-		postsInfo.POST("/verify", middleware.AuthUserMiddleware(RoleAdmin), postController.VerifyPost)
-		postsInfo.DELETE("/remove-unverified", middleware.AuthUserMiddleware(RoleAdmin), postController.RemoveUnverifiedPost)
+		// every route checks a permission, which also authenticates the request with a session or an access token
+		postsInfo.GET("/", middleware.RequirePermission(constants.PermPostsRead), postController.GetPosts)
+		postsInfo.GET("/user/", middleware.RequirePermission(constants.PermPostsRead), postController.GetPostsByUserID)
+		postsInfo.GET("/me", middleware.RequirePermission(constants.PermPostsRead), postController.GetMyPosts)
+		postsInfo.GET("/post", middleware.RequirePermission(constants.PermPostsRead), postController.GetPostByID)
+		postsInfo.POST("/", middleware.RequirePermission(constants.PermPostsWrite), postController.CreatePost)
+		postsInfo.PUT("/:id", middleware.RequirePermission(constants.PermPostsWrite), postController.UpdatePost)
+		postsInfo.GET("/:id/revisions", middleware.RequirePermission(constants.PermPostsRead), middleware.OptionalScopedPermission(constants.PermPostsVerify), postController.GetPostRevisions)
+		postsInfo.GET("/tags/:tag", middleware.RequirePermission(constants.PermPostsRead), postController.GetPostsByTag)
+		postsInfo.GET("/drafts", middleware.RequirePermission(constants.PermPostsWrite), postController.GetDrafts)
+		postsInfo.PUT("/:id/schedule", middleware.RequirePermission(constants.PermPostsWrite), postController.SchedulePost)
+		postsInfo.DELETE("/:id/schedule", middleware.RequirePermission(constants.PermPostsWrite), postController.CancelSchedule)
+		postsInfo.POST("/:id/publish", middleware.RequirePermission(constants.PermPostsWrite), postController.PublishPost)
+		postsInfo.POST("/:id/poll/vote", middleware.RequirePermission(constants.PermPostsRead), pollController.Vote)
+		postsInfo.GET("/:id/poll/voters", middleware.RequirePermission(constants.PermPostsRead), pollController.GetPollVoters)
+		postsInfo.POST("/:id/repost", middleware.RequirePermission(constants.PermPostsWrite), postController.Repost)
+		postsInfo.DELETE("/:id/repost", middleware.RequirePermission(constants.PermPostsWrite), postController.Unrepost)
+		postsInfo.DELETE("/", middleware.RequirePermission(constants.PermPostsWrite), postController.DeletePost)
+		postsInfo.GET("/search", middleware.RequirePermission(constants.PermPostsRead), postController.SearchPosts)
+		postsInfo.GET("/unverified", middleware.RequireScopedPermission(constants.PermPostsVerify), postController.GetUnverifiedPosts)
+		postsInfo.POST("/verify", middleware.RequireScopedPermission(constants.PermPostsVerify), postController.VerifyPost)
+		postsInfo.DELETE("/remove-unverified", middleware.RequireScopedPermission(constants.PermPostsVerify), postController.RemoveUnverifiedPost)
 
 		// likes
-		postsInfo.POST("/like", postLikeController.AddLike)
-		postsInfo.POST("/dislike", postLikeController.RemoveLike)
+		postsInfo.POST("/like", middleware.RequirePermission(constants.PermPostsRead), postLikeController.AddLike)
+		postsInfo.POST("/dislike", middleware.RequirePermission(constants.PermPostsRead), postLikeController.RemoveLike)
 		// comments
 		comments := postsInfo.Group("/comments")
-		comments.GET("/", commentController.GetComments)
-		comments.GET("/reply", commentController.GetReplies)
-		comments.POST("/reply", middleware.AuthUserMiddleware(RoleStudent), commentController.AddReply)
-		comments.POST("/", middleware.AuthUserMiddleware(RoleStudent), commentController.AddComment)
-		comments.DELETE("/:comment_id", middleware.AuthUserMiddleware(RoleStudent), commentController.DeleteComment)
-		comments.PUT("/:comment_id", middleware.AuthUserMiddleware(RoleStudent), commentController.EditComment)
+		comments.GET("/", middleware.RequirePermission(constants.PermPostsRead), commentController.GetComments)
+		comments.GET("/reply", middleware.RequirePermission(constants.PermPostsRead), commentController.GetReplies)
+		comments.POST("/reply", middleware.RequirePermission(constants.PermCommentsWrite), commentController.AddReply)
+		comments.POST("/", middleware.RequirePermission(constants.PermCommentsWrite), commentController.AddComment)
+		comments.DELETE("/:comment_id", middleware.RequirePermission(constants.PermCommentsWrite), commentController.DeleteComment)
+		comments.PUT("/:comment_id", middleware.RequirePermission(constants.PermCommentsWrite), commentController.EditComment)
 
 	}
 
 	reports := r.Group("/api/reports")
 
 	{
-		reports.POST("/post", middleware.AuthUserMiddleware(RoleStudent), reportController.ReportPost)
-		reports.POST("/job", middleware.AuthUserMiddleware(RoleStudent), reportController.ReportJob)
-		reports.GET("/post", middleware.AuthUserMiddleware(RoleAdmin), reportController.GetReportedPosts)
-		reports.GET("/job", middleware.AuthUserMiddleware(RoleAdmin), reportController.GetReportedJobs)
-		reports.GET("/analytics", middleware.AuthUserMiddleware(RoleAdmin), reportController.GetReportAnalytics)
-		reports.POST("/take-action", middleware.AuthUserMiddleware(RoleAdmin), reportController.TakeActionOnReport)
+		reports.POST("/post", middleware.RequirePermission(constants.PermReportsCreate), reportController.ReportPost)
+		reports.POST("/job", middleware.RequirePermission(constants.PermReportsCreate), reportController.ReportJob)
+		reports.GET("/post", middleware.RequireScopedPermission(constants.PermReportsRead), reportController.GetReportedPosts)
+		reports.GET("/job", middleware.RequireScopedPermission(constants.PermReportsRead), reportController.GetReportedJobs)
+		reports.GET("/analytics", middleware.RequirePermission(constants.PermReportsRead), reportController.GetReportAnalytics)
+		reports.POST("/take-action", middleware.RequireScopedPermission(constants.PermReportsAct), reportController.TakeActionOnReport)
 	}
 
 	connection := r.Group("/api/connections")
 	{
-		connection.GET("/suggestions", middleware.AuthUserMiddleware(RoleStudent), connectionController.GetConnectionSuggestions)
-		connection.GET("/", middleware.AuthUserMiddleware(RoleStudent), connectionController.GetConnections)
-		connection.GET("/requests/", middleware.AuthUserMiddleware(RoleStudent), connectionController.GetConnectRequests)
-		connection.POST("/", middleware.AuthUserMiddleware(RoleStudent), connectionController.CreateConnection)
-		connection.DELETE("/", middleware.AuthUserMiddleware(RoleStudent), connectionController.DeleteConnection)
-		connection.GET("/is-connected", middleware.AuthUserMiddleware(RoleStudent), connectionController.IsConnected)
-		connection.GET("/count", middleware.AuthUserMiddleware(RoleStudent), connectionController.GetConnectionsCount)
-		connection.POST("/accept", middleware.AuthUserMiddleware(RoleStudent), connectionController.AcceptConnection)
+		connection.GET("/suggestions", middleware.RequirePermission(constants.PermConnectionsManage), connectionController.GetConnectionSuggestions)
+		connection.GET("/", middleware.RequirePermission(constants.PermConnectionsManage), connectionController.GetConnections)
+		connection.GET("/requests/", middleware.RequirePermission(constants.PermConnectionsManage), connectionController.GetConnectRequests)
+		connection.POST("/", middleware.RequirePermission(constants.PermConnectionsManage), connectionController.CreateConnection)
+		connection.DELETE("/", middleware.RequirePermission(constants.PermConnectionsManage), connectionController.DeleteConnection)
+		connection.GET("/is-connected", middleware.RequirePermission(constants.PermConnectionsManage), connectionController.IsConnected)
+		connection.GET("/count", middleware.RequirePermission(constants.PermConnectionsManage), connectionController.GetConnectionsCount)
+		connection.POST("/accept", middleware.RequirePermission(constants.PermConnectionsManage), connectionController.AcceptConnection)
 	}
 
 	// Materials endpoints
 	material := r.Group("/api/materials")
 	{
-		material.GET("/", middleware.AuthUserMiddleware(RoleAll), materialController.GetMaterials)
-		material.GET("/tree", middleware.AuthUserMiddleware(RoleAll), materialController.GetMaterialsInTree)
-		material.GET("/:id", middleware.AuthUserMiddleware(RoleAll), materialController.GetMaterialByID)
-		material.POST("/", middleware.AuthUserMiddleware(RoleAdmin), materialController.CreateMaterial)
-		material.PUT("/:id", middleware.AuthUserMiddleware(RoleAdmin), materialController.UpdateMaterial)
-		material.DELETE("/:id", middleware.AuthUserMiddleware(RoleAdmin), materialController.DeleteMaterial)
+		material.GET("/", middleware.RequirePermission(constants.PermMaterialsRead), materialController.GetMaterials)
+		material.GET("/tree", middleware.RequirePermission(constants.PermMaterialsRead), materialController.GetMaterialsInTree)
+		material.GET("/:id", middleware.RequirePermission(constants.PermMaterialsRead), materialController.GetMaterialByID)
+		material.POST("/", middleware.RequireScopedPermission(constants.PermMaterialsWrite), materialController.CreateMaterial)
+		material.PUT("/:id", middleware.RequireScopedPermission(constants.PermMaterialsWrite), materialController.UpdateMaterial)
+		material.DELETE("/:id", middleware.RequireScopedPermission(constants.PermMaterialsWrite), materialController.DeleteMaterial)
 	}
 
 	// Departments endpoints
@@ -138,10 +178,10 @@ func SetupRoutes(
 	{
 		department.GET("/", departmentController.GetDepartments)
 		department.GET("/tree/:school_id", departmentController.GetDepartmentsInTree)
-		department.GET("/:id", middleware.AuthUserMiddleware(RoleAll), departmentController.GetDepartmentByID)
-		department.POST("/", middleware.AuthUserMiddleware(RoleAdmin), departmentController.CreateDepartment)
-		department.PUT("/:id", middleware.AuthUserMiddleware(RoleAdmin), departmentController.UpdateDepartment)
-		department.DELETE("/:id", middleware.AuthUserMiddleware(RoleAdmin), departmentController.DeleteDepartment)
+		department.GET("/:id", middleware.AuthUserMiddleware(), departmentController.GetDepartmentByID)
+		department.POST("/", middleware.RequirePermission(constants.PermDepartmentsWrite), departmentController.CreateDepartment)
+		department.PUT("/:id", middleware.RequirePermission(constants.PermDepartmentsWrite), departmentController.UpdateDepartment)
+		department.DELETE("/:id", middleware.RequirePermission(constants.PermDepartmentsWrite), departmentController.DeleteDepartment)
 	}
 
 	// Schools endpoints
@@ -150,9 +190,9 @@ func SetupRoutes(
 		school.GET("/", schoolController.GetSchools)
 		school.GET("/all", schoolController.GetAllSchools)
 		school.GET("/:id", schoolController.GetSchoolByID)
-		school.POST("/", middleware.AuthUserMiddleware(RoleAdmin), schoolController.CreateSchool)
-		school.PUT("/:id", middleware.AuthUserMiddleware(RoleAdmin), schoolController.UpdateSchool)
-		school.DELETE("/:id", middleware.AuthUserMiddleware(RoleAdmin), schoolController.DeleteSchool)
+		school.POST("/", middleware.RequirePermission(constants.PermSchoolsWrite), schoolController.CreateSchool)
+		school.PUT("/:id", middleware.RequirePermission(constants.PermSchoolsWrite), schoolController.UpdateSchool)
+		school.DELETE("/:id", middleware.RequirePermission(constants.PermSchoolsWrite), schoolController.DeleteSchool)
 	}
 
 	// Universities endpoints
@@ -160,44 +200,122 @@ func SetupRoutes(
 	{
 		university.GET("/", universityController.GetUniversities)
 		university.GET("/:id", universityController.GetUniversityByID)
-		university.POST("/", middleware.AuthUserMiddleware(RoleAdmin), universityController.CreateUniversity)
-		university.PUT("/:id", middleware.AuthUserMiddleware(RoleAdmin), universityController.UpdateUniversity)
-		university.DELETE("/:id", middleware.AuthUserMiddleware(RoleAdmin), universityController.DeleteUniversity)
+		university.POST("/", middleware.RequirePermission(constants.PermUniversitiesWrite), universityController.CreateUniversity)
+		university.PUT("/:id", middleware.RequirePermission(constants.PermUniversitiesWrite), universityController.UpdateUniversity)
+		university.DELETE("/:id", middleware.RequirePermission(constants.PermUniversitiesWrite), universityController.DeleteUniversity)
+		university.POST("/:id/domains", middleware.RequirePermission(constants.PermUniversitiesWrite), universityController.AddEmailDomain)
+		university.DELETE("/:id/domains/:domain", middleware.RequirePermission(constants.PermUniversitiesWrite), universityController.RemoveEmailDomain)
 	}
 
 	// Jobs endpoints
 	job := r.Group("/api/jobs")
 	{
-		job.GET("/", middleware.AuthUserMiddleware(RoleAll), jobController.GetRecommendedJobs)
-		job.GET("/:id", middleware.AuthUserMiddleware(RoleAll), jobController.GetJobByID)
-		job.POST("/", middleware.AuthUserMiddleware(RoleStudent), jobController.CreateJob)
-		job.PUT("/:id", middleware.AuthUserMiddleware(RoleStudent), jobController.UpdateJob)
-		job.DELETE("/:id", middleware.AuthUserMiddleware(RoleStudent), jobController.DeleteJob)
+		job.GET("/", middleware.RequirePermission(constants.PermJobsRead), jobController.GetRecommendedJobs)
+		job.GET("/:id", middleware.RequirePermission(constants.PermJobsRead), jobController.GetJobByID)
+		job.POST("/", middleware.RequirePermission(constants.PermJobsWrite), jobController.CreateJob)
+		job.PUT("/:id", middleware.RequirePermission(constants.PermJobsWrite), jobController.UpdateJob)
+		job.DELETE("/:id", middleware.RequirePermission(constants.PermJobsWrite), jobController.DeleteJob)
 		// likes
-		job.POST("/like", middleware.AuthUserMiddleware(RoleStudent), jobLikeController.AddLike)
-		job.POST("/dislike", middleware.AuthUserMiddleware(RoleStudent), jobLikeController.RemoveLike)
+		job.POST("/like", middleware.RequirePermission(constants.PermJobsRead), jobLikeController.AddLike)
+		job.POST("/dislike", middleware.RequirePermission(constants.PermJobsRead), jobLikeController.RemoveLike)
 	}
 	user := r.Group("/api/users")
 	{
 
-		user.GET("/:id", middleware.AuthUserMiddleware(RoleAll), userController.GetUserByID)
-		user.GET("/me", middleware.AuthUserMiddleware(RoleAll), userController.Me)
-		user.PUT("/me", middleware.AuthUserMiddleware(RoleAll), userController.UpdateMe)
-		user.POST("/complete-account", middleware.AuthUserMiddleware(RoleAll), userController.CompleteUser)
-		user.GET("/analytics", middleware.AuthUserMiddleware(RoleAdmin), userController.UserAnalytics)
+		user.GET("/:id", middleware.AuthUserMiddleware(), userController.GetUserByID)
+		user.GET("/by-handle/:handle", middleware.AuthUserMiddleware(), userController.GetUserByHandle)
+		user.GET("/me", middleware.AuthUserMiddleware(), userController.Me)
+		user.PUT("/me", middleware.AuthUserMiddleware(), userController.UpdateMe)
+		user.PUT("/me/handle", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), userController.ChangeHandle)
+		user.DELETE("/me", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), accountController.DeleteMe)
+		user.POST("/me/deletion/cancel", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), accountController.CancelDeletion)
+		user.GET("/me/export", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), accountController.ExportMe)
+		user.POST("/me/email", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), emailChangeController.RequestEmailChange)
+		user.GET("/me/sessions", middleware.AuthUserMiddleware(), authController.GetMySessions)
+		user.DELETE("/me/sessions/:session_id", middleware.AuthUserMiddleware(), authController.RevokeMySession)
+		user.GET("/me/tokens", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), accessTokenController.GetMyTokens)
+		user.POST("/me/tokens", middleware.AuthUserMiddleware(), middleware.NoImpersonation(), accessTokenController.CreateToken)
+		user.DELETE("/me/tokens/:token_id", middleware.AuthUserMiddleware(), accessTokenController.RevokeToken)
+		user.POST("/complete-account", middleware.AuthUserMiddleware(), userController.CompleteUser)
+		user.GET("/analytics", middleware.RequirePermission(constants.PermUsersAnalytics), userController.UserAnalytics)
 	}
 
 	admins := r.Group("/api/admins")
 
 	{
-		admins.POST("/send-email", middleware.AuthUserMiddleware(SuperAdmin), adminController.SendEmailToUsers)
-		admins.POST("/improve-email", middleware.AuthUserMiddleware(SuperAdmin), adminController.ImproveEmail)
+		admins.POST("/send-email", middleware.RequirePermission(constants.PermAdminsEmail), adminController.SendEmailToUsers)
+		admins.POST("/improve-email", middleware.RequirePermission(constants.PermAdminsEmail), adminController.ImproveEmail)
+
+		// view the platform as a user, every impersonated request is audited
+		impersonations := admins.Group("/impersonations")
+		impersonations.Use(middleware.RequirePermission(constants.PermUsersImpersonate), middleware.NoImpersonation())
+		impersonations.POST("/", impersonationController.StartImpersonation)
+		impersonations.GET("/", impersonationController.GetActiveImpersonations)
+		impersonations.DELETE("/:session_id", impersonationController.EndImpersonation)
+	}
+
+	invitations := r.Group("/api/invitations")
+	{
+		invitations.GET("/code/:code", invitationController.PreviewInvitation)
+		invitations.POST("/redeem", middleware.AuthUserMiddleware(), invitationController.RedeemInvitation)
+		// scoped grants can only invite to and see the invitations of their departments
+		invitations.POST("/", middleware.RequireScopedPermission(constants.PermInvitationsManage), invitationController.CreateInvitation)
+		invitations.POST("/bulk", middleware.RequireScopedPermission(constants.PermInvitationsManage), invitationController.BulkInvite)
+		invitations.GET("/", middleware.RequireScopedPermission(constants.PermInvitationsManage), invitationController.GetInvitations)
+		invitations.DELETE("/:id", middleware.RequireScopedPermission(constants.PermInvitationsManage), invitationController.RevokeInvitation)
+		invitations.GET("/:id/redemptions", middleware.RequireScopedPermission(constants.PermInvitationsManage), invitationController.GetRedemptions)
+	}
+
+	roles := r.Group("/api/roles")
+	{
+		roles.Use(middleware.RequirePermission(constants.PermRolesManage))
+		roles.GET("/", roleController.GetRoles)
+		roles.GET("/permissions", roleController.GetPermissions)
+		roles.PUT("/", roleController.SaveRole)
+		roles.DELETE("/:name", roleController.DeleteRole)
+		roles.GET("/assignments", roleController.GetUserAssignments)
+		roles.POST("/assignments", roleController.AssignRole)
+		roles.DELETE("/assignments/:id", roleController.RemoveAssignment)
+	}
+
+	// bots can only be managed from a logged in session, never with an access token
+	bots := r.Group("/api/bots")
+	{
+		bots.Use(middleware.AuthUserMiddleware(), middleware.RequirePermission(constants.PermBotsManage))
+		bots.GET("/", botController.GetBots)
+		bots.POST("/", botController.CreateBot)
+		bots.DELETE("/:id", botController.DeleteBot)
+		bots.GET("/:id/tokens", botController.GetBotTokens)
+		bots.POST("/:id/tokens", botController.CreateBotToken)
+		bots.DELETE("/:id/tokens/:token_id", botController.RevokeBotToken)
+	}
+
+	verifications := r.Group("/api/verifications")
+	{
+		verifications.POST("/", middleware.AuthUserMiddleware(), verificationController.CreateRequest)
+		verifications.GET("/me", middleware.AuthUserMiddleware(), verificationController.GetMyRequests)
+		verifications.GET("/", middleware.RequirePermission(constants.PermVerificationsReview), verificationController.GetRequests)
+		verifications.POST("/:id/approve", middleware.RequirePermission(constants.PermVerificationsReview), verificationController.ApproveRequest)
+		verifications.POST("/:id/reject", middleware.RequirePermission(constants.PermVerificationsReview), verificationController.RejectRequest)
+	}
+
+	// saved posts, jobs and materials
+	bookmarks := r.Group("/api/bookmarks")
+	{
+		bookmarks.Use(middleware.AuthUserMiddleware())
+		bookmarks.GET("/", bookmarkController.GetBookmarks)
+		bookmarks.POST("/", bookmarkController.AddBookmark)
+		bookmarks.DELETE("/:type/:id", bookmarkController.RemoveBookmark)
+		bookmarks.GET("/folders", bookmarkController.GetFolders)
+		bookmarks.POST("/folders", bookmarkController.CreateFolder)
+		bookmarks.PUT("/folders/:id", bookmarkController.RenameFolder)
+		bookmarks.DELETE("/folders/:id", bookmarkController.DeleteFolder)
 	}
 
 	// notifications
 	notifications := r.Group("/api/notifications")
 	{
-		notifications.GET("/", middleware.AuthUserMiddleware(RoleAll), notificationController.GetNotifications)
+		notifications.GET("/", middleware.AuthUserMiddleware(), notificationController.GetNotifications)
 	}
 
 	r.GET("api/health", func(c *gin.Context) {
@@ -206,7 +324,10 @@ func SetupRoutes(
 		})
 	})
 
-	r.GET("/api/ws", middleware.AuthUserMiddleware(RoleAll), websocketController.Connect)
+	r.GET("/api/ws", middleware.AuthUserMiddleware(), websocketController.Connect)
+
+	// public keys for the services that verify our tokens
+	r.GET("/.well-known/jwks.json", middleware.JWKSHandler)
 
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "Server is running"})
@@ -2,13 +2,13 @@ package main
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"os"
 
+	"github.com/chera-mihiretu/IKnow/infrastructure/oauth"
 	"github.com/gorilla/sessions"
-	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
-	"github.com/markbates/goth/providers/google"
 	"google.golang.org/genai"
 )
 
@@ -26,15 +26,9 @@ func GothSetup() {
 
 	gothic.Store = store
 
-	goth.UseProviders(
-		google.New(
-			os.Getenv("GOOGLE_CLIENT_ID"),
-			os.Getenv("GOOGLE_CLIENT_SECRET"),
-			os.Getenv("BASE_URL")+"/api/auth/google/callback",
-			"email",
-			"profile",
-		),
-	)
+	if err := oauth.Setup(oauth.ConfigsFromEnv(), os.Getenv("BASE_URL")); err != nil {
+		log.Fatal("Could not set up the login providers: ", err)
+	}
 }
 
 func GeminiClient(ctx context.Context) (*genai.Client, error) {
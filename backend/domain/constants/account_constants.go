@@ -0,0 +1,9 @@
+package constants
+
+const (
+	// TypePurgeAccounts deletes the accounts whose deletion grace period is over, it runs on
+	// the accounts queue at the start of every hour
+	TypePurgeAccounts    = "account:purge"
+	AccountsQueue        = "accounts"
+	AccountPurgeCronSpec = "0 * * * *"
+)
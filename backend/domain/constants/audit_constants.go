@@ -0,0 +1,36 @@
+package constants
+
+// audit log actions
+const (
+	AuditAccountLocked   = "account_locked"
+	AuditAccountUnlocked = "account_unlocked"
+	AuditIPBlocked       = "ip_blocked"
+
+	AuditAccountDeletionScheduled = "account_deletion_scheduled"
+	AuditAccountDeletionCancelled = "account_deletion_cancelled"
+	AuditAccountDeleted           = "account_deleted"
+
+	AuditProviderLinked   = "provider_linked"
+	AuditProviderUnlinked = "provider_unlinked"
+
+	AuditAccessTokenCreated = "access_token_created"
+	AuditAccessTokenRevoked = "access_token_revoked"
+	AuditBotCreated         = "bot_created"
+	AuditBotDeleted         = "bot_deleted"
+
+	AuditImpersonationStarted = "impersonation_started"
+	AuditImpersonationEnded   = "impersonation_ended"
+	AuditImpersonatedRequest  = "impersonated_request"
+
+	AuditInvitationCreated  = "invitation_created"
+	AuditInvitationRevoked  = "invitation_revoked"
+	AuditInvitationsInvited = "invitations_bulk_invited"
+)
+
+// audit log target types
+const (
+	AuditTargetUser = "user"
+	AuditTargetIP   = "ip"
+
+	AuditTargetInvitation = "invitation"
+)
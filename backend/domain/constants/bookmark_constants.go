@@ -0,0 +1,8 @@
+package constants
+
+// the kinds of content a user can bookmark
+const (
+	BookmarkTypePost     = "post"
+	BookmarkTypeJob      = "job"
+	BookmarkTypeMaterial = "material"
+)
@@ -2,4 +2,14 @@ package constants
 
 const (
 	TypeSendEmail = "email:send"
+	// TypeSendInvitationEmail sends one invitation of a bulk invite, on the invitations queue
+	TypeSendInvitationEmail = "email:invitation"
+	InvitationsQueue        = "invitations"
+)
+
+const (
+	EmailChangeStatusPending   = "pending"
+	EmailChangeStatusConfirmed = "confirmed"
+	EmailChangeStatusReverted  = "reverted"
+	EmailChangeStatusReplaced  = "replaced" // a newer request was made before this one was confirmed
 )
@@ -15,6 +15,13 @@ const (
 	JobBlocked               NotificationType = "job-blocked"
 	JobDeleted               NotificationType = "job-deleted"
 	PostDeleted              NotificationType = "post-deleted"
+	VerificationApproved     NotificationType = "verification-approved"
+	VerificationRejected     NotificationType = "verification-rejected"
+	ConnectionPosted         NotificationType = "connection-posted"
+	ScheduledPostPublished   NotificationType = "scheduled-post-published"
+	MentionedYou             NotificationType = "mentioned-you"
+	RepostedYourPost         NotificationType = "reposted-post"
+	QuotedYourPost           NotificationType = "quoted-post"
 
 	// Notiication Messages
 	CommentedOnYourPostMessage      = "You have a new comment on your post."
@@ -29,6 +36,13 @@ const (
 	JobDeletedMessage               = "Your job post has been deleted because it violated our terms of service."
 	JobBlockedMessage               = "Your job post was blocked by an Content Validation System. We will review it and unblock it if it's valid."
 	PostDeletedMessage              = "Your post has been deleted because it violated our terms of service."
+	VerificationApprovedMessage     = "Your verification request was approved."
+	VerificationRejectedMessage     = "Your verification request was rejected."
+	ConnectionPostedMessage         = "One of your connections shared a new post."
+	ScheduledPostPublishedMessage   = "Your scheduled post has been published."
+	MentionedYouMessage             = "You were mentioned in a post or a comment."
+	RepostedYourPostMessage         = "Your post was reposted."
+	QuotedYourPostMessage           = "Your post was quoted in a new post."
 )
 
 func GetNotificationMessageBasedOnAction(action string) NotificationType {
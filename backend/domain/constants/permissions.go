@@ -0,0 +1,125 @@
+package constants
+
+// Permission is a named action a role can grant, written as resource:action
+type Permission string
+
+const (
+	PermPostsRead           Permission = "posts:read"
+	PermPostsWrite          Permission = "posts:write"
+	PermPostsVerify         Permission = "posts:verify"
+	PermCommentsWrite       Permission = "comments:write"
+	PermReportsCreate       Permission = "reports:create"
+	PermReportsRead         Permission = "reports:read"
+	PermReportsAct          Permission = "reports:act"
+	PermConnectionsManage   Permission = "connections:manage"
+	PermMaterialsRead       Permission = "materials:read"
+	PermMaterialsWrite      Permission = "materials:write"
+	PermDepartmentsWrite    Permission = "departments:write"
+	PermSchoolsWrite        Permission = "schools:write"
+	PermUniversitiesWrite   Permission = "universities:write"
+	PermJobsRead            Permission = "jobs:read"
+	PermJobsWrite           Permission = "jobs:write"
+	PermUsersAnalytics      Permission = "users:analytics"
+	PermAdminsEmail         Permission = "admins:email"
+	PermRolesManage         Permission = "roles:manage"
+	PermVerificationsReview Permission = "verifications:review"
+	PermBotsManage          Permission = "bots:manage"
+	PermUsersImpersonate    Permission = "users:impersonate"
+	PermInvitationsManage   Permission = "invitations:manage"
+)
+
+// AllPermissions lists every permission known to the platform, roles can only be built from these
+var AllPermissions = []Permission{
+	PermPostsRead,
+	PermPostsWrite,
+	PermPostsVerify,
+	PermCommentsWrite,
+	PermReportsCreate,
+	PermReportsRead,
+	PermReportsAct,
+	PermConnectionsManage,
+	PermMaterialsRead,
+	PermMaterialsWrite,
+	PermDepartmentsWrite,
+	PermSchoolsWrite,
+	PermUniversitiesWrite,
+	PermJobsRead,
+	PermJobsWrite,
+	PermUsersAnalytics,
+	PermAdminsEmail,
+	PermRolesManage,
+	PermVerificationsReview,
+	PermBotsManage,
+	PermUsersImpersonate,
+	PermInvitationsManage,
+}
+
+// IsTokenScope reports whether the permission can be granted to a personal access token,
+// managing roles and bots or impersonating users needs a logged in user
+func IsTokenScope(permission Permission) bool {
+	return IsValidPermission(permission) && permission != PermRolesManage &&
+		permission != PermBotsManage && permission != PermUsersImpersonate
+}
+
+// IsValidPermission reports whether the permission is one of AllPermissions
+func IsValidPermission(permission Permission) bool {
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+var memberPermissions = []Permission{
+	PermPostsRead,
+	PermPostsWrite,
+	PermCommentsWrite,
+	PermReportsCreate,
+	PermConnectionsManage,
+	PermMaterialsRead,
+	PermJobsRead,
+	PermJobsWrite,
+}
+
+var moderatorPermissions = []Permission{
+	PermPostsVerify,
+	PermReportsRead,
+	PermReportsAct,
+	PermMaterialsWrite,
+}
+
+var adminPermissions = append(append([]Permission{}, moderatorPermissions...),
+	PermDepartmentsWrite,
+	PermSchoolsWrite,
+	PermUniversitiesWrite,
+	PermUsersAnalytics,
+	PermVerificationsReview,
+	PermBotsManage,
+	PermInvitationsManage,
+)
+
+// bots post announcements and read the platform, anything more is granted with role assignments
+var botPermissions = []Permission{
+	PermPostsRead,
+	PermPostsWrite,
+	PermMaterialsRead,
+	PermJobsRead,
+	PermJobsWrite,
+}
+
+// DefaultRolePermissions is seeded into the roles collection when a role does not exist yet,
+// after that the stored permission sets are the source of truth and only permissions
+// added to these sets later are granted to the existing default roles
+var DefaultRolePermissions = map[UserRole][]Permission{
+	UserRoleStudent:             memberPermissions,
+	UserRoleTeacher:             memberPermissions,
+	UserRoleDepartmentModerator: moderatorPermissions,
+	UserRoleBot:                 botPermissions,
+	UserRoleAdmin:               append(append([]Permission{}, memberPermissions...), adminPermissions...),
+	UserRoleSuperAdmin: append(append(append([]Permission{}, memberPermissions...), adminPermissions...),
+		PermAdminsEmail,
+		PermRolesManage,
+		PermUsersImpersonate,
+	),
+}
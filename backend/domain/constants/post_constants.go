@@ -0,0 +1,23 @@
+package constants
+
+const (
+	// posts saved before this existed have no status and count as published
+	PostStatusPublished = "published"
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+)
+
+const (
+	// TypePublishPost publishes a scheduled post, it runs on the posts queue
+	TypePublishPost = "post:publish"
+	PostsQueue      = "posts"
+)
+
+const (
+	// posts saved before audiences existed have none and are public
+	PostAudiencePublic      = "public"
+	PostAudienceUniversity  = "university"
+	PostAudienceSchool      = "school"
+	PostAudienceDepartment  = "department"
+	PostAudienceConnections = "connections"
+)
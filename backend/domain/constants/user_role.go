@@ -12,4 +12,24 @@ const (
 	UserRoleTeacher UserRole = "teacher"
 	// UserRoleAdmin represents an admin user role
 	UserRoleAdmin UserRole = "admin"
+	// UserRoleDepartmentModerator represents a moderator role, it is meant to be
+	// assigned with a university, school or department scope
+	UserRoleDepartmentModerator UserRole = "department_moderator"
+	// UserRoleBot is the role of service accounts used by integrations, they only
+	// authenticate with personal access tokens
+	UserRoleBot UserRole = "bot"
+)
+
+// MFARequiredRoles can not log in without a second factor, users with these
+// roles are asked to enroll on their next login
+var MFARequiredRoles = map[UserRole]bool{
+	UserRoleSuperAdmin: true,
+	UserRoleAdmin:      true,
+}
+
+const (
+	// who can @mention a user, users without the setting can be mentioned by everyone
+	MentionsFromEveryone    = "everyone"
+	MentionsFromConnections = "connections"
+	MentionsFromNobody      = "nobody"
 )
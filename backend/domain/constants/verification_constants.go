@@ -0,0 +1,12 @@
+package constants
+
+const (
+	// a teacher request makes the user a teacher with a blue badge, a blue badge
+	// request only verifies the identity of the user
+	VerificationTypeTeacher   = "teacher"
+	VerificationTypeBlueBadge = "blue-badge"
+
+	VerificationStatusPending  = "pending"
+	VerificationStatusApproved = "approved"
+	VerificationStatusRejected = "rejected"
+)
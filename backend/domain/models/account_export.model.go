@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// AccountExport is everything stored about a user, it is what the data export endpoint returns
+type AccountExport struct {
+	ExportedAt           time.Time              `json:"exported_at"`
+	Profile              User                   `json:"profile"`
+	Posts                []Posts                `json:"posts"`
+	PostRevisions        []PostRevisions        `json:"post_revisions"`
+	PollVotes            []PollVotes            `json:"poll_votes"`
+	Comments             []Comments             `json:"comments"`
+	PostLikes            []Like                 `json:"post_likes"`
+	JobLikes             []Like                 `json:"job_likes"`
+	Connections          []Connects             `json:"connections"`
+	Notifications        []Notifications        `json:"notifications"`
+	Reports              []Report               `json:"reports"`
+	Jobs                 []Opportunities        `json:"jobs"`
+	Materials            []Materials            `json:"materials"`
+	Sessions             []Sessions             `json:"sessions"`
+	VerificationRequests []VerificationRequests `json:"verification_requests"`
+	RoleAssignments      []RoleAssignments      `json:"role_assignments"`
+	EmailChanges         []EmailChanges         `json:"email_changes"`
+	LinkedAccounts       []UserIdentities       `json:"linked_accounts"`
+	AccessTokens         []AccessTokens         `json:"access_tokens"`
+	HandleHistory        []HandleHistory        `json:"handle_history"`
+	Bookmarks            []Bookmarks            `json:"bookmarks"`
+	BookmarkFolders      []BookmarkFolders      `json:"bookmark_folders"`
+}
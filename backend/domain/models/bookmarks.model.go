@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Bookmarks is a post, job or material a user saved, in one of their folders or in none
+type Bookmarks struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	TargetType string              `bson:"target_type" json:"target_type" binding:"required"` // post, job or material
+	TargetID   primitive.ObjectID  `bson:"target_id" json:"target_id" binding:"required"`
+	FolderID   *primitive.ObjectID `bson:"folder_id,omitempty" json:"folder_id,omitempty"`
+	CreatedAt  time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// BookmarkFolders are the named collections a user sorts their bookmarks into
+type BookmarkFolders struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Name      string             `bson:"name" json:"name" binding:"required"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// BookmarkView is a bookmark with the content it points to, only the field of its type is set
+type BookmarkView struct {
+	ID         primitive.ObjectID  `json:"id"`
+	TargetType string              `json:"target_type"`
+	TargetID   primitive.ObjectID  `json:"target_id"`
+	FolderID   *primitive.ObjectID `json:"folder_id,omitempty"`
+	Post       *Posts              `json:"post,omitempty"`
+	Job        *Opportunities      `json:"job,omitempty"`
+	Material   *Materials          `json:"material,omitempty"`
+	CreatedAt  time.Time           `json:"created_at"`
+}
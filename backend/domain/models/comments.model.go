@@ -15,6 +15,7 @@ type Comments struct {
 	Like            int                 `json:"likes" bson:"likes"`
 	ParentCommentID *primitive.ObjectID `json:"parent_comment_id,omitempty" bson:"parent_comment_id,omitempty"`
 	Content         string              `json:"content" bson:"content"`
+	Mentions        []Mentions          `json:"mentions,omitempty" bson:"mentions,omitempty"`
 	CreatedAt       time.Time           `json:"created_at" bson:"created_at"`
 }
 
@@ -26,5 +27,6 @@ type CommentsView struct {
 	Like            int                 `json:"likes" bson:"likes"`
 	ParentCommentID *primitive.ObjectID `json:"parent_comment_id,omitempty" bson:"parent_comment_id,omitempty"`
 	Content         string              `json:"content" bson:"content"`
+	Mentions        []MentionView       `json:"mentions" bson:"mentions"`
 	CreatedAt       time.Time           `json:"created_at" bson:"created_at"`
 }
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EmailChanges defines the database model for the email_changes collection, only the
+// sha256 of the confirmation and revert tokens are stored
+type EmailChanges struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID          primitive.ObjectID `bson:"user_id" json:"user_id"`
+	OldEmail        string             `bson:"old_email" json:"old_email"`
+	NewEmail        string             `bson:"new_email" json:"new_email"`
+	TokenHash       string             `bson:"token_hash" json:"-"`
+	RevertTokenHash string             `bson:"revert_token_hash" json:"-"`
+	Status          string             `bson:"status" json:"status"`
+	ExpiresAt       time.Time          `bson:"expires_at" json:"expires_at"`               // of the confirmation link
+	RevertExpiresAt time.Time          `bson:"revert_expires_at" json:"revert_expires_at"` // of the revert link
+	ConfirmedAt     *time.Time         `bson:"confirmed_at,omitempty" json:"confirmed_at,omitempty"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+}
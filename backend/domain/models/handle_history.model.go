@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// HandleHistory is a handle a user had before, links to it redirect to the user for a while
+type HandleHistory struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Handle    string             `bson:"handle" json:"handle"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"` // when the user stopped using it
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ImpersonationSession is what an admin receives when starting to act as a user, the
+// access token lasts as long as the session and there is no refresh token
+type ImpersonationSession struct {
+	SessionID      primitive.ObjectID `json:"session_id"`
+	UserID         primitive.ObjectID `json:"user_id"`
+	ImpersonatorID primitive.ObjectID `json:"impersonator_id"`
+	Reason         string             `json:"reason"`
+	AllowWrites    bool               `json:"allow_writes"`
+	AccessToken    string             `json:"token,omitempty"`
+	ExpiresAt      time.Time          `json:"expires_at"`
+	CreatedAt      time.Time          `json:"created_at"`
+}
+
+// ImpersonatedRequest is one request made with an impersonation token, blocked ones included
+type ImpersonatedRequest struct {
+	ImpersonatorID string
+	UserID         string
+	SessionID      string
+	Method         string
+	Path           string
+	IPAddress      string
+	Blocked        bool
+}
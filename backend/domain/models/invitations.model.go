@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invitations defines the database model for the invitations collection, an invitation
+// places whoever redeems it in a university and optionally a school, department and year.
+// Invitations of a bulk invite are bound to one email and can be used once
+type Invitations struct {
+	ID           primitive.ObjectID  `bson:"_id" json:"id"`
+	Code         string              `bson:"code" json:"code"`
+	CreatedBy    primitive.ObjectID  `bson:"created_by" json:"created_by"`
+	UniversityID primitive.ObjectID  `bson:"university_id" json:"university_id"`
+	SchoolID     *primitive.ObjectID `bson:"school_id,omitempty" json:"school_id,omitempty"`
+	DepartmentID *primitive.ObjectID `bson:"department_id,omitempty" json:"department_id,omitempty"`
+	AcedemicYear int                 `bson:"acedemic_year,omitempty" json:"acedemic_year,omitempty"`
+	Email        string              `bson:"email,omitempty" json:"email,omitempty"`
+	MaxUses      int                 `bson:"max_uses" json:"max_uses"`
+	Uses         int                 `bson:"uses" json:"uses"`
+	ExpiresAt    time.Time           `bson:"expires_at" json:"expires_at"`
+	RevokedAt    *time.Time          `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// InvitationRedemptions records who used an invitation, at registration or from an existing account
+type InvitationRedemptions struct {
+	ID           primitive.ObjectID `bson:"_id" json:"id"`
+	InvitationID primitive.ObjectID `bson:"invitation_id" json:"invitation_id"`
+	UserID       primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Email        string             `bson:"email" json:"email"`
+	RedeemedAt   time.Time          `bson:"redeemed_at" json:"redeemed_at"`
+}
+
+// InvitationPreview is what the sign up page shows about a code before it is used
+type InvitationPreview struct {
+	UniversityID primitive.ObjectID  `json:"university_id"`
+	SchoolID     *primitive.ObjectID `json:"school_id,omitempty"`
+	DepartmentID *primitive.ObjectID `json:"department_id,omitempty"`
+	AcedemicYear int                 `json:"acedemic_year,omitempty"`
+	Email        string              `json:"email,omitempty"`
+	ExpiresAt    time.Time           `json:"expires_at"`
+}
+
+// InvitationEmail is the payload of the invitation email task
+type InvitationEmail struct {
+	To        string    `json:"to"`
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// BulkInviteSkip is a row of a bulk invite that got no invitation
+type BulkInviteSkip struct {
+	Row    int    `json:"row"`
+	Email  string `json:"email"`
+	Reason string `json:"reason"`
+}
+
+// BulkInviteResult tells how many invitations were queued and why the other rows were skipped
+type BulkInviteResult struct {
+	Invited int              `json:"invited"`
+	Skipped []BulkInviteSkip `json:"skipped"`
+}
@@ -26,6 +26,7 @@ type OpportunitiesView struct {
 	Like          int64                `bson:"like" json:"like"`
 	Description   string               `bson:"description" json:"description"`
 	Liked         bool                 `bson:"liked" json:"liked"`
+	Saved         bool                 `bson:"saved" json:"saved"`
 	Link          string               `bson:"link" json:"link"`
 	Type          string               `bson:"type" json:"type"` // internship or job
 	PostedBy      UserView             `bson:"user" json:"user"`
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LoginFailure is the state of the brute force counters after a failed login,
+// AccountLocked and IPBlocked are only set by the failure that crossed the threshold
+type LoginFailure struct {
+	AccountFailures int64
+	IPFailures      int64
+	AccountLocked   bool
+	IPBlocked       bool
+	LockedUntil     time.Time
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Mentions is an @handle in a post or a comment that was resolved to a user, the offset
+// and length count the characters of the content from the @
+type Mentions struct {
+	UserID primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Handle string             `bson:"handle" json:"handle"`
+	Offset int                `bson:"offset" json:"offset"`
+	Length int                `bson:"length" json:"length"`
+}
+
+type MentionView struct {
+	User   UserView `json:"user"`
+	Handle string   `json:"handle"`
+	Offset int      `json:"offset"`
+	Length int      `json:"length"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MFAChallenges defines the database model for the mfa_challenges collection
+// a challenge is created once the password is checked and is exchanged for a session
+// after the second factor; it is single use and only accepts a few wrong codes
+type MFAChallenges struct {
+	ID                 primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID             primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Token              string             `bson:"token" json:"-"` // sha256 of the challenge token
+	EnrollmentRequired bool               `bson:"enrollment_required" json:"enrollment_required"`
+	Attempts           int                `bson:"attempts" json:"attempts"`
+	Used               bool               `bson:"used" json:"used"`
+	ExpiresAt          time.Time          `bson:"expires_at" json:"expires_at"`
+	CreatedAt          time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// MFAChallenge is sent to the client instead of the tokens when a second factor is needed
+type MFAChallenge struct {
+	Token              string    `json:"mfa_token"`
+	EnrollmentRequired bool      `json:"enrollment_required"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+// LoginResult holds either the tokens of a new session or the challenge to complete first
+type LoginResult struct {
+	Tokens    *AuthTokens
+	Challenge *MFAChallenge
+}
+
+// TOTPEnrollment is what the client needs to register the account in an authenticator app
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
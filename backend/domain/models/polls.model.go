@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Polls is attached to a post, the tallies are kept on it and the votes in poll_votes
+type Polls struct {
+	Question       string        `bson:"question" json:"question"`
+	Options        []PollOptions `bson:"options" json:"options"`
+	MultipleChoice bool          `bson:"multiple_choice" json:"multiple_choice"`
+	Anonymous      bool          `bson:"anonymous" json:"anonymous"`
+	ClosesAt       *time.Time    `bson:"closes_at,omitempty" json:"closes_at,omitempty"`
+	Voters         int           `bson:"voters" json:"voters"`
+}
+
+type PollOptions struct {
+	Text  string `bson:"text" json:"text"`
+	Votes int    `bson:"votes" json:"votes"`
+}
+
+// PollVotes is the vote of one user, the options are the indexes of the chosen options
+type PollVotes struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PostID    primitive.ObjectID `bson:"post_id" json:"post_id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Options   []int              `bson:"options" json:"options"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type PollView struct {
+	Question       string        `json:"question"`
+	Options        []PollOptions `json:"options"`
+	MultipleChoice bool          `json:"multiple_choice"`
+	Anonymous      bool          `json:"anonymous"`
+	ClosesAt       *time.Time    `json:"closes_at,omitempty"`
+	Closed         bool          `json:"closed"`
+	Voters         int           `json:"voters"`
+	Voted          []int         `json:"voted"` // the options the viewer chose, empty if they did not vote
+}
+
+// PollUpdate is pushed on the socket to the viewers of the post after each vote
+type PollUpdate struct {
+	Type    string             `json:"type"`
+	PostID  primitive.ObjectID `json:"post_id"`
+	Options []PollOptions      `json:"options"`
+	Voters  int                `json:"voters"`
+}
+
+// PollVoters lists who chose an option of a poll that is not anonymous
+type PollVoters struct {
+	Option int        `json:"option"`
+	Users  []UserView `json:"users"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PostRevisions keeps the content a post had before an edit or before it was removed, they are
+// never updated and stay when the post is gone so moderation can still read them
+type PostRevisions struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PostID          primitive.ObjectID `bson:"post_id" json:"post_id"`
+	UserID          primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Revision        int                `bson:"revision" json:"revision"`
+	Content         string             `bson:"content" json:"content"`
+	PostAttachments []string           `bson:"post_attachments" json:"post_attachments"`
+	IsValidated     bool               `bson:"is_validated" json:"is_validated"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"` // when this content was replaced
+	RemovedAt       *time.Time         `bson:"removed_at,omitempty" json:"removed_at,omitempty"`
+}
@@ -8,19 +8,41 @@ import (
 
 // Posts defines the database model for the posts collection
 type Posts struct {
-	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id" form:"id"`
-	UserID          primitive.ObjectID `bson:"user_id" json:"user_id" form:"user_id"`
-	Content         string             `bson:"content" json:"content" form:"content"`
-	PostAttachments []string           `bson:"post_attachments" json:"post_attachments" form:"post_attachments"`
-	IsAnnouncement  bool               `bson:"is_announcement" json:"is_announcement" form:"is_announcement"`
-	IsValidated     bool               `bson:"is_validated" json:"is_validated" form:"is_validated"`
-	IsFlagged       bool               `bson:"is_flagged" json:"is_flagged" form:"is_flagged"`
-	Likes           int                `bson:"likes" json:"likes" form:"likes"`
-	Comments        int                `bson:"comments" json:"comments" form:"comments"`
-	Departements    []string           `bson:"department_id" json:"department_id" form:"department_id" `
-	Tags            []string           `bson:"tags" json:"tags" form:"tags"`
-	CreatedAt       time.Time          `bson:"created_at" json:"created_at" form:"created_at"`
-	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at" form:"updated_at"`
+	ID              primitive.ObjectID   `bson:"_id,omitempty" json:"id" form:"id"`
+	UserID          primitive.ObjectID   `bson:"user_id" json:"user_id" form:"user_id"`
+	Content         string               `bson:"content" json:"content" form:"content"`
+	PostAttachments []string             `bson:"post_attachments" json:"post_attachments" form:"post_attachments"`
+	IsAnnouncement  bool                 `bson:"is_announcement" json:"is_announcement" form:"is_announcement"`
+	IsValidated     bool                 `bson:"is_validated" json:"is_validated" form:"is_validated"`
+	IsFlagged       bool                 `bson:"is_flagged" json:"is_flagged" form:"is_flagged"`
+	Likes           int                  `bson:"likes" json:"likes" form:"likes"`
+	Comments        int                  `bson:"comments" json:"comments" form:"comments"`
+	Departements    []string             `bson:"department_id" json:"department_id" form:"department_id" `
+	Tags            []string             `bson:"tags" json:"tags" form:"tags"`
+	AuthorTags      []string             `bson:"author_tags,omitempty" json:"-" form:"-"` // the tags the author gave, kept when the post is edited
+	Revisions       int                  `bson:"revisions" json:"revisions" form:"-"`
+	Status          string               `bson:"status,omitempty" json:"status,omitempty" form:"status"` // draft, scheduled or published
+	PublishAt       *time.Time           `bson:"publish_at,omitempty" json:"publish_at,omitempty" form:"publish_at" time_format:"2006-01-02T15:04:05Z07:00"`
+	Poll            *Polls               `bson:"poll,omitempty" json:"poll,omitempty" form:"-"`
+	Mentions        []Mentions           `bson:"mentions,omitempty" json:"mentions,omitempty" form:"-"`
+	Audience        string               `bson:"audience,omitempty" json:"audience,omitempty" form:"audience"`  // public, university, school, department or connections
+	AudienceIDs     []primitive.ObjectID `bson:"audience_ids,omitempty" json:"audience_ids,omitempty" form:"-"` // the university, school or departments the post is for
+	RepostOf        *primitive.ObjectID  `bson:"repost_of,omitempty" json:"repost_of,omitempty" form:"-"`       // a repost without content is a plain repost, with content a quote
+	Reposts         int                  `bson:"reposts" json:"reposts" form:"-"`
+	EditedAt        *time.Time           `bson:"edited_at,omitempty" json:"edited_at,omitempty" form:"-"`
+	CreatedAt       time.Time            `bson:"created_at" json:"created_at" form:"created_at"`
+	UpdatedAt       time.Time            `bson:"updated_at" json:"updated_at" form:"updated_at"`
+}
+
+// IsPlainRepost is true for a repost that adds nothing to the post it reposts
+func (p Posts) IsPlainRepost() bool {
+	return p.RepostOf != nil && p.Content == ""
+}
+
+// CountsAsRepost is true for a repost counted on the post it reposts, a quote only counts
+// once it passed moderation
+func (p Posts) CountsAsRepost() bool {
+	return p.RepostOf != nil && p.IsValidated
 }
 
 type PostView struct {
@@ -33,6 +55,25 @@ type PostView struct {
 	IsFlagged       bool               `bson:"is_flagged" json:"is_flagged"`
 	Likes           int                `bson:"likes" json:"likes"`
 	Liked           bool               `bson:"liked" json:"liked"`
+	Saved           bool               `bson:"saved" json:"saved"`
 	Comments        int                `bson:"comments" json:"comments"`
+	Tags            []string           `bson:"tags" json:"tags"`
+	Edited          bool               `bson:"edited" json:"edited"`
+	Status          string             `bson:"status,omitempty" json:"status,omitempty"`
+	PublishAt       *time.Time         `bson:"publish_at,omitempty" json:"publish_at,omitempty"`
+	EditedAt        *time.Time         `bson:"edited_at,omitempty" json:"edited_at,omitempty"`
+	Poll            *PollView          `bson:"poll,omitempty" json:"poll,omitempty"`
+	Mentions        []MentionView      `bson:"mentions" json:"mentions"`
+	Audience        string             `bson:"audience" json:"audience"`
+	Reposts         int                `bson:"reposts" json:"reposts"`
+	Reposted        bool               `bson:"reposted" json:"reposted"`
+	RepostOf        *PostView          `bson:"repost_of,omitempty" json:"repost_of,omitempty"`
 	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
 }
+
+// PublishPostTask is the payload of the task publishing a scheduled post, a task whose
+// publish time no longer matches the post was rescheduled or cancelled and does nothing
+type PublishPostTask struct {
+	PostID    primitive.ObjectID `json:"post_id"`
+	PublishAt time.Time          `json:"publish_at"`
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Roles defines the database model for the roles collection
+// a role is a named set of permissions, users.role holds the name of the global role of a user
+type Roles struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        string             `bson:"name" json:"name" binding:"required"`
+	Description string             `bson:"description" json:"description"`
+	Permissions []string           `bson:"permissions" json:"permissions"`
+	// KnownPermissions is every permission that existed when a default role was last seeded,
+	// only permissions added to the code after that are granted on the next start
+	KnownPermissions []string  `bson:"known_permissions,omitempty" json:"-"`
+	CreatedAt        time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// RoleAssignments defines the database model for the role_assignments collection
+// an assignment grants a role on top of the global one, limited to the given scope;
+// leaving every scope field empty makes the assignment global
+type RoleAssignments struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID       primitive.ObjectID  `bson:"user_id" json:"user_id" binding:"required"`
+	Role         string              `bson:"role" json:"role" binding:"required"`
+	UniversityID *primitive.ObjectID `bson:"university_id,omitempty" json:"university_id,omitempty"`
+	SchoolID     *primitive.ObjectID `bson:"school_id,omitempty" json:"school_id,omitempty"`
+	DepartmentID *primitive.ObjectID `bson:"department_id,omitempty" json:"department_id,omitempty"`
+	AssignedBy   primitive.ObjectID  `bson:"assigned_by" json:"assigned_by"`
+	CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// IsGlobal reports whether the assignment is not limited to any scope
+func (a RoleAssignments) IsGlobal() bool {
+	return a.UniversityID == nil && a.SchoolID == nil && a.DepartmentID == nil
+}
+
+// AccessScope is where a permission holds, scoped grants are resolved down to departments
+// since that is what posts and materials are attached to. The schools and universities the
+// grants cover whole are kept for what is bound to them, such as invitations
+type AccessScope struct {
+	Global        bool                 `json:"global"`
+	UniversityIDs []primitive.ObjectID `json:"university_ids,omitempty"`
+	SchoolIDs     []primitive.ObjectID `json:"school_ids,omitempty"`
+	DepartmentIDs []primitive.ObjectID `json:"department_ids"`
+}
+
+// AllowsUniversity reports whether the whole university is inside the scope
+func (s AccessScope) AllowsUniversity(universityID primitive.ObjectID) bool {
+	return s.Global || containsID(s.UniversityIDs, universityID)
+}
+
+// AllowsSchool reports whether the whole school is inside the scope
+func (s AccessScope) AllowsSchool(schoolID primitive.ObjectID) bool {
+	return s.Global || containsID(s.SchoolIDs, schoolID)
+}
+
+// AllowsDepartment reports whether the department is inside the scope
+func (s AccessScope) AllowsDepartment(departmentID primitive.ObjectID) bool {
+	if s.Global {
+		return true
+	}
+	return containsID(s.DepartmentIDs, departmentID)
+}
+
+// AllowsAnyDepartment reports whether at least one of the departments (in hex) is inside the scope
+func (s AccessScope) AllowsAnyDepartment(departmentIDs []string) bool {
+	if s.Global {
+		return true
+	}
+	for _, hex := range departmentIDs {
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			continue
+		}
+		if s.AllowsDepartment(id) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
@@ -7,11 +7,51 @@ import (
 )
 
 // Sessions defines the database model for the sessions collection
+// a session is one login (one refresh token family); the refresh token is rotated on every use
 type Sessions struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	UserID       primitive.ObjectID `bson:"user_id" json:"user_id"`
-	JWTToken     string             `bson:"jwt_token" json:"jwt_token"`
-	RefreshToken string             `bson:"refresh_token" json:"refresh_token"`
-	ExpiresAt    time.Time          `bson:"expires_at" json:"expires_at"`
-	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID            primitive.ObjectID `bson:"user_id" json:"user_id"`
+	RefreshToken      string             `bson:"refresh_token" json:"-"`       // sha256 of the current refresh token
+	UsedRefreshTokens []string           `bson:"used_refresh_tokens" json:"-"` // sha256 of already rotated refresh tokens
+	Device            string             `bson:"device" json:"device"`
+	UserAgent         string             `bson:"user_agent" json:"user_agent"`
+	IPAddress         string             `bson:"ip_address" json:"ip_address"`
+	LastSeenAt        time.Time          `bson:"last_seen_at" json:"last_seen_at"`
+	Revoked           bool               `bson:"revoked" json:"revoked"`
+	RevokedAt         *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	ExpiresAt         time.Time          `bson:"expires_at" json:"expires_at"`
+	CreatedAt         time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt         time.Time          `bson:"updated_at" json:"updated_at"`
+
+	// set on the sessions an admin opened to act as the user, they can not be refreshed
+	ImpersonatorID      *primitive.ObjectID `bson:"impersonator_id,omitempty" json:"impersonator_id,omitempty"`
+	ImpersonationReason string              `bson:"impersonation_reason,omitempty" json:"impersonation_reason,omitempty"`
+	AllowWrites         bool                `bson:"allow_writes,omitempty" json:"allow_writes,omitempty"`
+}
+
+// SessionDevice describes the client a session was opened from
+type SessionDevice struct {
+	Device    string `json:"device"`
+	UserAgent string `json:"user_agent"`
+	IPAddress string `json:"ip_address"`
+}
+
+// SessionView is what a user sees when listing their active sessions
+type SessionView struct {
+	ID        primitive.ObjectID `json:"id"`
+	Device    string             `json:"device"`
+	UserAgent string             `json:"user_agent"`
+	IPAddress string             `json:"ip_address"`
+	Current   bool               `json:"current"`
+	// Impersonated tells the user an admin opened this session to look at the account
+	Impersonated bool      `json:"impersonated,omitempty"`
+	LastSeenAt   time.Time `json:"last_seen_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AuthTokens is what the client receives after a successful login or refresh
+type AuthTokens struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
 }
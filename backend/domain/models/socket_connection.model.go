@@ -1,9 +1,29 @@
 package models
 
-import "github.com/gorilla/websocket"
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
 
 type SocketConnection struct {
 	UserID    string          `json:"user_id"`
 	Conn      *websocket.Conn `json:"conn"`
 	Broadcast chan *Notifications
+
+	writeMutex sync.Mutex
+}
+
+// WriteJSON writes one message at a time, notifications and live updates can be sent
+// to the same connection together
+func (s *SocketConnection) WriteJSON(message interface{}) error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	return s.Conn.WriteJSON(message)
+}
+
+// SocketSubscription is what a client sends on the socket to get the live updates of a post
+type SocketSubscription struct {
+	Action string `json:"action"` // subscribe or unsubscribe
+	PostID string `json:"post_id"`
 }
@@ -7,10 +7,11 @@ import (
 )
 
 type University struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name      string             `bson:"name" json:"name"`
-	City      string             `bson:"city" json:"country"`
-	CreatedBy primitive.ObjectID `bson:"created_by" json:"created_by"`
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name         string             `bson:"name" json:"name"`
+	City         string             `bson:"city" json:"country"`
+	EmailDomains []string           `bson:"email_domains" json:"email_domains"` // sub domains of these match too
+	CreatedBy    primitive.ObjectID `bson:"created_by" json:"created_by"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
 }
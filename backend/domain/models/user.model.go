@@ -10,6 +10,7 @@ import (
 type User struct {
 	ID              primitive.ObjectID  `json:"id" bson:"_id"`
 	Name            string              `json:"name" bson:"name"`
+	Handle          string              `json:"handle,omitempty" bson:"handle,omitempty"`
 	Email           string              `json:"email" bson:"email"`
 	GoogleID        string              `json:"google_id" bson:"google_id"`
 	PasswordHash    string              `json:"password" bson:"password_hash"`
@@ -24,13 +25,33 @@ type User struct {
 	IsVerified      bool                `json:"is_verified" bson:"is_verified"`
 	IsTeacher       bool                `json:"is_teacher" bson:"is_teacher"`
 	BlueBadge       bool                `json:"blue_badge" bson:"blue_badge"`
-	CreatedAt       time.Time           `json:"created_at" bson:"created_at"`
-	UpdatedAt       time.Time           `json:"updated_at" bson:"updated_at"`
+	MentionsFrom    string              `json:"mentions_from,omitempty" bson:"mentions_from,omitempty"`
+	// two factor authentication, the secrets and recovery codes never leave the server
+	TwoFactorEnabled       bool     `json:"two_factor_enabled" bson:"two_factor_enabled"`
+	TwoFactorSecret        string   `json:"-" bson:"two_factor_secret,omitempty"`
+	TwoFactorPendingSecret string   `json:"-" bson:"two_factor_pending_secret,omitempty"`
+	TwoFactorLastStep      int64    `json:"-" bson:"two_factor_last_step,omitempty"`
+	RecoveryCodes          []string `json:"-" bson:"recovery_codes,omitempty"` // sha256 of the unused recovery codes
+	// bots are service accounts of integrations, they can not log in and only use access tokens
+	IsBot      bool                `json:"is_bot,omitempty" bson:"is_bot,omitempty"`
+	BotOwnerID *primitive.ObjectID `json:"bot_owner_id,omitempty" bson:"bot_owner_id,omitempty"`
+	// InviteCode is read from the sign up request and kept on the unverified user until the
+	// email is verified, InvitationID is the invitation it redeemed
+	InviteCode   string              `json:"invite_code,omitempty" bson:"invite_code,omitempty"`
+	InvitationID *primitive.ObjectID `json:"invitation_id,omitempty" bson:"invitation_id,omitempty"`
+	// the account is purged once this passes, unless the user cancels the deletion
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty" bson:"deletion_scheduled_at,omitempty"`
+	HandleChangedAt     *time.Time `json:"handle_changed_at,omitempty" bson:"handle_changed_at,omitempty"`
+	// set when a hijacked email change is reverted, the password can not log in until it is reset
+	PasswordResetRequired bool      `json:"-" bson:"password_reset_required,omitempty"`
+	CreatedAt             time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at" bson:"updated_at"`
 }
 
 type UserView struct {
 	ID              primitive.ObjectID  `json:"id" bson:"_id"`
 	Name            string              `json:"name" bson:"name"`
+	Handle          string              `json:"handle,omitempty" bson:"handle,omitempty"`
 	Email           string              `json:"email" bson:"email"`
 	GoogleID        string              `json:"google_id" bson:"google_id"`
 	FollowCount     int                 `json:"follow_count" bson:"follow_count"`
@@ -42,6 +63,14 @@ type UserView struct {
 	IsComplete      bool                `json:"is_complete" bson:"is_complete"`
 	IsTeacher       bool                `json:"is_teacher" bson:"is_teacher"`
 	BlueBadge       bool                `json:"blue_badge" bson:"blue_badge"`
+	IsBot           bool                `json:"is_bot,omitempty" bson:"is_bot,omitempty"`
+	MentionsFrom    string              `json:"mentions_from,omitempty" bson:"mentions_from,omitempty"`
 	CreatedAt       time.Time           `json:"created_at" bson:"created_at"`
 	UpdatedAt       time.Time           `json:"updated_at" bson:"updated_at"`
 }
+
+// MeView is the profile the logged in user sees of themselves, with what other users must not see
+type MeView struct {
+	UserView            `bson:",inline"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty" bson:"deletion_scheduled_at,omitempty"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserIdentities defines the database model for the user_identities collection, one
+// document for every login provider account linked to a user
+type UserIdentities struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Provider       string             `bson:"provider" json:"provider"`
+	ProviderUserID string             `bson:"provider_user_id" json:"-"`
+	Email          string             `bson:"email" json:"email"`
+	EmailVerified  bool               `bson:"email_verified" json:"email_verified"`
+	Name           string             `bson:"name,omitempty" json:"name,omitempty"`
+	AvatarURL      string             `bson:"avatar_url,omitempty" json:"avatar_url,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+	LastUsedAt     time.Time          `bson:"last_used_at" json:"last_used_at"`
+}
+
+// ProviderLinks defines the database model for the provider_links collection, a started
+// link of a login provider that the callback of the provider can finish once
+type ProviderLinks struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Provider  string             `bson:"provider" json:"provider"`
+	NonceHash string             `bson:"nonce_hash" json:"-"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
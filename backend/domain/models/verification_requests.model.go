@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// VerificationRequests defines the database model for the verification_requests collection
+type VerificationRequests struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID       primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	Type         string              `bson:"type" json:"type"`
+	Message      string              `bson:"message" json:"message"`
+	EvidenceURLs []string            `bson:"evidence_urls" json:"evidence_urls"`
+	Status       string              `bson:"status" json:"status"`
+	ReviewNotes  string              `bson:"review_notes,omitempty" json:"review_notes,omitempty"`
+	ReviewedBy   *primitive.ObjectID `bson:"reviewed_by,omitempty" json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time          `bson:"reviewed_at,omitempty" json:"reviewed_at,omitempty"`
+	CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+type VerificationRequestView struct {
+	ID           primitive.ObjectID  `json:"id"`
+	User         UserView            `json:"user"`
+	Type         string              `json:"type"`
+	Message      string              `json:"message"`
+	EvidenceURLs []string            `json:"evidence_urls"`
+	Status       string              `json:"status"`
+	ReviewNotes  string              `json:"review_notes,omitempty"`
+	ReviewedBy   *primitive.ObjectID `json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time          `json:"reviewed_at,omitempty"`
+	CreatedAt    time.Time           `json:"created_at"`
+}
@@ -0,0 +1,152 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// accountEmailTemplate is the layout of the account security emails, it takes
+// the title, the message, the button link, the button text and the footer note
+const accountEmailTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>IKnow - %[1]s</title>
+</head>
+<body style="margin: 0; padding: 0; font-family: Arial, sans-serif; background-color: #f4f4f4;">
+	<table role="presentation" cellspacing="0" cellpadding="0" border="0" width="100%%" style="background-color: #f4f4f4;">
+		<tr>
+			<td align="center" style="padding: 40px 20px;">
+				<table role="presentation" cellspacing="0" cellpadding="0" border="0" width="600" style="max-width: 600px; background-color: #ffffff; border-radius: 12px; box-shadow: 0 4px 20px rgba(0,0,0,0.1); overflow: hidden;">
+					<tr>
+						<td style="height: 6px; background: linear-gradient(90deg, #9333ea 0%%, #3b82f6 100%%);"></td>
+					</tr>
+					<tr>
+						<td style="padding: 40px 40px 20px 40px; text-align: center;">
+							<div style="width: 80px; height: 80px; background: linear-gradient(135deg, #9333ea 0%%, #3b82f6 100%%); border-radius: 20px; display: inline-block; margin-bottom: 24px; line-height: 80px; font-size: 32px; font-weight: bold; color: white; font-family: Arial, sans-serif;">
+								IK
+							</div>
+							<h1 style="margin: 0 0 16px 0; font-size: 32px; font-weight: 700; color: #1f2937; font-family: Arial, sans-serif;">%[1]s</h1>
+							<p style="margin: 0; font-size: 18px; color: #6b7280; line-height: 1.6; font-family: Arial, sans-serif;">%[2]s</p>
+						</td>
+					</tr>
+					<tr>
+						<td style="padding: 0 40px 30px 40px; text-align: center;">
+							<a href="%[3]s" style="display: inline-block; background: linear-gradient(135deg, #9333ea 0%%, #3b82f6 100%%); color: white; font-size: 16px; font-weight: 600; padding: 16px 32px; text-decoration: none; border-radius: 12px; font-family: Arial, sans-serif;">%[4]s</a>
+						</td>
+					</tr>
+					<tr>
+						<td style="padding: 30px 40px 40px 40px; border-top: 1px solid #e5e7eb; text-align: center;">
+							<p style="margin: 0; font-size: 14px; color: #9ca3af; line-height: 1.5; font-family: Arial, sans-serif;">%[5]s</p>
+						</td>
+					</tr>
+				</table>
+			</td>
+		</tr>
+	</table>
+</body>
+</html>`
+
+func SendAccountLockedEmail(to, token string) error {
+	base_url := os.Getenv("BASE_URL")
+
+	subject := "Your account was temporarily locked - IKnow"
+	body := fmt.Sprintf(accountEmailTemplate,
+		"Account Locked",
+		"We noticed too many failed login attempts on your IKnow account, so we locked it for a while to keep it safe. If this was you, you can unlock it right away.",
+		fmt.Sprintf("%s/api/auth/email/unlock?token=%s", base_url, token),
+		"Unlock My Account",
+		"If this wasn't you, someone may be guessing your password. Consider resetting it once the account is unlocked.",
+	)
+
+	return sendAccountEmail(to, subject, body)
+}
+
+func SendEmailChangeConfirmationEmail(to, token string) error {
+	base_url := os.Getenv("BASE_URL")
+
+	subject := "Confirm your new email address - IKnow"
+	body := fmt.Sprintf(accountEmailTemplate,
+		"Confirm Your Email",
+		"You asked to use this address for your IKnow account. Confirm it and we will switch your account over to it.",
+		fmt.Sprintf("%s/api/auth/email/change/confirm?token=%s", base_url, token),
+		"Confirm New Email",
+		"If you didn't ask for this, you can safely ignore this email. This link will expire in 24 hours.",
+	)
+
+	return sendAccountEmail(to, subject, body)
+}
+
+func SendEmailChangeNoticeEmail(to, newEmail, token string) error {
+	base_url := os.Getenv("BASE_URL")
+
+	subject := "Your email address is being changed - IKnow"
+	body := fmt.Sprintf(accountEmailTemplate,
+		"Email Change Requested",
+		fmt.Sprintf("Someone asked to change the email of your IKnow account to %s. The change happens once the new address is confirmed.", html.EscapeString(newEmail)),
+		fmt.Sprintf("%s/api/auth/email/change/revert?token=%s", base_url, token),
+		"This Wasn't Me",
+		"If this wasn't you, use the button to keep this address and sign out every device. The link works for 7 days, even after the change.",
+	)
+
+	return sendAccountEmail(to, subject, body)
+}
+
+func SendMagicLinkEmail(to, token string) error {
+	front_url := os.Getenv("FRONT_BASE_URL")
+
+	subject := "Your login link - IKnow"
+	body := fmt.Sprintf(accountEmailTemplate,
+		"Log In to IKnow",
+		"Use the button below to log in to your IKnow account, no password needed.",
+		fmt.Sprintf("%s/auth/magic-link?token=%s", front_url, url.QueryEscape(token)),
+		"Log In",
+		"The link works once and expires in 15 minutes. If you didn't ask for it, you can safely ignore this email.",
+	)
+
+	return sendAccountEmail(to, subject, body)
+}
+
+// InvitationLink is the sign up page with the code filled in
+func InvitationLink(code string) string {
+	return fmt.Sprintf("%s/auth/register?invite=%s", os.Getenv("FRONT_BASE_URL"), url.QueryEscape(code))
+}
+
+func SendInvitationEmail(to, code string, expiresAt time.Time) error {
+	subject := "You are invited to join IKnow"
+	body := fmt.Sprintf(accountEmailTemplate,
+		"Join Your Campus on IKnow",
+		"Your university invited you to IKnow. Sign up with this email address and your school, department and year are set up for you.",
+		InvitationLink(code),
+		"Accept Invitation",
+		fmt.Sprintf("Your invitation code is %s, it expires on %s. If you weren't expecting it, you can safely ignore this email.", html.EscapeString(code), expiresAt.Format("January 2, 2006")),
+	)
+
+	return sendAccountEmail(to, subject, body)
+}
+
+func sendAccountEmail(to, subject, body string) error {
+	from := os.Getenv("EMAIL")
+	email_password := os.Getenv("EMAIL_PASSWORD")
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", from)
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/html", body)
+
+	d := gomail.NewDialer("smtp.gmail.com", 587, from, email_password)
+
+	if err := d.DialAndSend(m); err != nil {
+		return errors.New("infrastructure/account_emails.go: " + err.Error())
+	}
+
+	return nil
+}
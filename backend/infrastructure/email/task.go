@@ -1,6 +1,7 @@
 package email
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"time"
@@ -8,8 +9,12 @@ import (
 	"github.com/chera-mihiretu/IKnow/domain/constants"
 	"github.com/chera-mihiretu/IKnow/domain/models"
 	"github.com/hibiken/asynq"
+	"golang.org/x/time/rate"
 )
 
+// invitationLimiter keeps a bulk invite from sending faster than the mail server accepts
+var invitationLimiter = rate.NewLimiter(rate.Limit(5), 5)
+
 func NewSendEmailTask(to, subject, body string) (*asynq.Task, error) {
 	payload, err := json.Marshal(models.Email{
 		To:      to,
@@ -26,3 +31,34 @@ func NewSendEmailTask(to, subject, body string) (*asynq.Task, error) {
 	return t, nil
 
 }
+
+// NewSendInvitationEmailTask queues the invitation email of one bulk invite row
+func NewSendInvitationEmailTask(to, code string, expiresAt time.Time) (*asynq.Task, error) {
+	payload, err := json.Marshal(models.InvitationEmail{
+		To:        to,
+		Code:      code,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		log.Println("Failed to marshal invitation email payload:", err)
+		return nil, err
+	}
+
+	return asynq.NewTask(constants.TypeSendInvitationEmail, payload, asynq.MaxRetry(5), asynq.Timeout(30*time.Second)), nil
+}
+
+// HandleInvitationEmailTask sends the invitation email queued by NewSendInvitationEmailTask
+func HandleInvitationEmailTask(ctx context.Context, t *asynq.Task) error {
+	var p models.InvitationEmail
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return err
+	}
+	if err := invitationLimiter.Wait(ctx); err != nil {
+		return err
+	}
+	if err := SendInvitationEmail(p.To, p.Code, p.ExpiresAt); err != nil {
+		return err
+	}
+	log.Printf("Invitation sent to %s", p.To)
+	return nil
+}
@@ -2,87 +2,147 @@ package middleware
 
 import (
 	"errors"
-	"os"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
+const (
+	// AccessTokenTTL is kept short, clients use the refresh token to get a new one
+	AccessTokenTTL = 15 * time.Minute
+	// MagicLinkTTL is how long an emailed login link works, it can only be used once
+	MagicLinkTTL = 15 * time.Minute
+
+	magicLinkPurpose = "magic-login"
+)
+
 type Claims struct {
-	ID   string `json:"id"`
-	Role string `json:"role"`
+	ID        string `json:"id"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	// Actor is set on impersonation tokens, it is the admin acting as the user
+	Actor *ActorClaim `json:"act,omitempty"`
+	// AllowWrites lets an impersonation token make changes other than deletes
+	AllowWrites bool `json:"imp_writes,omitempty"`
 	jwt.StandardClaims
 }
 
-func GenerateJWT(user_id string, role string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// ActorClaim is the "act" claim of RFC 8693, the party acting on behalf of the subject
+type ActorClaim struct {
+	ID string `json:"sub"`
+}
+
+func GenerateJWT(user_id string, role string, session_id string) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenTTL)
 	claims := &Claims{
-		ID:   user_id,
-		Role: role,
+		ID:        user_id,
+		Role:      role,
+		SessionID: session_id,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	value, exists := os.LookupEnv("JWT_SECRET_KEY")
-	if !exists {
-		return "", errors.New("infrastructure/jwt_service: could not found jwt_secret_key, it does not exist")
+	ring, err := activeKeyRing()
+	if err != nil {
+		return "", err
+	}
+	return ring.Sign(claims)
+}
+
+// GenerateImpersonationJWT signs a token for an admin acting as the user, it is valid
+// until the impersonation session ends
+func GenerateImpersonationJWT(user_id, role, session_id, impersonator_id string, allowWrites bool, expiresAt time.Time) (string, error) {
+	claims := &Claims{
+		ID:          user_id,
+		Role:        role,
+		SessionID:   session_id,
+		Actor:       &ActorClaim{ID: impersonator_id},
+		AllowWrites: allowWrites,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expiresAt.Unix(),
+		},
 	}
-	jwtKey := []byte(value)
-	tokenString, err := token.SignedString(jwtKey)
+	ring, err := activeKeyRing()
 	if err != nil {
-		return "", errors.New("infrastructure/jwt_service: " + err.Error())
+		return "", err
 	}
-	return tokenString, nil
+	return ring.Sign(claims)
 }
 
 func GenerateVerficationToken(email string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+	return generateEmailToken(email, "", 24*time.Hour)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"email": email,
-		"exp":   expirationTime.Unix(),
-	})
+// GenerateMagicLinkToken signs a short lived login link, the purpose claim keeps
+// verification links from being used to log in
+func GenerateMagicLinkToken(email string) (string, error) {
+	return generateEmailToken(email, magicLinkPurpose, MagicLinkTTL)
+}
 
-	value, exists := os.LookupEnv("JWT_SECRET_KEY")
-	if !exists {
-		return "", errors.New("infrastructure/jwt_service: could not found jwt_secret_key, it does not exist")
+func generateEmailToken(email, purpose string, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"email": email,
+		"exp":   time.Now().Add(ttl).Unix(),
 	}
-	jwtKey := []byte(value)
-	tokenString, err := token.SignedString(jwtKey)
+	if purpose != "" {
+		claims["purpose"] = purpose
+	}
+	return signClaims(claims)
+}
 
+// MagicLinkTokenValidate returns the email of a valid magic link token
+func MagicLinkTokenValidate(tokenString string) (string, error) {
+	claims, err := parsePurposeToken(tokenString, magicLinkPurpose)
 	if err != nil {
-		return "", errors.New("infrastructure/jwt_service: " + err.Error())
+		return "", err
 	}
-
-	return tokenString, nil
+	email, ok := claims["email"].(string)
+	if !ok || email == "" {
+		return "", errors.New("infrastructure/jwt_service: invalid token")
+	}
+	return email, nil
 }
 
-func VerificationTokenValidate(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		secretKey, exist := os.LookupEnv("JWT_SECRET_KEY")
-
-		if !exist {
-			return nil, errors.New("infrastructure/jwt_service: " + "could not found jwt_secret_key, it does not exist")
-		}
-		return []byte(secretKey), nil
-
-	})
-
+func signClaims(claims jwt.MapClaims) (string, error) {
+	ring, err := activeKeyRing()
 	if err != nil {
-		return "", errors.New("infrastructure/jwt_service: " + err.Error())
+		return "", err
 	}
+	return ring.Sign(claims)
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		expiration := claims["exp"].(float64)
-
-		if time.Now().Unix() > int64(expiration) {
-			return "", errors.New("infrastructure/jwt_service: " + "token is expired")
-		}
-		email := claims["email"].(string)
-		return email, nil
+// parsePurposeToken checks the signature, the expiry and the purpose claim of a token, an
+// empty purpose is for the tokens made without one
+func parsePurposeToken(tokenString, purpose string) (jwt.MapClaims, error) {
+	ring, err := activeKeyRing()
+	if err != nil {
+		return nil, err
+	}
+	token, err := ring.Parse(tokenString, jwt.MapClaims{})
+	if err != nil || !token.Valid {
+		return nil, errors.New("infrastructure/jwt_service: invalid token")
 	}
 
-	return "", errors.New("infrastructure/jwt_service: " + "invalid token")
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("infrastructure/jwt_service: invalid token")
+	}
+	if tokenPurpose, _ := claims["purpose"].(string); tokenPurpose != purpose {
+		return nil, errors.New("infrastructure/jwt_service: invalid token")
+	}
+	return claims, nil
+}
 
+// VerificationTokenValidate returns the email of a valid verification token, tokens made
+// for another purpose are refused
+func VerificationTokenValidate(tokenString string) (string, error) {
+	claims, err := parsePurposeToken(tokenString, "")
+	if err != nil {
+		return "", err
+	}
+	email, ok := claims["email"].(string)
+	if !ok || email == "" {
+		return "", errors.New("infrastructure/jwt_service: invalid token")
+	}
+	return email, nil
 }
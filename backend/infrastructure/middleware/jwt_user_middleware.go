@@ -1,82 +1,364 @@
 package middleware
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"os"
 	"strings"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
 	"github.com/gin-gonic/gin"
 )
 
-var RoleMap = map[string]int{
-	"super_admin": 4,
-	"admin":       3,
-	"teacher":     2,
-	"student":     1,
-	"all":         0,
+// SessionChecker tells the middleware whether the session a token was issued for is still alive
+type SessionChecker interface {
+	IsSessionActive(ctx context.Context, sessionID string) (bool, error)
 }
 
-func AuthUserMiddleware(role int) gin.HandlerFunc {
-	fmt.Println("AuthUserMiddleware called with role:", role)
-	load_key, exist := os.LookupEnv("JWT_SECRET_KEY")
-	if !exist {
-		panic("No JWT_SECRET_KEY found")
-	}
-	jwtKey := []byte(load_key)
+// TokenAuthenticator resolves a personal access token to the user it acts for
+type TokenAuthenticator interface {
+	AuthenticateAccessToken(ctx context.Context, token, clientIP string) (models.AccessTokenPrincipal, error)
+}
+
+// AccessTokenPrefix starts every personal access token, anything else is read as a JWT
+const AccessTokenPrefix = "ikp_"
+
+// PermissionResolver tells the middleware whether a user holds a permission and where
+type PermissionResolver interface {
+	ResolvePermission(ctx context.Context, userID, role string, permission constants.Permission) (models.AccessScope, bool, error)
+}
+
+// ImpersonationRecorder keeps the trail of every request made with an impersonation token
+type ImpersonationRecorder interface {
+	RecordImpersonatedRequest(ctx context.Context, request models.ImpersonatedRequest)
+}
+
+// ImpersonatedByHeader is set on every response to an impersonated request
+const ImpersonatedByHeader = "X-Impersonated-By"
+
+var (
+	sessionChecker        SessionChecker
+	permissionResolver    PermissionResolver
+	tokenAuthenticator    TokenAuthenticator
+	impersonationRecorder ImpersonationRecorder
+)
+
+// UseSessionChecker registers the checker used to reject tokens of revoked sessions
+func UseSessionChecker(checker SessionChecker) {
+	sessionChecker = checker
+}
+
+// UseTokenAuthenticator registers the authenticator of personal access tokens, without it
+// only JWTs are accepted
+func UseTokenAuthenticator(authenticator TokenAuthenticator) {
+	tokenAuthenticator = authenticator
+}
+
+// UseImpersonationRecorder registers the recorder of impersonated requests
+func UseImpersonationRecorder(recorder ImpersonationRecorder) {
+	impersonationRecorder = recorder
+}
+
+// UsePermissionResolver registers the resolver used by RequirePermission and RequireScopedPermission
+func UsePermissionResolver(resolver PermissionResolver) {
+	permissionResolver = resolver
+}
 
+// AuthUserMiddleware only checks that the request comes from a logged in user, personal access
+// tokens are refused since these routes are not limited by a permission the token could be scoped to
+func AuthUserMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Allow preflight OPTIONS requests to pass through
-
 		if c.Request.Method == "OPTIONS" {
 			c.Next()
 			return
 		}
-		tokenString := c.GetHeader("Authorization")
+		if !authenticate(c, false) {
+			return
+		}
+		c.Next()
+	}
+}
 
-		if tokenString == "" {
-			fmt.Println("No token found in Authorization header")
-			c.JSON(401, gin.H{"error": "No token found"})
-			c.Abort()
+// RequirePermission lets the request through when the user holds every one of the
+// permissions globally, scoped grants are not enough here. Access tokens also need
+// every permission in their scopes
+func RequirePermission(permissions ...constants.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == "OPTIONS" {
+			c.Next()
+			return
+		}
+		if !authenticate(c, true) {
 			return
 		}
+		for _, permission := range permissions {
+			scope, ok := resolvePermission(c, permission)
+			if !ok {
+				return
+			}
+			if !scope.Global {
+				forbidden(c)
+				return
+			}
+		}
+		c.Next()
+	}
+}
 
-		// Remove "Bearer " prefix unconditionally
-		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+// RequireScopedPermission also accepts grants limited to a university, school or department,
+// the resolved scope is set as "access_scope" and the handler has to enforce it
+func RequireScopedPermission(permission constants.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == "OPTIONS" {
+			c.Next()
+			return
+		}
+		if !authenticate(c, true) {
+			return
+		}
+		scope, ok := resolvePermission(c, permission)
+		if !ok {
+			return
+		}
+		c.Set("access_scope", scope)
+		c.Next()
+	}
+}
 
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("invalid token")
+// OptionalScopedPermission resolves a permission the handler only needs for part of its
+// answer, the request goes through either way and "access_scope" is empty without the grant
+func OptionalScopedPermission(permission constants.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == "OPTIONS" {
+			c.Next()
+			return
+		}
+		if !authenticate(c, true) {
+			return
+		}
+		scope := models.AccessScope{}
+		if hasTokenScope(c, permission) && permissionResolver != nil {
+			resolved, granted, err := permissionResolver.ResolvePermission(c, c.GetString("user_id"), c.GetString("role"), permission)
+			if err != nil {
+				fmt.Println("Error resolving permission:", err)
+				c.JSON(500, gin.H{"error": "Could not verify permissions"})
+				c.Abort()
+				return
 			}
-			return jwtKey, nil
-		})
+			if granted {
+				scope = resolved
+			}
+		}
+		c.Set("access_scope", scope)
+		c.Next()
+	}
+}
+
+// authenticate validates the token and puts the user info into the context, it writes the
+// error response itself; a request already authenticated by a group middleware is not parsed twice
+func authenticate(c *gin.Context, allowAccessTokens bool) bool {
+	if c.GetString("user_id") != "" {
+		if !allowAccessTokens && c.GetString("token_id") != "" {
+			refuseAccessToken(c)
+			return false
+		}
+		return true
+	}
+
+	tokenString := c.GetHeader("Authorization")
+
+	if tokenString == "" {
+		fmt.Println("No token found in Authorization header")
+		c.JSON(401, gin.H{"error": "No token found"})
+		c.Abort()
+		return false
+	}
+
+	// Remove "Bearer " prefix unconditionally
+	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+
+	if strings.HasPrefix(tokenString, AccessTokenPrefix) {
+		if !allowAccessTokens {
+			refuseAccessToken(c)
+			return false
+		}
+		return authenticateAccessToken(c, tokenString)
+	}
+
+	ring, err := activeKeyRing()
+	if err != nil {
+		fmt.Println("Error loading signing keys:", err)
+		c.JSON(500, gin.H{"error": "Could not verify token"})
+		c.Abort()
+		return false
+	}
+
+	token, err := ring.Parse(tokenString, &Claims{})
+	if err != nil {
+		fmt.Println("Error parsing token:", err)
+		c.JSON(401, gin.H{"error": err.Error()})
+		c.Abort()
+		return false
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		c.JSON(401, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return false
+	}
+
+	if claims.SessionID == "" {
+		c.JSON(401, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return false
+	}
 
+	if sessionChecker != nil {
+		active, err := sessionChecker.IsSessionActive(c, claims.SessionID)
 		if err != nil {
-			fmt.Println("Error parsing token:", err)
-			c.JSON(401, gin.H{"error": err.Error()})
+			fmt.Println("Error checking session:", err)
+			c.JSON(500, gin.H{"error": "Could not verify session"})
 			c.Abort()
-			return
+			return false
 		}
-
-		claims, ok := token.Claims.(*Claims)
-		if !ok || !token.Valid {
-			c.JSON(401, gin.H{"error": "Invalid token"})
+		if !active {
+			c.JSON(401, gin.H{"error": "Session has been revoked"})
 			c.Abort()
-			return
+			return false
 		}
+	}
 
-		fmt.Println("Role:", claims.Role, "Required Role:", role, "Get Role : ", RoleMap[claims.Role])
+	if claims.Actor != nil && !allowImpersonated(c, claims) {
+		return false
+	}
 
-		if RoleMap[claims.Role] < role {
+	// ✅ Set user info to context
+	c.Set("user_id", claims.ID)
+	c.Set("session_id", claims.SessionID)
+	c.Set("role", claims.Role)
+	return true
+}
 
-			c.JSON(403, gin.H{"error": "Forbidden: insufficient permissions"})
+// allowImpersonated tags the request with the admin acting as the user and records it.
+// Impersonation is read only unless the admin asked for writes, deletes are always refused
+func allowImpersonated(c *gin.Context, claims *Claims) bool {
+	blocked := false
+	switch c.Request.Method {
+	case "GET", "HEAD", "OPTIONS":
+	case "DELETE":
+		blocked = true
+	default:
+		blocked = !claims.AllowWrites
+	}
+
+	if impersonationRecorder != nil {
+		impersonationRecorder.RecordImpersonatedRequest(c, models.ImpersonatedRequest{
+			ImpersonatorID: claims.Actor.ID,
+			UserID:         claims.ID,
+			SessionID:      claims.SessionID,
+			Method:         c.Request.Method,
+			Path:           c.Request.URL.Path,
+			IPAddress:      c.ClientIP(),
+			Blocked:        blocked,
+		})
+	}
+
+	c.Header(ImpersonatedByHeader, claims.Actor.ID)
+	if blocked {
+		c.JSON(403, gin.H{"error": "Forbidden: this action is not allowed while impersonating a user"})
+		c.Abort()
+		return false
+	}
+	c.Set("impersonator_id", claims.Actor.ID)
+	return true
+}
+
+// NoImpersonation refuses impersonated requests, it guards the account settings an admin
+// must never change for a user such as credentials, sessions and tokens. It goes after
+// the middleware that authenticates the request
+func NoImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("impersonator_id") != "" {
+			c.JSON(403, gin.H{"error": "Forbidden: this action is not allowed while impersonating a user"})
 			c.Abort()
 			return
 		}
-
-		// ✅ Set user info to context
-		c.Set("user_id", claims.ID)
 		c.Next()
 	}
 }
+
+func authenticateAccessToken(c *gin.Context, tokenString string) bool {
+	if tokenAuthenticator == nil {
+		c.JSON(401, gin.H{"error": "Access tokens are not accepted"})
+		c.Abort()
+		return false
+	}
+
+	principal, err := tokenAuthenticator.AuthenticateAccessToken(c, tokenString, c.ClientIP())
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid, expired or revoked access token"})
+		c.Abort()
+		return false
+	}
+
+	c.Set("user_id", principal.UserID)
+	c.Set("role", principal.Role)
+	c.Set("token_id", principal.TokenID)
+	c.Set("token_scopes", principal.Scopes)
+	return true
+}
+
+func refuseAccessToken(c *gin.Context) {
+	c.JSON(403, gin.H{"error": "Personal access tokens can not be used for this endpoint, log in instead"})
+	c.Abort()
+}
+
+// hasTokenScope is true for requests made with a session, which are not scoped
+func hasTokenScope(c *gin.Context, permission constants.Permission) bool {
+	value, exists := c.Get("token_scopes")
+	if !exists {
+		return true
+	}
+	scopes, _ := value.([]string)
+	for _, scope := range scopes {
+		if scope == string(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+func resolvePermission(c *gin.Context, permission constants.Permission) (models.AccessScope, bool) {
+	if !hasTokenScope(c, permission) {
+		c.JSON(403, gin.H{"error": "Forbidden: the access token is missing the " + string(permission) + " scope"})
+		c.Abort()
+		return models.AccessScope{}, false
+	}
+
+	if permissionResolver == nil {
+		fmt.Println("No permission resolver registered")
+		c.JSON(500, gin.H{"error": "Could not verify permissions"})
+		c.Abort()
+		return models.AccessScope{}, false
+	}
+
+	scope, granted, err := permissionResolver.ResolvePermission(c, c.GetString("user_id"), c.GetString("role"), permission)
+	if err != nil {
+		fmt.Println("Error resolving permission:", err)
+		c.JSON(500, gin.H{"error": "Could not verify permissions"})
+		c.Abort()
+		return models.AccessScope{}, false
+	}
+	if !granted {
+		forbidden(c)
+		return models.AccessScope{}, false
+	}
+	return scope, true
+}
+
+func forbidden(c *gin.Context) {
+	c.JSON(403, gin.H{"error": "Forbidden: insufficient permissions"})
+	c.Abort()
+}
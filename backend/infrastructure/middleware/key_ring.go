@@ -0,0 +1,311 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+// LegacyKeyID is the kid of the JWT_SECRET_KEY, tokens signed before key ids were added
+// have no kid and are checked with it as well
+const LegacyKeyID = "legacy"
+
+// KeyRing signs tokens with its active key and verifies them with any of its keys, the kid
+// header tells which one. Keys are read from the JSON file in JWT_KEYS_FILE:
+//
+//	{
+//	  "active_kid": "2025-10",
+//	  "keys": [
+//	    {"kid": "2025-10", "alg": "EdDSA", "private_key_file": "/secrets/jwt-2025-10.pem"},
+//	    {"kid": "2025-04", "alg": "RS256", "public_key_file": "/secrets/jwt-2025-04.pub.pem"},
+//	    {"kid": "hs-2025", "alg": "HS256", "secret_env": "JWT_SECRET_2025"}
+//	  ]
+//	}
+//
+// A key with only a public key verifies the tokens it signed before a rotation until they
+// expire. JWT_SECRET_KEY is always added as the legacy HS256 key, and is the active key when
+// there is no key file
+type KeyRing struct {
+	active *ringKey
+	keys   map[string]*ringKey
+}
+
+type ringKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{} // nil for keys that only verify
+	verifyKey interface{}
+}
+
+type keyFile struct {
+	ActiveKID string          `json:"active_kid"`
+	Keys      []keyFileRecord `json:"keys"`
+}
+
+type keyFileRecord struct {
+	KID            string `json:"kid"`
+	Alg            string `json:"alg"`
+	SecretEnv      string `json:"secret_env"`
+	PrivateKeyFile string `json:"private_key_file"`
+	PublicKeyFile  string `json:"public_key_file"`
+}
+
+var keyRing *KeyRing
+
+// UseKeyRing registers the ring used to sign and verify tokens, without one the ring is
+// built from the environment on every use
+func UseKeyRing(ring *KeyRing) {
+	keyRing = ring
+}
+
+func activeKeyRing() (*KeyRing, error) {
+	if keyRing != nil {
+		return keyRing, nil
+	}
+	return LoadKeyRing()
+}
+
+// LoadKeyRing builds the ring from JWT_KEYS_FILE and JWT_SECRET_KEY
+func LoadKeyRing() (*KeyRing, error) {
+	ring := &KeyRing{keys: map[string]*ringKey{}}
+
+	if secret := os.Getenv("JWT_SECRET_KEY"); secret != "" {
+		ring.keys[LegacyKeyID] = &ringKey{
+			id:        LegacyKeyID,
+			method:    jwt.SigningMethodHS256,
+			signKey:   []byte(secret),
+			verifyKey: []byte(secret),
+		}
+	}
+
+	path := os.Getenv("JWT_KEYS_FILE")
+	if path == "" {
+		ring.active = ring.keys[LegacyKeyID]
+		if ring.active == nil {
+			return nil, errors.New("infrastructure/jwt_service: could not found jwt_secret_key, it does not exist")
+		}
+		return ring, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("infrastructure/jwt_service: could not read the key file: %w", err)
+	}
+	var file keyFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("infrastructure/jwt_service: invalid key file: %w", err)
+	}
+
+	for _, record := range file.Keys {
+		key, err := loadRingKey(record)
+		if err != nil {
+			return nil, fmt.Errorf("infrastructure/jwt_service: key %q: %w", record.KID, err)
+		}
+		if _, exists := ring.keys[key.id]; exists {
+			return nil, fmt.Errorf("infrastructure/jwt_service: key %q is defined twice", key.id)
+		}
+		ring.keys[key.id] = key
+	}
+
+	activeKID := file.ActiveKID
+	if activeKID == "" {
+		activeKID = LegacyKeyID
+	}
+	ring.active = ring.keys[activeKID]
+	if ring.active == nil || ring.active.signKey == nil {
+		return nil, fmt.Errorf("infrastructure/jwt_service: the active key %q does not exist or can not sign", activeKID)
+	}
+	return ring, nil
+}
+
+func loadRingKey(record keyFileRecord) (*ringKey, error) {
+	if record.KID == "" {
+		return nil, errors.New("kid is required")
+	}
+	key := &ringKey{id: record.KID}
+
+	switch record.Alg {
+	case "HS256":
+		secret := os.Getenv(record.SecretEnv)
+		if record.SecretEnv == "" || secret == "" {
+			return nil, errors.New("secret_env must name a set environment variable")
+		}
+		key.method = jwt.SigningMethodHS256
+		key.signKey = []byte(secret)
+		key.verifyKey = []byte(secret)
+
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+		if record.PrivateKeyFile != "" {
+			private, err := readPEMFile(record.PrivateKeyFile, jwt.ParseRSAPrivateKeyFromPEM)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = private
+			key.verifyKey = &private.PublicKey
+		} else {
+			public, err := readPEMFile(record.PublicKeyFile, jwt.ParseRSAPublicKeyFromPEM)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = public
+		}
+
+	case "EdDSA":
+		key.method = SigningMethodEdDSA
+		if record.PrivateKeyFile != "" {
+			private, err := readPEMFile(record.PrivateKeyFile, parseEd25519PrivateKey)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = private
+			key.verifyKey = private.Public().(ed25519.PublicKey)
+		} else {
+			public, err := readPEMFile(record.PublicKeyFile, parseEd25519PublicKey)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = public
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported alg %q, use HS256, RS256 or EdDSA", record.Alg)
+	}
+	return key, nil
+}
+
+func readPEMFile[K any](path string, parse func([]byte) (K, error)) (K, error) {
+	var key K
+	if path == "" {
+		return key, errors.New("private_key_file or public_key_file is required")
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return key, err
+	}
+	return parse(raw)
+}
+
+func parseEd25519PrivateKey(raw []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("the key must be PEM encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 private key")
+	}
+	return private, nil
+}
+
+func parseEd25519PublicKey(raw []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("the key must be PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 public key")
+	}
+	return public, nil
+}
+
+// Sign signs the claims with the active key and puts its id in the kid header
+func (k *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.active.method, claims)
+	token.Header["kid"] = k.active.id
+	tokenString, err := token.SignedString(k.active.signKey)
+	if err != nil {
+		return "", errors.New("infrastructure/jwt_service: " + err.Error())
+	}
+	return tokenString, nil
+}
+
+// Parse verifies the token with the key of its kid, the algorithm of the token must be the
+// one of the key so a public key can never be used as an HMAC secret
+func (k *KeyRing) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = LegacyKeyID
+		}
+		key, ok := k.keys[kid]
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.verifyKey, nil
+	})
+}
+
+// JSONWebKey is a public key of the ring as published in the JWKS
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKS lists the public keys of the ring, HMAC secrets are never published
+func (k *KeyRing) JWKS() []JSONWebKey {
+	jwks := []JSONWebKey{}
+	for _, key := range k.keys {
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, JSONWebKey{
+				KeyType:   "RSA",
+				KeyID:     key.id,
+				Use:       "sig",
+				Algorithm: key.method.Alg(),
+				N:         base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks = append(jwks, JSONWebKey{
+				KeyType:   "OKP",
+				KeyID:     key.id,
+				Use:       "sig",
+				Algorithm: key.method.Alg(),
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	return jwks
+}
+
+// JWKSHandler publishes the public keys of the ring so other services can verify our tokens
+func JWKSHandler(c *gin.Context) {
+	ring, err := activeKeyRing()
+	if err != nil {
+		fmt.Println("Error loading signing keys:", err)
+		c.JSON(500, gin.H{"error": "Could not load the signing keys"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(200, gin.H{"keys": ring.JWKS()})
+}
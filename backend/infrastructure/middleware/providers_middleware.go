@@ -1,11 +1,22 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+
+	"github.com/chera-mihiretu/IKnow/infrastructure/oauth"
+	"github.com/gin-gonic/gin"
+)
+
+// OAuthProvider hands the :provider of the route to gothic, which reads it from the query
+func OAuthProvider(c *gin.Context) {
+	provider := c.Param("provider")
+	if !oauth.IsEnabled(provider) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": oauth.ErrUnknownProvider.Error()})
+		return
+	}
 
-func GoogleProvider(c *gin.Context) {
 	q := c.Request.URL.Query()
-	q.Add("provider", "google")
+	q.Set("provider", provider)
 	c.Request.URL.RawQuery = q.Encode()
 	c.Next()
-
 }
@@ -10,13 +10,16 @@ import (
 
 type WebSocketClient struct {
 	connections map[string]*models.SocketConnection
-	mutex       sync.Mutex
+	// topics holds the users watching something live, for example the tallies of a poll
+	topics map[string]map[string]struct{}
+	mutex  sync.Mutex
 }
 
 func NewWebSocketClient() *WebSocketClient {
 
 	return &WebSocketClient{
 		connections: make(map[string]*models.SocketConnection),
+		topics:      make(map[string]map[string]struct{}),
 	}
 
 }
@@ -31,6 +34,12 @@ func (c *WebSocketClient) AddConnection(conn *models.SocketConnection) {
 func (c *WebSocketClient) RemoveConnection(userID string) {
 	c.mutex.Lock()
 	delete(c.connections, userID)
+	for topic, users := range c.topics {
+		delete(users, userID)
+		if len(users) == 0 {
+			delete(c.topics, topic)
+		}
+	}
 	defer c.mutex.Unlock()
 }
 
@@ -45,6 +54,43 @@ func (c *WebSocketClient) SendMessage(ctx context.Context, notification *models.
 		return fmt.Errorf("user not found")
 	}
 
-	user.Conn.WriteJSON(notification)
+	user.WriteJSON(notification)
 	return nil
 }
+
+func (c *WebSocketClient) Subscribe(userID, topic string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.connections[userID]; !ok {
+		return
+	}
+	if c.topics[topic] == nil {
+		c.topics[topic] = make(map[string]struct{})
+	}
+	c.topics[topic][userID] = struct{}{}
+}
+
+func (c *WebSocketClient) Unsubscribe(userID, topic string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.topics[topic], userID)
+	if len(c.topics[topic]) == 0 {
+		delete(c.topics, topic)
+	}
+}
+
+// Broadcast sends the message to every user subscribed to the topic
+func (c *WebSocketClient) Broadcast(ctx context.Context, topic string, message interface{}) {
+	c.mutex.Lock()
+	receivers := make([]*models.SocketConnection, 0, len(c.topics[topic]))
+	for userID := range c.topics[topic] {
+		if conn, ok := c.connections[userID]; ok && conn != nil {
+			receivers = append(receivers, conn)
+		}
+	}
+	c.mutex.Unlock()
+
+	for _, conn := range receivers {
+		conn.WriteJSON(message)
+	}
+}
@@ -0,0 +1,161 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/markbates/goth"
+	"github.com/markbates/goth/providers/github"
+	"github.com/markbates/goth/providers/google"
+	"github.com/markbates/goth/providers/openidConnect"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown login provider")
+	ErrMissingSubject  = errors.New("the login provider did not return an account id")
+	ErrMissingEmail    = errors.New("the login provider did not return an email")
+)
+
+// ProviderConfig is one entry of the provider registry. Google and GitHub are built in,
+// any other name is an OpenID Connect provider found through its DiscoveryURL
+type ProviderConfig struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	DiscoveryURL string
+	Scopes       []string
+}
+
+// emails of these providers are always verified by the provider, the others have to
+// send an email_verified claim
+var trustedEmailProviders = map[string]bool{
+	"github": true,
+}
+
+// ConfigsFromEnv reads the registry from OAUTH_PROVIDERS, a comma separated list of names.
+// Every name reads <NAME>_CLIENT_ID, <NAME>_CLIENT_SECRET, <NAME>_DISCOVERY_URL and the
+// optional space separated <NAME>_SCOPES. Only google is enabled when the list is empty
+func ConfigsFromEnv() []ProviderConfig {
+	names := os.Getenv("OAUTH_PROVIDERS")
+	if strings.TrimSpace(names) == "" {
+		names = "google"
+	}
+
+	var configs []ProviderConfig
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		configs = append(configs, ProviderConfig{
+			Name:         name,
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			DiscoveryURL: os.Getenv(prefix + "DISCOVERY_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		})
+	}
+	return configs
+}
+
+// NewProvider builds the goth provider of a config, the callback is
+// <baseURL>/api/auth/<name>/callback
+func NewProvider(config ProviderConfig, baseURL string) (goth.Provider, error) {
+	callbackURL := fmt.Sprintf("%s/api/auth/%s/callback", baseURL, config.Name)
+
+	switch config.Name {
+	case "google":
+		scopes := config.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"email", "profile"}
+		}
+		return google.New(config.ClientID, config.ClientSecret, callbackURL, scopes...), nil
+	case "github":
+		scopes := config.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"read:user", "user:email"}
+		}
+		return github.New(config.ClientID, config.ClientSecret, callbackURL, scopes...), nil
+	}
+
+	if config.DiscoveryURL == "" {
+		return nil, fmt.Errorf("oauth provider %s: discovery url is required", config.Name)
+	}
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	provider, err := openidConnect.New(config.ClientID, config.ClientSecret, callbackURL, config.DiscoveryURL, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("oauth provider %s: %w", config.Name, err)
+	}
+	provider.SetName(config.Name)
+	return provider, nil
+}
+
+// Setup registers the providers of the configs with goth
+func Setup(configs []ProviderConfig, baseURL string) error {
+	providers := make([]goth.Provider, 0, len(configs))
+	for _, config := range configs {
+		provider, err := NewProvider(config, baseURL)
+		if err != nil {
+			return err
+		}
+		providers = append(providers, provider)
+	}
+	goth.UseProviders(providers...)
+	return nil
+}
+
+// IsEnabled reports whether the provider is in the registry
+func IsEnabled(name string) bool {
+	_, err := goth.GetProvider(name)
+	return err == nil
+}
+
+// Identity maps the user returned by a provider to the identity stored for it
+func Identity(user goth.User) (models.UserIdentities, error) {
+	if user.UserID == "" {
+		return models.UserIdentities{}, ErrMissingSubject
+	}
+	address := strings.ToLower(strings.TrimSpace(user.Email))
+	if address == "" {
+		return models.UserIdentities{}, ErrMissingEmail
+	}
+
+	name := user.Name
+	if name == "" {
+		name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+	}
+	if name == "" {
+		name = user.NickName
+	}
+
+	now := time.Now()
+	return models.UserIdentities{
+		Provider:       user.Provider,
+		ProviderUserID: user.UserID,
+		Email:          address,
+		EmailVerified:  trustedEmailProviders[user.Provider] || claimTrue(user.RawData, "email_verified") || claimTrue(user.RawData, "verified_email"),
+		Name:           name,
+		AvatarURL:      user.AvatarURL,
+		CreatedAt:      now,
+		LastUsedAt:     now,
+	}, nil
+}
+
+// claimTrue accepts booleans and the "true" strings some providers send
+func claimTrue(data map[string]interface{}, claim string) bool {
+	switch value := data[claim].(type) {
+	case bool:
+		return value
+	case string:
+		return strings.EqualFold(value, "true")
+	}
+	return false
+}
@@ -4,11 +4,13 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/hibiken/asynq"
+	goredis "github.com/redis/go-redis/v9"
 )
 
-func RedisClient() *asynq.Client {
+func redisClientOpt() asynq.RedisClientOpt {
 	addr := os.Getenv("REDIS_ADDR")
 	if addr == "" {
 		host := os.Getenv("REDIS_HOST")
@@ -32,11 +34,56 @@ func RedisClient() *asynq.Client {
 
 	log.Println("Connecting to Redis at", addr, "with DB", db, "and password", password)
 
-	client := asynq.NewClient(asynq.RedisClientOpt{
+	return asynq.RedisClientOpt{
 		Addr:     addr,
 		Password: password,
 		DB:       db,
-	})
+	}
+}
+
+func RedisClient() *asynq.Client {
+	client := asynq.NewClient(redisClientOpt())
 
 	return client
 }
+
+// RedisStore returns a plain client on the same redis asynq uses,
+// it is meant for counters and short lived keys
+func RedisStore() goredis.UniversalClient {
+	client, ok := redisClientOpt().MakeRedisClient().(goredis.UniversalClient)
+	if !ok {
+		return nil
+	}
+	return client
+}
+
+// StartScheduler enqueues the task on the queue at the times of the cron spec, every replica
+// runs one so the task is unique while it waits. Shut the returned scheduler down when the app stops
+func StartScheduler(cronspec string, task *asynq.Task, queue string, unique time.Duration) (*asynq.Scheduler, error) {
+	scheduler := asynq.NewScheduler(redisClientOpt(), nil)
+	if _, err := scheduler.Register(cronspec, task, asynq.Queue(queue), asynq.Unique(unique)); err != nil {
+		return nil, err
+	}
+	if err := scheduler.Start(); err != nil {
+		return nil, err
+	}
+	return scheduler, nil
+}
+
+// StartWorker processes the tasks of one queue with the given handlers, shut the
+// returned server down when the app stops
+func StartWorker(queue string, handlers map[string]asynq.HandlerFunc) (*asynq.Server, error) {
+	server := asynq.NewServer(redisClientOpt(), asynq.Config{
+		Concurrency: 5,
+		Queues:      map[string]int{queue: 1},
+	})
+
+	mux := asynq.NewServeMux()
+	for taskType, handler := range handlers {
+		mux.HandleFunc(taskType, handler)
+	}
+	if err := server.Start(mux); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
@@ -0,0 +1,44 @@
+package validation
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidEmailDomain = errors.New("invalid email domain")
+
+var domainRegex = regexp.MustCompile(`^([a-z0-9]([a-z0-9\-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+
+// NormalizeEmailDomain lower cases the domain and drops a leading @, so "@AAU.edu.et" becomes "aau.edu.et"
+func NormalizeEmailDomain(domain string) (string, error) {
+	domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "@")
+	if !domainRegex.MatchString(domain) {
+		return "", ErrInvalidEmailDomain
+	}
+	return domain, nil
+}
+
+// EmailDomain returns the lower cased part of the address after the @
+func EmailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(email[at+1:]))
+}
+
+// ParentDomains returns the domain and every parent of it, longest first, so addresses on
+// sub domains (student.aau.edu.et) match the domain registered for the university (aau.edu.et)
+func ParentDomains(domain string) []string {
+	var domains []string
+	for domain != "" {
+		domains = append(domains, domain)
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			break
+		}
+		domain = domain[dot+1:]
+	}
+	return domains
+}
@@ -0,0 +1,21 @@
+package validation
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var emailRegex = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,}$`)
+
+// NormalizeEmail lower cases the email and checks its format
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", errors.New("email is required")
+	}
+	if !emailRegex.MatchString(email) {
+		return "", errors.New("invalid email format")
+	}
+	return email, nil
+}
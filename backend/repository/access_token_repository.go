@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/hashing"
+	"github.com/chera-mihiretu/IKnow/infrastructure/middleware"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	accessTokenSize      = 32
+	accessTokenShownSize = 8
+	// accessTokenUseInterval keeps the last used time from being written on every request
+	accessTokenUseInterval = time.Minute
+)
+
+var (
+	ErrAccessTokenNotFound = errors.New("access token not found")
+	ErrInvalidAccessToken  = errors.New("invalid, expired or revoked access token")
+	ErrAccessTokenName     = errors.New("the token needs a name of at most 100 characters")
+	ErrAccessTokenScopes   = errors.New("the token needs at least one valid scope")
+	ErrAccessTokenExpiry   = errors.New("the token can expire in at most 365 days")
+)
+
+type AccessTokenRepository interface {
+	CreateToken(ctx context.Context, token models.AccessTokens) (models.AccessTokens, string, error)
+	GetUserTokens(ctx context.Context, userID primitive.ObjectID) ([]models.AccessTokens, error)
+	RevokeToken(ctx context.Context, userID, tokenID primitive.ObjectID) error
+	RevokeUserTokens(ctx context.Context, userID primitive.ObjectID) error
+	Authenticate(ctx context.Context, rawToken, clientIP string) (models.AccessTokens, models.User, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type accessTokenRepository struct {
+	tokens *mongo.Collection
+	users  *mongo.Collection
+}
+
+func NewAccessTokenRepository(db *mongo.Database) AccessTokenRepository {
+	return &accessTokenRepository{
+		tokens: db.Collection("access_tokens"),
+		users:  db.Collection("users"),
+	}
+}
+
+// CreateToken stores the token and returns the raw value, it is shown once and can not be read again
+func (r *accessTokenRepository) CreateToken(ctx context.Context, token models.AccessTokens) (models.AccessTokens, string, error) {
+	secret, err := hashing.GenerateToken(accessTokenSize)
+	if err != nil {
+		return models.AccessTokens{}, "", errors.New("could not generate access token")
+	}
+	rawToken := middleware.AccessTokenPrefix + secret
+
+	token.ID = primitive.NewObjectID()
+	token.Prefix = rawToken[:len(middleware.AccessTokenPrefix)+accessTokenShownSize]
+	token.TokenHash = hashing.HashToken(rawToken)
+	token.LastUsedAt = nil
+	token.RevokedAt = nil
+	token.CreatedAt = time.Now()
+
+	if _, err := r.tokens.InsertOne(ctx, token); err != nil {
+		return models.AccessTokens{}, "", err
+	}
+	return token, rawToken, nil
+}
+
+func (r *accessTokenRepository) GetUserTokens(ctx context.Context, userID primitive.ObjectID) ([]models.AccessTokens, error) {
+	cursor, err := r.tokens.Find(ctx,
+		bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}},
+		options.Find().SetSort(bson.M{"created_at": -1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tokens := []models.AccessTokens{}
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *accessTokenRepository) RevokeToken(ctx context.Context, userID, tokenID primitive.ObjectID) error {
+	res, err := r.tokens.UpdateOne(ctx,
+		bson.M{"_id": tokenID, "user_id": userID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrAccessTokenNotFound
+	}
+	return nil
+}
+
+func (r *accessTokenRepository) RevokeUserTokens(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.tokens.UpdateMany(ctx,
+		bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// Authenticate finds the active token and its user, accounts waiting for deletion can not use tokens
+func (r *accessTokenRepository) Authenticate(ctx context.Context, rawToken, clientIP string) (models.AccessTokens, models.User, error) {
+	if !strings.HasPrefix(rawToken, middleware.AccessTokenPrefix) {
+		return models.AccessTokens{}, models.User{}, ErrInvalidAccessToken
+	}
+
+	now := time.Now()
+	var token models.AccessTokens
+	err := r.tokens.FindOne(ctx, bson.M{
+		"token_hash": hashing.HashToken(rawToken),
+		"revoked_at": bson.M{"$exists": false},
+		"$or": bson.A{
+			bson.M{"expires_at": bson.M{"$exists": false}},
+			bson.M{"expires_at": bson.M{"$gt": now}},
+		},
+	}).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return models.AccessTokens{}, models.User{}, ErrInvalidAccessToken
+	}
+	if err != nil {
+		return models.AccessTokens{}, models.User{}, err
+	}
+
+	var user models.User
+	err = r.users.FindOne(ctx, bson.M{"_id": token.UserID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return models.AccessTokens{}, models.User{}, ErrInvalidAccessToken
+	}
+	if err != nil {
+		return models.AccessTokens{}, models.User{}, err
+	}
+	if user.DeletionScheduledAt != nil {
+		return models.AccessTokens{}, models.User{}, ErrInvalidAccessToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > accessTokenUseInterval {
+		_, err = r.tokens.UpdateOne(ctx,
+			bson.M{"_id": token.ID},
+			bson.M{"$set": bson.M{"last_used_at": now, "last_used_ip": clientIP}},
+		)
+		if err != nil {
+			return models.AccessTokens{}, models.User{}, err
+		}
+	}
+	return token, user, nil
+}
+
+func (r *accessTokenRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.tokens.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	})
+	return err
+}
@@ -0,0 +1,403 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/hashing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	AccountDeletionGracePeriod = 30 * 24 * time.Hour
+
+	// DeletedCommentContent replaces the content of the comments of a purged account,
+	// the comments are kept so the replies under them still make sense
+	DeletedCommentContent = "[deleted]"
+)
+
+var (
+	ErrDeletionNotScheduled = errors.New("the account is not scheduled for deletion")
+	ErrDeletionScheduled    = errors.New("the account is already scheduled for deletion")
+)
+
+type AccountRepository interface {
+	ScheduleDeletion(ctx context.Context, userID primitive.ObjectID, password string) (time.Time, error)
+	CancelDeletion(ctx context.Context, userID primitive.ObjectID) error
+	GetDueDeletions(ctx context.Context, now time.Time) ([]primitive.ObjectID, error)
+	PurgeUser(ctx context.Context, userID primitive.ObjectID) ([]string, error)
+	ExportUserData(ctx context.Context, userID primitive.ObjectID) (models.AccountExport, error)
+}
+
+type accountRepository struct {
+	users                *mongo.Collection
+	posts                *mongo.Collection
+	postRevisions        *mongo.Collection
+	pollVotes            *mongo.Collection
+	comments             *mongo.Collection
+	postLikes            *mongo.Collection
+	jobs                 *mongo.Collection
+	jobLikes             *mongo.Collection
+	connects             *mongo.Collection
+	notifications        *mongo.Collection
+	reports              *mongo.Collection
+	materials            *mongo.Collection
+	sessions             *mongo.Collection
+	mfaChallenges        *mongo.Collection
+	roleAssignments      *mongo.Collection
+	verificationRequests *mongo.Collection
+	emailChanges         *mongo.Collection
+	identities           *mongo.Collection
+	accessTokens         *mongo.Collection
+	emailVerifications   *mongo.Collection
+	passwordResets       *mongo.Collection
+	handleHistory        *mongo.Collection
+	bookmarks            *mongo.Collection
+	bookmarkFolders      *mongo.Collection
+	sessionRepository    SessionRepository
+}
+
+func NewAccountRepository(db *mongo.Database, sessionRepo SessionRepository) AccountRepository {
+	return &accountRepository{
+		users:                db.Collection("users"),
+		posts:                db.Collection("posts"),
+		postRevisions:        db.Collection("post_revisions"),
+		pollVotes:            db.Collection("poll_votes"),
+		comments:             db.Collection("comments"),
+		postLikes:            db.Collection("post_likes"),
+		jobs:                 db.Collection("jobs"),
+		jobLikes:             db.Collection("job_likes"),
+		connects:             db.Collection("connects"),
+		notifications:        db.Collection("notifications"),
+		reports:              db.Collection("reports"),
+		materials:            db.Collection("materials"),
+		sessions:             db.Collection("sessions"),
+		mfaChallenges:        db.Collection("mfa_challenges"),
+		roleAssignments:      db.Collection("role_assignments"),
+		verificationRequests: db.Collection("verification_requests"),
+		emailChanges:         db.Collection("email_changes"),
+		identities:           db.Collection("user_identities"),
+		accessTokens:         db.Collection("access_tokens"),
+		emailVerifications:   db.Collection("email_verifications"),
+		passwordResets:       db.Collection("password_resets"),
+		handleHistory:        db.Collection("handle_history"),
+		bookmarks:            db.Collection("bookmarks"),
+		bookmarkFolders:      db.Collection("bookmark_folders"),
+		sessionRepository:    sessionRepo,
+	}
+}
+
+// ScheduleDeletion marks the account for deletion after the grace period and signs it out
+// everywhere, logging in again and cancelling keeps the account
+func (r *accountRepository) ScheduleDeletion(ctx context.Context, userID primitive.ObjectID, password string) (time.Time, error) {
+	var user models.User
+	err := r.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, ErrUserNotFound
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	if user.DeletionScheduledAt != nil {
+		return time.Time{}, ErrDeletionScheduled
+	}
+	// google accounts have no password, the session is all they can prove
+	if user.PasswordHash != "" && !hashing.ComparePassword(user.PasswordHash, password) {
+		return time.Time{}, ErrWrongCredentials
+	}
+
+	scheduledAt := time.Now().Add(AccountDeletionGracePeriod)
+	_, err = r.users.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"deletion_scheduled_at": scheduledAt, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if _, err := r.sessionRepository.RevokeAllSessions(ctx, userID, primitive.NilObjectID); err != nil {
+		return time.Time{}, err
+	}
+	return scheduledAt, nil
+}
+
+func (r *accountRepository) CancelDeletion(ctx context.Context, userID primitive.ObjectID) error {
+	res, err := r.users.UpdateOne(ctx,
+		bson.M{"_id": userID, "deletion_scheduled_at": bson.M{"$exists": true}},
+		bson.M{
+			"$unset": bson.M{"deletion_scheduled_at": ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrDeletionNotScheduled
+	}
+	return nil
+}
+
+func (r *accountRepository) GetDueDeletions(ctx context.Context, now time.Time) ([]primitive.ObjectID, error) {
+	return distinctIDs(ctx, r.users, bson.M{"deletion_scheduled_at": bson.M{"$lte": now}})
+}
+
+// PurgeUser removes the account and what belongs only to it; comments, reports and materials
+// other users depend on are kept without the author. It returns the storage files to delete
+func (r *accountRepository) PurgeUser(ctx context.Context, userID primitive.ObjectID) ([]string, error) {
+	var user models.User
+	err := r.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletionScheduledAt == nil || user.DeletionScheduledAt.After(time.Now()) {
+		return nil, ErrDeletionNotScheduled
+	}
+
+	var files []string
+	if user.ProfileImageURL != "" {
+		files = append(files, user.ProfileImageURL)
+	}
+
+	// posts with everything attached to them
+	var posts []models.Posts
+	if err := findAll(ctx, r.posts, bson.M{"user_id": userID}, &posts); err != nil {
+		return nil, err
+	}
+	postIDs := make([]primitive.ObjectID, 0, len(posts))
+	for _, post := range posts {
+		postIDs = append(postIDs, post.ID)
+		files = append(files, post.PostAttachments...)
+	}
+	if len(postIDs) > 0 {
+		if _, err := r.postLikes.DeleteMany(ctx, bson.M{"post_id": bson.M{"$in": postIDs}}); err != nil {
+			return nil, err
+		}
+		if _, err := r.comments.DeleteMany(ctx, bson.M{"post_id": bson.M{"$in": postIDs}}); err != nil {
+			return nil, err
+		}
+		if _, err := r.postRevisions.DeleteMany(ctx, bson.M{"post_id": bson.M{"$in": postIDs}}); err != nil {
+			return nil, err
+		}
+		if _, err := r.pollVotes.DeleteMany(ctx, bson.M{"post_id": bson.M{"$in": postIDs}}); err != nil {
+			return nil, err
+		}
+		if err := deleteBookmarksOf(ctx, r.bookmarks, constants.BookmarkTypePost, postIDs...); err != nil {
+			return nil, err
+		}
+		if err := removeReposts(ctx, r.posts, r.bookmarks, posts...); err != nil {
+			return nil, err
+		}
+		if _, err := r.posts.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": postIDs}}); err != nil {
+			return nil, err
+		}
+	}
+
+	jobIDs, err := distinctIDs(ctx, r.jobs, bson.M{"posted_by": userID})
+	if err != nil {
+		return nil, err
+	}
+	if len(jobIDs) > 0 {
+		if _, err := r.jobLikes.DeleteMany(ctx, bson.M{"post_id": bson.M{"$in": jobIDs}}); err != nil {
+			return nil, err
+		}
+		if err := deleteBookmarksOf(ctx, r.bookmarks, constants.BookmarkTypeJob, jobIDs...); err != nil {
+			return nil, err
+		}
+		if _, err := r.jobs.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": jobIDs}}); err != nil {
+			return nil, err
+		}
+	}
+
+	contentIDs := append(append([]primitive.ObjectID{}, postIDs...), jobIDs...)
+	if len(contentIDs) > 0 {
+		if _, err := r.reports.DeleteMany(ctx, bson.M{"reported_post_id": bson.M{"$in": contentIDs}}); err != nil {
+			return nil, err
+		}
+	}
+
+	// likes on the content of other users, the counters go down with them
+	if err := r.removeLikes(ctx, r.postLikes, r.posts, userID); err != nil {
+		return nil, err
+	}
+	if err := r.removeLikes(ctx, r.jobLikes, r.jobs, userID); err != nil {
+		return nil, err
+	}
+	if err := r.removePollVotes(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	_, err = r.comments.UpdateMany(ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{"user_id": primitive.NilObjectID, "content": DeletedCommentContent}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.removeConnections(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"$or": []bson.M{{"user_id": userID}, {"to": userID}}}
+	if len(contentIDs) > 0 {
+		filter["$or"] = append(filter["$or"].([]bson.M), bson.M{"content_id": bson.M{"$in": contentIDs}})
+	}
+	if _, err := r.notifications.DeleteMany(ctx, filter); err != nil {
+		return nil, err
+	}
+
+	// moderation history and course materials stay, only the link to the user goes
+	if _, err := r.reports.UpdateMany(ctx, bson.M{"reported_by": userID}, bson.M{"$set": bson.M{"reported_by": primitive.NilObjectID}}); err != nil {
+		return nil, err
+	}
+	if _, err := r.materials.UpdateMany(ctx, bson.M{"uploaded_by": userID}, bson.M{"$set": bson.M{"uploaded_by": primitive.NilObjectID}}); err != nil {
+		return nil, err
+	}
+
+	var requests []models.VerificationRequests
+	if err := findAll(ctx, r.verificationRequests, bson.M{"user_id": userID}, &requests); err != nil {
+		return nil, err
+	}
+	for _, request := range requests {
+		files = append(files, request.EvidenceURLs...)
+	}
+
+	for _, collection := range []*mongo.Collection{r.sessions, r.mfaChallenges, r.roleAssignments, r.verificationRequests, r.emailChanges, r.identities, r.accessTokens, r.handleHistory, r.bookmarks, r.bookmarkFolders} {
+		if _, err := collection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+			return nil, err
+		}
+	}
+	for _, collection := range []*mongo.Collection{r.emailVerifications, r.passwordResets} {
+		if _, err := collection.DeleteMany(ctx, bson.M{"user_email": user.Email}); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := r.users.DeleteOne(ctx, bson.M{"_id": userID}); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (r *accountRepository) ExportUserData(ctx context.Context, userID primitive.ObjectID) (models.AccountExport, error) {
+	export := models.AccountExport{ExportedAt: time.Now()}
+
+	err := r.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&export.Profile)
+	if err == mongo.ErrNoDocuments {
+		return models.AccountExport{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.AccountExport{}, err
+	}
+	export.Profile.PasswordHash = ""
+
+	sections := []struct {
+		collection *mongo.Collection
+		filter     bson.M
+		results    interface{}
+	}{
+		{r.posts, bson.M{"user_id": userID}, &export.Posts},
+		{r.postRevisions, bson.M{"user_id": userID}, &export.PostRevisions},
+		{r.pollVotes, bson.M{"user_id": userID}, &export.PollVotes},
+		{r.comments, bson.M{"user_id": userID}, &export.Comments},
+		{r.postLikes, bson.M{"user_id": userID}, &export.PostLikes},
+		{r.jobLikes, bson.M{"user_id": userID}, &export.JobLikes},
+		{r.connects, bson.M{"$or": []bson.M{{"connector_id": userID}, {"connectee_id": userID}}}, &export.Connections},
+		{r.notifications, bson.M{"$or": []bson.M{{"user_id": userID}, {"to": userID}}}, &export.Notifications},
+		{r.reports, bson.M{"reported_by": userID}, &export.Reports},
+		{r.jobs, bson.M{"posted_by": userID}, &export.Jobs},
+		{r.materials, bson.M{"uploaded_by": userID}, &export.Materials},
+		{r.sessions, bson.M{"user_id": userID}, &export.Sessions},
+		{r.handleHistory, bson.M{"user_id": userID}, &export.HandleHistory},
+		{r.bookmarks, bson.M{"user_id": userID}, &export.Bookmarks},
+		{r.bookmarkFolders, bson.M{"user_id": userID}, &export.BookmarkFolders},
+		{r.verificationRequests, bson.M{"user_id": userID}, &export.VerificationRequests},
+		{r.roleAssignments, bson.M{"user_id": userID}, &export.RoleAssignments},
+		{r.emailChanges, bson.M{"user_id": userID}, &export.EmailChanges},
+		{r.identities, bson.M{"user_id": userID}, &export.LinkedAccounts},
+		{r.accessTokens, bson.M{"user_id": userID}, &export.AccessTokens},
+	}
+	for _, section := range sections {
+		if err := findAll(ctx, section.collection, section.filter, section.results); err != nil {
+			return models.AccountExport{}, err
+		}
+	}
+	return export, nil
+}
+
+// removeLikes deletes the likes of the user and lowers the like count of the liked documents
+func (r *accountRepository) removeLikes(ctx context.Context, likes, targets *mongo.Collection, userID primitive.ObjectID) error {
+	var userLikes []models.Like
+	if err := findAll(ctx, likes, bson.M{"user_id": userID}, &userLikes); err != nil {
+		return err
+	}
+	for _, like := range userLikes {
+		if _, err := targets.UpdateOne(ctx, bson.M{"_id": like.PostID}, bson.M{"$inc": bson.M{"likes": -1}}); err != nil {
+			return err
+		}
+	}
+	_, err := likes.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// removePollVotes deletes the votes of the user on the polls of other users and takes
+// them out of the tallies
+func (r *accountRepository) removePollVotes(ctx context.Context, userID primitive.ObjectID) error {
+	var votes []models.PollVotes
+	if err := findAll(ctx, r.pollVotes, bson.M{"user_id": userID}, &votes); err != nil {
+		return err
+	}
+	for _, vote := range votes {
+		decrements := bson.M{"poll.voters": -1}
+		for _, choice := range vote.Options {
+			decrements["poll.options."+strconv.Itoa(choice)+".votes"] = -1
+		}
+		if _, err := r.posts.UpdateOne(ctx, bson.M{"_id": vote.PostID, "poll": bson.M{"$exists": true}}, bson.M{"$inc": decrements}); err != nil {
+			return err
+		}
+	}
+	_, err := r.pollVotes.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// removeConnections deletes the connections of the user, the other side of an
+// accepted connection loses one from its follow count
+func (r *accountRepository) removeConnections(ctx context.Context, userID primitive.ObjectID) error {
+	var connects []models.Connects
+	filter := bson.M{"$or": []bson.M{{"connector_id": userID}, {"connectee_id": userID}}}
+	if err := findAll(ctx, r.connects, filter, &connects); err != nil {
+		return err
+	}
+	for _, connect := range connects {
+		if !connect.Accepted {
+			continue
+		}
+		other := connect.ConnectorID
+		if other == userID {
+			other = connect.ConnecteeID
+		}
+		if _, err := r.users.UpdateOne(ctx, bson.M{"_id": other}, bson.M{"$inc": bson.M{"follow_count": -1}}); err != nil {
+			return err
+		}
+	}
+	_, err := r.connects.DeleteMany(ctx, filter)
+	return err
+}
+
+func findAll(ctx context.Context, collection *mongo.Collection, filter bson.M, results interface{}) error {
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
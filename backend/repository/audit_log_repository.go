@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AuditLogRepository interface {
+	CreateAuditLog(ctx context.Context, auditLog models.AuditLogs) error
+}
+
+type auditLogRepository struct {
+	auditLogs *mongo.Collection
+}
+
+func NewAuditLogRepository(db *mongo.Database) AuditLogRepository {
+	return &auditLogRepository{
+		auditLogs: db.Collection("audit_logs"),
+	}
+}
+
+func (r *auditLogRepository) CreateAuditLog(ctx context.Context, auditLog models.AuditLogs) error {
+	auditLog.ID = primitive.NewObjectID()
+	if auditLog.CreatedAt.IsZero() {
+		auditLog.CreatedAt = time.Now()
+	}
+	_, err := r.auditLogs.InsertOne(ctx, auditLog)
+	return err
+}
@@ -3,7 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
-	"fmt"
+	"log"
 	"time"
 
 	"github.com/chera-mihiretu/IKnow/domain/constants"
@@ -14,15 +14,41 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// VerificationTokenTTL is how long verification and password reset links work
+	VerificationTokenTTL = 24 * time.Hour
+	// UnverifiedUserTTL is how long a signup waits for its email to be verified,
+	// every resent verification email restarts it
+	UnverifiedUserTTL = 7 * 24 * time.Hour
+)
+
+var (
+	ErrUserNotFound     = errors.New("user not found")
+	ErrWrongCredentials = errors.New("wrong cridential or maybe the user have no password, try forgot password")
+	ErrInvalidMagicLink = errors.New("the login link is invalid, expired or was already used")
+	ErrUserExists       = errors.New("user already exists with this email")
+	// ErrPasswordResetRequired is returned for a correct password of an account whose email
+	// change was reverted, whoever changed the email may know the password
+	ErrPasswordResetRequired = errors.New("the password of this account must be reset, use the reset link sent to your email")
 )
 
 type AuthRepository interface {
 	RegisterUserWithEmail(ctx context.Context, user models.User) error
-	LoginWithEmail(ctx context.Context, user models.User) (string, error)
-	SignInWithGoogle(ctx context.Context, user models.User) (string, error)
+	LoginWithEmail(ctx context.Context, user models.User, device models.SessionDevice) (models.LoginResult, error)
+	SignInWithProvider(ctx context.Context, identity models.UserIdentities, device models.SessionDevice) (models.LoginResult, error)
+	Logout(ctx context.Context, userID, sessionID primitive.ObjectID) error
+	LogoutAllSessions(ctx context.Context, userID, exceptSessionID primitive.ObjectID) (int64, error)
+	GetUnverifiedUser(ctx context.Context, token models.EmailVerification) (models.User, error)
 	VerifyEmail(ctx context.Context, token models.EmailVerification) error
 	ForgotPassword(ctx context.Context, user models.User) error
 	ResetPassword(ctx context.Context, user models.User, token models.EmailVerification) error
+	ResendVerificationEmail(ctx context.Context, email string) error
+	SendMagicLink(ctx context.Context, email string) error
+	LoginWithMagicLink(ctx context.Context, token string, device models.SessionDevice) (models.LoginResult, error)
+	EnsureIndexes(ctx context.Context) error
 }
 
 type authRepository struct {
@@ -30,32 +56,45 @@ type authRepository struct {
 	UsersCollectionUnverified *mongo.Collection
 	VerificationsCollection   *mongo.Collection
 	PasswordResetsCollection  *mongo.Collection
+	MagicLinksCollection      *mongo.Collection
+	HandleHistoryCollection   *mongo.Collection
 	universityRepository      UniversityRepository
+	sessionRepository         SessionRepository
+	mfaRepository             MFARepository
+	identityRepository        IdentityRepository
 }
 
-func NewAuthRepository(db *mongo.Database, universityRepo UniversityRepository) AuthRepository {
+func NewAuthRepository(db *mongo.Database, universityRepo UniversityRepository, sessionRepo SessionRepository, mfaRepo MFARepository, identityRepo IdentityRepository) AuthRepository {
 	return &authRepository{
 		UsersCollection:           db.Collection("users"),
 		UsersCollectionUnverified: db.Collection("users_temp"),
 		VerificationsCollection:   db.Collection("email_verifications"),
 		PasswordResetsCollection:  db.Collection("password_resets"),
+		MagicLinksCollection:      db.Collection("magic_links"),
+		HandleHistoryCollection:   db.Collection("handle_history"),
 		universityRepository:      universityRepo,
+		sessionRepository:         sessionRepo,
+		mfaRepository:             mfaRepo,
+		identityRepository:        identityRepo,
 	}
 }
 
 func (repo *authRepository) RegisterUserWithEmail(ctx context.Context, user models.User) error {
 	// Check if the user already exists
 
-	id := primitive.NewObjectID()
-	user.ID = id
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	id := user.ID
+	user.Email = normalizeEmail(user.Email)
 	userExists, err := repo.UsersCollection.CountDocuments(ctx, map[string]interface{}{
 		"email": user.Email,
 	})
 	if err != nil {
-		return errors.New("user already exists with this email")
+		return ErrUserExists
 	}
 	if userExists > 0 {
-		return errors.New("user already exists with this email")
+		return ErrUserExists
 	}
 	user.Role = string(constants.UserRoleStudent)
 	if user.AcedemicYear == 0 {
@@ -64,17 +103,19 @@ func (repo *authRepository) RegisterUserWithEmail(ctx context.Context, user mode
 	user.IsVerified = false
 	user.IsTeacher = false
 	user.BlueBadge = false
-	user.IsComplete = false
-	if user.UniversityID != nil && user.UniversityID.Hex() != "" {
-		exist, err := repo.universityRepository.VerifyExistence(ctx, *user.UniversityID)
+	// the university comes from the email domain, not from what the client claims, or from
+	// the invitation the usecase checked for this email
+	if user.InvitationID == nil {
+		university, err := repo.universityRepository.GetUniversityByEmail(ctx, user.Email)
 		if err != nil {
-
+			if err == ErrEmailDomainNotAllowed {
+				return err
+			}
 			return errors.New("could not verify university existence")
 		}
-		if exist {
-			user.IsComplete = true
-		}
+		user.UniversityID = &university.ID
 	}
+	user.IsComplete = true
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 
@@ -93,7 +134,7 @@ func (repo *authRepository) RegisterUserWithEmail(ctx context.Context, user mode
 	verification.Token = token
 	verification.UserEmail = user.Email
 	verification.SentAt = time.Now()
-	verification.ExpiresAt = time.Now().Add(24 * time.Hour)
+	verification.ExpiresAt = time.Now().Add(VerificationTokenTTL)
 
 	repo.VerificationsCollection.InsertOne(ctx, verification)
 
@@ -107,78 +148,125 @@ func (repo *authRepository) RegisterUserWithEmail(ctx context.Context, user mode
 
 }
 
-func (repo *authRepository) LoginWithEmail(ctx context.Context, user models.User) (string, error) {
-	filter := bson.M{"email": user.Email}
+func (repo *authRepository) LoginWithEmail(ctx context.Context, user models.User, device models.SessionDevice) (models.LoginResult, error) {
+	filter := bson.M{"email": normalizeEmail(user.Email)}
 	var foundUser models.User
 	err := repo.UsersCollection.FindOne(ctx, filter).Decode(&foundUser)
-	fmt.Println("Found user:", foundUser, "Error:", err)
 	if err != nil {
-		return "", errors.New("user not found")
+		return models.LoginResult{}, ErrUserNotFound
 	}
 
 	if !hashing.ComparePassword(foundUser.PasswordHash, user.PasswordHash) {
-		return "", errors.New("wrong cridential or maybe the user have no password, try forgot password")
+		return models.LoginResult{}, ErrWrongCredentials
 	}
-
-	token, err := middleware.GenerateJWT(foundUser.ID.Hex(), foundUser.Role)
-	if err != nil {
-		return "", errors.New("could not generate JWT token")
+	if foundUser.PasswordResetRequired {
+		return models.LoginResult{}, ErrPasswordResetRequired
 	}
 
-	return token, nil
+	return repo.mfaRepository.StartLogin(ctx, foundUser, device)
 }
-func (repo *authRepository) SignInWithGoogle(ctx context.Context, user models.User) (string, error) {
-	id := primitive.NewObjectID()
-	user.ID = id
-	userExists, err := repo.UsersCollection.CountDocuments(ctx, map[string]interface{}{
-		"email": user.Email,
-	})
 
-	if err != nil {
-		return "", errors.New("cannot check if user exists")
+// SignInWithProvider logs in the user linked to the provider account. An account with the
+// same email gets the provider linked when the provider verified the email, otherwise a
+// new user is registered
+func (repo *authRepository) SignInWithProvider(ctx context.Context, identity models.UserIdentities, device models.SessionDevice) (models.LoginResult, error) {
+	linked, err := repo.identityRepository.FindIdentity(ctx, identity.Provider, identity.ProviderUserID)
+	if err == nil {
+		var linkedUser models.User
+		if err := repo.UsersCollection.FindOne(ctx, bson.M{"_id": linked.UserID}).Decode(&linkedUser); err != nil {
+			return models.LoginResult{}, errors.New("user not found" + err.Error())
+		}
+		if err := repo.identityRepository.TouchIdentity(ctx, linked.ID); err != nil {
+			return models.LoginResult{}, errors.New("could not update linked account")
+		}
+		return repo.mfaRepository.StartLogin(ctx, linkedUser, device)
+	}
+	if err != ErrIdentityNotFound {
+		return models.LoginResult{}, errors.New("cannot check if user exists")
 	}
 
-	if userExists > 0 {
-		filter := bson.M{"email": user.Email}
-		var foundUser models.User
-		err := repo.UsersCollection.FindOne(ctx, filter).Decode(&foundUser)
-		if err != nil {
-			return "", errors.New("user not found" + err.Error())
+	// google accounts linked before the identities were stored only have the google id
+	if identity.Provider == "google" {
+		var linkedUser models.User
+		err := repo.UsersCollection.FindOne(ctx, bson.M{"google_id": identity.ProviderUserID}).Decode(&linkedUser)
+		if err == nil {
+			return repo.linkAndLogin(ctx, linkedUser, identity, device)
 		}
-
-		token, err := middleware.GenerateJWT(foundUser.ID.Hex(), foundUser.Role)
-		if err != nil {
-			return "", errors.New("could not generate JWT token")
+		if err != mongo.ErrNoDocuments {
+			return models.LoginResult{}, errors.New("cannot check if user exists")
 		}
+	}
 
-		return token, nil
-	} else {
-		id := primitive.NewObjectID()
+	var foundUser models.User
+	err = repo.UsersCollection.FindOne(ctx, emailFilter(identity.Email)).Decode(&foundUser)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return models.LoginResult{}, errors.New("cannot check if user exists")
+	}
+	// an unverified email would let anyone with a provider account take over the user
+	// or register with a university email they do not own
+	if !identity.EmailVerified {
+		return models.LoginResult{}, ErrProviderEmailUnverified
+	}
+	if err == nil {
+		return repo.linkAndLogin(ctx, foundUser, identity, device)
+	}
 
-		user.ID = id
-		user.Role = string(constants.UserRoleStudent)
-		user.IsVerified = false
-		user.IsTeacher = false
-		user.BlueBadge = false
-		user.CreatedAt = time.Now()
-		user.UpdatedAt = time.Now()
+	university, err := repo.universityRepository.GetUniversityByEmail(ctx, identity.Email)
+	if err != nil {
+		if err == ErrEmailDomainNotAllowed {
+			return models.LoginResult{}, err
+		}
+		return models.LoginResult{}, errors.New("could not verify university existence")
+	}
 
-		_, err = repo.UsersCollection.InsertOne(ctx, user)
+	var user models.User
+	user.ID = primitive.NewObjectID()
+	user.Email = normalizeEmail(identity.Email)
+	user.Name = identity.Name
+	user.ProfileImageURL = identity.AvatarURL
+	if identity.Provider == "google" {
+		user.GoogleID = identity.ProviderUserID
+	}
+	user.UniversityID = &university.ID
+	user.Role = string(constants.UserRoleStudent)
+	user.IsVerified = false
+	user.IsTeacher = false
+	user.BlueBadge = false
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
 
-		if err != nil {
-			return "", errors.New("could not insert user into collection")
-		}
+	_, err = repo.UsersCollection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return models.LoginResult{}, ErrUserExists
+	}
+	if err != nil {
+		return models.LoginResult{}, errors.New("could not insert user into collection")
+	}
+	assignHandleOnSignUp(ctx, repo.UsersCollection, repo.HandleHistoryCollection, user)
 
-		token, err := middleware.GenerateJWT(id.Hex(), user.Role)
-		if err != nil {
-			return "", errors.New("could not generate JWT token")
-		}
+	return repo.linkAndLogin(ctx, user, identity, device)
+}
 
-		return token, nil
+func (repo *authRepository) linkAndLogin(ctx context.Context, user models.User, identity models.UserIdentities, device models.SessionDevice) (models.LoginResult, error) {
+	if _, err := repo.identityRepository.LinkIdentity(ctx, user.ID, identity); err != nil {
+		if err == ErrProviderAlreadyLinked || err == ErrIdentityLinked {
+			return models.LoginResult{}, err
+		}
+		return models.LoginResult{}, errors.New("could not link provider account")
 	}
+	return repo.mfaRepository.StartLogin(ctx, user, device)
+}
 
+func (repo *authRepository) Logout(ctx context.Context, userID, sessionID primitive.ObjectID) error {
+	return repo.sessionRepository.RevokeUserSession(ctx, userID, sessionID)
 }
-func (repo *authRepository) VerifyEmail(ctx context.Context, token models.EmailVerification) error {
+
+func (repo *authRepository) LogoutAllSessions(ctx context.Context, userID, exceptSessionID primitive.ObjectID) (int64, error) {
+	return repo.sessionRepository.RevokeAllSessions(ctx, userID, exceptSessionID)
+}
+
+// GetUnverifiedUser returns the signed up user the verification token is for
+func (repo *authRepository) GetUnverifiedUser(ctx context.Context, token models.EmailVerification) (models.User, error) {
 	filter := bson.M{"user_email": token.UserEmail, "token": token.Token}
 
 	var verify models.EmailVerification
@@ -186,19 +274,29 @@ func (repo *authRepository) VerifyEmail(ctx context.Context, token models.EmailV
 	err := repo.VerificationsCollection.FindOne(ctx, filter).Decode(&verify)
 
 	if err != nil {
-		return errors.New("verification token not found")
+		return models.User{}, errors.New("verification token not found")
 	}
 
 	if verify.ExpiresAt.Before(time.Now()) {
-		return errors.New("verification token has expired")
+		return models.User{}, errors.New("verification token has expired")
 	}
 
 	filter = bson.M{"_id": verify.UserID}
 	var user models.User
 	err = repo.UsersCollectionUnverified.FindOne(ctx, filter).Decode(&user)
 	if err != nil {
-		return errors.New("user not found")
+		return models.User{}, errors.New("user not found")
+	}
+	return user, nil
+}
+
+func (repo *authRepository) VerifyEmail(ctx context.Context, token models.EmailVerification) error {
+	user, err := repo.GetUnverifiedUser(ctx, token)
+	if err != nil {
+		return err
 	}
+	// the invite code was redeemed by now, only the invitation id stays on the user
+	user.InviteCode = ""
 
 	count, err := repo.UsersCollection.CountDocuments(ctx, bson.M{})
 	if err != nil {
@@ -213,10 +311,15 @@ func (repo *authRepository) VerifyEmail(ctx context.Context, token models.EmailV
 	// TODO : Fix the concurent issue if may occur
 	_, err = repo.UsersCollection.InsertOne(ctx, user)
 
+	// somebody else verified the same email first
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUserExists
+	}
 	if err != nil {
 		return errors.New("could not insert user into verified collection")
 	}
-	filter = bson.M{"email": user.Email}
+	assignHandleOnSignUp(ctx, repo.UsersCollection, repo.HandleHistoryCollection, user)
+	filter := bson.M{"email": user.Email}
 	_, err = repo.UsersCollectionUnverified.DeleteMany(ctx, filter)
 	if err != nil {
 		return errors.New("could not delete user from unverified collection")
@@ -235,6 +338,7 @@ func (repo *authRepository) ForgotPassword(ctx context.Context, user models.User
 
 	var newUser models.User
 
+	user.Email = normalizeEmail(user.Email)
 	err := repo.UsersCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&newUser)
 
 	if err != nil {
@@ -255,7 +359,7 @@ func (repo *authRepository) ForgotPassword(ctx context.Context, user models.User
 	verification.Token = token
 	verification.UserEmail = user.Email
 	verification.SentAt = time.Now()
-	verification.ExpiresAt = time.Now().Add(24 * time.Hour)
+	verification.ExpiresAt = time.Now().Add(VerificationTokenTTL)
 
 	err = email.SendPasswordResetEmail(newUser.Email, token)
 	if err != nil {
@@ -290,7 +394,10 @@ func (repo *authRepository) ResetPassword(ctx context.Context, theUser models.Us
 	if err != nil {
 		return errors.New("could not hash new password")
 	}
-	_, err = repo.UsersCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"password_hash": newPass}})
+	_, err = repo.UsersCollection.UpdateOne(ctx, filter, bson.M{
+		"$set":   bson.M{"password_hash": newPass},
+		"$unset": bson.M{"password_reset_required": ""},
+	})
 	if err != nil {
 		return errors.New("could not update password")
 	}
@@ -301,3 +408,205 @@ func (repo *authRepository) ResetPassword(ctx context.Context, theUser models.Us
 	return nil
 
 }
+
+// ResendVerificationEmail replaces the verification links of a pending signup with a new one
+func (repo *authRepository) ResendVerificationEmail(ctx context.Context, userEmail string) error {
+	var user models.User
+	err := repo.UsersCollectionUnverified.FindOne(ctx,
+		bson.M{"email": normalizeEmail(userEmail)},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := middleware.GenerateVerficationToken(user.Email)
+	if err != nil {
+		return errors.New("could not generate verification token")
+	}
+
+	if _, err := repo.VerificationsCollection.DeleteMany(ctx, bson.M{"user_email": user.Email}); err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = repo.VerificationsCollection.InsertOne(ctx, models.EmailVerification{
+		UserID:    user.ID,
+		UserEmail: user.Email,
+		Token:     token,
+		SentAt:    now,
+		ExpiresAt: now.Add(VerificationTokenTTL),
+	})
+	if err != nil {
+		return errors.New("could not insert verification token")
+	}
+	_, err = repo.UsersCollectionUnverified.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"updated_at": now}})
+	if err != nil {
+		return err
+	}
+
+	if err := email.SendVerificationEmail(user.Email, token); err != nil {
+		return errors.New("could not send verification email")
+	}
+	return nil
+}
+
+func (repo *authRepository) SendMagicLink(ctx context.Context, userEmail string) error {
+	var user models.User
+	err := repo.UsersCollection.FindOne(ctx, bson.M{"email": normalizeEmail(userEmail)}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := middleware.GenerateMagicLinkToken(user.Email)
+	if err != nil {
+		return errors.New("could not generate login link")
+	}
+	now := time.Now()
+	_, err = repo.MagicLinksCollection.InsertOne(ctx, models.MagicLinks{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hashing.HashToken(token),
+		ExpiresAt: now.Add(middleware.MagicLinkTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return errors.New("could not save login link")
+	}
+
+	if err := email.SendMagicLinkEmail(user.Email, token); err != nil {
+		return errors.New("could not send login link email")
+	}
+	return nil
+}
+
+// LoginWithMagicLink exchanges a login link for a session, the link is marked used
+// before anything else so a replayed link never logs in
+func (repo *authRepository) LoginWithMagicLink(ctx context.Context, token string, device models.SessionDevice) (models.LoginResult, error) {
+	var link models.MagicLinks
+	err := repo.MagicLinksCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"token_hash": hashing.HashToken(token),
+			"used":       false,
+			"expires_at": bson.M{"$gt": time.Now()},
+		},
+		bson.M{"$set": bson.M{"used": true}},
+	).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return models.LoginResult{}, ErrInvalidMagicLink
+	}
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	var user models.User
+	err = repo.UsersCollection.FindOne(ctx, bson.M{"_id": link.UserID, "email": link.Email}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return models.LoginResult{}, ErrInvalidMagicLink
+	}
+	if err != nil {
+		return models.LoginResult{}, err
+	}
+
+	return repo.mfaRepository.StartLogin(ctx, user, device)
+}
+
+// EnsureIndexes creates the ttl indexes that make mongo remove expired signups and links, and
+// the unique email index of the users
+func (repo *authRepository) EnsureIndexes(ctx context.Context) error {
+	ttlIndexes := []struct {
+		collection *mongo.Collection
+		field      string
+		after      time.Duration
+	}{
+		{repo.UsersCollectionUnverified, "updated_at", UnverifiedUserTTL},
+		{repo.VerificationsCollection, "expires_at", 0},
+		{repo.PasswordResetsCollection, "expires_at", 0},
+		{repo.MagicLinksCollection, "expires_at", 0},
+	}
+	for _, index := range ttlIndexes {
+		_, err := index.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: index.field, Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(index.after.Seconds())),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// the emails stored before the unique index are made to fit it once, when it is built
+	specifications, err := repo.UsersCollection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
+	}
+	indexed := false
+	for _, specification := range specifications {
+		indexed = indexed || specification.Name == "email_1"
+	}
+	if !indexed {
+		if err := repo.migrateEmails(ctx); err != nil {
+			return err
+		}
+	}
+
+	// emails are compared regardless of case, bots have no email and are left out
+	_, err = repo.UsersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetCollation(&options.Collation{Locale: "en", Strength: 2}).
+			SetPartialFilterExpression(bson.M{"email": bson.M{"$gt": ""}}),
+	})
+	return err
+}
+
+// migrateEmails lower cases the stored emails. Of the accounts sharing an email regardless of
+// case only the oldest keeps it, the others move it to duplicate_email so the unique index can
+// be built; they can not log in with the email until an admin sorts them out
+func (repo *authRepository) migrateEmails(ctx context.Context) error {
+	cursor, err := repo.UsersCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"email": bson.M{"$gt": ""}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"$toLower": "$email"}, "ids": bson.M{"$push": "$_id"}}}},
+		{{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var duplicates []struct {
+		IDs []primitive.ObjectID `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+	for _, duplicate := range duplicates {
+		log.Printf("Setting aside the email of %d accounts sharing it with %s", len(duplicate.IDs)-1, duplicate.IDs[0].Hex())
+		_, err := repo.UsersCollection.UpdateMany(ctx,
+			bson.M{"_id": bson.M{"$in": duplicate.IDs[1:]}},
+			mongo.Pipeline{
+				{{Key: "$set", Value: bson.M{"duplicate_email": "$email"}}},
+				{{Key: "$unset", Value: "email"}},
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, collection := range []*mongo.Collection{repo.UsersCollection, repo.UsersCollectionUnverified} {
+		_, err := collection.UpdateMany(ctx,
+			bson.M{"email": primitive.Regex{Pattern: "[A-Z]"}},
+			mongo.Pipeline{{{Key: "$set", Value: bson.M{"email": bson.M{"$toLower": "$email"}}}}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	MaxBookmarkFolders       = 50
+	MaxBookmarkFolderNameLen = 50
+)
+
+var (
+	ErrInvalidBookmarkType    = errors.New("a bookmark is of a post, a job or a material")
+	ErrBookmarkTargetNotFound = errors.New("the content to bookmark was not found")
+	ErrBookmarkNotFound       = errors.New("bookmark not found")
+	ErrBookmarkFolderNotFound = errors.New("bookmark folder not found")
+	ErrBookmarkFolderName     = errors.New("a folder name is 1 to 50 characters")
+	ErrBookmarkFolderExists   = errors.New("you already have a folder with this name")
+	ErrTooManyBookmarkFolders = errors.New("you can have at most 50 bookmark folders")
+)
+
+type BookmarkRepository interface {
+	AddBookmark(ctx context.Context, bookmark models.Bookmarks) (models.Bookmarks, error)
+	RemoveBookmark(ctx context.Context, userID primitive.ObjectID, targetType string, targetID primitive.ObjectID) error
+	GetBookmarks(ctx context.Context, userID primitive.ObjectID, targetType string, folderID *primitive.ObjectID, page int) ([]models.Bookmarks, error)
+	CheckListOfBookmarks(ctx context.Context, userID primitive.ObjectID, targetType string, targetIDs []primitive.ObjectID) ([]models.Bookmarks, error)
+	CreateFolder(ctx context.Context, folder models.BookmarkFolders) (models.BookmarkFolders, error)
+	GetFolders(ctx context.Context, userID primitive.ObjectID) ([]models.BookmarkFolders, error)
+	RenameFolder(ctx context.Context, userID, folderID primitive.ObjectID, name string) (models.BookmarkFolders, error)
+	DeleteFolder(ctx context.Context, userID, folderID primitive.ObjectID) error
+	EnsureIndexes(ctx context.Context) error
+}
+
+type bookmarkRepository struct {
+	bookmarks *mongo.Collection
+	folders   *mongo.Collection
+	posts     *mongo.Collection
+	jobs      *mongo.Collection
+	materials *mongo.Collection
+}
+
+func NewBookmarkRepository(db *mongo.Database) BookmarkRepository {
+	return &bookmarkRepository{
+		bookmarks: db.Collection("bookmarks"),
+		folders:   db.Collection("bookmark_folders"),
+		posts:     db.Collection("posts"),
+		jobs:      db.Collection("jobs"),
+		materials: db.Collection("materials"),
+	}
+}
+
+// ValidBookmarkType tells whether the type is one of the kinds of content a user can save
+func ValidBookmarkType(targetType string) bool {
+	switch targetType {
+	case constants.BookmarkTypePost, constants.BookmarkTypeJob, constants.BookmarkTypeMaterial:
+		return true
+	}
+	return false
+}
+
+// deleteBookmarksOf removes the bookmarks of content that is deleted
+func deleteBookmarksOf(ctx context.Context, bookmarks *mongo.Collection, targetType string, targetIDs ...primitive.ObjectID) error {
+	if len(targetIDs) == 0 {
+		return nil
+	}
+	_, err := bookmarks.DeleteMany(ctx, bson.M{"target_type": targetType, "target_id": bson.M{"$in": targetIDs}})
+	return err
+}
+
+// targetExists checks that the content can be bookmarked, drafts and blocked posts can not
+func (r *bookmarkRepository) targetExists(ctx context.Context, targetType string, targetID primitive.ObjectID) error {
+	var collection *mongo.Collection
+	filter := bson.M{"_id": targetID}
+	switch targetType {
+	case constants.BookmarkTypePost:
+		collection = r.posts
+		filter = published(bson.M{"_id": targetID, "is_validated": true})
+	case constants.BookmarkTypeJob:
+		collection = r.jobs
+	case constants.BookmarkTypeMaterial:
+		collection = r.materials
+	default:
+		return ErrInvalidBookmarkType
+	}
+
+	err := collection.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	if err == mongo.ErrNoDocuments {
+		return ErrBookmarkTargetNotFound
+	}
+	return err
+}
+
+func (r *bookmarkRepository) ownFolder(ctx context.Context, userID, folderID primitive.ObjectID) (models.BookmarkFolders, error) {
+	var folder models.BookmarkFolders
+	err := r.folders.FindOne(ctx, bson.M{"_id": folderID, "user_id": userID}).Decode(&folder)
+	if err == mongo.ErrNoDocuments {
+		return models.BookmarkFolders{}, ErrBookmarkFolderNotFound
+	}
+	return folder, err
+}
+
+// AddBookmark saves the content for the user, saving it again moves it to the given folder
+func (r *bookmarkRepository) AddBookmark(ctx context.Context, bookmark models.Bookmarks) (models.Bookmarks, error) {
+	if err := r.targetExists(ctx, bookmark.TargetType, bookmark.TargetID); err != nil {
+		return models.Bookmarks{}, err
+	}
+	if bookmark.FolderID != nil {
+		if _, err := r.ownFolder(ctx, bookmark.UserID, *bookmark.FolderID); err != nil {
+			return models.Bookmarks{}, err
+		}
+	}
+
+	filter := bson.M{"user_id": bookmark.UserID, "target_type": bookmark.TargetType, "target_id": bookmark.TargetID}
+	update := bson.M{"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "created_at": time.Now()}}
+	if bookmark.FolderID != nil {
+		update["$set"] = bson.M{"folder_id": *bookmark.FolderID}
+	} else {
+		update["$unset"] = bson.M{"folder_id": ""}
+	}
+
+	var saved models.Bookmarks
+	err := r.bookmarks.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&saved)
+	if mongo.IsDuplicateKeyError(err) {
+		// the same bookmark was added at the same time, the other request made it
+		err = r.bookmarks.FindOne(ctx, filter).Decode(&saved)
+	}
+	if err != nil {
+		return models.Bookmarks{}, err
+	}
+	return saved, nil
+}
+
+func (r *bookmarkRepository) RemoveBookmark(ctx context.Context, userID primitive.ObjectID, targetType string, targetID primitive.ObjectID) error {
+	if !ValidBookmarkType(targetType) {
+		return ErrInvalidBookmarkType
+	}
+	res, err := r.bookmarks.DeleteOne(ctx, bson.M{"user_id": userID, "target_type": targetType, "target_id": targetID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrBookmarkNotFound
+	}
+	return nil
+}
+
+// GetBookmarks lists the bookmarks of the user, the latest first, of any type when the type
+// is empty and in any folder when the folder is nil
+func (r *bookmarkRepository) GetBookmarks(ctx context.Context, userID primitive.ObjectID, targetType string, folderID *primitive.ObjectID, page int) ([]models.Bookmarks, error) {
+	filter := bson.M{"user_id": userID}
+	if targetType != "" {
+		if !ValidBookmarkType(targetType) {
+			return nil, ErrInvalidBookmarkType
+		}
+		filter["target_type"] = targetType
+	}
+	if folderID != nil {
+		if _, err := r.ownFolder(ctx, userID, *folderID); err != nil {
+			return nil, err
+		}
+		filter["folder_id"] = *folderID
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((page - 1) * Pagesize)).
+		SetLimit(int64(Pagesize + 1))
+	cursor, err := r.bookmarks.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	bookmarks := []models.Bookmarks{}
+	if err := cursor.All(ctx, &bookmarks); err != nil {
+		return nil, err
+	}
+	return bookmarks, nil
+}
+
+// CheckListOfBookmarks returns which of the given posts, jobs or materials the user saved
+func (r *bookmarkRepository) CheckListOfBookmarks(ctx context.Context, userID primitive.ObjectID, targetType string, targetIDs []primitive.ObjectID) ([]models.Bookmarks, error) {
+	if len(targetIDs) == 0 {
+		return []models.Bookmarks{}, nil
+	}
+	cursor, err := r.bookmarks.Find(ctx,
+		bson.M{"user_id": userID, "target_type": targetType, "target_id": bson.M{"$in": targetIDs}},
+		options.Find().SetProjection(bson.M{"target_id": 1, "target_type": 1, "folder_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	bookmarks := []models.Bookmarks{}
+	if err := cursor.All(ctx, &bookmarks); err != nil {
+		return nil, err
+	}
+	return bookmarks, nil
+}
+
+func normalizeFolderName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" || len([]rune(name)) > MaxBookmarkFolderNameLen {
+		return "", ErrBookmarkFolderName
+	}
+	return name, nil
+}
+
+func (r *bookmarkRepository) CreateFolder(ctx context.Context, folder models.BookmarkFolders) (models.BookmarkFolders, error) {
+	name, err := normalizeFolderName(folder.Name)
+	if err != nil {
+		return models.BookmarkFolders{}, err
+	}
+	count, err := r.folders.CountDocuments(ctx, bson.M{"user_id": folder.UserID})
+	if err != nil {
+		return models.BookmarkFolders{}, err
+	}
+	if count >= MaxBookmarkFolders {
+		return models.BookmarkFolders{}, ErrTooManyBookmarkFolders
+	}
+
+	folder.ID = primitive.NewObjectID()
+	folder.Name = name
+	folder.CreatedAt = time.Now()
+	_, err = r.folders.InsertOne(ctx, folder)
+	if mongo.IsDuplicateKeyError(err) {
+		return models.BookmarkFolders{}, ErrBookmarkFolderExists
+	}
+	if err != nil {
+		return models.BookmarkFolders{}, err
+	}
+	return folder, nil
+}
+
+func (r *bookmarkRepository) GetFolders(ctx context.Context, userID primitive.ObjectID) ([]models.BookmarkFolders, error) {
+	cursor, err := r.folders.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	folders := []models.BookmarkFolders{}
+	if err := cursor.All(ctx, &folders); err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+func (r *bookmarkRepository) RenameFolder(ctx context.Context, userID, folderID primitive.ObjectID, name string) (models.BookmarkFolders, error) {
+	name, err := normalizeFolderName(name)
+	if err != nil {
+		return models.BookmarkFolders{}, err
+	}
+
+	var folder models.BookmarkFolders
+	err = r.folders.FindOneAndUpdate(ctx,
+		bson.M{"_id": folderID, "user_id": userID},
+		bson.M{"$set": bson.M{"name": name}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&folder)
+	if err == mongo.ErrNoDocuments {
+		return models.BookmarkFolders{}, ErrBookmarkFolderNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return models.BookmarkFolders{}, ErrBookmarkFolderExists
+	}
+	if err != nil {
+		return models.BookmarkFolders{}, err
+	}
+	return folder, nil
+}
+
+// DeleteFolder removes the folder, the bookmarks in it are kept without a folder
+func (r *bookmarkRepository) DeleteFolder(ctx context.Context, userID, folderID primitive.ObjectID) error {
+	res, err := r.folders.DeleteOne(ctx, bson.M{"_id": folderID, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrBookmarkFolderNotFound
+	}
+	_, err = r.bookmarks.UpdateMany(ctx, bson.M{"user_id": userID, "folder_id": folderID}, bson.M{"$unset": bson.M{"folder_id": ""}})
+	return err
+}
+
+func (r *bookmarkRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.bookmarks.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "target_type", Value: 1}, {Key: "target_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "target_type", Value: 1}, {Key: "target_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	// folder names are unique for a user whatever their case
+	_, err = r.folders.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true).SetCollation(handleCollation),
+	})
+	return err
+}
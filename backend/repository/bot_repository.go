@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrBotNotFound = errors.New("bot not found")
+	ErrBotName     = errors.New("the bot needs a name of at most 100 characters")
+)
+
+type BotRepository interface {
+	CreateBot(ctx context.Context, ownerID primitive.ObjectID, name string) (models.User, error)
+	GetBots(ctx context.Context, page int) ([]models.User, error)
+	GetBotByID(ctx context.Context, botID primitive.ObjectID) (models.User, error)
+	DeleteBot(ctx context.Context, botID primitive.ObjectID) error
+}
+
+type botRepository struct {
+	users                 *mongo.Collection
+	handleHistory         *mongo.Collection
+	accessTokenRepository AccessTokenRepository
+}
+
+func NewBotRepository(db *mongo.Database, accessTokenRepo AccessTokenRepository) BotRepository {
+	return &botRepository{
+		users:                 db.Collection("users"),
+		handleHistory:         db.Collection("handle_history"),
+		accessTokenRepository: accessTokenRepo,
+	}
+}
+
+// CreateBot makes a service account in the university of its owner, it has no email and
+// no password so it can only act through access tokens
+func (r *botRepository) CreateBot(ctx context.Context, ownerID primitive.ObjectID, name string) (models.User, error) {
+	var owner models.User
+	err := r.users.FindOne(ctx, bson.M{"_id": ownerID}).Decode(&owner)
+	if err == mongo.ErrNoDocuments {
+		return models.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	now := time.Now()
+	bot := models.User{
+		ID:           primitive.NewObjectID(),
+		Name:         name,
+		Role:         string(constants.UserRoleBot),
+		UniversityID: owner.UniversityID,
+		IsComplete:   true,
+		IsVerified:   true,
+		IsBot:        true,
+		BotOwnerID:   &owner.ID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if _, err := r.users.InsertOne(ctx, bot); err != nil {
+		return models.User{}, err
+	}
+	if handle, err := assignHandle(ctx, r.users, r.handleHistory, bot); err == nil {
+		bot.Handle = handle
+	}
+	return bot, nil
+}
+
+func (r *botRepository) GetBots(ctx context.Context, page int) ([]models.User, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((page - 1) * Pagesize)).
+		SetLimit(int64(Pagesize + 1))
+
+	cursor, err := r.users.Find(ctx, bson.M{"is_bot": true, "deletion_scheduled_at": bson.M{"$exists": false}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	bots := []models.User{}
+	if err := cursor.All(ctx, &bots); err != nil {
+		return nil, err
+	}
+	return bots, nil
+}
+
+func (r *botRepository) GetBotByID(ctx context.Context, botID primitive.ObjectID) (models.User, error) {
+	var bot models.User
+	err := r.users.FindOne(ctx, bson.M{
+		"_id":                   botID,
+		"is_bot":                true,
+		"deletion_scheduled_at": bson.M{"$exists": false},
+	}).Decode(&bot)
+	if err == mongo.ErrNoDocuments {
+		return models.User{}, ErrBotNotFound
+	}
+	return bot, err
+}
+
+// DeleteBot revokes the tokens of the bot and hands it to the account purge, which
+// removes it with its posts on the next run
+func (r *botRepository) DeleteBot(ctx context.Context, botID primitive.ObjectID) error {
+	now := time.Now()
+	res, err := r.users.UpdateOne(ctx,
+		bson.M{"_id": botID, "is_bot": true, "deletion_scheduled_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deletion_scheduled_at": now, "updated_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrBotNotFound
+	}
+	return r.accessTokenRepository.RevokeUserTokens(ctx, botID)
+}
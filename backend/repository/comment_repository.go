@@ -18,7 +18,7 @@ type CommentRepository interface {
 	GetReply(ctx context.Context, commentID primitive.ObjectID, page int) ([]models.Comments, error)
 	AddComment(ctx context.Context, comment models.Comments) (models.Comments, error)
 	DeleteComment(ctx context.Context, commentID, userID primitive.ObjectID) error
-	EditComment(ctx context.Context, commentID, userID primitive.ObjectID, content string) (models.Comments, error)
+	EditComment(ctx context.Context, commentID, userID primitive.ObjectID, content string, mentions []models.Mentions) (models.Comments, error)
 	AddReply(ctx context.Context, reply models.Comments) (models.Comments, error)
 }
 
@@ -113,10 +113,12 @@ func (r *commentRepository) DeleteComment(ctx context.Context, commentID, userID
 	return nil
 }
 
-func (r *commentRepository) EditComment(ctx context.Context, commentID, userID primitive.ObjectID, content string) (models.Comments, error) {
+// EditComment replaces the content of the comment and the mentions resolved from it, the
+// offsets of the old mentions do not match the new content
+func (r *commentRepository) EditComment(ctx context.Context, commentID, userID primitive.ObjectID, content string, mentions []models.Mentions) (models.Comments, error) {
 	filter := bson.M{"_id": commentID, "user_id": userID}
-	update := bson.M{"$set": bson.M{"content": content}}
-	res := r.comments.FindOneAndUpdate(ctx, filter, update)
+	update := bson.M{"$set": bson.M{"content": content, "mentions": mentions}}
+	res := r.comments.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After))
 	var updated models.Comments
 	err := res.Decode(&updated)
 	if err != nil {
@@ -0,0 +1,306 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/email"
+	"github.com/chera-mihiretu/IKnow/infrastructure/hashing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	EmailChangeTTL       = 24 * time.Hour
+	EmailChangeRevertTTL = 7 * 24 * time.Hour
+
+	emailChangeTokenSize = 32
+)
+
+var (
+	ErrEmailTaken              = errors.New("an account with this email already exists")
+	ErrSameEmail               = errors.New("the new email is the same as the current one")
+	ErrEmailUniversityMismatch = errors.New("the new email must belong to your university")
+	ErrGoogleAccountNotLinked  = errors.New("sign in with google once more before changing the email of this account")
+	ErrInvalidEmailChangeToken = errors.New("invalid or expired email change link")
+)
+
+type EmailChangeRepository interface {
+	RequestEmailChange(ctx context.Context, userID primitive.ObjectID, newEmail, password string) (models.EmailChanges, error)
+	ConfirmEmailChange(ctx context.Context, token string) (models.EmailChanges, error)
+	RevertEmailChange(ctx context.Context, token string) (models.EmailChanges, error)
+}
+
+type emailChangeRepository struct {
+	changes               *mongo.Collection
+	users                 *mongo.Collection
+	usersUnverified       *mongo.Collection
+	identities            *mongo.Collection
+	passwordResets        *mongo.Collection
+	universityRepository  UniversityRepository
+	sessionRepository     SessionRepository
+	accessTokenRepository AccessTokenRepository
+}
+
+func NewEmailChangeRepository(db *mongo.Database, universityRepo UniversityRepository, sessionRepo SessionRepository, accessTokenRepo AccessTokenRepository) EmailChangeRepository {
+	return &emailChangeRepository{
+		changes:               db.Collection("email_changes"),
+		users:                 db.Collection("users"),
+		usersUnverified:       db.Collection("users_temp"),
+		identities:            db.Collection("user_identities"),
+		passwordResets:        db.Collection("password_resets"),
+		universityRepository:  universityRepo,
+		sessionRepository:     sessionRepo,
+		accessTokenRepository: accessTokenRepo,
+	}
+}
+
+// RequestEmailChange sends a confirmation link to the new address and a notice with a revert
+// link to the current one, the email of the user does not change until the link is confirmed
+func (r *emailChangeRepository) RequestEmailChange(ctx context.Context, userID primitive.ObjectID, newEmail, password string) (models.EmailChanges, error) {
+	newEmail = normalizeEmail(newEmail)
+	var user models.User
+	err := r.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return models.EmailChanges{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.EmailChanges{}, err
+	}
+
+	if user.PasswordHash != "" {
+		if !hashing.ComparePassword(user.PasswordHash, password) {
+			return models.EmailChanges{}, ErrWrongCredentials
+		}
+	} else if user.GoogleID == "" {
+		// google accounts made before the google id was stored are only linked by their email,
+		// changing it would make the next google sign in create a second account. Accounts
+		// linked to a provider are found by the provider account id and keep working
+		linked, err := r.identities.CountDocuments(ctx, bson.M{"user_id": userID})
+		if err != nil {
+			return models.EmailChanges{}, err
+		}
+		if linked == 0 {
+			return models.EmailChanges{}, ErrGoogleAccountNotLinked
+		}
+	}
+
+	if strings.EqualFold(newEmail, user.Email) {
+		return models.EmailChanges{}, ErrSameEmail
+	}
+	if err := r.checkEmailAvailable(ctx, newEmail, userID); err != nil {
+		return models.EmailChanges{}, err
+	}
+
+	university, err := r.universityRepository.GetUniversityByEmail(ctx, newEmail)
+	if err != nil {
+		return models.EmailChanges{}, err
+	}
+	if user.UniversityID != nil && *user.UniversityID != university.ID {
+		return models.EmailChanges{}, ErrEmailUniversityMismatch
+	}
+
+	token, err := hashing.GenerateToken(emailChangeTokenSize)
+	if err != nil {
+		return models.EmailChanges{}, errors.New("could not generate email change token")
+	}
+	revertToken, err := hashing.GenerateToken(emailChangeTokenSize)
+	if err != nil {
+		return models.EmailChanges{}, errors.New("could not generate email change token")
+	}
+
+	// only the latest request can be confirmed
+	_, err = r.changes.UpdateMany(ctx,
+		bson.M{"user_id": userID, "status": constants.EmailChangeStatusPending},
+		bson.M{"$set": bson.M{"status": constants.EmailChangeStatusReplaced}},
+	)
+	if err != nil {
+		return models.EmailChanges{}, err
+	}
+
+	now := time.Now()
+	change := models.EmailChanges{
+		ID:              primitive.NewObjectID(),
+		UserID:          userID,
+		OldEmail:        user.Email,
+		NewEmail:        newEmail,
+		TokenHash:       hashing.HashToken(token),
+		RevertTokenHash: hashing.HashToken(revertToken),
+		Status:          constants.EmailChangeStatusPending,
+		ExpiresAt:       now.Add(EmailChangeTTL),
+		RevertExpiresAt: now.Add(EmailChangeRevertTTL),
+		CreatedAt:       now,
+	}
+	if _, err := r.changes.InsertOne(ctx, change); err != nil {
+		return models.EmailChanges{}, err
+	}
+
+	if err := email.SendEmailChangeConfirmationEmail(newEmail, token); err != nil {
+		return models.EmailChanges{}, errors.New("could not send confirmation email")
+	}
+	if err := email.SendEmailChangeNoticeEmail(user.Email, newEmail, revertToken); err != nil {
+		return models.EmailChanges{}, errors.New("could not send email change notice")
+	}
+	return change, nil
+}
+
+// ConfirmEmailChange swaps the email of the user, the availability of the new address is checked
+// again since somebody may have registered it after the request
+func (r *emailChangeRepository) ConfirmEmailChange(ctx context.Context, token string) (models.EmailChanges, error) {
+	var change models.EmailChanges
+	err := r.changes.FindOne(ctx, bson.M{
+		"token_hash": hashing.HashToken(token),
+		"status":     constants.EmailChangeStatusPending,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&change)
+	if err == mongo.ErrNoDocuments {
+		return models.EmailChanges{}, ErrInvalidEmailChangeToken
+	}
+	if err != nil {
+		return models.EmailChanges{}, err
+	}
+
+	if err := r.checkEmailAvailable(ctx, change.NewEmail, change.UserID); err != nil {
+		return models.EmailChanges{}, err
+	}
+
+	now := time.Now()
+	err = r.changes.FindOneAndUpdate(ctx,
+		bson.M{"_id": change.ID, "status": constants.EmailChangeStatusPending},
+		bson.M{"$set": bson.M{"status": constants.EmailChangeStatusConfirmed, "confirmed_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&change)
+	if err == mongo.ErrNoDocuments {
+		return models.EmailChanges{}, ErrInvalidEmailChangeToken
+	}
+	if err != nil {
+		return models.EmailChanges{}, err
+	}
+
+	res, err := r.users.UpdateOne(ctx,
+		bson.M{"_id": change.UserID, "email": change.OldEmail},
+		bson.M{"$set": bson.M{"email": change.NewEmail, "updated_at": now}},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// the unique index caught an account made with the address since the check above
+		_, err = r.changes.UpdateOne(ctx,
+			bson.M{"_id": change.ID},
+			bson.M{"$set": bson.M{"status": constants.EmailChangeStatusPending}, "$unset": bson.M{"confirmed_at": ""}},
+		)
+		if err != nil {
+			return models.EmailChanges{}, err
+		}
+		return models.EmailChanges{}, ErrEmailTaken
+	}
+	if err != nil {
+		return models.EmailChanges{}, err
+	}
+	if res.MatchedCount == 0 {
+		return models.EmailChanges{}, ErrInvalidEmailChangeToken
+	}
+	return change, nil
+}
+
+// RevertEmailChange is the link sent to the old address, it cancels a pending change or puts
+// the old email back. The account may be taken over, so it is signed out everywhere, its access
+// tokens and the providers linked since the request are removed and the password must be reset
+func (r *emailChangeRepository) RevertEmailChange(ctx context.Context, token string) (models.EmailChanges, error) {
+	var change models.EmailChanges
+	err := r.changes.FindOneAndUpdate(ctx,
+		bson.M{
+			"revert_token_hash": hashing.HashToken(token),
+			"status":            bson.M{"$in": []string{constants.EmailChangeStatusPending, constants.EmailChangeStatusConfirmed}},
+			"revert_expires_at": bson.M{"$gt": time.Now()},
+		},
+		bson.M{"$set": bson.M{"status": constants.EmailChangeStatusReverted}},
+	).Decode(&change)
+	if err == mongo.ErrNoDocuments {
+		return models.EmailChanges{}, ErrInvalidEmailChangeToken
+	}
+	if err != nil {
+		return models.EmailChanges{}, err
+	}
+
+	// the account is locked down before the email is restored, so a failed restore does not
+	// leave it open. Whoever made the change should not be able to finish another one
+	_, err = r.changes.UpdateMany(ctx,
+		bson.M{"user_id": change.UserID, "status": constants.EmailChangeStatusPending},
+		bson.M{"$set": bson.M{"status": constants.EmailChangeStatusReplaced}},
+	)
+	if err != nil {
+		return models.EmailChanges{}, err
+	}
+	_, err = r.users.UpdateOne(ctx,
+		bson.M{"_id": change.UserID},
+		bson.M{"$set": bson.M{"password_reset_required": true, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return models.EmailChanges{}, err
+	}
+	if _, err := r.passwordResets.DeleteMany(ctx, bson.M{"user_id": change.UserID}); err != nil {
+		return models.EmailChanges{}, err
+	}
+	_, err = r.identities.DeleteMany(ctx, bson.M{"user_id": change.UserID, "created_at": bson.M{"$gte": change.CreatedAt}})
+	if err != nil {
+		return models.EmailChanges{}, err
+	}
+	if _, err := r.sessionRepository.RevokeAllSessions(ctx, change.UserID, primitive.NilObjectID); err != nil {
+		return models.EmailChanges{}, err
+	}
+	if err := r.accessTokenRepository.RevokeUserTokens(ctx, change.UserID); err != nil {
+		return models.EmailChanges{}, err
+	}
+
+	if change.Status == constants.EmailChangeStatusConfirmed {
+		_, err = r.users.UpdateOne(ctx,
+			bson.M{"_id": change.UserID, "email": change.NewEmail},
+			bson.M{"$set": bson.M{"email": change.OldEmail, "updated_at": time.Now()}},
+		)
+		if mongo.IsDuplicateKeyError(err) {
+			return models.EmailChanges{}, ErrEmailTaken
+		}
+		if err != nil {
+			return models.EmailChanges{}, err
+		}
+	}
+	change.Status = constants.EmailChangeStatusReverted
+	return change, nil
+}
+
+func (r *emailChangeRepository) checkEmailAvailable(ctx context.Context, address string, userID primitive.ObjectID) error {
+	filter := emailFilter(address)
+	filter["_id"] = bson.M{"$ne": userID}
+	count, err := r.users.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrEmailTaken
+	}
+
+	count, err = r.usersUnverified.CountDocuments(ctx, emailFilter(address))
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+// normalizeEmail is the email as it is stored, lower cased
+func normalizeEmail(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+// emailFilter matches the email regardless of case, older accounts were stored as typed
+func emailFilter(address string) bson.M {
+	return bson.M{"email": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(address) + "$", Options: "i"}}
+}
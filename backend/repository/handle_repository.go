@@ -0,0 +1,324 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	MinHandleLen = 3
+	MaxHandleLen = 30
+	// a user picks a new handle at most once in this period, changing only its case is free
+	HandleChangeCooldown = 30 * 24 * time.Hour
+	// an old handle keeps redirecting to its user, and nobody else can take it, for this period
+	HandleRedirectPeriod = 90 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidHandle  = errors.New("a handle is 3 to 30 letters, digits or underscores and starts with a letter")
+	ErrHandleReserved = errors.New("this handle is reserved")
+	ErrHandleTaken    = errors.New("this handle is already taken")
+	ErrHandleCooldown = errors.New("you changed your handle recently, try again later")
+	ErrHandleNotFound = errors.New("no user has this handle")
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{2,29}$`)
+
+// reservedHandles are words of the app users could be mistaken for staff with, or that
+// clash with the routes of the web client
+var reservedHandles = map[string]bool{
+	"admin": true, "admins": true, "administrator": true, "moderator": true, "moderators": true,
+	"mod": true, "staff": true, "support": true, "help": true, "security": true, "system": true,
+	"root": true, "superadmin": true, "official": true, "team": true, "bot": true, "bots": true,
+	"api": true, "app": true, "www": true, "mail": true, "email": true, "login": true, "logout": true,
+	"signup": true, "register": true, "settings": true, "profile": true, "me": true, "home": true,
+	"feed": true, "explore": true, "search": true, "notifications": true, "messages": true,
+	"posts": true, "jobs": true, "materials": true, "users": true, "user": true, "about": true,
+	"terms": true, "privacy": true, "everyone": true, "here": true, "all": true, "null": true,
+	"undefined": true, "anonymous": true, "deleted": true,
+}
+
+// ValidateHandle tells whether a user may pick the handle, it does not look at who has it
+func ValidateHandle(handle string) error {
+	if !handlePattern.MatchString(handle) {
+		return ErrInvalidHandle
+	}
+	lower := strings.ToLower(handle)
+	if reservedHandles[lower] || strings.HasPrefix(lower, "iknow") {
+		return ErrHandleReserved
+	}
+	return nil
+}
+
+type HandleRepository interface {
+	GetUserByHandle(ctx context.Context, handle string) (models.UserView, error)
+	ChangeHandle(ctx context.Context, userID primitive.ObjectID, handle string) (models.UserView, error)
+	GenerateMissingHandles(ctx context.Context) (int, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type handleRepository struct {
+	users   *mongo.Collection
+	history *mongo.Collection
+}
+
+func NewHandleRepository(db *mongo.Database) HandleRepository {
+	return &handleRepository{
+		users:   db.Collection("users"),
+		history: db.Collection("handle_history"),
+	}
+}
+
+// GetUserByHandle finds the user with the handle, or the user who had it until recently,
+// the caller can tell the two apart by comparing the handles
+func (r *handleRepository) GetUserByHandle(ctx context.Context, handle string) (models.UserView, error) {
+	var user models.UserView
+	err := r.users.FindOne(ctx, bson.M{"handle": handle}, options.FindOne().SetCollation(handleCollation)).Decode(&user)
+	if err == nil {
+		return user, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return models.UserView{}, err
+	}
+
+	var old models.HandleHistory
+	err = r.history.FindOne(ctx,
+		bson.M{"handle": handle, "created_at": bson.M{"$gt": time.Now().Add(-HandleRedirectPeriod)}},
+		options.FindOne().SetCollation(handleCollation).SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	).Decode(&old)
+	if err == mongo.ErrNoDocuments {
+		return models.UserView{}, ErrHandleNotFound
+	}
+	if err != nil {
+		return models.UserView{}, err
+	}
+
+	err = r.users.FindOne(ctx, bson.M{"_id": old.UserID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return models.UserView{}, ErrHandleNotFound
+	}
+	if err != nil {
+		return models.UserView{}, err
+	}
+	return user, nil
+}
+
+// ChangeHandle gives the user a new handle, the old one is kept in the history so links to
+// it keep working
+func (r *handleRepository) ChangeHandle(ctx context.Context, userID primitive.ObjectID, handle string) (models.UserView, error) {
+	if err := ValidateHandle(handle); err != nil {
+		return models.UserView{}, err
+	}
+
+	var user models.User
+	err := r.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return models.UserView{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.UserView{}, err
+	}
+
+	now := time.Now()
+	caseOnly := strings.EqualFold(user.Handle, handle)
+	set := bson.M{"handle": handle, "updated_at": now}
+	if user.Handle != handle && !caseOnly {
+		if user.HandleChangedAt != nil && now.Before(user.HandleChangedAt.Add(HandleChangeCooldown)) {
+			return models.UserView{}, ErrHandleCooldown
+		}
+		held, err := handleHeld(ctx, r.history, handle, userID)
+		if err != nil {
+			return models.UserView{}, err
+		}
+		if held {
+			return models.UserView{}, ErrHandleTaken
+		}
+		set["handle_changed_at"] = now
+	}
+
+	if user.Handle != handle {
+		// matching the handle read above keeps two changes at the same time from both passing
+		// the cooldown
+		filter := bson.M{"_id": userID, "handle": user.Handle}
+		if user.Handle == "" {
+			filter["handle"] = bson.M{"$exists": false}
+		}
+		res, err := r.users.UpdateOne(ctx, filter, bson.M{"$set": set})
+		if mongo.IsDuplicateKeyError(err) {
+			return models.UserView{}, ErrHandleTaken
+		}
+		if err != nil {
+			return models.UserView{}, err
+		}
+		if res.MatchedCount == 0 {
+			// another change of the handle got in first, it may have taken this one
+			return models.UserView{}, ErrHandleTaken
+		}
+
+		if user.Handle != "" && !caseOnly {
+			_, err = r.history.InsertOne(ctx, models.HandleHistory{
+				ID:        primitive.NewObjectID(),
+				UserID:    userID,
+				Handle:    user.Handle,
+				CreatedAt: now,
+			})
+			if err != nil {
+				return models.UserView{}, err
+			}
+			// a handle the user takes back does not need to redirect anymore
+			_, err = r.history.DeleteMany(ctx, bson.M{"user_id": userID, "handle": handle}, options.Delete().SetCollation(handleCollation))
+			if err != nil {
+				return models.UserView{}, err
+			}
+		}
+	}
+
+	var view models.UserView
+	if err := r.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&view); err != nil {
+		return models.UserView{}, err
+	}
+	return view, nil
+}
+
+// handleHeld is true while the handle still redirects to another user who had it
+func handleHeld(ctx context.Context, history *mongo.Collection, handle string, userID primitive.ObjectID) (bool, error) {
+	count, err := history.CountDocuments(ctx,
+		bson.M{"handle": handle, "user_id": bson.M{"$ne": userID}, "created_at": bson.M{"$gt": time.Now().Add(-HandleRedirectPeriod)}},
+		options.Count().SetCollation(handleCollation).SetLimit(1),
+	)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GenerateMissingHandles is the migration giving a handle to the users who signed up before
+// handles existed, or whose handle could not be made at sign up
+func (r *handleRepository) GenerateMissingHandles(ctx context.Context) (int, error) {
+	cursor, err := r.users.Find(ctx,
+		bson.M{"handle": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"_id": 1, "name": 1, "email": 1}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	generated := 0
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return generated, err
+		}
+		if _, err := assignHandle(ctx, r.users, r.history, user); err != nil {
+			return generated, err
+		}
+		generated++
+	}
+	return generated, cursor.Err()
+}
+
+func (r *handleRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.users.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "handle", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetCollation(handleCollation).
+			SetPartialFilterExpression(bson.M{"handle": bson.M{"$type": "string"}}),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.history.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "handle", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetCollation(handleCollation),
+	})
+	return err
+}
+
+// assignHandle makes a handle from the name of a user who has none yet, a number is added
+// when the handle is taken
+func assignHandle(ctx context.Context, users, history *mongo.Collection, user models.User) (string, error) {
+	base := handleBase(user.Name)
+	if base == "" {
+		base = handleBase(strings.SplitN(user.Email, "@", 2)[0])
+	}
+	if base == "" || ValidateHandle(base+"1000") != nil {
+		base = "user"
+	}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		handle := base
+		if attempt > 0 || ValidateHandle(handle) != nil {
+			handle = base + strconv.Itoa(1000+rand.Intn(9000))
+		}
+		held, err := handleHeld(ctx, history, handle, user.ID)
+		if err != nil {
+			return "", err
+		}
+		if held {
+			continue
+		}
+
+		res, err := users.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "handle": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"handle": handle}},
+		)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if res.MatchedCount == 0 {
+			// the user got a handle in the meantime
+			return "", nil
+		}
+		return handle, nil
+	}
+	return "", ErrHandleTaken
+}
+
+// assignHandleOnSignUp gives a new user a handle, the sign up goes on without one when it
+// fails and the migration at the next start makes it
+func assignHandleOnSignUp(ctx context.Context, users, history *mongo.Collection, user models.User) {
+	if _, err := assignHandle(ctx, users, history, user); err != nil {
+		log.Println("Could not make a handle for user", user.ID.Hex(), err)
+	}
+}
+
+// handleBase turns a name into a handle, "Abebe Kebede" becomes "abebe_kebede", letters
+// that are not latin are dropped
+func handleBase(name string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			b.WriteRune(r)
+			underscore = false
+		case b.Len() > 0 && !underscore:
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+	base := strings.Trim(b.String(), "_")
+	base = strings.TrimLeft(base, "0123456789_")
+	// room is left for the number added to a taken handle
+	if len(base) > MaxHandleLen-4 {
+		base = strings.TrimRight(base[:MaxHandleLen-4], "_")
+	}
+	return base
+}
@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/hashing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrIdentityNotFound        = errors.New("this login provider is not linked to the account")
+	ErrIdentityLinked          = errors.New("this provider account is already linked to another user")
+	ErrProviderAlreadyLinked   = errors.New("an account of this provider is already linked, unlink it first")
+	ErrLastLoginMethod         = errors.New("set a password or link another provider before unlinking the last one")
+	ErrProviderEmailUnverified = errors.New("the provider did not verify this email, log in and link the provider from the account settings")
+	ErrInvalidProviderLink     = errors.New("the provider link is invalid, expired or was already used")
+)
+
+const (
+	// ProviderLinkTTL is how long a started provider link can take to come back from the provider
+	ProviderLinkTTL = 10 * time.Minute
+
+	providerLinkNonceSize = 32
+)
+
+type IdentityRepository interface {
+	FindIdentity(ctx context.Context, provider, providerUserID string) (models.UserIdentities, error)
+	GetUserIdentities(ctx context.Context, userID primitive.ObjectID) ([]models.UserIdentities, error)
+	LinkIdentity(ctx context.Context, userID primitive.ObjectID, identity models.UserIdentities) (models.UserIdentities, error)
+	UnlinkIdentity(ctx context.Context, userID primitive.ObjectID, provider string) error
+	TouchIdentity(ctx context.Context, id primitive.ObjectID) error
+	StartLink(ctx context.Context, userID primitive.ObjectID, provider string) (string, error)
+	ConsumeLink(ctx context.Context, nonce, provider string) (primitive.ObjectID, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type identityRepository struct {
+	identities *mongo.Collection
+	links      *mongo.Collection
+	users      *mongo.Collection
+}
+
+func NewIdentityRepository(db *mongo.Database) IdentityRepository {
+	return &identityRepository{
+		identities: db.Collection("user_identities"),
+		links:      db.Collection("provider_links"),
+		users:      db.Collection("users"),
+	}
+}
+
+func (r *identityRepository) FindIdentity(ctx context.Context, provider, providerUserID string) (models.UserIdentities, error) {
+	var identity models.UserIdentities
+	err := r.identities.FindOne(ctx, bson.M{"provider": provider, "provider_user_id": providerUserID}).Decode(&identity)
+	if err == mongo.ErrNoDocuments {
+		return models.UserIdentities{}, ErrIdentityNotFound
+	}
+	return identity, err
+}
+
+func (r *identityRepository) GetUserIdentities(ctx context.Context, userID primitive.ObjectID) ([]models.UserIdentities, error) {
+	cursor, err := r.identities.Find(ctx, bson.M{"user_id": userID},
+		options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	identities := []models.UserIdentities{}
+	if err := cursor.All(ctx, &identities); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// LinkIdentity attaches a provider account to the user, linking the same account again
+// only refreshes it
+func (r *identityRepository) LinkIdentity(ctx context.Context, userID primitive.ObjectID, identity models.UserIdentities) (models.UserIdentities, error) {
+	existing, err := r.FindIdentity(ctx, identity.Provider, identity.ProviderUserID)
+	if err == nil {
+		if existing.UserID != userID {
+			return models.UserIdentities{}, ErrIdentityLinked
+		}
+		return existing, r.TouchIdentity(ctx, existing.ID)
+	}
+	if err != ErrIdentityNotFound {
+		return models.UserIdentities{}, err
+	}
+
+	identity.ID = primitive.NewObjectID()
+	identity.UserID = userID
+	now := time.Now()
+	identity.CreatedAt = now
+	identity.LastUsedAt = now
+	if _, err := r.identities.InsertOne(ctx, identity); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// the unique indexes allow one account per provider and user
+			return models.UserIdentities{}, ErrProviderAlreadyLinked
+		}
+		return models.UserIdentities{}, err
+	}
+
+	if identity.Provider == "google" {
+		_, err = r.users.UpdateOne(ctx,
+			bson.M{"_id": userID, "google_id": bson.M{"$in": bson.A{"", nil}}},
+			bson.M{"$set": bson.M{"google_id": identity.ProviderUserID}})
+		if err != nil {
+			return models.UserIdentities{}, err
+		}
+	}
+	return identity, nil
+}
+
+// UnlinkIdentity refuses to remove the last way the user has to log in
+func (r *identityRepository) UnlinkIdentity(ctx context.Context, userID primitive.ObjectID, provider string) error {
+	var user models.User
+	err := r.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	linked, err := r.identities.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash == "" && linked <= 1 {
+		return ErrLastLoginMethod
+	}
+
+	result, err := r.identities.DeleteOne(ctx, bson.M{"user_id": userID, "provider": provider})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrIdentityNotFound
+	}
+
+	if provider == "google" {
+		_, err = r.users.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"google_id": ""}})
+	}
+	return err
+}
+
+func (r *identityRepository) TouchIdentity(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.identities.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_used_at": time.Now()}})
+	return err
+}
+
+// StartLink keeps a link of the provider for the user and returns its nonce, only the
+// hash of the nonce is stored
+func (r *identityRepository) StartLink(ctx context.Context, userID primitive.ObjectID, provider string) (string, error) {
+	nonce, err := hashing.GenerateToken(providerLinkNonceSize)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	_, err = r.links.InsertOne(ctx, models.ProviderLinks{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Provider:  provider,
+		NonceHash: hashing.HashToken(nonce),
+		ExpiresAt: now.Add(ProviderLinkTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+	return nonce, nil
+}
+
+// ConsumeLink returns the user a started link of the provider is for, the link is
+// deleted so the nonce works once
+func (r *identityRepository) ConsumeLink(ctx context.Context, nonce, provider string) (primitive.ObjectID, error) {
+	var link models.ProviderLinks
+	err := r.links.FindOneAndDelete(ctx, bson.M{
+		"nonce_hash": hashing.HashToken(nonce),
+		"provider":   provider,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, ErrInvalidProviderLink
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return link.UserID, nil
+}
+
+func (r *identityRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.links.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "nonce_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.identities.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "provider_user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "provider", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	return err
+}
@@ -0,0 +1,403 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/email"
+	"github.com/hibiken/asynq"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	invitationCodeLength = 10
+	// no 0/O or 1/I so codes can be read out and typed
+	invitationCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+var (
+	ErrInvitationNotFound   = errors.New("invitation not found")
+	ErrInvalidInvitation    = errors.New("the invitation code is invalid, expired or already used")
+	ErrInvitationEmail      = errors.New("this invitation was sent to another email address")
+	ErrInvitationAddress    = errors.New("the email of the invitation is not a valid address")
+	ErrInvitationUniversity = errors.New("this invitation is for another university")
+	ErrInvitationBinding    = errors.New("the school must belong to the university and the department to the school")
+	ErrInvitationOutOfScope = errors.New("you can only invite to the departments you manage")
+	ErrInvitationUses       = errors.New("max_uses must be between 1 and 1000")
+	ErrInvitationExpiry     = errors.New("expires_in_days must be between 1 and 90")
+	ErrInvitationYear       = errors.New("acedemic_year must be between 1 and the years of the department")
+	ErrInvitationCSV        = errors.New("the file must be a CSV with an email column and at most 1000 rows")
+)
+
+type InvitationRepository interface {
+	CreateInvitations(ctx context.Context, invitations []models.Invitations) ([]models.Invitations, error)
+	ValidateBinding(ctx context.Context, invitation models.Invitations) error
+	GetInvitations(ctx context.Context, page int, scope models.AccessScope) ([]models.Invitations, error)
+	GetInvitationByID(ctx context.Context, invitationID primitive.ObjectID) (models.Invitations, error)
+	GetInvitationByCode(ctx context.Context, code string) (models.Invitations, error)
+	RevokeInvitation(ctx context.Context, invitationID primitive.ObjectID) error
+	CheckInvitation(ctx context.Context, code, userEmail string) (models.Invitations, error)
+	Redeem(ctx context.Context, code string, userID primitive.ObjectID, userEmail string) (models.Invitations, error)
+	CancelRedemption(ctx context.Context, invitationID, userID primitive.ObjectID) error
+	ApplyInvitation(ctx context.Context, userID primitive.ObjectID, invitation models.Invitations) error
+	GetRedemptions(ctx context.Context, invitationID primitive.ObjectID) ([]models.InvitationRedemptions, error)
+	GetRegisteredEmails(ctx context.Context, emails []string) (map[string]bool, error)
+	EnqueueInvitationEmails(ctx context.Context, invitations []models.Invitations) (int, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type invitationRepository struct {
+	invitations          *mongo.Collection
+	redemptions          *mongo.Collection
+	users                *mongo.Collection
+	schools              *mongo.Collection
+	departments          *mongo.Collection
+	universityRepository UniversityRepository
+	redisClient          *asynq.Client
+}
+
+func NewInvitationRepository(db *mongo.Database, universityRepository UniversityRepository, redisClient *asynq.Client) InvitationRepository {
+	return &invitationRepository{
+		invitations:          db.Collection("invitations"),
+		redemptions:          db.Collection("invitation_redemptions"),
+		users:                db.Collection("users"),
+		schools:              db.Collection("schools"),
+		departments:          db.Collection("departments"),
+		universityRepository: universityRepository,
+		redisClient:          redisClient,
+	}
+}
+
+// CreateInvitations gives every invitation a code and stores them in one write
+func (r *invitationRepository) CreateInvitations(ctx context.Context, invitations []models.Invitations) ([]models.Invitations, error) {
+	if len(invitations) == 0 {
+		return invitations, nil
+	}
+	now := time.Now()
+	docs := make([]interface{}, 0, len(invitations))
+	for i := range invitations {
+		code, err := generateInvitationCode()
+		if err != nil {
+			return nil, errors.New("could not generate invitation code")
+		}
+		invitations[i].ID = primitive.NewObjectID()
+		invitations[i].Code = code
+		invitations[i].Uses = 0
+		invitations[i].CreatedAt = now
+		docs = append(docs, invitations[i])
+	}
+	if _, err := r.invitations.InsertMany(ctx, docs); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func generateInvitationCode() (string, error) {
+	var code strings.Builder
+	max := big.NewInt(int64(len(invitationCodeAlphabet)))
+	for i := 0; i < invitationCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(invitationCodeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+// ValidateBinding checks that the school is in the university, the department in the
+// school and the year inside the department
+func (r *invitationRepository) ValidateBinding(ctx context.Context, invitation models.Invitations) error {
+	if invitation.DepartmentID != nil && invitation.SchoolID == nil {
+		return ErrInvitationBinding
+	}
+	if invitation.SchoolID != nil {
+		count, err := r.schools.CountDocuments(ctx, bson.M{"_id": *invitation.SchoolID, "university_id": invitation.UniversityID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrInvitationBinding
+		}
+	}
+
+	maxYear := 7
+	if invitation.DepartmentID != nil {
+		var department models.Departments
+		err := r.departments.FindOne(ctx, bson.M{"_id": *invitation.DepartmentID, "school_id": *invitation.SchoolID}).Decode(&department)
+		if err == mongo.ErrNoDocuments {
+			return ErrInvitationBinding
+		}
+		if err != nil {
+			return err
+		}
+		if department.Years > 0 {
+			maxYear = department.Years
+		}
+	}
+	if invitation.AcedemicYear < 0 || invitation.AcedemicYear > maxYear {
+		return ErrInvitationYear
+	}
+	return nil
+}
+
+func (r *invitationRepository) GetInvitations(ctx context.Context, page int, scope models.AccessScope) ([]models.Invitations, error) {
+	filter := bson.M{}
+	if !scope.Global {
+		// a department is in the scope when its school is, and a school when its university is
+		within := bson.A{}
+		if len(scope.DepartmentIDs) > 0 {
+			within = append(within, bson.M{"department_id": bson.M{"$in": scope.DepartmentIDs}})
+		}
+		if len(scope.SchoolIDs) > 0 {
+			within = append(within, bson.M{"school_id": bson.M{"$in": scope.SchoolIDs}})
+		}
+		if len(scope.UniversityIDs) > 0 {
+			within = append(within, bson.M{"university_id": bson.M{"$in": scope.UniversityIDs}})
+		}
+		if len(within) == 0 {
+			return []models.Invitations{}, nil
+		}
+		filter["$or"] = within
+	}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((page - 1) * Pagesize)).
+		SetLimit(int64(Pagesize + 1))
+
+	cursor, err := r.invitations.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	invitations := []models.Invitations{}
+	if err := cursor.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (r *invitationRepository) GetInvitationByID(ctx context.Context, invitationID primitive.ObjectID) (models.Invitations, error) {
+	var invitation models.Invitations
+	err := r.invitations.FindOne(ctx, bson.M{"_id": invitationID}).Decode(&invitation)
+	if err == mongo.ErrNoDocuments {
+		return models.Invitations{}, ErrInvitationNotFound
+	}
+	return invitation, err
+}
+
+// GetInvitationByCode only finds invitations that can still be used
+func (r *invitationRepository) GetInvitationByCode(ctx context.Context, code string) (models.Invitations, error) {
+	var invitation models.Invitations
+	err := r.invitations.FindOne(ctx, usableInvitationFilter(code)).Decode(&invitation)
+	if err == mongo.ErrNoDocuments {
+		return models.Invitations{}, ErrInvalidInvitation
+	}
+	return invitation, err
+}
+
+func usableInvitationFilter(code string) bson.M {
+	return bson.M{
+		"code":       strings.ToUpper(strings.TrimSpace(code)),
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+		"$expr":      bson.M{"$lt": bson.A{"$uses", "$max_uses"}},
+	}
+}
+
+func (r *invitationRepository) RevokeInvitation(ctx context.Context, invitationID primitive.ObjectID) error {
+	res, err := r.invitations.UpdateOne(ctx,
+		bson.M{"_id": invitationID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// CheckInvitation finds the usable invitation of the code without taking a use. An invitation
+// sent to an email only works for it, an open one only for addresses of its university
+func (r *invitationRepository) CheckInvitation(ctx context.Context, code, userEmail string) (models.Invitations, error) {
+	invitation, err := r.GetInvitationByCode(ctx, code)
+	if err != nil {
+		return models.Invitations{}, err
+	}
+	if invitation.Email != "" {
+		if !strings.EqualFold(invitation.Email, userEmail) {
+			return models.Invitations{}, ErrInvitationEmail
+		}
+		return invitation, nil
+	}
+	university, err := r.universityRepository.GetUniversityByEmail(ctx, userEmail)
+	if err != nil && err != ErrEmailDomainNotAllowed {
+		return models.Invitations{}, err
+	}
+	if err == ErrEmailDomainNotAllowed || university.ID != invitation.UniversityID {
+		return models.Invitations{}, ErrInvitationUniversity
+	}
+	return invitation, nil
+}
+
+// Redeem takes one use of the invitation for the user, after the checks of CheckInvitation
+func (r *invitationRepository) Redeem(ctx context.Context, code string, userID primitive.ObjectID, userEmail string) (models.Invitations, error) {
+	invitation, err := r.CheckInvitation(ctx, code, userEmail)
+	if err != nil {
+		return models.Invitations{}, err
+	}
+
+	// the filter takes the use atomically, two sign ups can not share the last one
+	filter := usableInvitationFilter(code)
+	filter["_id"] = invitation.ID
+	res, err := r.invitations.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"uses": 1}})
+	if err != nil {
+		return models.Invitations{}, err
+	}
+	if res.MatchedCount == 0 {
+		return models.Invitations{}, ErrInvalidInvitation
+	}
+
+	_, err = r.redemptions.InsertOne(ctx, models.InvitationRedemptions{
+		ID:           primitive.NewObjectID(),
+		InvitationID: invitation.ID,
+		UserID:       userID,
+		Email:        strings.ToLower(userEmail),
+		RedeemedAt:   time.Now(),
+	})
+	if err != nil {
+		r.invitations.UpdateOne(ctx, bson.M{"_id": invitation.ID}, bson.M{"$inc": bson.M{"uses": -1}})
+		if mongo.IsDuplicateKeyError(err) {
+			return models.Invitations{}, ErrInvalidInvitation
+		}
+		return models.Invitations{}, err
+	}
+	invitation.Uses++
+	return invitation, nil
+}
+
+// CancelRedemption gives the use back when the sign up it was taken for failed
+func (r *invitationRepository) CancelRedemption(ctx context.Context, invitationID, userID primitive.ObjectID) error {
+	res, err := r.redemptions.DeleteOne(ctx, bson.M{"invitation_id": invitationID, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return nil
+	}
+	_, err = r.invitations.UpdateOne(ctx, bson.M{"_id": invitationID}, bson.M{"$inc": bson.M{"uses": -1}})
+	return err
+}
+
+// ApplyInvitation places an existing user where the invitation says, like CompleteUser does
+func (r *invitationRepository) ApplyInvitation(ctx context.Context, userID primitive.ObjectID, invitation models.Invitations) error {
+	set := bson.M{
+		"university_id": invitation.UniversityID,
+		"invitation_id": invitation.ID,
+		"is_complete":   true,
+		"updated_at":    time.Now(),
+	}
+	if invitation.SchoolID != nil {
+		set["school_id"] = invitation.SchoolID
+	}
+	if invitation.DepartmentID != nil {
+		set["department_id"] = invitation.DepartmentID
+	}
+	if invitation.AcedemicYear > 0 {
+		set["acedemic_year"] = invitation.AcedemicYear
+	}
+	res, err := r.users.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *invitationRepository) GetRedemptions(ctx context.Context, invitationID primitive.ObjectID) ([]models.InvitationRedemptions, error) {
+	cursor, err := r.redemptions.Find(ctx,
+		bson.M{"invitation_id": invitationID},
+		options.Find().SetSort(bson.D{{Key: "redeemed_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	redemptions := []models.InvitationRedemptions{}
+	if err := cursor.All(ctx, &redemptions); err != nil {
+		return nil, err
+	}
+	return redemptions, nil
+}
+
+// GetRegisteredEmails tells which of the lower cased addresses already have an account
+func (r *invitationRepository) GetRegisteredEmails(ctx context.Context, emails []string) (map[string]bool, error) {
+	registered := map[string]bool{}
+	if len(emails) == 0 {
+		return registered, nil
+	}
+	cursor, err := r.users.Find(ctx,
+		bson.M{"email": bson.M{"$in": emails}},
+		options.Find().SetProjection(bson.M{"email": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user struct {
+			Email string `bson:"email"`
+		}
+		if err := cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		registered[strings.ToLower(user.Email)] = true
+	}
+	return registered, cursor.Err()
+}
+
+// EnqueueInvitationEmails queues one email per invitation on the invitations queue, it returns
+// how many were queued before a failure
+func (r *invitationRepository) EnqueueInvitationEmails(ctx context.Context, invitations []models.Invitations) (int, error) {
+	for i, invitation := range invitations {
+		task, err := email.NewSendInvitationEmailTask(invitation.Email, invitation.Code, invitation.ExpiresAt)
+		if err != nil {
+			return i, err
+		}
+		if _, err := r.redisClient.EnqueueContext(ctx, task, asynq.Queue(constants.InvitationsQueue)); err != nil {
+			return i, err
+		}
+	}
+	return len(invitations), nil
+}
+
+func (r *invitationRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.invitations.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "department_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.redemptions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "invitation_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/chera-mihiretu/IKnow/domain/constants"
 	"github.com/chera-mihiretu/IKnow/domain/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -24,6 +25,7 @@ type JobRepository interface {
 
 type jobRepository struct {
 	jobs             *mongo.Collection
+	bookmarks        *mongo.Collection
 	departmentRepo   DepartmentRepository
 	geminiRepository GeminiRepository
 }
@@ -33,6 +35,7 @@ func NewJobRepository(db *mongo.Database,
 	geminiRepository GeminiRepository) JobRepository {
 	return &jobRepository{
 		jobs:             db.Collection("jobs"),
+		bookmarks:        db.Collection("bookmarks"),
 		departmentRepo:   departmentRepo,
 		geminiRepository: geminiRepository,
 	}
@@ -136,7 +139,7 @@ func (r *jobRepository) DeleteJob(ctx context.Context, id primitive.ObjectID) er
 	if res.DeletedCount == 0 {
 		return mongo.ErrNoDocuments
 	}
-	return nil
+	return deleteBookmarksOf(ctx, r.bookmarks, constants.BookmarkTypeJob, id)
 }
 
 // GetRecommendedJobs prioritizes jobs by department match and likes
@@ -0,0 +1,263 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/hashing"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	LoginFailureWindow   = 15 * time.Minute
+	LoginDelayAfter      = 3 // failures before every new attempt is delayed
+	LoginMaxDelay        = 30 * time.Second
+	AccountLockThreshold = 10
+	AccountLockDuration  = 30 * time.Minute
+	IPBlockThreshold     = 50
+	IPBlockDuration      = 30 * time.Minute
+
+	PasswordResetWindow     = time.Hour
+	PasswordResetPerAccount = 3
+	PasswordResetPerIP      = 10
+
+	VerificationResendWindow     = time.Hour
+	VerificationResendPerAccount = 3
+	VerificationResendPerIP      = 10
+
+	MagicLinkWindow     = time.Hour
+	MagicLinkPerAccount = 5
+	MagicLinkPerIP      = 20
+
+	unlockTokenSize = 32
+	loginKeyPrefix  = "auth:"
+)
+
+var ErrInvalidUnlockToken = errors.New("invalid or expired unlock link")
+
+// ThrottledError is returned while an account or an ip has to wait before trying again
+type ThrottledError struct {
+	Locked     bool // the account is locked, the user got an email to unlock it
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s, try again in %d seconds", e.Reason, int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+type LoginAttemptRepository interface {
+	CheckLogin(ctx context.Context, account, ip string) error
+	RecordFailure(ctx context.Context, account, ip string) (models.LoginFailure, error)
+	RecordSuccess(ctx context.Context, account string) error
+	CreateUnlockToken(ctx context.Context, account string) (string, error)
+	Unlock(ctx context.Context, token string) (string, error)
+	CheckPasswordReset(ctx context.Context, account, ip string) error
+	CheckVerificationResend(ctx context.Context, account, ip string) error
+	CheckMagicLink(ctx context.Context, account, ip string) error
+}
+
+type loginAttemptRepository struct {
+	store goredis.UniversalClient
+}
+
+func NewLoginAttemptRepository(store goredis.UniversalClient) LoginAttemptRepository {
+	return &loginAttemptRepository{store: store}
+}
+
+func (r *loginAttemptRepository) CheckLogin(ctx context.Context, account, ip string) error {
+	account = normalizeAccount(account)
+
+	ttl, err := r.store.PTTL(ctx, accountLockKey(account)).Result()
+	if err != nil {
+		return err
+	}
+	if ttl > 0 {
+		return &ThrottledError{Locked: true, Reason: "account temporarily locked after too many failed logins, check your email to unlock it", RetryAfter: ttl}
+	}
+
+	if ip != "" {
+		ttl, err = r.store.PTTL(ctx, ipBlockKey(ip)).Result()
+		if err != nil {
+			return err
+		}
+		if ttl > 0 {
+			return &ThrottledError{Reason: "too many failed logins from your network", RetryAfter: ttl}
+		}
+	}
+
+	ttl, err = r.store.PTTL(ctx, accountDelayKey(account)).Result()
+	if err != nil {
+		return err
+	}
+	if ttl > 0 {
+		return &ThrottledError{Reason: "too many failed logins", RetryAfter: ttl}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login for the account and the ip, delays the next attempt
+// exponentially once LoginDelayAfter is reached and locks or blocks on the thresholds.
+// Without an account, for an email nobody has, only the ip is counted
+func (r *loginAttemptRepository) RecordFailure(ctx context.Context, account, ip string) (models.LoginFailure, error) {
+	account = normalizeAccount(account)
+	var failure models.LoginFailure
+
+	if ip != "" {
+		ipFailures, err := r.incrementWindow(ctx, ipFailureKey(ip), LoginFailureWindow)
+		if err != nil {
+			return failure, err
+		}
+		failure.IPFailures = ipFailures
+
+		if ipFailures == IPBlockThreshold {
+			if err := r.store.Set(ctx, ipBlockKey(ip), 1, IPBlockDuration).Err(); err != nil {
+				return failure, err
+			}
+			failure.IPBlocked = true
+		}
+	}
+	if account == "" {
+		return failure, nil
+	}
+
+	accountFailures, err := r.incrementWindow(ctx, accountFailureKey(account), LoginFailureWindow)
+	if err != nil {
+		return failure, err
+	}
+	failure.AccountFailures = accountFailures
+
+	if accountFailures == AccountLockThreshold {
+		if err := r.store.Set(ctx, accountLockKey(account), 1, AccountLockDuration).Err(); err != nil {
+			return failure, err
+		}
+		failure.AccountLocked = true
+		failure.LockedUntil = time.Now().Add(AccountLockDuration)
+		return failure, nil
+	}
+
+	if accountFailures >= LoginDelayAfter {
+		delay := time.Duration(1<<uint(min(accountFailures-LoginDelayAfter, 5))) * time.Second
+		if delay > LoginMaxDelay {
+			delay = LoginMaxDelay
+		}
+		if err := r.store.Set(ctx, accountDelayKey(account), 1, delay).Err(); err != nil {
+			return failure, err
+		}
+	}
+	return failure, nil
+}
+
+// RecordSuccess clears the account counters, the ip counter is kept since one
+// valid account does not make the other attempts of that ip legitimate
+func (r *loginAttemptRepository) RecordSuccess(ctx context.Context, account string) error {
+	account = normalizeAccount(account)
+	return r.store.Del(ctx, accountFailureKey(account), accountDelayKey(account)).Err()
+}
+
+func (r *loginAttemptRepository) CreateUnlockToken(ctx context.Context, account string) (string, error) {
+	token, err := hashing.GenerateToken(unlockTokenSize)
+	if err != nil {
+		return "", errors.New("could not generate unlock token")
+	}
+	err = r.store.Set(ctx, unlockKey(token), normalizeAccount(account), AccountLockDuration).Err()
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Unlock consumes the token from the unlock email and returns the unlocked account
+func (r *loginAttemptRepository) Unlock(ctx context.Context, token string) (string, error) {
+	account, err := r.store.GetDel(ctx, unlockKey(token)).Result()
+	if err == goredis.Nil {
+		return "", ErrInvalidUnlockToken
+	}
+	if err != nil {
+		return "", err
+	}
+	err = r.store.Del(ctx, accountLockKey(account), accountFailureKey(account), accountDelayKey(account)).Err()
+	if err != nil {
+		return "", err
+	}
+	return account, nil
+}
+
+func (r *loginAttemptRepository) CheckPasswordReset(ctx context.Context, account, ip string) error {
+	return r.checkEmailLimit(ctx, "reset", account, ip,
+		PasswordResetWindow, PasswordResetPerAccount, PasswordResetPerIP,
+		"too many password reset requests")
+}
+
+func (r *loginAttemptRepository) CheckVerificationResend(ctx context.Context, account, ip string) error {
+	return r.checkEmailLimit(ctx, "resend", account, ip,
+		VerificationResendWindow, VerificationResendPerAccount, VerificationResendPerIP,
+		"too many verification emails requested")
+}
+
+func (r *loginAttemptRepository) CheckMagicLink(ctx context.Context, account, ip string) error {
+	return r.checkEmailLimit(ctx, "magic", account, ip,
+		MagicLinkWindow, MagicLinkPerAccount, MagicLinkPerIP,
+		"too many login links requested")
+}
+
+// checkEmailLimit counts the requests that send an email to the account, per account and per ip
+func (r *loginAttemptRepository) checkEmailLimit(ctx context.Context, kind, account, ip string, window time.Duration, perAccount, perIP int64, reason string) error {
+	account = normalizeAccount(account)
+
+	accountKey := loginKeyPrefix + kind + ":account:" + account
+	count, err := r.incrementWindow(ctx, accountKey, window)
+	if err != nil {
+		return err
+	}
+	if count > perAccount {
+		return r.limitThrottled(ctx, accountKey, reason)
+	}
+
+	if ip != "" {
+		ipKey := loginKeyPrefix + kind + ":ip:" + ip
+		count, err = r.incrementWindow(ctx, ipKey, window)
+		if err != nil {
+			return err
+		}
+		if count > perIP {
+			return r.limitThrottled(ctx, ipKey, reason)
+		}
+	}
+	return nil
+}
+
+func (r *loginAttemptRepository) limitThrottled(ctx context.Context, key, reason string) error {
+	ttl, err := r.store.PTTL(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	return &ThrottledError{Reason: reason, RetryAfter: ttl}
+}
+
+// incrementWindow increments a counter that expires a fixed time after its first increment
+func (r *loginAttemptRepository) incrementWindow(ctx context.Context, key string, window time.Duration) (int64, error) {
+	pipe := r.store.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func normalizeAccount(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
+
+func accountFailureKey(account string) string { return loginKeyPrefix + "failures:account:" + account }
+func accountDelayKey(account string) string   { return loginKeyPrefix + "delay:account:" + account }
+func accountLockKey(account string) string    { return loginKeyPrefix + "lock:account:" + account }
+func ipFailureKey(ip string) string           { return loginKeyPrefix + "failures:ip:" + ip }
+func ipBlockKey(ip string) string             { return loginKeyPrefix + "block:ip:" + ip }
+func unlockKey(token string) string           { return loginKeyPrefix + "unlock:" + hashing.HashToken(token) }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/chera-mihiretu/IKnow/domain/constants"
 	"github.com/chera-mihiretu/IKnow/domain/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -20,20 +21,37 @@ type MaterialsRepository interface {
 	UpdateMaterials(ctx context.Context, materials models.Materials) (models.Materials, error)
 	DeleteMaterials(ctx context.Context, userID primitive.ObjectID, id primitive.ObjectID) error
 	GetMaterialsInTree(ctx context.Context, departmentID primitive.ObjectID, year int, semester int) ([]models.Materials, error)
+	GetMaterialsWithListOfId(ctx context.Context, materialIDs []primitive.ObjectID) ([]models.Materials, error)
 }
 
 type materialsRepository struct {
 	materialss *mongo.Collection
 	department *mongo.Collection
+	bookmarks  *mongo.Collection
 }
 
 func NewMaterialsRepository(db *mongo.Database) MaterialsRepository {
 	return &materialsRepository{
 		materialss: db.Collection("materials"),
 		department: db.Collection("departments"),
+		bookmarks:  db.Collection("bookmarks"),
 	}
 }
 
+func (r *materialsRepository) GetMaterialsWithListOfId(ctx context.Context, materialIDs []primitive.ObjectID) ([]models.Materials, error) {
+	cursor, err := r.materialss.Find(ctx, bson.M{"_id": bson.M{"$in": materialIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	materials := []models.Materials{}
+	if err := cursor.All(ctx, &materials); err != nil {
+		return nil, err
+	}
+	return materials, nil
+}
+
 // GetMaterials implements MaterialsRepository.
 func (r *materialsRepository) GetMaterials(ctx context.Context, userID primitive.ObjectID, page int) ([]models.Materials, error) {
 	var materialss []models.Materials
@@ -129,7 +147,7 @@ func (r *materialsRepository) DeleteMaterials(ctx context.Context, userID primit
 		return mongo.ErrNoDocuments // No document found to delete
 	}
 
-	return nil
+	return deleteBookmarksOf(ctx, r.bookmarks, constants.BookmarkTypeMaterial, id)
 }
 
 // GetMaterialsInTree retrieves materials for a department filtered by year and semester
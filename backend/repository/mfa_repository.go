@@ -0,0 +1,406 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/hashing"
+	"github.com/chera-mihiretu/IKnow/infrastructure/totp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	MFAChallengeTTL = 5 * time.Minute
+	TOTPIssuer      = "IKnow"
+
+	mfaChallengeTokenSize = 32
+	mfaMaxAttempts        = 5
+	recoveryCodeCount     = 10
+	recoveryCodeSize      = 5
+)
+
+var (
+	ErrInvalidMFAChallenge   = errors.New("invalid or expired mfa challenge")
+	ErrInvalidMFACode        = errors.New("invalid authentication code")
+	ErrMFAEnrollmentRequired = errors.New("two factor authentication must be set up before logging in")
+	ErrMFANotEnabled         = errors.New("two factor authentication is not enabled")
+	ErrMFAAlreadyEnabled     = errors.New("two factor authentication is already enabled")
+	ErrMFANoPendingSetup     = errors.New("no pending two factor setup, start the enrollment first")
+	ErrMFAMandatory          = errors.New("two factor authentication is mandatory for your role")
+)
+
+type MFARepository interface {
+	// StartLogin opens a session right away or returns a challenge when a second factor is needed
+	StartLogin(ctx context.Context, user models.User, device models.SessionDevice) (models.LoginResult, error)
+	VerifyChallenge(ctx context.Context, challengeToken, code, recoveryCode string, device models.SessionDevice) (models.AuthTokens, error)
+	BeginEnrollment(ctx context.Context, userID primitive.ObjectID) (models.TOTPEnrollment, error)
+	ConfirmEnrollment(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error)
+	BeginChallengeEnrollment(ctx context.Context, challengeToken string) (models.TOTPEnrollment, error)
+	ConfirmChallengeEnrollment(ctx context.Context, challengeToken, code string, device models.SessionDevice) ([]string, models.AuthTokens, error)
+	DisableTwoFactor(ctx context.Context, userID primitive.ObjectID, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error)
+}
+
+type mfaRepository struct {
+	challenges        *mongo.Collection
+	users             *mongo.Collection
+	sessionRepository SessionRepository
+}
+
+func NewMFARepository(db *mongo.Database, sessionRepo SessionRepository) MFARepository {
+	return &mfaRepository{
+		challenges:        db.Collection("mfa_challenges"),
+		users:             db.Collection("users"),
+		sessionRepository: sessionRepo,
+	}
+}
+
+func (r *mfaRepository) StartLogin(ctx context.Context, user models.User, device models.SessionDevice) (models.LoginResult, error) {
+	mandatory := constants.MFARequiredRoles[constants.UserRole(user.Role)]
+	if !user.TwoFactorEnabled && !mandatory {
+		tokens, err := r.sessionRepository.CreateSession(ctx, user, device)
+		if err != nil {
+			return models.LoginResult{}, err
+		}
+		return models.LoginResult{Tokens: &tokens}, nil
+	}
+
+	token, err := hashing.GenerateToken(mfaChallengeTokenSize)
+	if err != nil {
+		return models.LoginResult{}, errors.New("could not generate mfa challenge")
+	}
+
+	now := time.Now()
+	challenge := models.MFAChallenges{
+		ID:                 primitive.NewObjectID(),
+		UserID:             user.ID,
+		Token:              hashing.HashToken(token),
+		EnrollmentRequired: !user.TwoFactorEnabled,
+		Attempts:           0,
+		Used:               false,
+		ExpiresAt:          now.Add(MFAChallengeTTL),
+		CreatedAt:          now,
+	}
+	if _, err := r.challenges.InsertOne(ctx, challenge); err != nil {
+		return models.LoginResult{}, errors.New("could not create mfa challenge")
+	}
+
+	return models.LoginResult{Challenge: &models.MFAChallenge{
+		Token:              token,
+		EnrollmentRequired: challenge.EnrollmentRequired,
+		ExpiresAt:          challenge.ExpiresAt,
+	}}, nil
+}
+
+func (r *mfaRepository) VerifyChallenge(ctx context.Context, challengeToken, code, recoveryCode string, device models.SessionDevice) (models.AuthTokens, error) {
+	challenge, err := r.findChallenge(ctx, challengeToken)
+	if err != nil {
+		return models.AuthTokens{}, err
+	}
+	if challenge.EnrollmentRequired {
+		return models.AuthTokens{}, ErrMFAEnrollmentRequired
+	}
+
+	user, err := r.findUser(ctx, challenge.UserID)
+	if err != nil {
+		return models.AuthTokens{}, err
+	}
+	if !user.TwoFactorEnabled {
+		return models.AuthTokens{}, ErrMFANotEnabled
+	}
+
+	if recoveryCode != "" {
+		err = r.useRecoveryCode(ctx, user, recoveryCode)
+	} else {
+		err = r.checkCode(ctx, user, user.TwoFactorSecret, code)
+	}
+	if err != nil {
+		r.failAttempt(ctx, challenge)
+		return models.AuthTokens{}, err
+	}
+
+	if err := r.consumeChallenge(ctx, challenge); err != nil {
+		return models.AuthTokens{}, err
+	}
+	return r.sessionRepository.CreateSession(ctx, user, device)
+}
+
+func (r *mfaRepository) BeginEnrollment(ctx context.Context, userID primitive.ObjectID) (models.TOTPEnrollment, error) {
+	user, err := r.findUser(ctx, userID)
+	if err != nil {
+		return models.TOTPEnrollment{}, err
+	}
+	if user.TwoFactorEnabled {
+		return models.TOTPEnrollment{}, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return models.TOTPEnrollment{}, errors.New("could not generate totp secret")
+	}
+	// the secret is kept pending until the user proves the app was set up with a valid code
+	_, err = r.users.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"two_factor_pending_secret": secret, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return models.TOTPEnrollment{}, err
+	}
+
+	return models.TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(secret, TOTPIssuer, user.Email),
+	}, nil
+}
+
+func (r *mfaRepository) ConfirmEnrollment(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error) {
+	user, err := r.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TwoFactorPendingSecret == "" {
+		return nil, ErrMFANoPendingSetup
+	}
+	if err := r.checkCode(ctx, user, user.TwoFactorPendingSecret, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashed, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.users.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{
+			"$set": bson.M{
+				"two_factor_enabled": true,
+				"two_factor_secret":  user.TwoFactorPendingSecret,
+				"recovery_codes":     hashed,
+				"updated_at":         time.Now(),
+			},
+			"$unset": bson.M{"two_factor_pending_secret": ""},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (r *mfaRepository) BeginChallengeEnrollment(ctx context.Context, challengeToken string) (models.TOTPEnrollment, error) {
+	challenge, err := r.findChallenge(ctx, challengeToken)
+	if err != nil {
+		return models.TOTPEnrollment{}, err
+	}
+	if !challenge.EnrollmentRequired {
+		return models.TOTPEnrollment{}, ErrMFAAlreadyEnabled
+	}
+	return r.BeginEnrollment(ctx, challenge.UserID)
+}
+
+// ConfirmChallengeEnrollment finishes the mandatory enrollment of a login in progress,
+// the login completes in the same step so the user does not have to type a second code
+func (r *mfaRepository) ConfirmChallengeEnrollment(ctx context.Context, challengeToken, code string, device models.SessionDevice) ([]string, models.AuthTokens, error) {
+	challenge, err := r.findChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, models.AuthTokens{}, err
+	}
+	if !challenge.EnrollmentRequired {
+		return nil, models.AuthTokens{}, ErrMFAAlreadyEnabled
+	}
+
+	codes, err := r.ConfirmEnrollment(ctx, challenge.UserID, code)
+	if err != nil {
+		if err == ErrInvalidMFACode {
+			r.failAttempt(ctx, challenge)
+		}
+		return nil, models.AuthTokens{}, err
+	}
+
+	if err := r.consumeChallenge(ctx, challenge); err != nil {
+		return nil, models.AuthTokens{}, err
+	}
+	user, err := r.findUser(ctx, challenge.UserID)
+	if err != nil {
+		return nil, models.AuthTokens{}, err
+	}
+	tokens, err := r.sessionRepository.CreateSession(ctx, user, device)
+	if err != nil {
+		return nil, models.AuthTokens{}, err
+	}
+	return codes, tokens, nil
+}
+
+func (r *mfaRepository) DisableTwoFactor(ctx context.Context, userID primitive.ObjectID, code string) error {
+	user, err := r.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if constants.MFARequiredRoles[constants.UserRole(user.Role)] {
+		return ErrMFAMandatory
+	}
+	if !user.TwoFactorEnabled {
+		return ErrMFANotEnabled
+	}
+	if err := r.checkCode(ctx, user, user.TwoFactorSecret, code); err != nil {
+		return err
+	}
+
+	_, err = r.users.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{
+			"$set": bson.M{"two_factor_enabled": false, "updated_at": time.Now()},
+			"$unset": bson.M{
+				"two_factor_secret":         "",
+				"two_factor_pending_secret": "",
+				"two_factor_last_step":      "",
+				"recovery_codes":            "",
+			},
+		},
+	)
+	return err
+}
+
+func (r *mfaRepository) RegenerateRecoveryCodes(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error) {
+	user, err := r.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TwoFactorEnabled {
+		return nil, ErrMFANotEnabled
+	}
+	if err := r.checkCode(ctx, user, user.TwoFactorSecret, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashed, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.users.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"recovery_codes": hashed, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (r *mfaRepository) findChallenge(ctx context.Context, challengeToken string) (models.MFAChallenges, error) {
+	var challenge models.MFAChallenges
+	err := r.challenges.FindOne(ctx, bson.M{
+		"token":      hashing.HashToken(challengeToken),
+		"used":       false,
+		"expires_at": bson.M{"$gt": time.Now()},
+		"attempts":   bson.M{"$lt": mfaMaxAttempts},
+	}).Decode(&challenge)
+	if err == mongo.ErrNoDocuments {
+		return models.MFAChallenges{}, ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return models.MFAChallenges{}, err
+	}
+	return challenge, nil
+}
+
+// consumeChallenge marks the challenge used, the filter on used makes sure a challenge
+// only ever turns into one session
+func (r *mfaRepository) consumeChallenge(ctx context.Context, challenge models.MFAChallenges) error {
+	res, err := r.challenges.UpdateOne(ctx,
+		bson.M{"_id": challenge.ID, "used": false},
+		bson.M{"$set": bson.M{"used": true}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 0 {
+		return ErrInvalidMFAChallenge
+	}
+	return nil
+}
+
+func (r *mfaRepository) failAttempt(ctx context.Context, challenge models.MFAChallenges) {
+	r.challenges.UpdateOne(ctx, bson.M{"_id": challenge.ID}, bson.M{"$inc": bson.M{"attempts": 1}})
+}
+
+func (r *mfaRepository) findUser(ctx context.Context, userID primitive.ObjectID) (models.User, error) {
+	var user models.User
+	if err := r.users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return models.User{}, errors.New("user not found")
+	}
+	return user, nil
+}
+
+// checkCode validates a totp code and records its time step, a code that was
+// already accepted once is rejected even if it is still inside its window
+func (r *mfaRepository) checkCode(ctx context.Context, user models.User, secret, code string) error {
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok || step <= user.TwoFactorLastStep {
+		return ErrInvalidMFACode
+	}
+
+	res, err := r.users.UpdateOne(ctx,
+		bson.M{
+			"_id": user.ID,
+			"$or": bson.A{
+				bson.M{"two_factor_last_step": bson.M{"$lt": step}},
+				bson.M{"two_factor_last_step": bson.M{"$exists": false}},
+			},
+		},
+		bson.M{"$set": bson.M{"two_factor_last_step": step}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (r *mfaRepository) useRecoveryCode(ctx context.Context, user models.User, recoveryCode string) error {
+	hashed := hashing.HashToken(normalizeRecoveryCode(recoveryCode))
+	res, err := r.users.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "recovery_codes": hashed},
+		bson.M{"$pull": bson.M{"recovery_codes": hashed}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// generateRecoveryCodes returns the codes to show once to the user and their hashes to store
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashed := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, errors.New("could not generate recovery codes")
+		}
+		code := hex.EncodeToString(buf)
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashed = append(hashed, hashing.HashToken(code))
+	}
+	return codes, hashed, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
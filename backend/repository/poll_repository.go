@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	MinPollOptions     = 2
+	MaxPollOptions     = 10
+	MaxPollQuestionLen = 300
+	MaxPollOptionLen   = 100
+)
+
+var (
+	ErrInvalidPoll     = errors.New("a poll needs a question and 2 to 10 distinct options")
+	ErrPollClosingTime = errors.New("the poll must close in the future")
+	ErrPollNotFound    = errors.New("poll not found")
+	ErrPollClosed      = errors.New("the poll is closed")
+	ErrAlreadyVoted    = errors.New("you have already voted on this poll")
+	ErrInvalidPollVote = errors.New("choose one of the options, or several if the poll allows it")
+	ErrPollAnonymous   = errors.New("the votes of an anonymous poll are not shown")
+)
+
+type PollRepository interface {
+	Vote(ctx context.Context, postID, userID primitive.ObjectID, choices []int) (models.Polls, error)
+	GetVotes(ctx context.Context, userID primitive.ObjectID, postIDs []primitive.ObjectID) ([]models.PollVotes, error)
+	GetPollVotes(ctx context.Context, postID primitive.ObjectID) ([]models.PollVotes, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type pollRepository struct {
+	posts *mongo.Collection
+	votes *mongo.Collection
+}
+
+func NewPollRepository(db *mongo.Database) PollRepository {
+	return &pollRepository{
+		posts: db.Collection("posts"),
+		votes: db.Collection("poll_votes"),
+	}
+}
+
+// normalizePoll trims the poll a post is created with and starts its tallies at zero
+func normalizePoll(poll models.Polls) (models.Polls, error) {
+	poll.Question = strings.TrimSpace(poll.Question)
+	if poll.Question == "" || len(poll.Question) > MaxPollQuestionLen {
+		return models.Polls{}, ErrInvalidPoll
+	}
+	if len(poll.Options) < MinPollOptions || len(poll.Options) > MaxPollOptions {
+		return models.Polls{}, ErrInvalidPoll
+	}
+	seen := make(map[string]bool, len(poll.Options))
+	for i, option := range poll.Options {
+		text := strings.TrimSpace(option.Text)
+		if text == "" || len(text) > MaxPollOptionLen || seen[strings.ToLower(text)] {
+			return models.Polls{}, ErrInvalidPoll
+		}
+		seen[strings.ToLower(text)] = true
+		poll.Options[i] = models.PollOptions{Text: text}
+	}
+	if poll.ClosesAt != nil && !poll.ClosesAt.After(time.Now()) {
+		return models.Polls{}, ErrPollClosingTime
+	}
+	poll.Voters = 0
+	return poll, nil
+}
+
+// pollText is what moderation reads of a poll
+func pollText(poll *models.Polls) string {
+	if poll == nil {
+		return ""
+	}
+	texts := []string{poll.Question}
+	for _, option := range poll.Options {
+		texts = append(texts, option.Text)
+	}
+	return "\n" + strings.Join(texts, "\n")
+}
+
+// Vote records the only vote the user gets on the poll and returns the new tallies,
+// the unique index on the votes keeps two votes at the same time from both counting
+func (r *pollRepository) Vote(ctx context.Context, postID, userID primitive.ObjectID, choices []int) (models.Polls, error) {
+	var post models.Posts
+	err := r.posts.FindOne(ctx, published(bson.M{"_id": postID, "is_validated": true, "poll": bson.M{"$exists": true}})).Decode(&post)
+	if err == mongo.ErrNoDocuments {
+		return models.Polls{}, ErrPollNotFound
+	}
+	if err != nil {
+		return models.Polls{}, err
+	}
+	poll := post.Poll
+	if poll == nil {
+		return models.Polls{}, ErrPollNotFound
+	}
+	if poll.ClosesAt != nil && !poll.ClosesAt.After(time.Now()) {
+		return models.Polls{}, ErrPollClosed
+	}
+
+	if len(choices) == 0 || (!poll.MultipleChoice && len(choices) > 1) {
+		return models.Polls{}, ErrInvalidPollVote
+	}
+	chosen := make(map[int]bool, len(choices))
+	for _, choice := range choices {
+		if choice < 0 || choice >= len(poll.Options) || chosen[choice] {
+			return models.Polls{}, ErrInvalidPollVote
+		}
+		chosen[choice] = true
+	}
+
+	_, err = r.votes.InsertOne(ctx, models.PollVotes{
+		ID:        primitive.NewObjectID(),
+		PostID:    postID,
+		UserID:    userID,
+		Options:   choices,
+		CreatedAt: time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return models.Polls{}, ErrAlreadyVoted
+	}
+	if err != nil {
+		return models.Polls{}, err
+	}
+
+	increments := bson.M{"poll.voters": 1}
+	for _, choice := range choices {
+		increments["poll.options."+strconv.Itoa(choice)+".votes"] = 1
+	}
+	var updated models.Posts
+	err = r.posts.FindOneAndUpdate(ctx,
+		bson.M{"_id": postID},
+		bson.M{"$inc": increments},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"poll": 1}),
+	).Decode(&updated)
+	if err != nil {
+		r.votes.DeleteOne(ctx, bson.M{"post_id": postID, "user_id": userID})
+		return models.Polls{}, err
+	}
+	return *updated.Poll, nil
+}
+
+// GetVotes returns the votes of the user on the given posts, to mark what they chose
+func (r *pollRepository) GetVotes(ctx context.Context, userID primitive.ObjectID, postIDs []primitive.ObjectID) ([]models.PollVotes, error) {
+	if len(postIDs) == 0 {
+		return []models.PollVotes{}, nil
+	}
+	cursor, err := r.votes.Find(ctx, bson.M{"user_id": userID, "post_id": bson.M{"$in": postIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	votes := []models.PollVotes{}
+	if err := cursor.All(ctx, &votes); err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
+
+// GetPollVotes returns every vote of a poll that is not anonymous
+func (r *pollRepository) GetPollVotes(ctx context.Context, postID primitive.ObjectID) ([]models.PollVotes, error) {
+	var post models.Posts
+	err := r.posts.FindOne(ctx, published(bson.M{"_id": postID, "poll": bson.M{"$exists": true}})).Decode(&post)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPollNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if post.Poll == nil {
+		return nil, ErrPollNotFound
+	}
+	if post.Poll.Anonymous {
+		return nil, ErrPollAnonymous
+	}
+
+	cursor, err := r.votes.Find(ctx, bson.M{"post_id": postID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	votes := []models.PollVotes{}
+	if err := cursor.All(ctx, &votes); err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
+
+func (r *pollRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.votes.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "post_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
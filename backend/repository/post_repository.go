@@ -2,10 +2,15 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
+	"github.com/chera-mihiretu/IKnow/domain/constants"
 	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/hibiken/asynq"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -16,38 +21,88 @@ const (
 	Pagesize = 10 // Number of posts per page
 )
 
+var (
+	ErrPostEditConflict = errors.New("the post was edited at the same time, try again")
+	ErrPostNotDraft     = errors.New("only drafts and scheduled posts can be scheduled or published")
+	ErrPostNotScheduled = errors.New("the post is not scheduled")
+	ErrPublishAtPast    = errors.New("publish_at must be in the future")
+
+	ErrInvalidAudience     = errors.New("the audience is public, university, school, department or connections, with at most 10 departments")
+	ErrAudienceUnavailable = errors.New("you are not part of a university, school or department to post to")
+	ErrAudienceDepartments = errors.New("the departments of the audience must be departments of your university")
+)
+
+// MaxAudienceDepartments is how many departments a post can be for
+const MaxAudienceDepartments = 10
+
+// unpublished matches drafts and scheduled posts, anything else is published
+var unpublished = bson.M{"$in": bson.A{constants.PostStatusDraft, constants.PostStatusScheduled}}
+
+// published restricts a filter to the posts everyone can see
+func published(filter bson.M) bson.M {
+	filter["status"] = bson.M{"$nin": bson.A{constants.PostStatusDraft, constants.PostStatusScheduled}}
+	return filter
+}
+
 type PostRepository interface {
 	GetRecomendedPosts(ctx context.Context, userID string, page int) ([]models.Posts, error)
 	GetPosts(ctx context.Context, userID string, page int) ([]models.Posts, error)
-	GetPostsByUserID(ctx context.Context, userID string, page int) ([]models.Posts, error)
+	GetPostsByUserID(ctx context.Context, userID string, viewerID primitive.ObjectID, page int) ([]models.Posts, error)
 	GetPostByID(ctx context.Context, id string) (models.Posts, error)
 	CreatePost(ctx context.Context, post models.Posts) (models.Posts, error)
 	UpdatePost(ctx context.Context, post models.Posts) (models.Posts, error)
 	DeletePost(ctx context.Context, userID string, postID string) error
-	SearchPosts(ctx context.Context, query string, page int) ([]models.Posts, error)
+	SearchPosts(ctx context.Context, query string, viewerID primitive.ObjectID, page int) ([]models.Posts, error)
 	GetPostsWithListOfId(ctx context.Context, postIDs []primitive.ObjectID) ([]models.Posts, error)
-	GetUnverifiedPosts(ctx context.Context, page int) ([]models.Posts, error)
+	GetUnverifiedPosts(ctx context.Context, page int, scope models.AccessScope) ([]models.Posts, error)
 	VerifyPosts(ctx context.Context, postID primitive.ObjectID) (primitive.ObjectID, error)
 	RemoveUnverifiedPost(ctx context.Context, postID primitive.ObjectID) (primitive.ObjectID, error)
+	GetPostRevisions(ctx context.Context, postID primitive.ObjectID) ([]models.PostRevisions, error)
+	GetDrafts(ctx context.Context, userID primitive.ObjectID, page int) ([]models.Posts, error)
+	SchedulePost(ctx context.Context, userID, postID primitive.ObjectID, publishAt time.Time) (models.Posts, error)
+	CancelSchedule(ctx context.Context, userID, postID primitive.ObjectID) (models.Posts, error)
+	PublishPost(ctx context.Context, postID primitive.ObjectID, userID *primitive.ObjectID, publishAt *time.Time) (models.Posts, error)
+	SetTags(ctx context.Context, postID primitive.ObjectID, content string, tags []string) error
+	GetPostsByTag(ctx context.Context, tag string, viewerID primitive.ObjectID, page int) ([]models.Posts, error)
+	GetVisiblePostIDs(ctx context.Context, viewerID primitive.ObjectID, postIDs []primitive.ObjectID) ([]primitive.ObjectID, error)
+	GetAudienceMembers(ctx context.Context, post models.Posts, userIDs []primitive.ObjectID) ([]primitive.ObjectID, error)
+	EnsureIndexes(ctx context.Context) error
 }
 
 type postRepository struct {
 	postsDB           *mongo.Collection
+	revisionsDB       *mongo.Collection
+	pollVotesDB       *mongo.Collection
+	postLikesDB       *mongo.Collection
+	bookmarksDB       *mongo.Collection
+	usersDB           *mongo.Collection
+	schoolsDB         *mongo.Collection
+	departmentsDB     *mongo.Collection
 	connectRepository ConnectRepository
 	userRepository    UserRepository
 	geminiRepository  GeminiRepository
+	redisClient       *asynq.Client
 }
 
 func NewPostRepository(db *mongo.Database,
 	department DepartmentRepository,
 	connect ConnectRepository,
 	userRepo userRepository,
-	geminiRepo GeminiRepository) PostRepository {
+	geminiRepo GeminiRepository,
+	redisClient *asynq.Client) PostRepository {
 	return &postRepository{
 		postsDB:           db.Collection("posts"),
+		revisionsDB:       db.Collection("post_revisions"),
+		pollVotesDB:       db.Collection("poll_votes"),
+		postLikesDB:       db.Collection("post_likes"),
+		bookmarksDB:       db.Collection("bookmarks"),
+		usersDB:           db.Collection("users"),
+		schoolsDB:         db.Collection("schools"),
+		departmentsDB:     db.Collection("departments"),
 		connectRepository: connect,
 		userRepository:    &userRepo,
 		geminiRepository:  geminiRepo,
+		redisClient:       redisClient,
 	}
 }
 
@@ -62,6 +117,18 @@ func (r *postRepository) RemoveUnverifiedPost(ctx context.Context, postID primit
 	if err != nil {
 		return primitive.NilObjectID, fmt.Errorf("failed to remove unverified post: %v", err)
 	}
+	if err := archiveRemovedPost(ctx, r.revisionsDB, post); err != nil {
+		return primitive.NilObjectID, fmt.Errorf("failed to keep the removed post: %v", err)
+	}
+	if _, err := r.pollVotesDB.DeleteMany(ctx, bson.M{"post_id": postID}); err != nil {
+		return primitive.NilObjectID, fmt.Errorf("failed to remove the poll votes: %v", err)
+	}
+	if err := deleteBookmarksOf(ctx, r.bookmarksDB, constants.BookmarkTypePost, postID); err != nil {
+		return primitive.NilObjectID, fmt.Errorf("failed to remove the bookmarks: %v", err)
+	}
+	if err := removeReposts(ctx, r.postsDB, r.bookmarksDB, post); err != nil {
+		return primitive.NilObjectID, fmt.Errorf("failed to remove the reposts: %v", err)
+	}
 	return post.UserID, nil
 }
 
@@ -73,17 +140,31 @@ func (r *postRepository) VerifyPosts(ctx context.Context, postID primitive.Objec
 	if err != nil {
 		return primitive.NilObjectID, fmt.Errorf("failed to find post: %v", err)
 	}
+	// only the verification that changes the post counts a quote on the post it quotes
+	filter["is_validated"] = bson.M{"$ne": true}
 	update := bson.M{"$set": bson.M{"is_validated": true, "updated_at": time.Now()}}
-	_, err = r.postsDB.UpdateOne(ctx, filter, update)
+	res, err := r.postsDB.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return primitive.NilObjectID, fmt.Errorf("failed to verify post: %v", err)
 	}
+	if res.ModifiedCount == 1 && post.RepostOf != nil {
+		if err := countReposts(ctx, r.postsDB, *post.RepostOf, 1); err != nil {
+			return primitive.NilObjectID, fmt.Errorf("failed to count the repost: %v", err)
+		}
+	}
 
 	return post.UserID, nil
 }
 
-func (p *postRepository) GetUnverifiedPosts(ctx context.Context, page int) ([]models.Posts, error) {
-	filter := bson.M{"is_validated": false}
+func (p *postRepository) GetUnverifiedPosts(ctx context.Context, page int, scope models.AccessScope) ([]models.Posts, error) {
+	filter := published(bson.M{"is_validated": false})
+	if !scope.Global {
+		departmentIDs := make([]string, 0, len(scope.DepartmentIDs))
+		for _, id := range scope.DepartmentIDs {
+			departmentIDs = append(departmentIDs, id.Hex())
+		}
+		filter["department_id"] = bson.M{"$in": departmentIDs}
+	}
 	pageSize := Pagesize
 	findOptions := options.Find().SetSkip(int64((page - 1) * pageSize)).SetLimit(int64(pageSize + 1))
 	cursor, err := p.postsDB.Find(ctx, filter, findOptions)
@@ -147,25 +228,20 @@ func (p *postRepository) GetRecomendedPosts(ctx context.Context, userID string,
 	}
 	// wrap single department in a slice
 
-	// Get the user's connections
-	following, err := p.connectRepository.GetConnects(ctx, userID)
+	userObjID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		return nil, err
 	}
 
-	connects := []primitive.ObjectID{}
-
-	userObjID, err := primitive.ObjectIDFromHex(userID)
+	// Get the user's connections
+	connects, err := p.connectIDs(ctx, userObjID)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, row := range following {
-		if row.ConnectorID == userObjID {
-			connects = append(connects, row.ConnecteeID)
-		} else {
-			connects = append(connects, row.ConnectorID)
-		}
+	interests, err := p.interestTags(ctx, userObjID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Pagination logic
@@ -176,11 +252,20 @@ func (p *postRepository) GetRecomendedPosts(ctx context.Context, userID string,
 
 	// Build the aggregation pipeline
 	pipeline := mongo.Pipeline{
-		// Stage 0: Exclude posts with IsVerified=false or IsFlagged=true
-		bson.D{{Key: "$match", Value: bson.M{
+		// Stage 0: Exclude posts with IsVerified=false or IsFlagged=true, the plain reposts of
+		// anyone but the connections and the posts that are not for the user
+		bson.D{{Key: "$match", Value: published(bson.M{
 			"is_validated": true,
 			"is_flagged":   false,
-		}}},
+			"$and": bson.A{
+				bson.M{"$or": bson.A{
+					bson.M{"repost_of": bson.M{"$exists": false}},
+					bson.M{"content": bson.M{"$ne": ""}},
+					bson.M{"user_id": bson.M{"$in": connects}},
+				}},
+				audienceFilter(user, connects),
+			},
+		})}},
 		// Stage 1: Add a priority field
 		bson.D{{Key: "$addFields", Value: bson.D{
 			{Key: "priority", Value: bson.D{
@@ -193,19 +278,29 @@ func (p *postRepository) GetRecomendedPosts(ctx context.Context, userID string,
 				}},
 			}},
 		}}},
-		// Stage 2: Sort by priority, then created_at (desc), likes (desc), comments (desc)
-		bson.D{{Key: "$sort", Value: bson.D{
-			{Key: "priority", Value: 1},
-			{Key: "created_at", Value: -1},
-			{Key: "likes", Value: -1},
-			{Key: "comments", Value: -1},
+		// Stage 1.5: Count the tags the post shares with what the user is interested in
+		bson.D{{Key: "$addFields", Value: bson.D{
+			{Key: "tag_matches", Value: bson.D{{Key: "$size", Value: bson.D{{Key: "$setIntersection", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$tags", bson.A{}}}}, interests}}}}}},
+		}}},
+		// Stage 2: Sort by priority, then tag matches (desc), created_at (desc), likes (desc), comments (desc)
+		bson.D{{Key: "$sort", Value: feedSort}},
+		// Stage 2.5: A post and its plain reposts show once, as whichever of them ranks first
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$eq", Value: bson.A{"$content", ""}}},
+				bson.D{{Key: "$ifNull", Value: bson.A{"$repost_of", "$_id"}}},
+				"$_id",
+			}}}},
+			{Key: "post", Value: bson.D{{Key: "$first", Value: "$$ROOT"}}},
 		}}},
+		bson.D{{Key: "$replaceRoot", Value: bson.D{{Key: "newRoot", Value: "$post"}}}},
+		bson.D{{Key: "$sort", Value: feedSort}},
 		// Stage 3: Pagination
 		bson.D{{Key: "$skip", Value: skip}},
 		bson.D{{Key: "$limit", Value: limit + 1}},
 	}
 
-	cursor, err := p.postsDB.Aggregate(ctx, pipeline)
+	cursor, err := p.postsDB.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
 	if err != nil {
 		fmt.Println("Error in aggregation pipeline:", err)
 		return nil, err
@@ -228,6 +323,244 @@ func (p *postRepository) GetRecomendedPosts(ctx context.Context, userID string,
 	return posts, nil
 }
 
+// connectIDs are the users the user is connected with
+func (p *postRepository) connectIDs(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	following, err := p.connectRepository.GetConnects(ctx, userID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	connects := make([]primitive.ObjectID, 0, len(following))
+	for _, row := range following {
+		if row.ConnectorID == userID {
+			connects = append(connects, row.ConnecteeID)
+		} else {
+			connects = append(connects, row.ConnectorID)
+		}
+	}
+	return connects, nil
+}
+
+// audienceFilter matches the posts the viewer is in the audience of, a post without an
+// audience is public and the author always sees their own posts
+func audienceFilter(viewer models.UserView, connects []primitive.ObjectID) bson.M {
+	groups := bson.A{}
+	for _, id := range []*primitive.ObjectID{viewer.UniversityID, viewer.SchoolID, viewer.DepartmentID} {
+		if id != nil {
+			groups = append(groups, *id)
+		}
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{"audience": bson.M{"$in": bson.A{nil, constants.PostAudiencePublic}}},
+		bson.M{"user_id": viewer.ID},
+		bson.M{
+			"audience":     bson.M{"$in": bson.A{constants.PostAudienceUniversity, constants.PostAudienceSchool, constants.PostAudienceDepartment}},
+			"audience_ids": bson.M{"$in": groups},
+		},
+		bson.M{"audience": constants.PostAudienceConnections, "user_id": bson.M{"$in": connects}},
+	}}
+}
+
+// viewerAudience is the audienceFilter of the viewer
+func (p *postRepository) viewerAudience(ctx context.Context, viewerID primitive.ObjectID) (bson.M, error) {
+	viewer, err := p.userRepository.GetUserById(ctx, viewerID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	connects, err := p.connectIDs(ctx, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	return audienceFilter(viewer, connects), nil
+}
+
+// GetVisiblePostIDs tells which of the posts the viewer can see, published and validated
+// posts the viewer is in the audience of. The author sees drafts and rejected posts too
+func (p *postRepository) GetVisiblePostIDs(ctx context.Context, viewerID primitive.ObjectID, postIDs []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	if len(postIDs) == 0 {
+		return []primitive.ObjectID{}, nil
+	}
+	audience, err := p.viewerAudience(ctx, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	return distinctIDs(ctx, p.postsDB, bson.M{
+		"_id": bson.M{"$in": postIDs},
+		"$or": bson.A{
+			bson.M{"user_id": viewerID},
+			published(bson.M{"is_validated": true, "$and": bson.A{audience}}),
+		},
+	})
+}
+
+// GetAudienceMembers keeps the users the post is for, so nobody is told about a post they
+// can not see
+func (p *postRepository) GetAudienceMembers(ctx context.Context, post models.Posts, userIDs []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	switch post.Audience {
+	case "", constants.PostAudiencePublic:
+		return userIDs, nil
+	case constants.PostAudienceConnections:
+		connects, err := p.connectIDs(ctx, post.UserID)
+		if err != nil {
+			return nil, err
+		}
+		connected := make(map[primitive.ObjectID]bool, len(connects))
+		for _, id := range connects {
+			connected[id] = true
+		}
+		members := make([]primitive.ObjectID, 0, len(userIDs))
+		for _, id := range userIDs {
+			if connected[id] || id == post.UserID {
+				members = append(members, id)
+			}
+		}
+		return members, nil
+	}
+
+	field := "department_id"
+	switch post.Audience {
+	case constants.PostAudienceUniversity:
+		field = "university_id"
+	case constants.PostAudienceSchool:
+		field = "school_id"
+	}
+	return distinctIDs(ctx, p.usersDB, bson.M{
+		"_id": bson.M{"$in": userIDs},
+		"$or": bson.A{bson.M{field: bson.M{"$in": post.AudienceIDs}}, bson.M{"_id": post.UserID}},
+	})
+}
+
+// resolveAudience fixes who the post is for when it is created, a university, school or
+// department audience keeps the ones of the author at that time
+func (p *postRepository) resolveAudience(ctx context.Context, post *models.Posts) error {
+	post.AudienceIDs = nil
+	switch post.Audience {
+	case "", constants.PostAudiencePublic:
+		post.Audience = constants.PostAudiencePublic
+		return nil
+	case constants.PostAudienceConnections:
+		return nil
+	case constants.PostAudienceUniversity, constants.PostAudienceSchool, constants.PostAudienceDepartment:
+	default:
+		return ErrInvalidAudience
+	}
+
+	author, err := p.userRepository.GetUserById(ctx, post.UserID.Hex())
+	if err != nil {
+		return err
+	}
+
+	// departments chosen with the post are its audience, they must be of the university
+	// of the author
+	if post.Audience == constants.PostAudienceDepartment && len(post.Departements) > 0 {
+		if len(post.Departements) > MaxAudienceDepartments {
+			return ErrInvalidAudience
+		}
+		chosen := map[primitive.ObjectID]bool{}
+		for _, hex := range post.Departements {
+			id, err := primitive.ObjectIDFromHex(hex)
+			if err != nil {
+				return ErrInvalidAudience
+			}
+			if !chosen[id] {
+				chosen[id] = true
+				post.AudienceIDs = append(post.AudienceIDs, id)
+			}
+		}
+		if author.UniversityID == nil {
+			return ErrAudienceUnavailable
+		}
+		schools, err := distinctIDs(ctx, p.schoolsDB, bson.M{"university_id": *author.UniversityID})
+		if err != nil {
+			return err
+		}
+		found, err := distinctIDs(ctx, p.departmentsDB, bson.M{"_id": bson.M{"$in": post.AudienceIDs}, "school_id": bson.M{"$in": schools}})
+		if err != nil {
+			return err
+		}
+		if len(found) != len(post.AudienceIDs) {
+			return ErrAudienceDepartments
+		}
+		post.Departements = make([]string, 0, len(post.AudienceIDs))
+		for _, id := range post.AudienceIDs {
+			post.Departements = append(post.Departements, id.Hex())
+		}
+		return nil
+	}
+
+	var id *primitive.ObjectID
+	switch post.Audience {
+	case constants.PostAudienceUniversity:
+		id = author.UniversityID
+	case constants.PostAudienceSchool:
+		id = author.SchoolID
+	case constants.PostAudienceDepartment:
+		id = author.DepartmentID
+		if id != nil {
+			post.Departements = []string{id.Hex()}
+		}
+	}
+	if id == nil {
+		return ErrAudienceUnavailable
+	}
+	post.AudienceIDs = []primitive.ObjectID{*id}
+	return nil
+}
+
+// feedSort ranks the feed, the id keeps the order of equal posts the same from page to page
+var feedSort = bson.D{
+	{Key: "priority", Value: 1},
+	{Key: "tag_matches", Value: -1},
+	{Key: "created_at", Value: -1},
+	{Key: "likes", Value: -1},
+	{Key: "comments", Value: -1},
+	{Key: "_id", Value: -1},
+}
+
+// interestTags are the most common tags of the posts the user recently liked or wrote
+func (p *postRepository) interestTags(ctx context.Context, userID primitive.ObjectID) ([]string, error) {
+	likedIDs := []primitive.ObjectID{}
+	cursor, err := p.postLikesDB.Find(ctx, bson.M{"user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(50).SetProjection(bson.M{"post_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var likes []models.Like
+	if err := cursor.All(ctx, &likes); err != nil {
+		return nil, err
+	}
+	for _, like := range likes {
+		likedIDs = append(likedIDs, like.PostID)
+	}
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"user_id": userID},
+			bson.M{"_id": bson.M{"$in": likedIDs}},
+		}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: -1}}}},
+		bson.D{{Key: "$limit", Value: 100}},
+		bson.D{{Key: "$unwind", Value: "$tags"}},
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$tags"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$limit", Value: 20}},
+	}
+	cursor, err = p.postsDB.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		Tag string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0, len(counts))
+	for _, count := range counts {
+		tags = append(tags, count.Tag)
+	}
+	return tags, nil
+}
+
 func (p *postRepository) GetPosts(ctx context.Context, userID string, page int) ([]models.Posts, error) {
 	return p.GetRecomendedPosts(ctx, userID, page)
 }
@@ -246,45 +579,377 @@ func (p *postRepository) GetPostByID(ctx context.Context, id string) (models.Pos
 	return post, nil
 }
 
+// CreatePost publishes the post right away unless it is saved as a draft or scheduled,
+// those are moderated when they are published
 func (p *postRepository) CreatePost(ctx context.Context, post models.Posts) (models.Posts, error) {
 	id := primitive.NewObjectID()
 	post.ID = id
+	post.Tags = NormalizeTags(post.Tags)
+	post.AuthorTags = post.Tags
+	if post.Poll != nil {
+		poll, err := normalizePoll(*post.Poll)
+		if err != nil {
+			return models.Posts{}, err
+		}
+		post.Poll = &poll
+	}
+	if err := p.resolveAudience(ctx, &post); err != nil {
+		return models.Posts{}, err
+	}
+	post.CreatedAt = time.Now()
+	post.UpdatedAt = time.Now()
 
-	validate, err := p.geminiRepository.EvaluatePost(ctx, post.Content)
+	switch {
+	case post.Status == constants.PostStatusDraft:
+		post.PublishAt = nil
+		post.IsValidated = false
+	case post.PublishAt != nil:
+		if !post.PublishAt.After(time.Now()) {
+			return models.Posts{}, ErrPublishAtPast
+		}
+		publishAt := post.PublishAt.Truncate(time.Millisecond)
+		post.PublishAt = &publishAt
+		post.Status = constants.PostStatusScheduled
+		post.IsValidated = false
+	default:
+		validate, err := p.geminiRepository.EvaluatePost(ctx, post.Content+pollText(post.Poll))
+		if err != nil {
+			return models.Posts{}, fmt.Errorf("failed to evaluate post content: %v", err)
+		}
+		post.Status = constants.PostStatusPublished
+		post.IsValidated = validate
+	}
+
+	_, err := p.postsDB.InsertOne(ctx, post)
+	if err != nil {
+		return models.Posts{}, err
+	}
+	if post.Status == constants.PostStatusScheduled {
+		if err := p.enqueuePublish(ctx, post.ID, *post.PublishAt); err != nil {
+			p.postsDB.DeleteOne(ctx, bson.M{"_id": post.ID})
+			return models.Posts{}, err
+		}
+	}
+	return post, nil
+}
+
+func (p *postRepository) enqueuePublish(ctx context.Context, postID primitive.ObjectID, publishAt time.Time) error {
+	payload, err := json.Marshal(models.PublishPostTask{PostID: postID, PublishAt: publishAt})
+	if err != nil {
+		return err
+	}
+	task := asynq.NewTask(constants.TypePublishPost, payload, asynq.MaxRetry(5), asynq.Timeout(time.Minute))
+	_, err = p.redisClient.EnqueueContext(ctx, task, asynq.Queue(constants.PostsQueue), asynq.ProcessAt(publishAt))
+	return err
+}
+
+// GetDrafts returns the drafts and scheduled posts of the user, the last edited first
+func (p *postRepository) GetDrafts(ctx context.Context, userID primitive.ObjectID, page int) ([]models.Posts, error) {
+	findOptions := options.Find().
+		SetSkip(int64((page - 1) * Pagesize)).
+		SetLimit(int64(Pagesize + 1)).
+		SetSort(bson.D{{Key: "updated_at", Value: -1}})
+
+	cursor, err := p.postsDB.Find(ctx, bson.M{"user_id": userID, "status": unpublished}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	posts := []models.Posts{}
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// SchedulePost schedules a draft or moves the time of a scheduled post, the task queued
+// for the old time finds the time changed and does nothing
+func (p *postRepository) SchedulePost(ctx context.Context, userID, postID primitive.ObjectID, publishAt time.Time) (models.Posts, error) {
+	if !publishAt.After(time.Now()) {
+		return models.Posts{}, ErrPublishAtPast
+	}
+	// the task payload goes through json, keep the time it can carry
+	publishAt = publishAt.Truncate(time.Millisecond)
+
+	var post models.Posts
+	err := p.postsDB.FindOneAndUpdate(ctx,
+		bson.M{"_id": postID, "user_id": userID, "status": unpublished},
+		bson.M{"$set": bson.M{
+			"status":     constants.PostStatusScheduled,
+			"publish_at": publishAt,
+			"updated_at": time.Now(),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&post)
+	if err == mongo.ErrNoDocuments {
+		return models.Posts{}, p.notDraftError(ctx, userID, postID)
+	}
+	if err != nil {
+		return models.Posts{}, err
+	}
+
+	if err := p.enqueuePublish(ctx, postID, publishAt); err != nil {
+		return models.Posts{}, err
+	}
+	return post, nil
+}
+
+// CancelSchedule turns a scheduled post back into a draft
+func (p *postRepository) CancelSchedule(ctx context.Context, userID, postID primitive.ObjectID) (models.Posts, error) {
+	var post models.Posts
+	err := p.postsDB.FindOneAndUpdate(ctx,
+		bson.M{"_id": postID, "user_id": userID, "status": constants.PostStatusScheduled},
+		bson.M{
+			"$set":   bson.M{"status": constants.PostStatusDraft, "updated_at": time.Now()},
+			"$unset": bson.M{"publish_at": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&post)
+	if err == mongo.ErrNoDocuments {
+		if err := p.postsDB.FindOne(ctx, bson.M{"_id": postID, "user_id": userID}).Err(); err != nil {
+			return models.Posts{}, err
+		}
+		return models.Posts{}, ErrPostNotScheduled
+	}
+	if err != nil {
+		return models.Posts{}, err
+	}
+	return post, nil
+}
+
+// PublishPost moderates and publishes a draft or scheduled post. The author publishes their
+// own posts with userID, the scheduled task passes the publish time it was queued for
+func (p *postRepository) PublishPost(ctx context.Context, postID primitive.ObjectID, userID *primitive.ObjectID, publishAt *time.Time) (models.Posts, error) {
+	filter := bson.M{"_id": postID, "status": unpublished}
+	if userID != nil {
+		filter["user_id"] = *userID
+	}
+	if publishAt != nil {
+		filter["status"] = constants.PostStatusScheduled
+		filter["publish_at"] = *publishAt
+	}
+
+	var post models.Posts
+	err := p.postsDB.FindOne(ctx, filter).Decode(&post)
+	if err == mongo.ErrNoDocuments {
+		if publishAt != nil {
+			return models.Posts{}, ErrPostNotScheduled
+		}
+		return models.Posts{}, p.notDraftError(ctx, *userID, postID)
+	}
+	if err != nil {
+		return models.Posts{}, err
+	}
+
+	validate, err := p.geminiRepository.EvaluatePost(ctx, post.Content+pollText(post.Poll))
 	if err != nil {
 		return models.Posts{}, fmt.Errorf("failed to evaluate post content: %v", err)
 	}
-	post.IsValidated = validate
-	post.CreatedAt = time.Now()
-	post.UpdatedAt = time.Now()
 
-	_, err = p.postsDB.InsertOne(ctx, post)
+	// published posts are dated when they go out so they show up fresh in the feed
+	now := time.Now()
+	filter["content"] = post.Content
+	res, err := p.postsDB.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{
+			"status":       constants.PostStatusPublished,
+			"is_validated": validate,
+			"created_at":   now,
+			"updated_at":   now,
+		},
+		"$unset": bson.M{"publish_at": ""},
+	})
 	if err != nil {
 		return models.Posts{}, err
 	}
+	if res.MatchedCount == 0 {
+		return models.Posts{}, ErrPostEditConflict
+	}
+
+	post.Status = constants.PostStatusPublished
+	post.IsValidated = validate
+	post.PublishAt = nil
+	post.CreatedAt = now
+	post.UpdatedAt = now
 	return post, nil
 }
 
+// SetTags stores the tags extracted from the content, tags of content that was edited
+// again in the meantime are dropped
+func (p *postRepository) SetTags(ctx context.Context, postID primitive.ObjectID, content string, tags []string) error {
+	_, err := p.postsDB.UpdateOne(ctx,
+		bson.M{"_id": postID, "content": content},
+		bson.M{"$set": bson.M{"tags": tags}},
+	)
+	return err
+}
+
+func (p *postRepository) GetPostsByTag(ctx context.Context, tag string, viewerID primitive.ObjectID, page int) ([]models.Posts, error) {
+	audience, err := p.viewerAudience(ctx, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	filter := published(bson.M{"tags": tag, "is_validated": true, "is_flagged": false, "$and": bson.A{audience}})
+	findOptions := options.Find().
+		SetSkip(int64((page - 1) * Pagesize)).
+		SetLimit(int64(Pagesize + 1)).
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "likes", Value: -1}})
+
+	cursor, err := p.postsDB.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	posts := []models.Posts{}
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// notDraftError tells a post of someone else or a missing one apart from a published one
+func (p *postRepository) notDraftError(ctx context.Context, userID, postID primitive.ObjectID) error {
+	if err := p.postsDB.FindOne(ctx, bson.M{"_id": postID, "user_id": userID}).Err(); err != nil {
+		return err
+	}
+	return ErrPostNotDraft
+}
+
+// UpdatePost keeps the replaced content as a revision and sends the new content to moderation
+// again, an edit the moderation declines hides the post until an admin verifies it
 func (p *postRepository) UpdatePost(ctx context.Context, post models.Posts) (models.Posts, error) {
+	var current models.Posts
+	err := p.postsDB.FindOne(ctx, bson.M{"_id": post.ID, "user_id": post.UserID}).Decode(&current)
+	if err != nil {
+		return models.Posts{}, err
+	}
+	if current.Content == post.Content {
+		return current, nil
+	}
+	if current.IsPlainRepost() {
+		return models.Posts{}, ErrRepostNotEditable
+	}
+	if current.Status == constants.PostStatusDraft || current.Status == constants.PostStatusScheduled {
+		// nobody saw a draft yet, it is moderated when it is published
+		now := time.Now()
+		_, err := p.postsDB.UpdateOne(ctx, bson.M{"_id": current.ID}, bson.M{"$set": bson.M{"content": post.Content, "mentions": post.Mentions, "updated_at": now}})
+		if err != nil {
+			return models.Posts{}, err
+		}
+		current.Content = post.Content
+		current.Mentions = post.Mentions
+		current.UpdatedAt = now
+		return current, nil
+	}
 
-	filter := bson.M{"_id": post.ID, "user_id": post.UserID}
+	validate, err := p.geminiRepository.EvaluatePost(ctx, post.Content+pollText(current.Poll))
+	if err != nil {
+		return models.Posts{}, fmt.Errorf("failed to evaluate post content: %v", err)
+	}
+
+	now := time.Now()
+	// matching the revision count keeps two edits at the same time from losing a revision
+	filter := bson.M{"_id": current.ID, "user_id": current.UserID, "revisions": current.Revisions}
+	if current.Revisions == 0 {
+		filter["revisions"] = bson.M{"$in": bson.A{0, nil}}
+	}
 	postUpdate := bson.M{
 		"$set": bson.M{
-			"content":    post.Content,
-			"updated_at": time.Now(),
+			"content":      post.Content,
+			"mentions":     post.Mentions,
+			"is_validated": validate,
+			"edited_at":    now,
+			"updated_at":   now,
 		},
+		"$inc": bson.M{"revisions": 1},
 	}
 
-	res, err := p.postsDB.UpdateOne(ctx, filter, postUpdate)
+	// the revision is written first, an edit is never saved without the content it replaced.
+	// The unique index on the revision number refuses a second edit racing for the same one
+	revision := models.PostRevisions{
+		ID:              primitive.NewObjectID(),
+		PostID:          current.ID,
+		UserID:          current.UserID,
+		Revision:        current.Revisions + 1,
+		Content:         current.Content,
+		PostAttachments: current.PostAttachments,
+		IsValidated:     current.IsValidated,
+		CreatedAt:       now,
+	}
+	_, err = p.revisionsDB.InsertOne(ctx, revision)
+	if mongo.IsDuplicateKeyError(err) {
+		return models.Posts{}, ErrPostEditConflict
+	}
 	if err != nil {
 		return models.Posts{}, err
 	}
 
-	if res.MatchedCount == 0 {
-		return models.Posts{}, mongo.ErrNoDocuments // No document found to update
+	res, err := p.postsDB.UpdateOne(ctx, filter, postUpdate)
+	if err != nil || res.MatchedCount == 0 {
+		// the post was not changed, the revision would keep content that was never replaced
+		if _, deleteErr := p.revisionsDB.DeleteOne(ctx, bson.M{"_id": revision.ID}); deleteErr != nil {
+			log.Println("Could not remove the revision of a failed edit", revision.ID.Hex(), deleteErr)
+		}
+		if err != nil {
+			return models.Posts{}, err
+		}
+		return models.Posts{}, ErrPostEditConflict
 	}
 
-	return post, nil
+	// a quote the moderation declines stops counting on the post it quotes until it is verified
+	counted := current.CountsAsRepost()
+	current.IsValidated = validate
+	if counted != current.CountsAsRepost() {
+		delta := 1
+		if counted {
+			delta = -1
+		}
+		if err := countReposts(ctx, p.postsDB, *current.RepostOf, delta); err != nil {
+			return models.Posts{}, fmt.Errorf("failed to count the repost: %v", err)
+		}
+	}
+
+	current.Content = post.Content
+	current.Mentions = post.Mentions
+	current.Revisions++
+	current.EditedAt = &now
+	current.UpdatedAt = now
+	return current, nil
+}
+
+// archiveRemovedPost keeps the last content of a removed post next to its revisions, the
+// history of a post is what moderation reads after it is gone
+func archiveRemovedPost(ctx context.Context, revisions *mongo.Collection, post models.Posts) error {
+	now := time.Now()
+	_, err := revisions.InsertOne(ctx, models.PostRevisions{
+		ID:              primitive.NewObjectID(),
+		PostID:          post.ID,
+		UserID:          post.UserID,
+		Revision:        post.Revisions + 1,
+		Content:         post.Content,
+		PostAttachments: post.PostAttachments,
+		IsValidated:     post.IsValidated,
+		CreatedAt:       now,
+		RemovedAt:       &now,
+	})
+	return err
+}
+
+// GetPostRevisions returns the earlier contents of the post, the latest edit first
+func (p *postRepository) GetPostRevisions(ctx context.Context, postID primitive.ObjectID) ([]models.PostRevisions, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "revision", Value: -1}})
+	cursor, err := p.revisionsDB.Find(ctx, bson.M{"post_id": postID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	revisions := []models.PostRevisions{}
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
 }
 
 func (p *postRepository) DeletePost(ctx context.Context, userID string, postID string) error {
@@ -293,16 +958,30 @@ func (p *postRepository) DeletePost(ctx context.Context, userID string, postID s
 	if err != nil {
 		return fmt.Errorf("invalid post ID format: %v", err)
 	}
+	ownerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID format: %v", err)
+	}
 
-	filter := bson.M{"_id": newId, "user_id": userID}
+	filter := bson.M{"_id": newId, "user_id": ownerID}
 
-	res, err := p.postsDB.DeleteOne(ctx, filter)
+	var post models.Posts
+	err = p.postsDB.FindOneAndDelete(ctx, filter).Decode(&post)
 	if err != nil {
-		return err
+		return err // mongo.ErrNoDocuments when there is no post to delete
 	}
 
-	if res.DeletedCount == 0 {
-		return mongo.ErrNoDocuments // No document found to delete
+	if err := archiveRemovedPost(ctx, p.revisionsDB, post); err != nil {
+		return err
+	}
+	if _, err := p.pollVotesDB.DeleteMany(ctx, bson.M{"post_id": newId}); err != nil {
+		return err
+	}
+	if err := deleteBookmarksOf(ctx, p.bookmarksDB, constants.BookmarkTypePost, newId); err != nil {
+		return err
+	}
+	if err := removeReposts(ctx, p.postsDB, p.bookmarksDB, post); err != nil {
+		return err
 	}
 
 	// TODO : Delete The Images from the storage
@@ -310,12 +989,22 @@ func (p *postRepository) DeletePost(ctx context.Context, userID string, postID s
 	return nil // Implement the logic to delete a post
 }
 
-func (p *postRepository) GetPostsByUserID(ctx context.Context, userID string, page int) ([]models.Posts, error) {
+// GetPostsByUserID lists the posts of the user the viewer is in the audience of
+func (p *postRepository) GetPostsByUserID(ctx context.Context, userID string, viewerID primitive.ObjectID, page int) ([]models.Posts, error) {
 	id, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		return nil, fmt.Errorf("invalid user ID format: %v", err)
 	}
-	filter := bson.M{"user_id": id}
+	filter := published(bson.M{"user_id": id})
+	if id != viewerID {
+		audience, err := p.viewerAudience(ctx, viewerID)
+		if err != nil {
+			return nil, err
+		}
+		// others only see the posts the moderation let through
+		filter["is_validated"] = true
+		filter["$and"] = bson.A{audience}
+	}
 
 	// Pagination logic
 	skip := (page - 1) * Pagesize
@@ -345,15 +1034,24 @@ func (p *postRepository) GetPostsByUserID(ctx context.Context, userID string, pa
 	return posts, nil
 }
 
-func (p *postRepository) SearchPosts(ctx context.Context, query string, page int) ([]models.Posts, error) {
+func (p *postRepository) SearchPosts(ctx context.Context, query string, viewerID primitive.ObjectID, page int) ([]models.Posts, error) {
 	skip := (page - 1) * Pagesize
 	limit := Pagesize
 	fmt.Println("This is query", query)
-	filter := bson.M{
+	audience, err := p.viewerAudience(ctx, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	// the viewer finds their own posts, of the others only the ones the moderation let through
+	filter := published(bson.M{
 		"$text": bson.M{
 			"$search": query,
 		},
-	}
+		"$and": bson.A{audience, bson.M{"$or": bson.A{
+			bson.M{"is_validated": true},
+			bson.M{"user_id": viewerID},
+		}}},
+	})
 
 	findOptions := options.Find().
 		SetSkip(int64(skip)).
@@ -384,3 +1082,19 @@ func (p *postRepository) SearchPosts(ctx context.Context, query string, page int
 
 	return posts, nil
 }
+
+// EnsureIndexes numbers the revisions of a post once, two edits can not both replace one
+// content, and finds the posts of a tag without reading every post
+func (p *postRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := p.revisionsDB.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "post_id", Value: 1}, {Key: "revision", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = p.postsDB.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tags", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	return err
+}
@@ -14,11 +14,14 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var ErrReportNotFound = errors.New("report not found")
+
 type ReportRepository interface {
 	ReportPost(ctx context.Context, report models.Report) (models.Report, error)
 	ReportJob(ctx context.Context, report models.Report) (models.Report, error)
-	GetReportedPosts(ctx context.Context, page int) ([]models.Report, error)
-	GetReportedJobs(ctx context.Context, page int) ([]models.Report, error)
+	GetReportedPosts(ctx context.Context, page int, scope models.AccessScope) ([]models.Report, error)
+	GetReportedJobs(ctx context.Context, page int, scope models.AccessScope) ([]models.Report, error)
+	GetReportByID(ctx context.Context, reportID primitive.ObjectID) (models.Report, error)
 
 	GetReportAnalytics(ctx context.Context) (models.ReportAnalytics, error)
 
@@ -30,18 +33,24 @@ type ReportRepository interface {
 }
 
 type reportRepository struct {
-	postCollection   *mongo.Collection
-	jobCollection    *mongo.Collection
-	actionCollection *mongo.Collection
-	reportCollection *mongo.Collection
+	postCollection      *mongo.Collection
+	revisionsCollection *mongo.Collection
+	pollVotesCollection *mongo.Collection
+	jobCollection       *mongo.Collection
+	bookmarkCollection  *mongo.Collection
+	actionCollection    *mongo.Collection
+	reportCollection    *mongo.Collection
 }
 
 func NewReportRepository(db *mongo.Database) ReportRepository {
 	return &reportRepository{
-		postCollection:   db.Collection("posts"),
-		jobCollection:    db.Collection("jobs"),
-		actionCollection: db.Collection("actions"),
-		reportCollection: db.Collection("reports"),
+		postCollection:      db.Collection("posts"),
+		revisionsCollection: db.Collection("post_revisions"),
+		pollVotesCollection: db.Collection("poll_votes"),
+		jobCollection:       db.Collection("jobs"),
+		bookmarkCollection:  db.Collection("bookmarks"),
+		actionCollection:    db.Collection("actions"),
+		reportCollection:    db.Collection("reports"),
 	}
 }
 
@@ -84,11 +93,19 @@ func (r *reportRepository) ReportPost(ctx context.Context, report models.Report)
 	return report, nil
 }
 
-func (r *reportRepository) GetReportedJobs(ctx context.Context, page int) ([]models.Report, error) {
+// GetReportedJobs lists the pending job reports, a scoped moderator only gets the jobs of their departments
+func (r *reportRepository) GetReportedJobs(ctx context.Context, page int, scope models.AccessScope) ([]models.Report, error) {
 	limit := ConnectPageSize
 	skip := (page - 1) * limit
 
 	filter := bson.M{"reviewed": false, "type": constants.ReportTypeJob}
+	if !scope.Global {
+		jobIDs, err := distinctIDs(ctx, r.jobCollection, bson.M{"department_ids": bson.M{"$in": scope.DepartmentIDs}})
+		if err != nil {
+			return nil, err
+		}
+		filter["reported_post_id"] = bson.M{"$in": jobIDs}
+	}
 	options := options.Find()
 	options.SetLimit(int64(limit))
 	options.SetSkip(int64(skip))
@@ -107,12 +124,24 @@ func (r *reportRepository) GetReportedJobs(ctx context.Context, page int) ([]mod
 	return reports, nil
 }
 
-func (r *reportRepository) GetReportedPosts(ctx context.Context, page int) ([]models.Report, error) {
+// GetReportedPosts lists the pending post reports, a scoped moderator only gets the posts of their departments
+func (r *reportRepository) GetReportedPosts(ctx context.Context, page int, scope models.AccessScope) ([]models.Report, error) {
 
 	limit := ConnectPageSize
 	skip := (page - 1) * limit
 
 	filter := bson.M{"reviewed": false, "type": constants.ReportTypePost}
+	if !scope.Global {
+		departmentIDs := make([]string, 0, len(scope.DepartmentIDs))
+		for _, id := range scope.DepartmentIDs {
+			departmentIDs = append(departmentIDs, id.Hex())
+		}
+		postIDs, err := distinctIDs(ctx, r.postCollection, bson.M{"department_id": bson.M{"$in": departmentIDs}})
+		if err != nil {
+			return nil, err
+		}
+		filter["reported_post_id"] = bson.M{"$in": postIDs}
+	}
 	options := options.Find()
 	options.SetLimit(int64(limit))
 	options.SetSkip(int64(skip))
@@ -132,6 +161,18 @@ func (r *reportRepository) GetReportedPosts(ctx context.Context, page int) ([]mo
 
 }
 
+func (r *reportRepository) GetReportByID(ctx context.Context, reportID primitive.ObjectID) (models.Report, error) {
+	var report models.Report
+	err := r.reportCollection.FindOne(ctx, bson.M{"_id": reportID}).Decode(&report)
+	if err == mongo.ErrNoDocuments {
+		return models.Report{}, ErrReportNotFound
+	}
+	if err != nil {
+		return models.Report{}, err
+	}
+	return report, nil
+}
+
 func (r *reportRepository) GetReportAnalytics(ctx context.Context) (models.ReportAnalytics, error) {
 	var analytics models.ReportAnalytics
 	now := time.Now()
@@ -345,15 +386,30 @@ func (r *reportRepository) DeleteActionOnReport(ctx context.Context, reportID pr
 			}
 			return models.ActionTaken{}, errors.New("job not found or already deleted")
 		}
+		if err := deleteBookmarksOf(ctx, r.bookmarkCollection, constants.BookmarkTypeJob, report.ReportedPostID); err != nil {
+			return models.ActionTaken{}, err
+		}
 	case constants.ReportTypePost:
-		eff, err := r.postCollection.DeleteOne(ctx, bson.M{"_id": report.ReportedPostID})
-
-		if err != nil || eff.DeletedCount == 0 {
-			if err != nil {
-				return models.ActionTaken{}, err
-			}
+		var post models.Posts
+		err := r.postCollection.FindOneAndDelete(ctx, bson.M{"_id": report.ReportedPostID}).Decode(&post)
+		if err == mongo.ErrNoDocuments {
 			return models.ActionTaken{}, errors.New("post not found or already deleted")
 		}
+		if err != nil {
+			return models.ActionTaken{}, err
+		}
+		if err := archiveRemovedPost(ctx, r.revisionsCollection, post); err != nil {
+			return models.ActionTaken{}, err
+		}
+		if _, err := r.pollVotesCollection.DeleteMany(ctx, bson.M{"post_id": report.ReportedPostID}); err != nil {
+			return models.ActionTaken{}, err
+		}
+		if err := deleteBookmarksOf(ctx, r.bookmarkCollection, constants.BookmarkTypePost, report.ReportedPostID); err != nil {
+			return models.ActionTaken{}, err
+		}
+		if err := removeReposts(ctx, r.postCollection, r.bookmarkCollection, post); err != nil {
+			return models.ActionTaken{}, err
+		}
 	default:
 		return models.ActionTaken{}, errors.New("invalid report type")
 	}
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrRepostNotFound    = errors.New("the post to repost was not found")
+	ErrAlreadyReposted   = errors.New("you have already reposted this post")
+	ErrNotReposted       = errors.New("you have not reposted this post")
+	ErrRepostNotEditable = errors.New("a repost without content can not be edited")
+)
+
+type RepostRepository interface {
+	Repost(ctx context.Context, repost models.Posts) (models.Posts, models.Posts, error)
+	Unrepost(ctx context.Context, userID, postID primitive.ObjectID) error
+	GetReposted(ctx context.Context, userID primitive.ObjectID, postIDs []primitive.ObjectID) ([]primitive.ObjectID, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type repostRepository struct {
+	posts            *mongo.Collection
+	bookmarks        *mongo.Collection
+	geminiRepository GeminiRepository
+}
+
+func NewRepostRepository(db *mongo.Database, geminiRepo GeminiRepository) RepostRepository {
+	return &repostRepository{
+		posts:            db.Collection("posts"),
+		bookmarks:        db.Collection("bookmarks"),
+		geminiRepository: geminiRepo,
+	}
+}
+
+// Repost shares a published public post, with content it is a quote that goes through
+// moderation like any post. It returns the repost and the post it reposts
+func (r *repostRepository) Repost(ctx context.Context, repost models.Posts) (models.Posts, models.Posts, error) {
+	original, err := r.repostable(ctx, *repost.RepostOf)
+	if err != nil {
+		return models.Posts{}, models.Posts{}, err
+	}
+	// a plain repost only points at its post, reposting it reposts that post
+	if original.IsPlainRepost() {
+		original, err = r.repostable(ctx, *original.RepostOf)
+		if err != nil {
+			return models.Posts{}, models.Posts{}, err
+		}
+	}
+
+	now := time.Now()
+	repost.ID = primitive.NewObjectID()
+	repost.RepostOf = &original.ID
+	repost.Content = strings.TrimSpace(repost.Content)
+	repost.Status = constants.PostStatusPublished
+	repost.Audience = constants.PostAudiencePublic
+	repost.IsValidated = true
+	repost.CreatedAt = now
+	repost.UpdatedAt = now
+	if repost.Content != "" {
+		validate, err := r.geminiRepository.EvaluatePost(ctx, repost.Content)
+		if err != nil {
+			return models.Posts{}, models.Posts{}, fmt.Errorf("failed to evaluate post content: %v", err)
+		}
+		repost.IsValidated = validate
+	}
+
+	_, err = r.posts.InsertOne(ctx, repost)
+	if mongo.IsDuplicateKeyError(err) {
+		return models.Posts{}, models.Posts{}, ErrAlreadyReposted
+	}
+	if err != nil {
+		return models.Posts{}, models.Posts{}, err
+	}
+	if repost.CountsAsRepost() {
+		if err := countReposts(ctx, r.posts, original.ID, 1); err != nil {
+			return models.Posts{}, models.Posts{}, err
+		}
+		original.Reposts++
+	}
+	return repost, original, nil
+}
+
+// repostable finds the post if it can be reposted, a post for a smaller audience would reach
+// people it is not for
+func (r *repostRepository) repostable(ctx context.Context, postID primitive.ObjectID) (models.Posts, error) {
+	var post models.Posts
+	err := r.posts.FindOne(ctx, published(bson.M{
+		"_id":          postID,
+		"is_validated": true,
+		"audience":     bson.M{"$in": bson.A{nil, constants.PostAudiencePublic}},
+	})).Decode(&post)
+	if err == mongo.ErrNoDocuments {
+		return models.Posts{}, ErrRepostNotFound
+	}
+	if err != nil {
+		return models.Posts{}, err
+	}
+	return post, nil
+}
+
+// Unrepost takes back the plain repost of the post, a quote is deleted like any post
+func (r *repostRepository) Unrepost(ctx context.Context, userID, postID primitive.ObjectID) error {
+	var repost models.Posts
+	err := r.posts.FindOneAndDelete(ctx, bson.M{"user_id": userID, "repost_of": postID, "content": ""}).Decode(&repost)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotReposted
+	}
+	if err != nil {
+		return err
+	}
+	return removeReposts(ctx, r.posts, r.bookmarks, repost)
+}
+
+// GetReposted tells which of the posts the user reposted without content
+func (r *repostRepository) GetReposted(ctx context.Context, userID primitive.ObjectID, postIDs []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	cursor, err := r.posts.Find(ctx,
+		bson.M{"user_id": userID, "repost_of": bson.M{"$in": postIDs}, "content": ""},
+		options.Find().SetProjection(bson.M{"repost_of": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var reposts []models.Posts
+	if err := cursor.All(ctx, &reposts); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(reposts))
+	for _, repost := range reposts {
+		ids = append(ids, *repost.RepostOf)
+	}
+	return ids, nil
+}
+
+// EnsureIndexes lets a user repost a post once without content, quoting it is not limited
+func (r *repostRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.posts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "repost_of", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"repost_of": bson.M{"$type": "objectId"}, "content": ""}),
+	})
+	return err
+}
+
+// countReposts moves the repost count of a post, by one for every repost that starts or stops
+// counting on it
+func countReposts(ctx context.Context, posts *mongo.Collection, postID primitive.ObjectID, delta int) error {
+	_, err := posts.UpdateOne(ctx, bson.M{"_id": postID}, bson.M{"$inc": bson.M{"reposts": delta}})
+	return err
+}
+
+// removeReposts keeps the reposts in step with deleted posts, the posts they reposted count
+// one less and plain reposts of them go with them. A quote stays without its original
+func removeReposts(ctx context.Context, posts, bookmarks *mongo.Collection, deleted ...models.Posts) error {
+	ids := make([]primitive.ObjectID, 0, len(deleted))
+	for _, post := range deleted {
+		ids = append(ids, post.ID)
+		if !post.CountsAsRepost() {
+			continue
+		}
+		if err := countReposts(ctx, posts, *post.RepostOf, -1); err != nil {
+			return err
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	plain, err := distinctIDs(ctx, posts, bson.M{"repost_of": bson.M{"$in": ids}, "content": ""})
+	if err != nil || len(plain) == 0 {
+		return err
+	}
+	if err := deleteBookmarksOf(ctx, bookmarks, constants.BookmarkTypePost, plain...); err != nil {
+		return err
+	}
+	_, err = posts.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": plain}})
+	return err
+}
@@ -0,0 +1,342 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrInvalidPermission = errors.New("unknown permission")
+	ErrDefaultRole       = errors.New("default roles can not be deleted")
+)
+
+type RoleRepository interface {
+	SeedDefaultRoles(ctx context.Context) error
+	GetRoles(ctx context.Context) ([]models.Roles, error)
+	GetRoleByName(ctx context.Context, name string) (models.Roles, error)
+	SaveRole(ctx context.Context, role models.Roles) (models.Roles, error)
+	DeleteRole(ctx context.Context, name string) error
+	AssignRole(ctx context.Context, assignment models.RoleAssignments) (models.RoleAssignments, error)
+	RemoveAssignment(ctx context.Context, id primitive.ObjectID) error
+	GetUserAssignments(ctx context.Context, userID primitive.ObjectID) ([]models.RoleAssignments, error)
+	ResolvePermission(ctx context.Context, userID, role string, permission constants.Permission) (models.AccessScope, bool, error)
+}
+
+type roleRepository struct {
+	roles       *mongo.Collection
+	assignments *mongo.Collection
+	schools     *mongo.Collection
+	departments *mongo.Collection
+}
+
+func NewRoleRepository(db *mongo.Database) RoleRepository {
+	return &roleRepository{
+		roles:       db.Collection("roles"),
+		assignments: db.Collection("role_assignments"),
+		schools:     db.Collection("schools"),
+		departments: db.Collection("departments"),
+	}
+}
+
+// SeedDefaultRoles inserts the default roles which are missing and grants the default roles the
+// permissions introduced since the last start; permissions removed by admins are not granted again
+func (r *roleRepository) SeedDefaultRoles(ctx context.Context) error {
+	now := time.Now()
+	allPermissions := permissionStrings(constants.AllPermissions)
+
+	for name, permissions := range constants.DefaultRolePermissions {
+		var role models.Roles
+		err := r.roles.FindOne(ctx, bson.M{"name": string(name)}).Decode(&role)
+		if err == mongo.ErrNoDocuments {
+			_, err = r.roles.InsertOne(ctx, models.Roles{
+				ID:               primitive.NewObjectID(),
+				Name:             string(name),
+				Permissions:      permissionStrings(permissions),
+				KnownPermissions: allPermissions,
+				CreatedAt:        now,
+				UpdatedAt:        now,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		known := make(map[string]bool, len(role.KnownPermissions))
+		for _, permission := range role.KnownPermissions {
+			known[permission] = true
+		}
+		added := []string{}
+		for _, permission := range permissionStrings(permissions) {
+			if !known[permission] {
+				added = append(added, permission)
+			}
+		}
+
+		_, err = r.roles.UpdateOne(ctx,
+			bson.M{"_id": role.ID},
+			bson.M{
+				"$addToSet": bson.M{"permissions": bson.M{"$each": added}},
+				"$set":      bson.M{"known_permissions": allPermissions, "updated_at": now},
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *roleRepository) GetRoles(ctx context.Context) ([]models.Roles, error) {
+	cursor, err := r.roles.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var roles []models.Roles
+	for cursor.Next(ctx) {
+		var role models.Roles
+		if err := cursor.Decode(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *roleRepository) GetRoleByName(ctx context.Context, name string) (models.Roles, error) {
+	var role models.Roles
+	err := r.roles.FindOne(ctx, bson.M{"name": name}).Decode(&role)
+	if err == mongo.ErrNoDocuments {
+		return models.Roles{}, ErrRoleNotFound
+	}
+	if err != nil {
+		return models.Roles{}, err
+	}
+	return role, nil
+}
+
+// SaveRole creates the role or replaces the permission set of an existing one with the same name
+func (r *roleRepository) SaveRole(ctx context.Context, role models.Roles) (models.Roles, error) {
+	for _, permission := range role.Permissions {
+		if !constants.IsValidPermission(constants.Permission(permission)) {
+			return models.Roles{}, ErrInvalidPermission
+		}
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+
+	now := time.Now()
+	var saved models.Roles
+	err := r.roles.FindOneAndUpdate(ctx,
+		bson.M{"name": role.Name},
+		bson.M{
+			"$set": bson.M{
+				"description": role.Description,
+				"permissions": role.Permissions,
+				"updated_at":  now,
+			},
+			"$setOnInsert": bson.M{"created_at": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&saved)
+	if err != nil {
+		return models.Roles{}, err
+	}
+	return saved, nil
+}
+
+func (r *roleRepository) DeleteRole(ctx context.Context, name string) error {
+	if _, ok := constants.DefaultRolePermissions[constants.UserRole(name)]; ok {
+		return ErrDefaultRole
+	}
+	res, err := r.roles.DeleteOne(ctx, bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrRoleNotFound
+	}
+	_, err = r.assignments.DeleteMany(ctx, bson.M{"role": name})
+	return err
+}
+
+func (r *roleRepository) AssignRole(ctx context.Context, assignment models.RoleAssignments) (models.RoleAssignments, error) {
+	count, err := r.roles.CountDocuments(ctx, bson.M{"name": assignment.Role})
+	if err != nil {
+		return models.RoleAssignments{}, err
+	}
+	if count == 0 {
+		return models.RoleAssignments{}, ErrRoleNotFound
+	}
+
+	assignment.ID = primitive.NewObjectID()
+	assignment.CreatedAt = time.Now()
+	if _, err := r.assignments.InsertOne(ctx, assignment); err != nil {
+		return models.RoleAssignments{}, err
+	}
+	return assignment, nil
+}
+
+func (r *roleRepository) RemoveAssignment(ctx context.Context, id primitive.ObjectID) error {
+	res, err := r.assignments.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *roleRepository) GetUserAssignments(ctx context.Context, userID primitive.ObjectID) ([]models.RoleAssignments, error) {
+	cursor, err := r.assignments.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var assignments []models.RoleAssignments
+	for cursor.Next(ctx) {
+		var assignment models.RoleAssignments
+		if err := cursor.Decode(&assignment); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, assignment)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+// ResolvePermission looks at the global role of the user first and then at the role assignments,
+// the returned scope is global as soon as one unscoped grant holds the permission
+func (r *roleRepository) ResolvePermission(ctx context.Context, userID, role string, permission constants.Permission) (models.AccessScope, bool, error) {
+	count, err := r.roles.CountDocuments(ctx, bson.M{"name": role, "permissions": string(permission)})
+	if err != nil {
+		return models.AccessScope{}, false, err
+	}
+	if count > 0 {
+		return models.AccessScope{Global: true}, true, nil
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return models.AccessScope{}, false, nil
+	}
+	assignments, err := r.GetUserAssignments(ctx, userObjID)
+	if err != nil {
+		return models.AccessScope{}, false, err
+	}
+	if len(assignments) == 0 {
+		return models.AccessScope{}, false, nil
+	}
+
+	roleNames := make([]string, 0, len(assignments))
+	for _, assignment := range assignments {
+		roleNames = append(roleNames, assignment.Role)
+	}
+	granting, err := r.rolesWithPermission(ctx, roleNames, permission)
+	if err != nil {
+		return models.AccessScope{}, false, err
+	}
+
+	var universityIDs, schoolIDs []primitive.ObjectID
+	departmentIDs := []primitive.ObjectID{} // filters take it as an $in list
+	for _, assignment := range assignments {
+		if !granting[assignment.Role] {
+			continue
+		}
+		switch {
+		case assignment.IsGlobal():
+			return models.AccessScope{Global: true}, true, nil
+		case assignment.DepartmentID != nil:
+			departmentIDs = append(departmentIDs, *assignment.DepartmentID)
+		case assignment.SchoolID != nil:
+			schoolIDs = append(schoolIDs, *assignment.SchoolID)
+		case assignment.UniversityID != nil:
+			universityIDs = append(universityIDs, *assignment.UniversityID)
+		}
+	}
+
+	if len(universityIDs) > 0 {
+		ids, err := distinctIDs(ctx, r.schools, bson.M{"university_id": bson.M{"$in": universityIDs}})
+		if err != nil {
+			return models.AccessScope{}, false, err
+		}
+		schoolIDs = append(schoolIDs, ids...)
+	}
+	if len(schoolIDs) > 0 {
+		ids, err := distinctIDs(ctx, r.departments, bson.M{"school_id": bson.M{"$in": schoolIDs}})
+		if err != nil {
+			return models.AccessScope{}, false, err
+		}
+		departmentIDs = append(departmentIDs, ids...)
+	}
+
+	if len(universityIDs) == 0 && len(schoolIDs) == 0 && len(departmentIDs) == 0 {
+		return models.AccessScope{}, false, nil
+	}
+	return models.AccessScope{UniversityIDs: universityIDs, SchoolIDs: schoolIDs, DepartmentIDs: departmentIDs}, true, nil
+}
+
+func (r *roleRepository) rolesWithPermission(ctx context.Context, names []string, permission constants.Permission) (map[string]bool, error) {
+	cursor, err := r.roles.Find(ctx, bson.M{
+		"name":        bson.M{"$in": names},
+		"permissions": string(permission),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	granting := make(map[string]bool)
+	for cursor.Next(ctx) {
+		var role models.Roles
+		if err := cursor.Decode(&role); err != nil {
+			return nil, err
+		}
+		granting[role.Name] = true
+	}
+	return granting, cursor.Err()
+}
+
+func distinctIDs(ctx context.Context, collection *mongo.Collection, filter bson.M) ([]primitive.ObjectID, error) {
+	values, err := collection.Distinct(ctx, "_id", filter)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func permissionStrings(permissions []constants.Permission) []string {
+	result := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		result = append(result, string(permission))
+	}
+	return result
+}
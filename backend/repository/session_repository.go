@@ -0,0 +1,363 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/hashing"
+	"github.com/chera-mihiretu/IKnow/infrastructure/middleware"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	RefreshTokenTTL  = 30 * 24 * time.Hour
+	refreshTokenSize = 32
+	// LastSeenInterval is how often the requests of a session move its last_seen_at forward
+	LastSeenInterval = time.Minute
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+)
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, user models.User, device models.SessionDevice) (models.AuthTokens, error)
+	RefreshSession(ctx context.Context, refreshToken string, device models.SessionDevice) (models.AuthTokens, error)
+	RevokeSession(ctx context.Context, sessionID primitive.ObjectID) error
+	RevokeUserSession(ctx context.Context, userID, sessionID primitive.ObjectID) error
+	RevokeAllSessions(ctx context.Context, userID, exceptSessionID primitive.ObjectID) (int64, error)
+	GetUserSessions(ctx context.Context, userID primitive.ObjectID) ([]models.Sessions, error)
+	IsSessionActive(ctx context.Context, sessionID string) (bool, error)
+	CreateImpersonationSession(ctx context.Context, user models.User, impersonatorID primitive.ObjectID, reason string, allowWrites bool, ttl time.Duration, device models.SessionDevice) (models.ImpersonationSession, error)
+	GetActiveImpersonations(ctx context.Context) ([]models.Sessions, error)
+	EndImpersonation(ctx context.Context, sessionID primitive.ObjectID) (models.Sessions, error)
+}
+
+type sessionRepository struct {
+	sessions *mongo.Collection
+	users    *mongo.Collection
+}
+
+func NewSessionRepository(db *mongo.Database) SessionRepository {
+	return &sessionRepository{
+		sessions: db.Collection("sessions"),
+		users:    db.Collection("users"),
+	}
+}
+
+func (r *sessionRepository) CreateSession(ctx context.Context, user models.User, device models.SessionDevice) (models.AuthTokens, error) {
+	refreshToken, err := hashing.GenerateToken(refreshTokenSize)
+	if err != nil {
+		return models.AuthTokens{}, errors.New("could not generate refresh token")
+	}
+
+	now := time.Now()
+	session := models.Sessions{
+		ID:                primitive.NewObjectID(),
+		UserID:            user.ID,
+		RefreshToken:      hashing.HashToken(refreshToken),
+		UsedRefreshTokens: []string{},
+		Device:            device.Device,
+		UserAgent:         device.UserAgent,
+		IPAddress:         device.IPAddress,
+		LastSeenAt:        now,
+		Revoked:           false,
+		ExpiresAt:         now.Add(RefreshTokenTTL),
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+
+	if _, err := r.sessions.InsertOne(ctx, session); err != nil {
+		return models.AuthTokens{}, errors.New("could not create session")
+	}
+
+	accessToken, err := middleware.GenerateJWT(user.ID.Hex(), user.Role, session.ID.Hex())
+	if err != nil {
+		return models.AuthTokens{}, errors.New("could not generate JWT token")
+	}
+
+	return models.AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    now.Add(middleware.AccessTokenTTL),
+	}, nil
+}
+
+// RefreshSession rotates the refresh token of a session, if an already rotated token
+// is presented the whole session is revoked since the token must have been stolen
+func (r *sessionRepository) RefreshSession(ctx context.Context, refreshToken string, device models.SessionDevice) (models.AuthTokens, error) {
+	hashed := hashing.HashToken(refreshToken)
+
+	var session models.Sessions
+	err := r.sessions.FindOne(ctx, bson.M{"refresh_token": hashed}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		var reused models.Sessions
+		err = r.sessions.FindOne(ctx, bson.M{"used_refresh_tokens": hashed}).Decode(&reused)
+		if err == mongo.ErrNoDocuments {
+			return models.AuthTokens{}, ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return models.AuthTokens{}, err
+		}
+		log.Println("Refresh token reuse detected for session:", reused.ID.Hex())
+		if err := r.RevokeSession(ctx, reused.ID); err != nil {
+			return models.AuthTokens{}, err
+		}
+		return models.AuthTokens{}, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return models.AuthTokens{}, err
+	}
+
+	if session.Revoked || session.ExpiresAt.Before(time.Now()) || session.ImpersonatorID != nil {
+		return models.AuthTokens{}, ErrInvalidRefreshToken
+	}
+
+	var user models.User
+	if err := r.users.FindOne(ctx, bson.M{"_id": session.UserID}).Decode(&user); err != nil {
+		return models.AuthTokens{}, errors.New("user not found")
+	}
+
+	newRefreshToken, err := hashing.GenerateToken(refreshTokenSize)
+	if err != nil {
+		return models.AuthTokens{}, errors.New("could not generate refresh token")
+	}
+
+	now := time.Now()
+	// the filter on the current token makes the rotation atomic, two concurrent
+	// refreshes with the same token can not both succeed
+	res, err := r.sessions.UpdateOne(ctx,
+		bson.M{"_id": session.ID, "refresh_token": hashed, "revoked": false},
+		bson.M{
+			"$set": bson.M{
+				"refresh_token": hashing.HashToken(newRefreshToken),
+				"device":        device.Device,
+				"user_agent":    device.UserAgent,
+				"ip_address":    device.IPAddress,
+				"last_seen_at":  now,
+				"expires_at":    now.Add(RefreshTokenTTL),
+				"updated_at":    now,
+			},
+			"$push": bson.M{"used_refresh_tokens": hashed},
+		},
+	)
+	if err != nil {
+		return models.AuthTokens{}, err
+	}
+	if res.MatchedCount == 0 {
+		return models.AuthTokens{}, ErrInvalidRefreshToken
+	}
+
+	accessToken, err := middleware.GenerateJWT(user.ID.Hex(), user.Role, session.ID.Hex())
+	if err != nil {
+		return models.AuthTokens{}, errors.New("could not generate JWT token")
+	}
+
+	return models.AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		ExpiresAt:    now.Add(middleware.AccessTokenTTL),
+	}, nil
+}
+
+func (r *sessionRepository) RevokeSession(ctx context.Context, sessionID primitive.ObjectID) error {
+	now := time.Now()
+	_, err := r.sessions.UpdateOne(ctx,
+		bson.M{"_id": sessionID},
+		bson.M{"$set": bson.M{"revoked": true, "revoked_at": now, "updated_at": now}},
+	)
+	return err
+}
+
+func (r *sessionRepository) RevokeUserSession(ctx context.Context, userID, sessionID primitive.ObjectID) error {
+	now := time.Now()
+	res, err := r.sessions.UpdateOne(ctx,
+		bson.M{"_id": sessionID, "user_id": userID, "revoked": false},
+		bson.M{"$set": bson.M{"revoked": true, "revoked_at": now, "updated_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// RevokeAllSessions revokes every session of the user, pass primitive.NilObjectID
+// as exceptSessionID to include the current session as well
+func (r *sessionRepository) RevokeAllSessions(ctx context.Context, userID, exceptSessionID primitive.ObjectID) (int64, error) {
+	now := time.Now()
+	filter := bson.M{"user_id": userID, "revoked": false}
+	if exceptSessionID != primitive.NilObjectID {
+		filter["_id"] = bson.M{"$ne": exceptSessionID}
+	}
+	res, err := r.sessions.UpdateMany(ctx, filter,
+		bson.M{"$set": bson.M{"revoked": true, "revoked_at": now, "updated_at": now}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+func (r *sessionRepository) GetUserSessions(ctx context.Context, userID primitive.ObjectID) ([]models.Sessions, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"revoked":    false,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+
+	cursor, err := r.sessions.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []models.Sessions
+	for cursor.Next(ctx) {
+		var session models.Sessions
+		if err := cursor.Decode(&session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// IsSessionActive runs on every request, it also keeps last_seen_at of the session at the
+// latest request, written at most once per LastSeenInterval
+func (r *sessionRepository) IsSessionActive(ctx context.Context, sessionID string) (bool, error) {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return false, nil
+	}
+	now := time.Now()
+	var session models.Sessions
+	err = r.sessions.FindOne(ctx, bson.M{
+		"_id":        id,
+		"revoked":    false,
+		"expires_at": bson.M{"$gt": now},
+	}, options.FindOne().SetProjection(bson.M{"last_seen_at": 1})).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if now.Sub(session.LastSeenAt) >= LastSeenInterval {
+		_, err := r.sessions.UpdateOne(ctx,
+			bson.M{"_id": id, "last_seen_at": bson.M{"$lt": now.Add(-LastSeenInterval)}},
+			bson.M{"$set": bson.M{"last_seen_at": now}},
+		)
+		if err != nil {
+			// the request is let through, only the activity shown in the session list is late
+			log.Println("Could not update the last activity of the session:", err)
+		}
+	}
+	return true, nil
+}
+
+var ErrImpersonationNotFound = errors.New("impersonation session not found or already ended")
+
+// CreateImpersonationSession opens a session for an admin to act as the user, it ends at
+// ttl and its refresh token is thrown away so it can not be extended
+func (r *sessionRepository) CreateImpersonationSession(ctx context.Context, user models.User, impersonatorID primitive.ObjectID, reason string, allowWrites bool, ttl time.Duration, device models.SessionDevice) (models.ImpersonationSession, error) {
+	refreshToken, err := hashing.GenerateToken(refreshTokenSize)
+	if err != nil {
+		return models.ImpersonationSession{}, errors.New("could not generate refresh token")
+	}
+
+	now := time.Now()
+	session := models.Sessions{
+		ID:                  primitive.NewObjectID(),
+		UserID:              user.ID,
+		RefreshToken:        hashing.HashToken(refreshToken),
+		UsedRefreshTokens:   []string{},
+		Device:              device.Device,
+		UserAgent:           device.UserAgent,
+		IPAddress:           device.IPAddress,
+		LastSeenAt:          now,
+		Revoked:             false,
+		ExpiresAt:           now.Add(ttl),
+		CreatedAt:           now,
+		UpdatedAt:           now,
+		ImpersonatorID:      &impersonatorID,
+		ImpersonationReason: reason,
+		AllowWrites:         allowWrites,
+	}
+
+	if _, err := r.sessions.InsertOne(ctx, session); err != nil {
+		return models.ImpersonationSession{}, errors.New("could not create session")
+	}
+
+	accessToken, err := middleware.GenerateImpersonationJWT(user.ID.Hex(), user.Role, session.ID.Hex(), impersonatorID.Hex(), allowWrites, session.ExpiresAt)
+	if err != nil {
+		return models.ImpersonationSession{}, errors.New("could not generate JWT token")
+	}
+
+	return models.ImpersonationSession{
+		SessionID:      session.ID,
+		UserID:         user.ID,
+		ImpersonatorID: impersonatorID,
+		Reason:         reason,
+		AllowWrites:    allowWrites,
+		AccessToken:    accessToken,
+		ExpiresAt:      session.ExpiresAt,
+		CreatedAt:      now,
+	}, nil
+}
+
+func (r *sessionRepository) GetActiveImpersonations(ctx context.Context) ([]models.Sessions, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := r.sessions.Find(ctx, bson.M{
+		"impersonator_id": bson.M{"$exists": true},
+		"revoked":         false,
+		"expires_at":      bson.M{"$gt": time.Now()},
+	}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []models.Sessions{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// EndImpersonation revokes an active impersonation session and returns it
+func (r *sessionRepository) EndImpersonation(ctx context.Context, sessionID primitive.ObjectID) (models.Sessions, error) {
+	now := time.Now()
+	var session models.Sessions
+	err := r.sessions.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":             sessionID,
+			"impersonator_id": bson.M{"$exists": true},
+			"revoked":         false,
+			"expires_at":      bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"revoked": true, "revoked_at": now, "updated_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return models.Sessions{}, ErrImpersonationNotFound
+	}
+	if err != nil {
+		return models.Sessions{}, err
+	}
+	return session, nil
+}
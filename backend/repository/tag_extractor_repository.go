@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	MaxPostTags   = 10
+	MaxPostTagLen = 40
+)
+
+// TagExtractorRepository suggests the tags of a post from its content
+type TagExtractorRepository interface {
+	ExtractTags(ctx context.Context, content string) ([]string, error)
+}
+
+type tagExtractorRepository struct {
+	baseURL    string
+	httpClient *http.Client
+	fallback   TagExtractorRepository
+}
+
+// NewTagExtractorRepository calls the /extract-tags endpoint of the text_extractor service,
+// the fallback tags the post when the service is not configured or does not answer
+func NewTagExtractorRepository(baseURL string, httpClient *http.Client, fallback TagExtractorRepository) TagExtractorRepository {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 20 * time.Second}
+	}
+	return &tagExtractorRepository{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+		fallback:   fallback,
+	}
+}
+
+func (r *tagExtractorRepository) ExtractTags(ctx context.Context, content string) ([]string, error) {
+	if r.baseURL == "" {
+		return r.fallbackTags(ctx, content, nil)
+	}
+
+	// the service reads a blog post, the first line of a post stands in for the title
+	title, body := content, ""
+	if i := strings.IndexByte(content, '\n'); i >= 0 {
+		title, body = content[:i], content[i+1:]
+	}
+	payload, err := json.Marshal(map[string]string{"title": title, "body": body})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.baseURL+"/extract-tags", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return r.fallbackTags(ctx, content, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return r.fallbackTags(ctx, content, fmt.Errorf("tag extractor answered %d", res.StatusCode))
+	}
+
+	var result struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return r.fallbackTags(ctx, content, err)
+	}
+	return NormalizeTags(result.Tags), nil
+}
+
+func (r *tagExtractorRepository) fallbackTags(ctx context.Context, content string, cause error) ([]string, error) {
+	if r.fallback == nil {
+		if cause == nil {
+			cause = fmt.Errorf("no tag extractor configured")
+		}
+		return nil, cause
+	}
+	return r.fallback.ExtractTags(ctx, content)
+}
+
+type localTagExtractor struct{}
+
+// NewLocalTagExtractor tags a post with its most frequent words, the same content always
+// gets the same tags
+func NewLocalTagExtractor() TagExtractorRepository {
+	return localTagExtractor{}
+}
+
+var tagStopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "but": true, "not": true, "you": true,
+	"all": true, "any": true, "can": true, "her": true, "was": true, "one": true, "our": true,
+	"out": true, "has": true, "have": true, "had": true, "his": true, "how": true, "its": true,
+	"who": true, "will": true, "with": true, "this": true, "that": true, "these": true,
+	"those": true, "from": true, "they": true, "them": true, "their": true, "there": true,
+	"what": true, "when": true, "where": true, "which": true, "while": true, "would": true,
+	"could": true, "should": true, "about": true, "into": true, "just": true, "your": true,
+	"been": true, "were": true, "some": true, "more": true, "also": true, "than": true,
+	"then": true, "very": true, "does": true, "here": true, "only": true, "over": true,
+	"such": true, "like": true, "want": true, "need": true, "know": true, "anyone": true,
+	"please": true, "thanks": true, "today": true, "tomorrow": true, "used": true, "using": true,
+	"make": true, "made": true, "good": true, "great": true, "thing": true, "things": true,
+}
+
+func (localTagExtractor) ExtractTags(ctx context.Context, content string) ([]string, error) {
+	words := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '#'
+	})
+
+	counts := map[string]int{}
+	first := map[string]int{}
+	for i, word := range words {
+		word = strings.TrimLeft(word, "#")
+		if len([]rune(word)) < 3 || tagStopwords[word] || isNumber(word) {
+			continue
+		}
+		if _, ok := first[word]; !ok {
+			first[word] = i
+		}
+		counts[word]++
+	}
+
+	tags := make([]string, 0, len(counts))
+	for word := range counts {
+		tags = append(tags, word)
+	}
+	// most used first, the earlier word wins a tie
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] != counts[tags[j]] {
+			return counts[tags[i]] > counts[tags[j]]
+		}
+		return first[tags[i]] < first[tags[j]]
+	})
+	if len(tags) > 5 {
+		tags = tags[:5]
+	}
+	return NormalizeTags(tags), nil
+}
+
+func isNumber(word string) bool {
+	for _, r := range word {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeTags lower cases the tags, drops the empty, long and repeated ones and keeps at
+// most MaxPostTags of them
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(strings.ToLower(strings.TrimLeft(strings.TrimSpace(tag), "#"))), " ")
+		if tag == "" || len(tag) > MaxPostTagLen || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+		if len(normalized) == MaxPostTags {
+			break
+		}
+	}
+	return normalized
+}
@@ -2,12 +2,20 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/validation"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrEmailDomainNotAllowed = errors.New("registration is only open to addresses of a registered university email domain")
+	ErrEmailDomainTaken      = errors.New("email domain already belongs to another university")
 )
 
 type UniversityRepository interface {
@@ -17,6 +25,9 @@ type UniversityRepository interface {
 	UpdateUniversity(ctx context.Context, university models.University) (models.University, error)
 	DeleteUniversity(ctx context.Context, id, userID primitive.ObjectID) error
 	VerifyExistence(ctx context.Context, university primitive.ObjectID) (bool, error)
+	GetUniversityByEmail(ctx context.Context, email string) (models.University, error)
+	AddEmailDomain(ctx context.Context, id primitive.ObjectID, domain string) (models.University, error)
+	RemoveEmailDomain(ctx context.Context, id primitive.ObjectID, domain string) (models.University, error)
 }
 
 type universityRepository struct {
@@ -63,6 +74,15 @@ func (r *universityRepository) GetUniversityByID(ctx context.Context, id primiti
 
 func (r *universityRepository) CreateUniversity(ctx context.Context, university models.University) (models.University, error) {
 	university.ID = primitive.NewObjectID()
+	domains := make([]string, 0, len(university.EmailDomains))
+	for _, domain := range university.EmailDomains {
+		domain, err := r.checkEmailDomain(ctx, university.ID, domain)
+		if err != nil {
+			return models.University{}, err
+		}
+		domains = append(domains, domain)
+	}
+	university.EmailDomains = domains
 	university.CreatedAt = time.Now()
 	university.UpdatedAt = time.Now()
 	_, err := r.database.InsertOne(ctx, university)
@@ -106,3 +126,90 @@ func (r *universityRepository) VerifyExistence(ctx context.Context, university p
 	}
 	return count > 0, nil
 }
+
+// GetUniversityByEmail finds the university owning the domain of the address, the most
+// specific registered domain wins; ErrEmailDomainNotAllowed is returned when none matches
+func (r *universityRepository) GetUniversityByEmail(ctx context.Context, email string) (models.University, error) {
+	domain := validation.EmailDomain(email)
+	if domain == "" {
+		return models.University{}, ErrEmailDomainNotAllowed
+	}
+
+	candidates := validation.ParentDomains(domain)
+	cursor, err := r.database.Find(ctx, bson.M{"email_domains": bson.M{"$in": candidates}})
+	if err != nil {
+		return models.University{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var match models.University
+	bestLength := 0
+	for cursor.Next(ctx) {
+		var university models.University
+		if err := cursor.Decode(&university); err != nil {
+			return models.University{}, err
+		}
+		for _, registered := range university.EmailDomains {
+			for _, candidate := range candidates {
+				if registered == candidate && len(candidate) > bestLength {
+					match = university
+					bestLength = len(candidate)
+				}
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return models.University{}, err
+	}
+	if bestLength == 0 {
+		return models.University{}, ErrEmailDomainNotAllowed
+	}
+	return match, nil
+}
+
+func (r *universityRepository) AddEmailDomain(ctx context.Context, id primitive.ObjectID, domain string) (models.University, error) {
+	domain, err := r.checkEmailDomain(ctx, id, domain)
+	if err != nil {
+		return models.University{}, err
+	}
+	return r.updateEmailDomains(ctx, id, bson.M{"$addToSet": bson.M{"email_domains": domain}})
+}
+
+func (r *universityRepository) RemoveEmailDomain(ctx context.Context, id primitive.ObjectID, domain string) (models.University, error) {
+	domain, err := validation.NormalizeEmailDomain(domain)
+	if err != nil {
+		return models.University{}, err
+	}
+	return r.updateEmailDomains(ctx, id, bson.M{"$pull": bson.M{"email_domains": domain}})
+}
+
+func (r *universityRepository) updateEmailDomains(ctx context.Context, id primitive.ObjectID, update bson.M) (models.University, error) {
+	update["$set"] = bson.M{"updated_at": time.Now()}
+
+	var university models.University
+	err := r.database.FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&university)
+	if err != nil {
+		return models.University{}, err
+	}
+	return university, nil
+}
+
+// checkEmailDomain normalizes the domain and makes sure no other university registered it
+func (r *universityRepository) checkEmailDomain(ctx context.Context, id primitive.ObjectID, domain string) (string, error) {
+	domain, err := validation.NormalizeEmailDomain(domain)
+	if err != nil {
+		return "", err
+	}
+	count, err := r.database.CountDocuments(ctx, bson.M{"_id": bson.M{"$ne": id}, "email_domains": domain})
+	if err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "", ErrEmailDomainTaken
+	}
+	return domain, nil
+}
@@ -12,14 +12,23 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrUniversityReadOnly    = errors.New("the university comes from your email domain and can not be changed")
+	ErrSchoolNotInUniversity = errors.New("the school is not part of your university")
+	ErrDepartmentNotInSchool = errors.New("the department is not part of the school")
 )
 
 type UserRepository interface {
 	// GetUserById retrieves a user by their ID.
 	GetUserByIdNoneView(ctx context.Context, userID string) (models.User, error)
 	GetUserById(ctx context.Context, userID string) (models.UserView, error)
+	GetMe(ctx context.Context, userID string) (models.MeView, error)
 	GetUserByEmail(ctx context.Context, email string) (models.UserView, error)
 	GetListOfUsers(ctx context.Context, ids []primitive.ObjectID) ([]models.UserView, error)
+	GetUsersByHandles(ctx context.Context, handles []string) ([]models.UserView, error)
 	CompleteUser(ctx context.Context, user models.User) (models.UserView, error)
 	UserAnalytics(ctx context.Context) (models.UserAnalytics, error)
 	GetAllUsers(ctx context.Context) ([]models.UserView, error)
@@ -59,14 +68,24 @@ func (c *userRepository) UpdateMe(ctx context.Context, user models.User) (models
 		update["profile_image_url"] = user.ProfileImageURL
 	}
 	log.Println("we are here")
+	// the university was derived from the email domain at registration, it can be sent
+	// back but not changed; only accounts that never got one can still pick it
+	university := beforeUser.UniversityID
 	if user.UniversityID != nil && *user.UniversityID != primitive.NilObjectID {
-		count, err := c.universityCollection.CountDocuments(ctx, bson.M{"_id": *user.UniversityID})
-		if err != nil {
-			return models.UserView{}, fmt.Errorf("university with ID %s does not exist", user.UniversityID.Hex())
-		}
-		if count == 0 {
-			return models.UserView{}, fmt.Errorf("university with ID %s does not exist", user.UniversityID.Hex())
+		if university != nil && *university != primitive.NilObjectID {
+			if *user.UniversityID != *university {
+				return models.UserView{}, ErrUniversityReadOnly
+			}
+		} else {
+			count, err := c.universityCollection.CountDocuments(ctx, bson.M{"_id": *user.UniversityID})
+			if err != nil {
+				return models.UserView{}, fmt.Errorf("university with ID %s does not exist", user.UniversityID.Hex())
+			}
+			if count == 0 {
+				return models.UserView{}, fmt.Errorf("university with ID %s does not exist", user.UniversityID.Hex())
+			}
 		}
+		university = user.UniversityID
 		update["university_id"] = *user.UniversityID
 		update["school_id"] = nil
 		update["department_id"] = nil
@@ -75,24 +94,12 @@ func (c *userRepository) UpdateMe(ctx context.Context, user models.User) (models
 	log.Println("We are here at school")
 	if user.SchoolID != nil && *user.SchoolID != primitive.NilObjectID {
 		if _, hasUniversity := update["university_id"]; hasUniversity {
-			count, err := c.schoolCollection.CountDocuments(ctx, bson.M{"_id": *user.SchoolID})
-			if err != nil {
-				return models.UserView{}, fmt.Errorf("school with ID %s does not exist", user.SchoolID.Hex())
-			}
-			if count != 0 {
-				update["school_id"] = *user.SchoolID
-				update["department_id"] = nil
+			if err := c.checkPlacement(ctx, *university, *user.SchoolID, user.DepartmentID); err != nil {
+				return models.UserView{}, err
 			}
-		}
-	}
-	log.Println("We are here at department")
-	if user.DepartmentID != nil && *user.DepartmentID != primitive.NilObjectID {
-		if _, hasSchool := update["school_id"]; hasSchool {
-			count, err := c.departmentCollection.CountDocuments(ctx, bson.M{"_id": *user.DepartmentID})
-			if err != nil {
-				return models.UserView{}, fmt.Errorf("department with ID %s does not exist", user.DepartmentID.Hex())
-			}
-			if count != 0 {
+			update["school_id"] = *user.SchoolID
+			update["department_id"] = nil
+			if user.DepartmentID != nil && *user.DepartmentID != primitive.NilObjectID {
 				update["department_id"] = *user.DepartmentID
 			}
 		}
@@ -101,6 +108,9 @@ func (c *userRepository) UpdateMe(ctx context.Context, user models.User) (models
 	if user.AcedemicYear != 0 {
 		update["acedemic_year"] = user.AcedemicYear
 	}
+	if user.MentionsFrom != "" {
+		update["mentions_from"] = user.MentionsFrom
+	}
 
 	var res *mongo.UpdateResult
 	if len(update) > 0 {
@@ -136,9 +146,23 @@ func (c *userRepository) GetUserById(ctx context.Context, userID string) (models
 	return user, nil
 }
 
+// GetMe returns the profile of the user for the user themselves
+func (c *userRepository) GetMe(ctx context.Context, userID string) (models.MeView, error) {
+	var me models.MeView
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return models.MeView{}, errors.New("invalid user ID format")
+	}
+	err = c.users.FindOne(ctx, bson.M{"_id": id}).Decode(&me)
+	if err != nil {
+		return models.MeView{}, err
+	}
+	return me, nil
+}
+
 func (c *userRepository) GetUserByEmail(ctx context.Context, email string) (models.UserView, error) {
 	var user models.UserView
-	err := c.users.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	err := c.users.FindOne(ctx, bson.M{"email": normalizeEmail(email)}).Decode(&user)
 	if err != nil {
 		return models.UserView{}, err
 	}
@@ -172,17 +196,64 @@ func (c *userRepository) GetListOfUsers(ctx context.Context, ids []primitive.Obj
 	return users, nil
 }
 
+// handleCollation compares handles without case, @Abebe and @abebe are the same user
+var handleCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// GetUsersByHandles finds the users with the given handles, the case of a handle is ignored
+func (c *userRepository) GetUsersByHandles(ctx context.Context, handles []string) ([]models.UserView, error) {
+	users := []models.UserView{}
+	if len(handles) == 0 {
+		return users, nil
+	}
+	// accounts waiting to be deleted can not be mentioned
+	cursor, err := c.users.Find(ctx,
+		bson.M{"handle": bson.M{"$in": handles}, "deletion_scheduled_at": bson.M{"$exists": false}},
+		options.Find().SetCollation(handleCollation),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (c *userRepository) CompleteUser(ctx context.Context, user models.User) (models.UserView, error) {
 	fmt.Println("Completing user:", user.ID)
+	beforeUser, err := c.GetUserById(ctx, user.ID.Hex())
+	if err != nil {
+		return models.UserView{}, err
+	}
+
+	set := bson.M{
+		"profile_image_url": user.ProfileImageURL,
+		"department_id":     user.DepartmentID,
+		"school_id":         user.SchoolID,
+		"is_complete":       true,
+	}
+	// like UpdateMe, the university from the email domain is kept and the school and the
+	// department have to be part of it
+	university := beforeUser.UniversityID
+	if university == nil || *university == primitive.NilObjectID {
+		university = user.UniversityID
+		set["university_id"] = user.UniversityID
+	} else if user.UniversityID != nil && *user.UniversityID != *university {
+		return models.UserView{}, ErrUniversityReadOnly
+	}
+	if university == nil || user.SchoolID == nil {
+		return models.UserView{}, ErrSchoolNotInUniversity
+	}
+	if err := c.checkPlacement(ctx, *university, *user.SchoolID, user.DepartmentID); err != nil {
+		return models.UserView{}, err
+	}
+
 	res, err := c.users.UpdateOne(ctx,
 		bson.M{"_id": user.ID},
-		bson.M{"$set": bson.M{
-			"profile_image_url": user.ProfileImageURL,
-			"department_id":     user.DepartmentID,
-			"school_id":         user.SchoolID,
-			"is_complete":       true,
-		},
-		})
+		bson.M{"$set": set},
+	)
 
 	fmt.Println("Update result:", res, "Error:", err)
 	if err != nil {
@@ -196,6 +267,29 @@ func (c *userRepository) CompleteUser(ctx context.Context, user models.User) (mo
 	return updatedUser, nil
 }
 
+// checkPlacement makes sure the school is part of the university and, when there is one,
+// the department part of the school
+func (c *userRepository) checkPlacement(ctx context.Context, university, school primitive.ObjectID, department *primitive.ObjectID) error {
+	count, err := c.schoolCollection.CountDocuments(ctx, bson.M{"_id": school, "university_id": university})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrSchoolNotInUniversity
+	}
+	if department == nil || *department == primitive.NilObjectID {
+		return nil
+	}
+	count, err = c.departmentCollection.CountDocuments(ctx, bson.M{"_id": *department, "school_id": school})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrDepartmentNotInSchool
+	}
+	return nil
+}
+
 func (c *userRepository) GetUserByIdNoneView(ctx context.Context, userID string) (models.User, error) {
 	var user models.User
 	id, err := primitive.ObjectIDFromHex(userID)
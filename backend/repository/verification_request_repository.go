@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrVerificationNotFound    = errors.New("verification request not found")
+	ErrInvalidVerificationType = errors.New("verification type must be teacher or blue-badge")
+	ErrVerificationPending     = errors.New("you already have a pending request of this type")
+	ErrAlreadyVerified         = errors.New("you are already verified for this type")
+	ErrVerificationReviewed    = errors.New("the verification request was already reviewed")
+)
+
+type VerificationRequestRepository interface {
+	CreateRequest(ctx context.Context, request models.VerificationRequests) (models.VerificationRequests, error)
+	GetRequests(ctx context.Context, page int, status string) ([]models.VerificationRequests, error)
+	GetUserRequests(ctx context.Context, userID primitive.ObjectID) ([]models.VerificationRequests, error)
+	GetRequestByID(ctx context.Context, id primitive.ObjectID) (models.VerificationRequests, error)
+	ReviewRequest(ctx context.Context, id, reviewerID primitive.ObjectID, approve bool, notes string) (models.VerificationRequests, error)
+}
+
+type verificationRequestRepository struct {
+	requests *mongo.Collection
+	users    *mongo.Collection
+}
+
+func NewVerificationRequestRepository(db *mongo.Database) VerificationRequestRepository {
+	return &verificationRequestRepository{
+		requests: db.Collection("verification_requests"),
+		users:    db.Collection("users"),
+	}
+}
+
+func (r *verificationRequestRepository) CreateRequest(ctx context.Context, request models.VerificationRequests) (models.VerificationRequests, error) {
+	var flag string
+	switch request.Type {
+	case constants.VerificationTypeTeacher:
+		flag = "is_teacher"
+	case constants.VerificationTypeBlueBadge:
+		flag = "blue_badge"
+	default:
+		return models.VerificationRequests{}, ErrInvalidVerificationType
+	}
+
+	count, err := r.users.CountDocuments(ctx, bson.M{"_id": request.UserID, flag: true})
+	if err != nil {
+		return models.VerificationRequests{}, err
+	}
+	if count > 0 {
+		return models.VerificationRequests{}, ErrAlreadyVerified
+	}
+
+	count, err = r.requests.CountDocuments(ctx, bson.M{
+		"user_id": request.UserID,
+		"type":    request.Type,
+		"status":  constants.VerificationStatusPending,
+	})
+	if err != nil {
+		return models.VerificationRequests{}, err
+	}
+	if count > 0 {
+		return models.VerificationRequests{}, ErrVerificationPending
+	}
+
+	now := time.Now()
+	request.ID = primitive.NewObjectID()
+	request.Status = constants.VerificationStatusPending
+	request.CreatedAt = now
+	request.UpdatedAt = now
+	if _, err := r.requests.InsertOne(ctx, request); err != nil {
+		return models.VerificationRequests{}, err
+	}
+	return request, nil
+}
+
+// GetRequests is the review queue, the oldest requests come first so nobody waits forever
+func (r *verificationRequestRepository) GetRequests(ctx context.Context, page int, status string) ([]models.VerificationRequests, error) {
+	if status == "" {
+		status = constants.VerificationStatusPending
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetSkip(int64((page - 1) * Pagesize)).
+		SetLimit(int64(Pagesize + 1))
+
+	cursor, err := r.requests.Find(ctx, bson.M{"status": status}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var requests []models.VerificationRequests
+	if err := cursor.All(ctx, &requests); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func (r *verificationRequestRepository) GetUserRequests(ctx context.Context, userID primitive.ObjectID) ([]models.VerificationRequests, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := r.requests.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var requests []models.VerificationRequests
+	if err := cursor.All(ctx, &requests); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func (r *verificationRequestRepository) GetRequestByID(ctx context.Context, id primitive.ObjectID) (models.VerificationRequests, error) {
+	var request models.VerificationRequests
+	err := r.requests.FindOne(ctx, bson.M{"_id": id}).Decode(&request)
+	if err == mongo.ErrNoDocuments {
+		return models.VerificationRequests{}, ErrVerificationNotFound
+	}
+	if err != nil {
+		return models.VerificationRequests{}, err
+	}
+	return request, nil
+}
+
+// ReviewRequest closes a pending request, approving a teacher request flags the user as a
+// teacher with a blue badge and promotes students to the teacher role
+func (r *verificationRequestRepository) ReviewRequest(ctx context.Context, id, reviewerID primitive.ObjectID, approve bool, notes string) (models.VerificationRequests, error) {
+	status := constants.VerificationStatusRejected
+	if approve {
+		status = constants.VerificationStatusApproved
+	}
+
+	now := time.Now()
+	var request models.VerificationRequests
+	err := r.requests.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": constants.VerificationStatusPending},
+		bson.M{"$set": bson.M{
+			"status":       status,
+			"review_notes": notes,
+			"reviewed_by":  reviewerID,
+			"reviewed_at":  now,
+			"updated_at":   now,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&request)
+	if err == mongo.ErrNoDocuments {
+		if _, err := r.GetRequestByID(ctx, id); err != nil {
+			return models.VerificationRequests{}, err
+		}
+		return models.VerificationRequests{}, ErrVerificationReviewed
+	}
+	if err != nil {
+		return models.VerificationRequests{}, err
+	}
+
+	if !approve {
+		return request, nil
+	}
+
+	flags := bson.M{"blue_badge": true, "updated_at": now}
+	if request.Type == constants.VerificationTypeTeacher {
+		flags["is_teacher"] = true
+	}
+	if _, err := r.users.UpdateOne(ctx, bson.M{"_id": request.UserID}, bson.M{"$set": flags}); err != nil {
+		return models.VerificationRequests{}, err
+	}
+
+	if request.Type == constants.VerificationTypeTeacher {
+		// only students are promoted, moderators and admins keep their role
+		_, err = r.users.UpdateOne(ctx,
+			bson.M{"_id": request.UserID, "role": string(constants.UserRoleStudent)},
+			bson.M{"$set": bson.M{"role": string(constants.UserRoleTeacher)}},
+		)
+		if err != nil {
+			return models.VerificationRequests{}, err
+		}
+	}
+	return request, nil
+}
@@ -11,6 +11,9 @@ type WebSocketRepository interface {
 	AddConnection(connection *models.SocketConnection)
 	RemoveConnection(userID string)
 	SendMessage(ctx context.Context, message *models.Notifications)
+	Subscribe(userID, topic string)
+	Unsubscribe(userID, topic string)
+	Broadcast(ctx context.Context, topic string, message interface{})
 }
 
 type webSocketRepository struct {
@@ -34,3 +37,15 @@ func (r *webSocketRepository) RemoveConnection(userID string) {
 func (r *webSocketRepository) SendMessage(ctx context.Context, message *models.Notifications) {
 	r.webSocketClient.SendMessage(ctx, message)
 }
+
+func (r *webSocketRepository) Subscribe(userID, topic string) {
+	r.webSocketClient.Subscribe(userID, topic)
+}
+
+func (r *webSocketRepository) Unsubscribe(userID, topic string) {
+	r.webSocketClient.Unsubscribe(userID, topic)
+}
+
+func (r *webSocketRepository) Broadcast(ctx context.Context, topic string, message interface{}) {
+	r.webSocketClient.Broadcast(ctx, topic, message)
+}
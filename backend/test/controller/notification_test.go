@@ -43,6 +43,9 @@ func (m *UserUsecaseMock) GetListOfUsers(ctx context.Context, userIds []primitiv
 func (m *UserUsecaseMock) GetUserById(ctx context.Context, userID string) (models.UserView, error) {
 	return models.UserView{}, nil
 }
+func (m *UserUsecaseMock) GetMe(ctx context.Context, userID string) (models.MeView, error) {
+	return models.MeView{}, nil
+}
 func (m *UserUsecaseMock) GetUserByIdNoneView(ctx context.Context, userID string) (models.User, error) {
 	return models.User{}, nil
 }
@@ -0,0 +1,339 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	appcontroller "github.com/chera-mihiretu/IKnow/delivery/controller"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/middleware"
+	"github.com/chera-mihiretu/IKnow/infrastructure/oauth"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"github.com/markbates/goth/gothic"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	fakeProvider     = "fakeid"
+	fakeClientID     = "iknow-test"
+	fakeSubject      = "fake-user-42"
+	fakeEmail        = "Alice@Example.com"
+	fakeFrontHost    = "front.test"
+	fakeLinkedUserID = "66f1a1a1a1a1a1a1a1a1a1a1"
+
+	providerLinkStateForTest = "link.guessed-nonce"
+)
+
+// fakeOIDCServer is the smallest openid connect provider goth can log in with, it
+// approves every authorization request for the same user
+func fakeOIDCServer(t *testing.T, emailVerified bool) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"userinfo_endpoint":      server.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") != fakeClientID {
+			http.Error(w, "unknown client", http.StatusBadRequest)
+			return
+		}
+		callback := q.Get("redirect_uri") + "?" + url.Values{"code": {"fake-code"}, "state": {q.Get("state")}}.Encode()
+		http.Redirect(w, r, callback, http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("code") != "fake-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "fake-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token": fakeIDToken(map[string]interface{}{
+				"iss":   server.URL,
+				"aud":   fakeClientID,
+				"sub":   fakeSubject,
+				"exp":   time.Now().Add(time.Hour).Unix(),
+				"email": fakeEmail,
+				"name":  "Alice Student",
+			}),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fake-access-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub":            fakeSubject,
+			"email":          fakeEmail,
+			"email_verified": emailVerified,
+		})
+	})
+
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// fakeIDToken is not signed, goth reads the claims of the token it got from the token endpoint
+func fakeIDToken(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "none", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+// authUsecaseStub records the provider calls, the other methods are not used by these tests
+type authUsecaseStub struct {
+	usecases.AuthUseCase
+	signedIn *models.UserIdentities
+	linked   *models.UserIdentities
+	linkedTo primitive.ObjectID
+	links    map[string]primitive.ObjectID
+}
+
+func (s *authUsecaseStub) SignInWithProvider(ctx context.Context, identity models.UserIdentities, device models.SessionDevice) (models.LoginResult, error) {
+	s.signedIn = &identity
+	return models.LoginResult{Tokens: &models.AuthTokens{AccessToken: "access", RefreshToken: "refresh"}}, nil
+}
+
+func (s *authUsecaseStub) LinkProvider(ctx context.Context, userID primitive.ObjectID, identity models.UserIdentities) (models.UserIdentities, error) {
+	s.linked = &identity
+	s.linkedTo = userID
+	return identity, nil
+}
+
+func (s *authUsecaseStub) StartProviderLink(ctx context.Context, userID primitive.ObjectID, provider string) (string, error) {
+	nonce := primitive.NewObjectID().Hex()
+	if s.links == nil {
+		s.links = map[string]primitive.ObjectID{}
+	}
+	s.links[nonce+provider] = userID
+	return nonce, nil
+}
+
+func (s *authUsecaseStub) FinishProviderLink(ctx context.Context, nonce string, identity models.UserIdentities) (models.UserIdentities, error) {
+	userID, ok := s.links[nonce+identity.Provider]
+	if !ok {
+		return models.UserIdentities{}, repository.ErrInvalidProviderLink
+	}
+	delete(s.links, nonce+identity.Provider)
+	return s.LinkProvider(ctx, userID, identity)
+}
+
+// setupProviderTest starts the api with the fake provider registered and returns a
+// browser like client that stops at the front end
+func setupProviderTest(t *testing.T, emailVerified bool) (*httptest.Server, *http.Client, *authUsecaseStub) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	t.Setenv("FRONT_BASE_URL", "http://"+fakeFrontHost)
+	gothic.Store = sessions.NewCookieStore([]byte("test-session-secret"))
+
+	stub := &authUsecaseStub{}
+	authController := appcontroller.NewAuthController(stub, nil)
+
+	r := gin.New()
+	providerAuth := r.Group("/api/auth/:provider", middleware.OAuthProvider)
+	providerAuth.GET("/login", authController.LoginWithProvider)
+	providerAuth.GET("/callback", authController.HandleCallback)
+	providerAuth.POST("/link", func(c *gin.Context) {
+		c.Set("user_id", fakeLinkedUserID)
+	}, authController.StartProviderLink)
+
+	api := httptest.NewServer(r)
+	t.Cleanup(api.Close)
+	t.Setenv("BASE_URL", api.URL)
+
+	issuer := fakeOIDCServer(t, emailVerified)
+	err := oauth.Setup([]oauth.ProviderConfig{{
+		Name:         fakeProvider,
+		ClientID:     fakeClientID,
+		ClientSecret: "secret",
+		DiscoveryURL: issuer.URL + "/.well-known/openid-configuration",
+	}}, api.URL)
+	if err != nil {
+		t.Fatalf("could not register the fake provider: %v", err)
+	}
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Host == fakeFrontHost {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+	return api, client, stub
+}
+
+func frontRedirect(t *testing.T, client *http.Client, target string) *url.URL {
+	t.Helper()
+	location, _ := frontResponse(t, client, target)
+	return location
+}
+
+// frontResponse follows the login up to the redirect to the front end, with the cookies it sets
+func frontResponse(t *testing.T, client *http.Client, target string) (*url.URL, []*http.Cookie) {
+	t.Helper()
+	res, err := client.Get(target)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		var body map[string]interface{}
+		json.NewDecoder(res.Body).Decode(&body)
+		t.Fatalf("expected a redirect to the front end, got %d %v", res.StatusCode, body)
+	}
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect: %v", err)
+	}
+	return location, res.Cookies()
+}
+
+func TestProviderLoginWithFakeOIDC(t *testing.T) {
+	api, client, stub := setupProviderTest(t, true)
+
+	location, cookies := frontResponse(t, client, api.URL+"/api/auth/"+fakeProvider+"/login")
+
+	if location.Path != "/auth/callback" || location.Query().Get("token") != "access" || location.Query().Has("refresh_token") {
+		t.Fatalf("unexpected redirect %s", location)
+	}
+	var refresh *http.Cookie
+	for _, cookie := range cookies {
+		if cookie.Name == "refresh_token" {
+			refresh = cookie
+		}
+	}
+	if refresh == nil || refresh.Value != "refresh" || !refresh.HttpOnly || !refresh.Secure || refresh.Path != "/api/auth" || refresh.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("expected the refresh token in an http only, secure and same site cookie, got %+v", refresh)
+	}
+	if stub.signedIn == nil {
+		t.Fatal("expected a provider sign in")
+	}
+	if stub.signedIn.Provider != fakeProvider || stub.signedIn.ProviderUserID != fakeSubject {
+		t.Fatalf("unexpected identity %+v", stub.signedIn)
+	}
+	if stub.signedIn.Email != "alice@example.com" || !stub.signedIn.EmailVerified {
+		t.Fatalf("expected the normalized, verified email, got %+v", stub.signedIn)
+	}
+	if stub.linked != nil {
+		t.Fatal("a login must not link")
+	}
+}
+
+func TestProviderLoginKeepsUnverifiedEmailFlag(t *testing.T) {
+	api, client, stub := setupProviderTest(t, false)
+
+	frontRedirect(t, client, api.URL+"/api/auth/"+fakeProvider+"/login")
+
+	if stub.signedIn == nil || stub.signedIn.EmailVerified {
+		t.Fatalf("expected an unverified identity, got %+v", stub.signedIn)
+	}
+}
+
+// startLink starts a link as the logged in user and returns the url of the provider
+func startLink(t *testing.T, api *httptest.Server, client *http.Client) string {
+	t.Helper()
+	res, err := client.Post(api.URL+"/api/auth/"+fakeProvider+"/link", "application/json", nil)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	var started struct {
+		URL string `json:"url"`
+	}
+	json.NewDecoder(res.Body).Decode(&started)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || started.URL == "" {
+		t.Fatalf("could not start linking: %d", res.StatusCode)
+	}
+	return started.URL
+}
+
+func TestProviderLinkWithFakeOIDC(t *testing.T) {
+	api, client, stub := setupProviderTest(t, true)
+
+	location := frontRedirect(t, client, startLink(t, api, client))
+
+	if location.Path != "/settings/linked-accounts" || location.Query().Get("linked") != fakeProvider {
+		t.Fatalf("unexpected redirect %s", location)
+	}
+	if stub.linked == nil || stub.linkedTo.Hex() != fakeLinkedUserID {
+		t.Fatalf("expected the provider linked to %s, got %v", fakeLinkedUserID, stub.linkedTo.Hex())
+	}
+	if stub.signedIn != nil {
+		t.Fatal("a link must not log in")
+	}
+	if len(stub.links) != 0 {
+		t.Fatal("expected the link nonce to be used up")
+	}
+
+	// the next login of the same browser is a plain login
+	frontRedirect(t, client, api.URL+"/api/auth/"+fakeProvider+"/login")
+	if stub.signedIn == nil {
+		t.Fatal("expected a sign in after the link")
+	}
+}
+
+func TestProviderLinkRefusesOtherBrowser(t *testing.T) {
+	api, client, stub := setupProviderTest(t, true)
+	providerURL := startLink(t, api, client)
+
+	// someone else opening the url has no gothic session with the state of the link
+	jar, _ := cookiejar.New(nil)
+	other := &http.Client{Jar: jar, CheckRedirect: client.CheckRedirect}
+	res, err := other.Get(providerURL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusFound || stub.linked != nil || stub.signedIn != nil {
+		t.Fatalf("expected the link to be refused, got %d", res.StatusCode)
+	}
+}
+
+func TestProviderLoginStateCanNotStartLink(t *testing.T) {
+	api, client, stub := setupProviderTest(t, true)
+
+	frontRedirect(t, client, api.URL+"/api/auth/"+fakeProvider+"/login?state="+providerLinkStateForTest)
+	if stub.linked != nil || stub.signedIn == nil {
+		t.Fatal("a state from the query must not turn a login into a link")
+	}
+}
+
+func TestUnknownProvider(t *testing.T) {
+	api, client, _ := setupProviderTest(t, true)
+
+	res, err := client.Get(api.URL + "/api/auth/unknown/login")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", res.StatusCode)
+	}
+}
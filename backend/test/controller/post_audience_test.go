@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appcontroller "github.com/chera-mihiretu/IKnow/delivery/controller"
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// audiencePostStub serves one post, the viewer is in its audience or not
+type audiencePostStub struct {
+	usecases.PostUseCase
+	post    models.Posts
+	visible bool
+	checks  int
+}
+
+func (s *audiencePostStub) GetPostByID(ctx context.Context, id string) (models.Posts, error) {
+	return s.post, nil
+}
+
+func (s *audiencePostStub) CanView(ctx context.Context, viewerID, postID primitive.ObjectID) (bool, error) {
+	s.checks++
+	return s.visible && postID == s.post.ID, nil
+}
+
+// interactionStub counts the comments and likes that reach the usecases
+type interactionStub struct {
+	usecases.CommentUsecase
+	usecases.PostLikeUsecase
+	calls int
+}
+
+func (s *interactionStub) GetComments(ctx context.Context, postID primitive.ObjectID, page int) ([]models.Comments, error) {
+	s.calls++
+	return []models.Comments{}, nil
+}
+
+func (s *interactionStub) AddComment(ctx context.Context, comment models.Comments) (models.Comments, error) {
+	s.calls++
+	return comment, nil
+}
+
+func (s *interactionStub) AddLike(ctx context.Context, postID, userID primitive.ObjectID) error {
+	s.calls++
+	return nil
+}
+
+func serveAs(viewer primitive.ObjectID, method, path string, handler gin.HandlerFunc, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Handle(method, strings.Split(path, "?")[0], func(c *gin.Context) {
+		c.Set("user_id", viewer.Hex())
+		c.Next()
+	}, handler)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestHiddenPostsCanNotBeSeenOrInteractedWith(t *testing.T) {
+	viewer := primitive.NewObjectID()
+	author := primitive.NewObjectID()
+
+	for _, audience := range []string{
+		constants.PostAudienceUniversity,
+		constants.PostAudienceSchool,
+		constants.PostAudienceDepartment,
+		constants.PostAudienceConnections,
+	} {
+		t.Run(audience, func(t *testing.T) {
+			post := models.Posts{ID: primitive.NewObjectID(), UserID: author, Audience: audience, Status: constants.PostStatusPublished, IsValidated: true}
+			posts := &audiencePostStub{post: post}
+			interactions := &interactionStub{}
+			postController := appcontroller.NewPostController(posts, nil, nil, nil, interactions, nil, nil, nil, nil)
+			commentController := appcontroller.NewCommentController(interactions, nil, posts, nil)
+			likeController := appcontroller.NewPostLikeController(interactions, nil, posts)
+
+			requests := []struct {
+				name    string
+				method  string
+				path    string
+				handler gin.HandlerFunc
+				body    string
+			}{
+				{"get by id", http.MethodGet, "/post?id=" + post.ID.Hex(), postController.GetPostByID, ""},
+				{"comments", http.MethodGet, "/comments?post_id=" + post.ID.Hex(), commentController.GetComments, ""},
+				{"comment", http.MethodPost, "/comments", commentController.AddComment, `{"post_id":"` + post.ID.Hex() + `","content":"hi"}`},
+				{"like", http.MethodPost, "/like", likeController.AddLike, `{"post_id":"` + post.ID.Hex() + `"}`},
+			}
+			for _, request := range requests {
+				w := serveAs(viewer, request.method, request.path, request.handler, request.body)
+				if w.Code != http.StatusNotFound {
+					t.Fatalf("%s: expected the post not to be found, got %d %s", request.name, w.Code, w.Body)
+				}
+			}
+			if posts.checks != len(requests) {
+				t.Fatalf("expected the audience to be checked %d times, got %d", len(requests), posts.checks)
+			}
+			if interactions.calls != 0 {
+				t.Fatalf("expected nothing to reach the comments or likes, got %d calls", interactions.calls)
+			}
+		})
+	}
+}
+
+func TestDraftOfSomeoneElseIsNotFound(t *testing.T) {
+	post := models.Posts{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Status: constants.PostStatusDraft}
+	posts := &audiencePostStub{post: post, visible: true}
+	postController := appcontroller.NewPostController(posts, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	w := serveAs(primitive.NewObjectID(), http.MethodGet, "/post?id="+post.ID.Hex(), postController.GetPostByID, "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected the draft not to be found, got %d %s", w.Code, w.Body)
+	}
+	if posts.checks != 0 {
+		t.Fatal("expected the draft to be refused before its audience is checked")
+	}
+}
+
+func TestVisiblePostCanBeLiked(t *testing.T) {
+	viewer := primitive.NewObjectID()
+	post := models.Posts{ID: primitive.NewObjectID(), UserID: viewer, Audience: constants.PostAudienceDepartment, Status: constants.PostStatusPublished, IsValidated: true}
+	posts := &audiencePostStub{post: post, visible: true}
+	interactions := &interactionStub{}
+	likeController := appcontroller.NewPostLikeController(interactions, nil, posts)
+
+	w := serveAs(viewer, http.MethodPost, "/like", likeController.AddLike, `{"post_id":"`+post.ID.Hex()+`"}`)
+	if w.Code != http.StatusOK || interactions.calls != 1 {
+		t.Fatalf("expected the like to be added, got %d %s", w.Code, w.Body)
+	}
+}
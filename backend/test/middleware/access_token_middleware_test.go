@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+const readOnlyToken = middleware.AccessTokenPrefix + "read-only"
+
+// tokenStub knows one token, scoped to reading posts
+type tokenStub struct{}
+
+func (tokenStub) AuthenticateAccessToken(ctx context.Context, token, clientIP string) (models.AccessTokenPrincipal, error) {
+	if token != readOnlyToken {
+		return models.AccessTokenPrincipal{}, errors.New("unknown token")
+	}
+	return models.AccessTokenPrincipal{
+		UserID:  "user",
+		Role:    "student",
+		TokenID: "token",
+		Scopes:  []string{string(constants.PermPostsRead)},
+	}, nil
+}
+
+// grantAll holds every permission globally, only the scopes of the token can refuse
+type grantAll struct{}
+
+func (grantAll) ResolvePermission(ctx context.Context, userID, role string, permission constants.Permission) (models.AccessScope, bool, error) {
+	return models.AccessScope{Global: true}, true, nil
+}
+
+func useStubs(t *testing.T) {
+	t.Helper()
+	middleware.UseTokenAuthenticator(tokenStub{})
+	middleware.UsePermissionResolver(grantAll{})
+	t.Cleanup(func() {
+		middleware.UseTokenAuthenticator(nil)
+		middleware.UsePermissionResolver(nil)
+	})
+}
+
+func serve(r *gin.Engine, method, path, token string) int {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAccessTokenScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	useStubs(t)
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r := gin.New()
+	r.GET("/posts", middleware.RequirePermission(constants.PermPostsRead), ok)
+	r.POST("/posts", middleware.RequirePermission(constants.PermPostsWrite), ok)
+	r.GET("/scoped", middleware.RequireScopedPermission(constants.PermPostsWrite), ok)
+	r.GET("/me", middleware.AuthUserMiddleware(), ok)
+
+	session, err := middleware.GenerateJWT("user", "student", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"read-only token reads", http.MethodGet, "/posts", readOnlyToken, http.StatusOK},
+		{"read-only token is refused on writes", http.MethodPost, "/posts", readOnlyToken, http.StatusForbidden},
+		{"read-only token is refused on scoped writes", http.MethodGet, "/scoped", readOnlyToken, http.StatusForbidden},
+		{"token is refused on logged in user routes", http.MethodGet, "/me", readOnlyToken, http.StatusForbidden},
+		{"unknown token", http.MethodGet, "/posts", middleware.AccessTokenPrefix + "unknown", http.StatusUnauthorized},
+		{"session writes", http.MethodPost, "/posts", session, http.StatusOK},
+		{"session reaches logged in user routes", http.MethodGet, "/me", session, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := serve(r, tt.method, tt.path, tt.token); status != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, status)
+			}
+		})
+	}
+}
+
+func TestAccessTokenRefusedAfterGroupMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useStubs(t)
+
+	// a group authenticated by a permission, then a route only for logged in users
+	r := gin.New()
+	group := r.Group("/", middleware.RequirePermission(constants.PermPostsRead))
+	group.GET("/settings", middleware.AuthUserMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	if status := serve(r, http.MethodGet, "/settings", readOnlyToken); status != http.StatusForbidden {
+		t.Fatalf("expected the token to be refused, got %d", status)
+	}
+}
+
+func TestOptionalScopedPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	useStubs(t)
+
+	r := gin.New()
+	r.GET("/revisions", middleware.RequirePermission(constants.PermPostsRead), middleware.OptionalScopedPermission(constants.PermPostsVerify), func(c *gin.Context) {
+		scope, _ := c.Get("access_scope")
+		if scope.(models.AccessScope).Global {
+			c.Status(http.StatusOK)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	session, err := middleware.GenerateJWT("user", "student", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := serve(r, http.MethodGet, "/revisions", session); status != http.StatusOK {
+		t.Fatalf("expected the session to get its scope, got %d", status)
+	}
+	// the token is not scoped to moderation, it is let through without a scope
+	if status := serve(r, http.MethodGet, "/revisions", readOnlyToken); status != http.StatusNoContent {
+		t.Fatalf("expected the token to get an empty scope, got %d", status)
+	}
+}
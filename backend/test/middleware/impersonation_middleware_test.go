@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+type impersonationRecorderStub struct {
+	requests []models.ImpersonatedRequest
+}
+
+func (s *impersonationRecorderStub) RecordImpersonatedRequest(ctx context.Context, request models.ImpersonatedRequest) {
+	s.requests = append(s.requests, request)
+}
+
+func TestImpersonationLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	recorder := &impersonationRecorderStub{}
+	middleware.UseImpersonationRecorder(recorder)
+	t.Cleanup(func() { middleware.UseImpersonationRecorder(nil) })
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r := gin.New()
+	r.Use(middleware.AuthUserMiddleware())
+	r.GET("/posts", ok)
+	r.POST("/posts", ok)
+	r.PUT("/posts", ok)
+	r.DELETE("/posts", ok)
+	r.POST("/password", middleware.NoImpersonation(), ok)
+
+	expires := time.Now().Add(time.Hour)
+	readOnly, err := middleware.GenerateImpersonationJWT("user", "student", "session", "admin", false, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withWrites, err := middleware.GenerateImpersonationJWT("user", "student", "session", "admin", true, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		token   string
+		status  int
+		blocked bool
+	}{
+		{"reads are allowed", http.MethodGet, "/posts", readOnly, http.StatusOK, false},
+		{"writes are refused by default", http.MethodPost, "/posts", readOnly, http.StatusForbidden, true},
+		{"updates are refused by default", http.MethodPut, "/posts", readOnly, http.StatusForbidden, true},
+		{"writes are allowed when opted in", http.MethodPost, "/posts", withWrites, http.StatusOK, false},
+		{"deletes are refused without writes", http.MethodDelete, "/posts", readOnly, http.StatusForbidden, true},
+		{"deletes are refused even with writes", http.MethodDelete, "/posts", withWrites, http.StatusForbidden, true},
+		{"account settings are refused even with writes", http.MethodPost, "/password", withWrites, http.StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.requests = nil
+			if status := serve(r, tt.method, tt.path, tt.token); status != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, status)
+			}
+			if len(recorder.requests) != 1 {
+				t.Fatalf("expected the request to be recorded once, got %+v", recorder.requests)
+			}
+			request := recorder.requests[0]
+			if request.Blocked != tt.blocked || request.ImpersonatorID != "admin" || request.Method != tt.method {
+				t.Fatalf("unexpected record %+v", request)
+			}
+		})
+	}
+}
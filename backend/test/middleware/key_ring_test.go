@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/infrastructure/middleware"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// writeKeyRing writes an Ed25519 key pair and a key file where the new key signs and the
+// legacy secret only verifies
+func writeKeyRing(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "jwt.pem")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, _ := json.Marshal(map[string]interface{}{
+		"active_kid": "ed-1",
+		"keys": []map[string]string{
+			{"kid": "ed-1", "alg": "EdDSA", "private_key_file": keyPath},
+		},
+	})
+	filePath := filepath.Join(dir, "keys.json")
+	if err := os.WriteFile(filePath, file, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "legacy-secret")
+	legacy, err := middleware.LoadKeyRing()
+	if err != nil {
+		t.Fatalf("could not load the legacy ring: %v", err)
+	}
+	oldToken, err := legacy.Sign(&middleware.Claims{ID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatalf("could not sign: %v", err)
+	}
+
+	t.Setenv("JWT_KEYS_FILE", writeKeyRing(t))
+	ring, err := middleware.LoadKeyRing()
+	if err != nil {
+		t.Fatalf("could not load the ring: %v", err)
+	}
+
+	newToken, err := ring.Sign(&middleware.Claims{ID: "user", SessionID: "session"})
+	if err != nil {
+		t.Fatalf("could not sign: %v", err)
+	}
+	token, err := ring.Parse(newToken, &middleware.Claims{})
+	if err != nil || !token.Valid || token.Header["kid"] != "ed-1" || token.Method.Alg() != "EdDSA" {
+		t.Fatalf("expected a valid EdDSA token with its kid, got %v %v", token, err)
+	}
+	if _, err := ring.Parse(oldToken, &middleware.Claims{}); err != nil {
+		t.Fatalf("tokens of the legacy key must still verify: %v", err)
+	}
+
+	keys := ring.JWKS()
+	if len(keys) != 1 || keys[0].KeyID != "ed-1" || keys[0].Curve != "Ed25519" || keys[0].X == "" {
+		t.Fatalf("expected only the Ed25519 public key, got %+v", keys)
+	}
+}
+
+func TestKeyRingRefusesOtherAlgorithm(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "legacy-secret")
+	t.Setenv("JWT_KEYS_FILE", writeKeyRing(t))
+	ring, err := middleware.LoadKeyRing()
+	if err != nil {
+		t.Fatalf("could not load the ring: %v", err)
+	}
+
+	// an HMAC token claiming the kid of the Ed25519 key
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()})
+	forged.Header["kid"] = "ed-1"
+	tokenString, err := forged.SignedString([]byte("legacy-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ring.Parse(tokenString, jwt.MapClaims{}); err == nil {
+		t.Fatal("a token must be signed with the algorithm of its key")
+	}
+}
@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestEnsureIndexesMigratesEmails(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	ttlIndexes := []bson.D{
+		mtest.CreateSuccessResponse(),
+		mtest.CreateSuccessResponse(),
+		mtest.CreateSuccessResponse(),
+		mtest.CreateSuccessResponse(),
+	}
+
+	mt.Run("accounts sharing an email are set aside before the unique index", func(mt *mtest.T) {
+		oldest, newer := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(ttlIndexes...)
+		mt.AddMockResponses(
+			document(mt.T, "db.users", bson.M{"name": "_id_", "key": bson.M{"_id": 1}, "v": 2}),
+			document(mt.T, "db.users", bson.M{"_id": "alice@aau.edu.et", "ids": bson.A{oldest, newer}}),
+			updated(1),
+			updated(1),
+			updated(0),
+			mtest.CreateSuccessResponse(),
+		)
+		auth := repository.NewAuthRepository(mt.DB, nil, nil, nil, nil)
+
+		if err := auth.EnsureIndexes(context.Background()); err != nil {
+			mt.Fatal(err)
+		}
+
+		updates := sentUpdates(mt)
+		if len(updates) != 3 {
+			mt.Fatalf("expected the duplicates set aside and two lower casing updates, got %v", updates)
+		}
+		ids, err := updates[0].Lookup("q", "_id", "$in").Array().Values()
+		if err != nil || len(ids) != 1 || ids[0].ObjectID() != newer {
+			mt.Fatalf("expected only the newer account set aside, got %s", updates[0])
+		}
+		if pattern, _, ok := updates[1].Lookup("q", "email").RegexOK(); !ok || pattern != "[A-Z]" {
+			mt.Fatalf("expected the upper case emails to be lower cased, got %s", updates[1])
+		}
+
+		started := mt.GetAllStartedEvents()
+		last := started[len(started)-1]
+		if last.CommandName != "createIndexes" {
+			mt.Fatalf("expected the unique index to be built last, got %s", last.CommandName)
+		}
+	})
+
+	mt.Run("nothing is migrated once the index exists", func(mt *mtest.T) {
+		mt.AddMockResponses(ttlIndexes...)
+		mt.AddMockResponses(
+			document(mt.T, "db.users",
+				bson.M{"name": "_id_", "key": bson.M{"_id": 1}, "v": 2},
+				bson.M{"name": "email_1", "key": bson.M{"email": 1}, "unique": true, "v": 2},
+			),
+			mtest.CreateSuccessResponse(),
+		)
+		auth := repository.NewAuthRepository(mt.DB, nil, nil, nil, nil)
+
+		if err := auth.EnsureIndexes(context.Background()); err != nil {
+			mt.Fatal(err)
+		}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "aggregate" || event.CommandName == "update" {
+				mt.Fatalf("expected no migration, got %s", event.Command)
+			}
+		}
+	})
+}
+
+func TestRegisterUserWithEmailIgnoresCase(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("an existing email in another case is a conflict", func(mt *mtest.T) {
+		mt.AddMockResponses(document(mt.T, "db.users", bson.M{"n": 1}))
+		auth := repository.NewAuthRepository(mt.DB, nil, nil, nil, nil)
+
+		err := auth.RegisterUserWithEmail(context.Background(), models.User{Email: " Alice@AAU.edu.et"})
+		if err != repository.ErrUserExists {
+			mt.Fatalf("expected the user to exist, got %v", err)
+		}
+		pipeline, _ := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Values()
+		if email := pipeline[0].Document().Lookup("$match", "email").StringValue(); email != "alice@aau.edu.et" {
+			mt.Fatalf("expected the lower cased email to be looked up, got %q", email)
+		}
+	})
+}
+
+func TestVerifyEmailDuplicateIsConflict(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("an email verified by another sign up first is a conflict", func(mt *mtest.T) {
+		user := models.User{ID: primitive.NewObjectID(), Email: "alice@aau.edu.et"}
+		mt.AddMockResponses(
+			document(mt.T, "db.email_verifications", models.EmailVerification{UserID: user.ID, UserEmail: user.Email, Token: "token", ExpiresAt: time.Now().Add(time.Hour)}),
+			document(mt.T, "db.users_temp", user),
+			document(mt.T, "db.users", bson.M{"n": 1}),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key error"}),
+		)
+		auth := repository.NewAuthRepository(mt.DB, nil, nil, nil, nil)
+
+		err := auth.VerifyEmail(context.Background(), models.EmailVerification{UserEmail: user.Email, Token: "token"})
+		if err != repository.ErrUserExists {
+			mt.Fatalf("expected the duplicate to be a conflict, got %v", err)
+		}
+	})
+}
+
+func TestEnsureIndexesExpiresStaleRecords(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("pending sign ups and used up tokens are removed by mongo", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			document(mt.T, "db.users", bson.M{"name": "email_1", "key": bson.M{"email": 1}, "unique": true, "v": 2}),
+			mtest.CreateSuccessResponse(),
+		)
+		auth := repository.NewAuthRepository(mt.DB, nil, nil, nil, nil)
+
+		if err := auth.EnsureIndexes(context.Background()); err != nil {
+			mt.Fatal(err)
+		}
+
+		want := map[string]int32{
+			"users_temp":          int32(repository.UnverifiedUserTTL.Seconds()),
+			"email_verifications": 0,
+			"password_resets":     0,
+			"magic_links":         0,
+		}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName != "createIndexes" {
+				continue
+			}
+			collection := event.Command.Lookup("createIndexes").StringValue()
+			after, expected := want[collection]
+			if !expected {
+				continue
+			}
+			if got, ok := event.Command.Lookup("indexes", "0", "expireAfterSeconds").Int32OK(); !ok || got != after {
+				mt.Fatalf("expected %s to expire after %d seconds, got %s", collection, after, event.Command)
+			}
+			delete(want, collection)
+		}
+		if len(want) != 0 {
+			mt.Fatalf("expected a ttl index on %v", want)
+		}
+	})
+}
+
+func TestLoginWithMagicLinkReplay(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("a used or expired link does not log in", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+		auth := repository.NewAuthRepository(mt.DB, nil, nil, nil, nil)
+
+		_, err := auth.LoginWithMagicLink(context.Background(), "token", models.SessionDevice{})
+		if err != repository.ErrInvalidMagicLink {
+			mt.Fatalf("expected the link to be refused, got %v", err)
+		}
+
+		started := mt.GetAllStartedEvents()
+		if len(started) != 1 {
+			mt.Fatalf("expected no user to be looked up, got %d commands", len(started))
+		}
+		command := started[0].Command
+		if used, ok := command.Lookup("query", "used").BooleanOK(); !ok || used {
+			mt.Fatalf("expected only an unused link to be redeemed, got %s", command)
+		}
+		if _, err := command.LookupErr("query", "expires_at", "$gt"); err != nil {
+			mt.Fatalf("expected only a live link to be redeemed, got %s", command)
+		}
+		if used := command.Lookup("update", "$set", "used").Boolean(); !used {
+			mt.Fatalf("expected the link to be used up, got %s", command)
+		}
+	})
+
+	mt.Run("a link of a user whose email changed does not log in", func(mt *mtest.T) {
+		link := models.MagicLinks{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Email: "alice@aau.edu.et"}
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: link}),
+			noDocument("db.users"),
+		)
+		auth := repository.NewAuthRepository(mt.DB, nil, nil, nil, nil)
+
+		_, err := auth.LoginWithMagicLink(context.Background(), "token", models.SessionDevice{})
+		if err != repository.ErrInvalidMagicLink {
+			mt.Fatalf("expected the link to be refused, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAddBookmark(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	user, post := primitive.NewObjectID(), primitive.NewObjectID()
+	folder := primitive.NewObjectID()
+	saved := models.Bookmarks{ID: primitive.NewObjectID(), UserID: user, TargetType: constants.BookmarkTypePost, TargetID: post}
+
+	mt.Run("an unknown type is refused", func(mt *mtest.T) {
+		bookmarks := repository.NewBookmarkRepository(mt.DB)
+
+		_, err := bookmarks.AddBookmark(context.Background(), models.Bookmarks{UserID: user, TargetType: "comment", TargetID: post})
+		if err != repository.ErrInvalidBookmarkType {
+			mt.Fatalf("expected the type to be refused, got %v", err)
+		}
+		if started := mt.GetAllStartedEvents(); len(started) != 0 {
+			mt.Fatalf("expected nothing to be looked up, got %v", started)
+		}
+	})
+
+	mt.Run("a draft or blocked post can not be saved", func(mt *mtest.T) {
+		mt.AddMockResponses(noDocument("db.posts"))
+		bookmarks := repository.NewBookmarkRepository(mt.DB)
+
+		_, err := bookmarks.AddBookmark(context.Background(), models.Bookmarks{UserID: user, TargetType: constants.BookmarkTypePost, TargetID: post})
+		if err != repository.ErrBookmarkTargetNotFound {
+			mt.Fatalf("expected the post not to be found, got %v", err)
+		}
+		filter := findFilter(mt, "posts")
+		if validated, ok := filter.Lookup("is_validated").BooleanOK(); !ok || !validated {
+			mt.Fatalf("expected only validated posts, got %s", filter)
+		}
+		if _, err := filter.LookupErr("status", "$nin"); err != nil {
+			mt.Fatalf("expected only published posts, got %s", filter)
+		}
+	})
+
+	mt.Run("a folder of someone else can not be used", func(mt *mtest.T) {
+		mt.AddMockResponses(document(mt.T, "db.posts", bson.M{"_id": post}), noDocument("db.bookmark_folders"))
+		bookmarks := repository.NewBookmarkRepository(mt.DB)
+
+		_, err := bookmarks.AddBookmark(context.Background(), models.Bookmarks{UserID: user, TargetType: constants.BookmarkTypePost, TargetID: post, FolderID: &folder})
+		if err != repository.ErrBookmarkFolderNotFound {
+			mt.Fatalf("expected the folder not to be found, got %v", err)
+		}
+	})
+
+	mt.Run("saving again takes the bookmark out of its folder", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			document(mt.T, "db.posts", bson.M{"_id": post}),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: saved}),
+		)
+		bookmarks := repository.NewBookmarkRepository(mt.DB)
+
+		if _, err := bookmarks.AddBookmark(context.Background(), models.Bookmarks{UserID: user, TargetType: constants.BookmarkTypePost, TargetID: post}); err != nil {
+			mt.Fatal(err)
+		}
+		started := mt.GetAllStartedEvents()
+		command := started[len(started)-1].Command
+		if !command.Lookup("upsert").Boolean() {
+			mt.Fatalf("expected one bookmark per content, got %s", command)
+		}
+		if _, err := command.LookupErr("update", "$unset", "folder_id"); err != nil {
+			mt.Fatalf("expected the folder to be removed, got %s", command)
+		}
+	})
+}
+
+func TestGetBookmarksOfUnknownType(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("an unknown type is refused", func(mt *mtest.T) {
+		bookmarks := repository.NewBookmarkRepository(mt.DB)
+
+		if _, err := bookmarks.GetBookmarks(context.Background(), primitive.NewObjectID(), "comment", nil, 1); err != repository.ErrInvalidBookmarkType {
+			mt.Fatalf("expected the type to be refused, got %v", err)
+		}
+	})
+}
+
+func TestBookmarkFolders(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	user := primitive.NewObjectID()
+
+	tests := []struct {
+		name      string
+		folder    string
+		responses func(mt *mtest.T) []bson.D
+		want      error
+	}{
+		{"a blank name", "   ", func(mt *mtest.T) []bson.D { return nil }, repository.ErrBookmarkFolderName},
+		{"a name too long", strings.Repeat("a", repository.MaxBookmarkFolderNameLen+1), func(mt *mtest.T) []bson.D { return nil }, repository.ErrBookmarkFolderName},
+		{
+			name:   "one folder too many",
+			folder: "exams",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{document(mt.T, "db.bookmark_folders", bson.M{"n": repository.MaxBookmarkFolders})}
+			},
+			want: repository.ErrTooManyBookmarkFolders,
+		},
+		{
+			name:   "a name taken in another case",
+			folder: "Exams",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{
+					document(mt.T, "db.bookmark_folders", bson.M{"n": 1}),
+					mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key error"}),
+				}
+			},
+			want: repository.ErrBookmarkFolderExists,
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses(mt)...)
+			bookmarks := repository.NewBookmarkRepository(mt.DB)
+
+			if _, err := bookmarks.CreateFolder(context.Background(), models.BookmarkFolders{UserID: user, Name: tt.folder}); err != tt.want {
+				mt.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	mt.Run("the name is saved without extra spaces", func(mt *mtest.T) {
+		mt.AddMockResponses(noDocument("db.bookmark_folders"), mtest.CreateSuccessResponse())
+		bookmarks := repository.NewBookmarkRepository(mt.DB)
+
+		folder, err := bookmarks.CreateFolder(context.Background(), models.BookmarkFolders{UserID: user, Name: "  exam   prep "})
+		if err != nil || folder.Name != "exam prep" {
+			mt.Fatalf("expected the name to be cleaned, got %q %v", folder.Name, err)
+		}
+	})
+
+	mt.Run("deleting a folder keeps its bookmarks", func(mt *mtest.T) {
+		folder := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: int32(1)}), updated(2))
+		bookmarks := repository.NewBookmarkRepository(mt.DB)
+
+		if err := bookmarks.DeleteFolder(context.Background(), user, folder); err != nil {
+			mt.Fatal(err)
+		}
+		updates := sentUpdates(mt)
+		if len(updates) != 1 {
+			mt.Fatalf("expected the bookmarks to be updated, got %v", updates)
+		}
+		if id, ok := updates[0].Lookup("q", "folder_id").ObjectIDOK(); !ok || id != folder {
+			mt.Fatalf("expected the bookmarks of the folder, got %s", updates[0])
+		}
+		if _, err := updates[0].LookupErr("u", "$unset", "folder_id"); err != nil {
+			mt.Fatalf("expected the bookmarks to be kept without a folder, got %s", updates[0])
+		}
+	})
+}
+
+func TestBookmarksRemovedWithTheirTarget(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("deleting a job removes its bookmarks", func(mt *mtest.T) {
+		job := primitive.NewObjectID()
+		deleted := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: int32(1)})
+		mt.AddMockResponses(deleted, deleted)
+		jobs := repository.NewJobRepository(mt.DB, nil, nil)
+
+		if err := jobs.DeleteJob(context.Background(), job); err != nil {
+			mt.Fatal(err)
+		}
+		started := mt.GetAllStartedEvents()
+		if len(started) != 2 || started[1].Command.Lookup("delete").StringValue() != "bookmarks" {
+			mt.Fatalf("expected the bookmarks to be deleted, got %v", started)
+		}
+		filter := started[1].Command.Lookup("deletes", "0", "q").Document()
+		if targetType := filter.Lookup("target_type").StringValue(); targetType != constants.BookmarkTypeJob {
+			mt.Fatalf("expected the job bookmarks, got %s", filter)
+		}
+		ids, err := filter.Lookup("target_id", "$in").Array().Values()
+		if err != nil || len(ids) != 1 || ids[0].ObjectID() != job {
+			mt.Fatalf("expected the bookmarks of the job, got %s", filter)
+		}
+	})
+}
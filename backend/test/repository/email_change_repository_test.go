@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/hashing"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// updatesOf returns the update statements the repository sent to a collection, in order
+func updatesOf(mt *mtest.T, collection string) []bson.Raw {
+	var updates []bson.Raw
+	for _, event := range mt.GetAllStartedEvents() {
+		if event.CommandName != "update" || event.Command.Lookup("update").StringValue() != collection {
+			continue
+		}
+		values, _ := event.Command.Lookup("updates").Array().Values()
+		for _, value := range values {
+			updates = append(updates, value.Document())
+		}
+	}
+	return updates
+}
+
+func TestRevertEmailChange(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const token = "revert-token"
+	userID := primitive.NewObjectID()
+	change := models.EmailChanges{
+		ID:              primitive.NewObjectID(),
+		UserID:          userID,
+		OldEmail:        "owner@uni.edu",
+		NewEmail:        "attacker@uni.edu",
+		RevertTokenHash: hashing.HashToken(token),
+		Status:          constants.EmailChangeStatusConfirmed,
+		RevertExpiresAt: time.Now().Add(time.Hour),
+		CreatedAt:       time.Now().Add(-time.Hour),
+	}
+	found := func(t *testing.T) bson.D {
+		raw, err := bson.Marshal(change)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.Raw(raw)})
+	}
+	deleted := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: int32(0)})
+
+	tests := []struct {
+		name    string
+		restore bson.D
+		err     error
+	}{
+		{"old email is restored", updated(1), nil},
+		{"old email taken since the change", mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "duplicate key"}), repository.ErrEmailTaken},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(
+				found(mt.T),
+				updated(0), // pending changes replaced
+				updated(1), // password reset required
+				deleted,    // password resets
+				deleted,    // identities linked since the request
+				updated(1), // sessions
+				updated(1), // access tokens
+				tt.restore,
+			)
+			changes := repository.NewEmailChangeRepository(mt.DB, nil, repository.NewSessionRepository(mt.DB), repository.NewAccessTokenRepository(mt.DB))
+
+			if _, err := changes.RevertEmailChange(context.Background(), token); err != tt.err {
+				mt.Fatalf("expected %v, got %v", tt.err, err)
+			}
+
+			users := updatesOf(mt, "users")
+			if len(users) != 2 || !users[0].Lookup("u", "$set", "password_reset_required").Boolean() {
+				mt.Fatalf("expected a password reset to be required before the email is restored, got %v", users)
+			}
+			if users[1].Lookup("u", "$set", "email").StringValue() != change.OldEmail {
+				mt.Fatalf("expected the old email to be restored, got %s", users[1])
+			}
+			if sessions := updatesOf(mt, "sessions"); len(sessions) != 1 || !sessions[0].Lookup("u", "$set", "revoked").Boolean() {
+				mt.Fatalf("expected the sessions to be revoked, got %v", sessions)
+			}
+			if tokens := updatesOf(mt, "access_tokens"); len(tokens) != 1 {
+				mt.Fatalf("expected the access tokens to be revoked, got %v", tokens)
+			}
+		})
+	}
+}
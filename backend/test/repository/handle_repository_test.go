@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestValidateHandle(t *testing.T) {
+	tests := []struct {
+		handle string
+		err    error
+	}{
+		{"alice", nil},
+		{"Alice_99", nil},
+		{"abc", nil},
+		{"a" + strings.Repeat("b", repository.MaxHandleLen-1), nil},
+		{"ab", repository.ErrInvalidHandle},
+		{"a" + strings.Repeat("b", repository.MaxHandleLen), repository.ErrInvalidHandle},
+		{"", repository.ErrInvalidHandle},
+		{"1alice", repository.ErrInvalidHandle},
+		{"_alice", repository.ErrInvalidHandle},
+		{"alice.b", repository.ErrInvalidHandle},
+		{"alice b", repository.ErrInvalidHandle},
+		{"ålice", repository.ErrInvalidHandle},
+		{"admin", repository.ErrHandleReserved},
+		{"Admin", repository.ErrHandleReserved},
+		{"ADMIN", repository.ErrHandleReserved},
+		{"SuperAdmin", repository.ErrHandleReserved},
+		{"Settings", repository.ErrHandleReserved},
+		{"iknow", repository.ErrHandleReserved},
+		{"IKnow_Team", repository.ErrHandleReserved},
+	}
+	for _, tt := range tests {
+		t.Run(tt.handle, func(t *testing.T) {
+			if err := repository.ValidateHandle(tt.handle); err != tt.err {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestChangeHandleLostRaceIsTaken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("lost race", func(mt *mtest.T) {
+		userID := primitive.NewObjectID()
+		mt.AddMockResponses(
+			document(mt.T, "db.users", models.User{ID: userID, Handle: "alice"}),
+			noDocument("db.handle_history"),
+			updated(0),
+		)
+		handles := repository.NewHandleRepository(mt.DB)
+
+		if _, err := handles.ChangeHandle(context.Background(), userID, "alice_b"); err != repository.ErrHandleTaken {
+			mt.Fatalf("expected the handle to be taken, got %v", err)
+		}
+		if updates := sentUpdates(mt); len(updates) != 1 || updates[0].Lookup("q", "handle").StringValue() != "alice" {
+			mt.Fatalf("expected the change to match the handle it read, got %v", updates)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetInvitationsScope(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	university, school, department := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	tests := []struct {
+		name   string
+		scope  models.AccessScope
+		fields []string
+	}{
+		{"department grant", models.AccessScope{DepartmentIDs: []primitive.ObjectID{department}}, []string{"department_id"}},
+		{"school grant also sees the school invitations", models.AccessScope{SchoolIDs: []primitive.ObjectID{school}, DepartmentIDs: []primitive.ObjectID{department}}, []string{"department_id", "school_id"}},
+		{"university grant also sees the university invitations", models.AccessScope{UniversityIDs: []primitive.ObjectID{university}, SchoolIDs: []primitive.ObjectID{school}, DepartmentIDs: []primitive.ObjectID{department}}, []string{"department_id", "school_id", "university_id"}},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(noDocument("db.invitations"))
+			invitations := repository.NewInvitationRepository(mt.DB, nil, nil)
+
+			if _, err := invitations.GetInvitations(context.Background(), 1, tt.scope); err != nil {
+				mt.Fatal(err)
+			}
+
+			started := mt.GetStartedEvent()
+			values, err := started.Command.Lookup("filter", "$or").Array().Values()
+			if err != nil || len(values) != len(tt.fields) {
+				mt.Fatalf("expected %d scope clauses, got %s", len(tt.fields), started.Command.Lookup("filter"))
+			}
+			for i, field := range tt.fields {
+				if _, err := values[i].Document().LookupErr(field); err != nil {
+					mt.Fatalf("expected clause %d on %s, got %s", i, field, values[i])
+				}
+			}
+		})
+	}
+
+	mt.Run("empty scope sees nothing", func(mt *mtest.T) {
+		invitations := repository.NewInvitationRepository(mt.DB, nil, nil)
+
+		found, err := invitations.GetInvitations(context.Background(), 1, models.AccessScope{})
+		if err != nil || len(found) != 0 {
+			mt.Fatalf("expected no invitations, got %v %v", found, err)
+		}
+		if started := mt.GetAllStartedEvents(); len(started) != 0 {
+			mt.Fatalf("expected no query, got %v", started)
+		}
+	})
+}
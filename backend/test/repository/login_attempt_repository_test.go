@@ -0,0 +1,343 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/repository"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// fakeRedis speaks just enough RESP for the login attempt counters, keys expire like in redis
+type fakeRedis struct {
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+func startFakeRedis(t *testing.T) goredis.UniversalClient {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	store := &fakeRedis{values: map[string]string{}, expires: map[string]time.Time{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go store.serve(conn)
+		}
+	}()
+
+	client := goredis.NewClient(&goredis.Options{Addr: listener.Addr().String(), Protocol: 2, DisableIndentity: true})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	var queued [][]string
+	inMulti := false
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		switch strings.ToUpper(args[0]) {
+		case "MULTI":
+			inMulti = true
+			conn.Write([]byte("+OK\r\n"))
+		case "EXEC":
+			reply := fmt.Sprintf("*%d\r\n", len(queued))
+			for _, queuedArgs := range queued {
+				reply += f.exec(queuedArgs)
+			}
+			queued, inMulti = nil, false
+			conn.Write([]byte(reply))
+		default:
+			if inMulti {
+				queued = append(queued, args)
+				conn.Write([]byte("+QUEUED\r\n"))
+				continue
+			}
+			conn.Write([]byte(f.exec(args)))
+		}
+	}
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, at := range f.expires {
+		if time.Now().After(at) {
+			delete(f.values, key)
+			delete(f.expires, key)
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "INCR":
+		n, _ := strconv.ParseInt(f.values[args[1]], 10, 64)
+		n++
+		f.values[args[1]] = strconv.FormatInt(n, 10)
+		return fmt.Sprintf(":%d\r\n", n)
+	case "EXPIRE":
+		_, exists := f.values[args[1]]
+		_, hasTTL := f.expires[args[1]]
+		if !exists || (len(args) > 3 && strings.ToUpper(args[3]) == "NX" && hasTTL) {
+			return ":0\r\n"
+		}
+		seconds, _ := strconv.Atoi(args[2])
+		f.expires[args[1]] = time.Now().Add(time.Duration(seconds) * time.Second)
+		return ":1\r\n"
+	case "SET":
+		f.values[args[1]] = args[2]
+		delete(f.expires, args[1])
+		if len(args) > 4 {
+			n, _ := strconv.Atoi(args[4])
+			unit := time.Second
+			if strings.ToUpper(args[3]) == "PX" {
+				unit = time.Millisecond
+			}
+			f.expires[args[1]] = time.Now().Add(time.Duration(n) * unit)
+		}
+		return "+OK\r\n"
+	case "PTTL":
+		if _, exists := f.values[args[1]]; !exists {
+			return ":-2\r\n"
+		}
+		at, hasTTL := f.expires[args[1]]
+		if !hasTTL {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", time.Until(at).Milliseconds()+1)
+	case "GETDEL":
+		value, exists := f.values[args[1]]
+		if !exists {
+			return "$-1\r\n"
+		}
+		delete(f.values, args[1])
+		delete(f.expires, args[1])
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, exists := f.values[key]; exists {
+				deleted++
+			}
+			delete(f.values, key)
+			delete(f.expires, key)
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, errors.New("expected an array")
+	}
+	count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func recordFailures(t *testing.T, attempts repository.LoginAttemptRepository, account, ip string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := attempts.RecordFailure(context.Background(), account, ip); err != nil {
+			t.Fatalf("could not record failure: %v", err)
+		}
+	}
+}
+
+func throttled(err error) *repository.ThrottledError {
+	var throttle *repository.ThrottledError
+	errors.As(err, &throttle)
+	return throttle
+}
+
+func TestLoginDelayedAfterFailures(t *testing.T) {
+	attempts := repository.NewLoginAttemptRepository(startFakeRedis(t))
+	ctx := context.Background()
+
+	recordFailures(t, attempts, "alice@example.com", "10.0.0.1", repository.LoginDelayAfter-1)
+	if err := attempts.CheckLogin(ctx, "alice@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("expected no delay before %d failures, got %v", repository.LoginDelayAfter, err)
+	}
+
+	recordFailures(t, attempts, "alice@example.com", "10.0.0.1", 1)
+	throttle := throttled(attempts.CheckLogin(ctx, "ALICE@example.com ", "10.0.0.2"))
+	if throttle == nil || throttle.Locked || throttle.RetryAfter <= 0 {
+		t.Fatalf("expected the account to be delayed, got %+v", throttle)
+	}
+	if err := attempts.CheckLogin(ctx, "bob@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("the delay of one account must not slow down another, got %v", err)
+	}
+}
+
+func TestAccountLockedAtThreshold(t *testing.T) {
+	attempts := repository.NewLoginAttemptRepository(startFakeRedis(t))
+	ctx := context.Background()
+
+	recordFailures(t, attempts, "alice@example.com", "10.0.0.1", repository.AccountLockThreshold-1)
+	failure, err := attempts.RecordFailure(ctx, "alice@example.com", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !failure.AccountLocked || failure.AccountFailures != repository.AccountLockThreshold {
+		t.Fatalf("expected the account to lock at %d failures, got %+v", repository.AccountLockThreshold, failure)
+	}
+	if throttle := throttled(attempts.CheckLogin(ctx, "alice@example.com", "10.0.0.9")); throttle == nil || !throttle.Locked {
+		t.Fatalf("expected the account to be locked from any ip, got %+v", throttle)
+	}
+
+	// only the failure that crosses the threshold reports the lock, one email is sent
+	failure, err = attempts.RecordFailure(ctx, "alice@example.com", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failure.AccountLocked {
+		t.Fatal("expected the lock to be reported once")
+	}
+
+	token, err := attempts.CreateUnlockToken(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := attempts.Unlock(ctx, token)
+	if err != nil || account != "alice@example.com" {
+		t.Fatalf("expected the account to be unlocked, got %q %v", account, err)
+	}
+	if err := attempts.CheckLogin(ctx, "alice@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("expected no lock or delay after unlocking, got %v", err)
+	}
+	if _, err := attempts.Unlock(ctx, token); err != repository.ErrInvalidUnlockToken {
+		t.Fatalf("expected the unlock token to work once, got %v", err)
+	}
+}
+
+func TestIPBlockedAtThreshold(t *testing.T) {
+	attempts := repository.NewLoginAttemptRepository(startFakeRedis(t))
+	ctx := context.Background()
+
+	for i := 1; i <= repository.IPBlockThreshold; i++ {
+		// a new account every time, so no account gets locked on the way
+		failure, err := attempts.RecordFailure(ctx, fmt.Sprintf("user%d@example.com", i), "10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failure.IPBlocked != (i == repository.IPBlockThreshold) {
+			t.Fatalf("failure %d: unexpected ip block %+v", i, failure)
+		}
+	}
+	if throttle := throttled(attempts.CheckLogin(ctx, "new@example.com", "10.0.0.1")); throttle == nil || throttle.Locked {
+		t.Fatalf("expected the ip to be blocked, got %+v", throttle)
+	}
+	if err := attempts.CheckLogin(ctx, "new@example.com", "10.0.0.2"); err != nil {
+		t.Fatalf("expected other ips to be let through, got %v", err)
+	}
+}
+
+func TestFailureWithoutAccountOnlyCountsIP(t *testing.T) {
+	attempts := repository.NewLoginAttemptRepository(startFakeRedis(t))
+
+	for i := 0; i < repository.AccountLockThreshold; i++ {
+		failure, err := attempts.RecordFailure(context.Background(), "", "10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failure.AccountLocked || failure.AccountFailures != 0 || failure.IPFailures != int64(i+1) {
+			t.Fatalf("failure %d: expected only the ip to be counted, got %+v", i+1, failure)
+		}
+	}
+	if err := attempts.CheckLogin(context.Background(), "", "10.0.0.1"); err != nil {
+		t.Fatalf("expected no delay without an account, got %v", err)
+	}
+}
+
+func TestVerificationResendLimited(t *testing.T) {
+	attempts := repository.NewLoginAttemptRepository(startFakeRedis(t))
+	ctx := context.Background()
+
+	for i := 0; i < repository.VerificationResendPerAccount; i++ {
+		if err := attempts.CheckVerificationResend(ctx, "alice@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("resend %d: expected to be let through, got %v", i+1, err)
+		}
+	}
+	throttle := throttled(attempts.CheckVerificationResend(ctx, "Alice@example.com", "10.0.0.2"))
+	if throttle == nil || throttle.Locked || throttle.RetryAfter <= 0 || throttle.RetryAfter > repository.VerificationResendWindow {
+		t.Fatalf("expected the account to wait for the window, got %+v", throttle)
+	}
+	if err := attempts.CheckVerificationResend(ctx, "bob@example.com", "10.0.0.2"); err != nil {
+		t.Fatalf("the limit of one account must not stop another, got %v", err)
+	}
+}
+
+func TestVerificationResendLimitedPerIP(t *testing.T) {
+	attempts := repository.NewLoginAttemptRepository(startFakeRedis(t))
+	ctx := context.Background()
+
+	for i := 1; i <= repository.VerificationResendPerIP; i++ {
+		// a new account every time, so only the ip reaches its limit
+		if err := attempts.CheckVerificationResend(ctx, fmt.Sprintf("user%d@example.com", i), "10.0.0.1"); err != nil {
+			t.Fatalf("resend %d: expected to be let through, got %v", i, err)
+		}
+	}
+	if throttle := throttled(attempts.CheckVerificationResend(ctx, "new@example.com", "10.0.0.1")); throttle == nil {
+		t.Fatal("expected the ip to be limited")
+	}
+	if err := attempts.CheckVerificationResend(ctx, "other@example.com", "10.0.0.2"); err != nil {
+		t.Fatalf("expected other ips to be let through, got %v", err)
+	}
+}
+
+func TestMagicLinkLimited(t *testing.T) {
+	attempts := repository.NewLoginAttemptRepository(startFakeRedis(t))
+	ctx := context.Background()
+
+	for i := 0; i < repository.MagicLinkPerAccount; i++ {
+		if err := attempts.CheckMagicLink(ctx, "alice@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("link %d: expected to be let through, got %v", i+1, err)
+		}
+	}
+	throttle := throttled(attempts.CheckMagicLink(ctx, "alice@example.com", "10.0.0.2"))
+	if throttle == nil || throttle.RetryAfter <= 0 || throttle.RetryAfter > repository.MagicLinkWindow {
+		t.Fatalf("expected the account to wait for the window, got %+v", throttle)
+	}
+	// the login links are counted apart from the verification emails
+	if err := attempts.CheckVerificationResend(ctx, "alice@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("expected the verification emails to be let through, got %v", err)
+	}
+}
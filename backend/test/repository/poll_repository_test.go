@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// pollOptions makes options with votes already on them, a new poll must reset them
+func pollOptions(texts ...string) []models.PollOptions {
+	options := make([]models.PollOptions, 0, len(texts))
+	for _, text := range texts {
+		options = append(options, models.PollOptions{Text: text, Votes: 7})
+	}
+	return options
+}
+
+func TestCreatePostPoll(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name string
+		poll models.Polls
+		want error
+	}{
+		{"a single option", models.Polls{Question: "lunch?", Options: pollOptions("yes")}, repository.ErrInvalidPoll},
+		{"the same option twice", models.Polls{Question: "lunch?", Options: pollOptions("Yes", " yes ")}, repository.ErrInvalidPoll},
+		{"an empty option", models.Polls{Question: "lunch?", Options: pollOptions("yes", "  ")}, repository.ErrInvalidPoll},
+		{"no question", models.Polls{Question: " ", Options: pollOptions("yes", "no")}, repository.ErrInvalidPoll},
+		{"closed already", models.Polls{Question: "lunch?", Options: pollOptions("yes", "no"), ClosesAt: &past}, repository.ErrPollClosingTime},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+			post := models.Posts{UserID: primitive.NewObjectID(), Status: constants.PostStatusDraft, Poll: &tt.poll}
+			if _, err := posts.CreatePost(context.Background(), post); err != tt.want {
+				mt.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			if started := mt.GetAllStartedEvents(); len(started) != 0 {
+				mt.Fatalf("expected no post to be saved, got %v", started)
+			}
+		})
+	}
+
+	mt.Run("the options are trimmed and the tallies start at zero", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		poll := models.Polls{Question: " lunch? ", Options: pollOptions(" yes", "no "), Voters: 3}
+		created, err := posts.CreatePost(context.Background(), models.Posts{UserID: primitive.NewObjectID(), Status: constants.PostStatusDraft, Poll: &poll})
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if created.Poll.Question != "lunch?" || created.Poll.Options[0].Text != "yes" || created.Poll.Options[1].Text != "no" {
+			mt.Fatalf("expected the poll to be trimmed, got %+v", created.Poll)
+		}
+		if created.Poll.Voters != 0 || created.Poll.Options[0].Votes != 0 || created.Poll.Options[1].Votes != 0 {
+			mt.Fatalf("expected no votes yet, got %+v", created.Poll)
+		}
+	})
+}
+
+func TestVote(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	voter := primitive.NewObjectID()
+	single := models.Posts{ID: primitive.NewObjectID(), IsValidated: true, Poll: &models.Polls{Question: "lunch?", Options: pollOptions("yes", "no", "later")}}
+	closesAt := time.Now().Add(-time.Minute)
+	closed := single
+	closed.Poll = &models.Polls{Question: "lunch?", Options: pollOptions("yes", "no"), ClosesAt: &closesAt}
+
+	tests := []struct {
+		name    string
+		post    models.Posts
+		choices []int
+		want    error
+	}{
+		{"no choice", single, nil, repository.ErrInvalidPollVote},
+		{"two choices on a single choice poll", single, []int{0, 1}, repository.ErrInvalidPollVote},
+		{"an option that does not exist", single, []int{3}, repository.ErrInvalidPollVote},
+		{"a closed poll", closed, []int{0}, repository.ErrPollClosed},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(document(mt.T, "db.posts", tt.post))
+			polls := repository.NewPollRepository(mt.DB)
+
+			if _, err := polls.Vote(context.Background(), tt.post.ID, voter, tt.choices); err != tt.want {
+				mt.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			for _, event := range mt.GetAllStartedEvents() {
+				if event.CommandName == "insert" {
+					mt.Fatalf("expected no vote to be saved, got %s", event.Command)
+				}
+			}
+		})
+	}
+
+	mt.Run("a poll of a hidden post can not be voted on", func(mt *mtest.T) {
+		mt.AddMockResponses(noDocument("db.posts"))
+		polls := repository.NewPollRepository(mt.DB)
+
+		if _, err := polls.Vote(context.Background(), single.ID, voter, []int{0}); err != repository.ErrPollNotFound {
+			mt.Fatalf("expected the poll not to be found, got %v", err)
+		}
+		if validated, ok := findFilter(mt, "posts").Lookup("is_validated").BooleanOK(); !ok || !validated {
+			mt.Fatalf("expected only validated posts, got %s", findFilter(mt, "posts"))
+		}
+	})
+
+	mt.Run("the vote is counted", func(mt *mtest.T) {
+		tallied := *single.Poll
+		tallied.Voters = 1
+		mt.AddMockResponses(
+			document(mt.T, "db.posts", single),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: models.Posts{ID: single.ID, Poll: &tallied}}),
+		)
+		polls := repository.NewPollRepository(mt.DB)
+
+		poll, err := polls.Vote(context.Background(), single.ID, voter, []int{1})
+		if err != nil || poll.Voters != 1 {
+			mt.Fatalf("expected the new tallies, got %+v %v", poll, err)
+		}
+		started := mt.GetAllStartedEvents()
+		increments := started[len(started)-1].Command.Lookup("update", "$inc").Document()
+		if increments.Lookup("poll.voters").Int32() != 1 || increments.Lookup("poll.options.1.votes").Int32() != 1 {
+			mt.Fatalf("expected the voter and the option to be counted, got %s", increments)
+		}
+		if _, err := increments.LookupErr("poll.options.0.votes"); err == nil {
+			mt.Fatalf("expected only the chosen option to be counted, got %s", increments)
+		}
+	})
+
+	mt.Run("a second vote is refused", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			document(mt.T, "db.posts", single),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key error"}),
+		)
+		polls := repository.NewPollRepository(mt.DB)
+
+		if _, err := polls.Vote(context.Background(), single.ID, voter, []int{0}); err != repository.ErrAlreadyVoted {
+			mt.Fatalf("expected the vote to be refused, got %v", err)
+		}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "findAndModify" {
+				mt.Fatalf("expected the tallies to be left alone, got %s", event.Command)
+			}
+		}
+	})
+}
+
+func TestGetPollVotesAnonymous(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("the voters of an anonymous poll are not shown", func(mt *mtest.T) {
+		post := models.Posts{ID: primitive.NewObjectID(), Poll: &models.Polls{Question: "lunch?", Options: pollOptions("yes", "no"), Anonymous: true}}
+		mt.AddMockResponses(document(mt.T, "db.posts", post))
+		polls := repository.NewPollRepository(mt.DB)
+
+		if _, err := polls.GetPollVotes(context.Background(), post.ID); err != repository.ErrPollAnonymous {
+			mt.Fatalf("expected the votes to be hidden, got %v", err)
+		}
+		if started := mt.GetAllStartedEvents(); len(started) != 1 {
+			mt.Fatalf("expected no votes to be read, got %v", started)
+		}
+	})
+}
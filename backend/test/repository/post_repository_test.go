@@ -0,0 +1,614 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestDeletePost(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	post := models.Posts{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Content: "to be removed", IsValidated: true}
+
+	mt.Run("the owner's post is deleted and archived", func(mt *mtest.T) {
+		raw, err := bson.Marshal(post)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		deleted := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: int32(0)})
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.Raw(raw)}),
+			mtest.CreateSuccessResponse(), // revision archived
+			deleted,                       // poll votes
+			deleted,                       // bookmarks
+			mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A{}}), // plain reposts
+		)
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		if err := posts.DeletePost(context.Background(), post.UserID.Hex(), post.ID.Hex()); err != nil {
+			mt.Fatal(err)
+		}
+
+		started := mt.GetAllStartedEvents()
+		if len(started) == 0 || started[0].CommandName != "findAndModify" {
+			mt.Fatalf("expected the post to be looked up for deletion, got %v", started)
+		}
+		query := started[0].Command.Lookup("query")
+		if owner, ok := query.Document().Lookup("user_id").ObjectIDOK(); !ok || owner != post.UserID {
+			mt.Fatalf("expected the owner to be matched as an ObjectID, got %s", query)
+		}
+		if !started[0].Command.Lookup("remove").Boolean() {
+			mt.Fatalf("expected the post to be removed, got %s", started[0].Command)
+		}
+
+		var archived bool
+		for _, event := range started {
+			if event.CommandName == "insert" && event.Command.Lookup("insert").StringValue() == "post_revisions" {
+				archived = true
+			}
+		}
+		if !archived {
+			mt.Fatal("expected the removed post to be archived with its revisions")
+		}
+	})
+
+	mt.Run("an invalid user id is rejected", func(mt *mtest.T) {
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		if err := posts.DeletePost(context.Background(), "not-an-id", post.ID.Hex()); err == nil {
+			mt.Fatal("expected an invalid user id to fail")
+		}
+		if started := mt.GetAllStartedEvents(); len(started) != 0 {
+			mt.Fatalf("expected nothing to be deleted, got %v", started)
+		}
+	})
+}
+
+// findFilter returns the filter of the first find on the collection
+func findFilter(mt *mtest.T, collection string) bson.Raw {
+	mt.Helper()
+	for _, event := range mt.GetAllStartedEvents() {
+		if event.CommandName == "find" && event.Command.Lookup("find").StringValue() == collection {
+			return event.Command.Lookup("filter").Document()
+		}
+	}
+	mt.Fatalf("expected a find on %s", collection)
+	return nil
+}
+
+func TestGetPostsByUserIDHidesUnvalidatedPosts(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	author := primitive.NewObjectID()
+
+	mt.Run("other viewers only get validated posts", func(mt *mtest.T) {
+		viewer := models.UserView{ID: primitive.NewObjectID()}
+		mt.AddMockResponses(document(mt.T, "db.users", viewer), noDocument("db.connects"), noDocument("db.posts"))
+		posts := repository.NewPostRepository(mt.DB, nil, repository.NewConnectRepository(mt.DB), *repository.NewUserRepository(mt.DB), nil, nil)
+
+		if _, err := posts.GetPostsByUserID(context.Background(), author.Hex(), viewer.ID, 1); err != nil {
+			mt.Fatal(err)
+		}
+		if validated, ok := findFilter(mt, "posts").Lookup("is_validated").BooleanOK(); !ok || !validated {
+			mt.Fatalf("expected only validated posts, got %s", findFilter(mt, "posts"))
+		}
+	})
+
+	mt.Run("the author gets all their posts", func(mt *mtest.T) {
+		mt.AddMockResponses(noDocument("db.posts"))
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		if _, err := posts.GetPostsByUserID(context.Background(), author.Hex(), author, 1); err != nil {
+			mt.Fatal(err)
+		}
+		if _, err := findFilter(mt, "posts").LookupErr("is_validated"); err == nil {
+			mt.Fatalf("expected the author to see rejected posts too, got %s", findFilter(mt, "posts"))
+		}
+	})
+}
+
+func TestSearchPostsHidesUnvalidatedPosts(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("only the viewer's own posts are found unvalidated", func(mt *mtest.T) {
+		viewer := models.UserView{ID: primitive.NewObjectID()}
+		mt.AddMockResponses(document(mt.T, "db.users", viewer), noDocument("db.connects"), noDocument("db.posts"))
+		posts := repository.NewPostRepository(mt.DB, nil, repository.NewConnectRepository(mt.DB), *repository.NewUserRepository(mt.DB), nil, nil)
+
+		if _, err := posts.SearchPosts(context.Background(), "exam", viewer.ID, 1); err != nil {
+			mt.Fatal(err)
+		}
+		filter := findFilter(mt, "posts")
+		clauses, err := filter.Lookup("$and").Array().Values()
+		if err != nil || len(clauses) != 2 {
+			mt.Fatalf("expected the audience and the validation clauses, got %s", filter)
+		}
+		either, err := clauses[1].Document().Lookup("$or").Array().Values()
+		if err != nil || len(either) != 2 {
+			mt.Fatalf("expected validated posts or the viewer's own, got %s", clauses[1])
+		}
+		if validated, ok := either[0].Document().Lookup("is_validated").BooleanOK(); !ok || !validated {
+			mt.Fatalf("expected validated posts, got %s", either[0])
+		}
+		if owner, ok := either[1].Document().Lookup("user_id").ObjectIDOK(); !ok || owner != viewer.ID {
+			mt.Fatalf("expected the viewer's own posts, got %s", either[1])
+		}
+	})
+}
+
+func TestCreatePostDepartmentAudience(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	university, school := primitive.NewObjectID(), primitive.NewObjectID()
+	ours, theirs := primitive.NewObjectID(), primitive.NewObjectID()
+	author := models.UserView{ID: primitive.NewObjectID(), UniversityID: &university}
+	distinct := func(ids ...interface{}) bson.D {
+		return mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A(ids)})
+	}
+
+	mt.Run("departments of another university are rejected", func(mt *mtest.T) {
+		mt.AddMockResponses(document(mt.T, "db.users", author), distinct(school), distinct(ours))
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		post := models.Posts{UserID: author.ID, Content: "exam moved", Audience: constants.PostAudienceDepartment, Departements: []string{ours.Hex(), theirs.Hex()}}
+		if _, err := posts.CreatePost(context.Background(), post); err != repository.ErrAudienceDepartments {
+			mt.Fatalf("expected the departments to be rejected, got %v", err)
+		}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "insert" {
+				mt.Fatalf("expected no post to be saved, got %s", event.Command)
+			}
+		}
+	})
+
+	mt.Run("an author without a university can not pick departments", func(mt *mtest.T) {
+		mt.AddMockResponses(document(mt.T, "db.users", models.UserView{ID: author.ID}))
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		post := models.Posts{UserID: author.ID, Content: "exam moved", Audience: constants.PostAudienceDepartment, Departements: []string{ours.Hex()}}
+		if _, err := posts.CreatePost(context.Background(), post); err != repository.ErrAudienceUnavailable {
+			mt.Fatalf("expected no audience, got %v", err)
+		}
+	})
+
+	mt.Run("departments of the author's university are kept once", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			document(mt.T, "db.users", author),
+			distinct(school),
+			distinct(ours),
+			mtest.CreateSuccessResponse(),
+		)
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		post := models.Posts{UserID: author.ID, Content: "exam moved", Audience: constants.PostAudienceDepartment, Status: constants.PostStatusDraft, Departements: []string{ours.Hex(), ours.Hex()}}
+		created, err := posts.CreatePost(context.Background(), post)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if len(created.AudienceIDs) != 1 || created.AudienceIDs[0] != ours {
+			mt.Fatalf("expected the department once, got %v", created.AudienceIDs)
+		}
+	})
+}
+
+func TestCreatePostDraft(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	author := primitive.NewObjectID()
+
+	mt.Run("a draft is saved without moderation", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		// no moderation is given, a draft that reached it would panic
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		publishAt := time.Now().Add(time.Hour)
+		post := models.Posts{UserID: author, Content: "club fair on friday", Status: constants.PostStatusDraft, PublishAt: &publishAt, IsValidated: true}
+		created, err := posts.CreatePost(context.Background(), post)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if created.Status != constants.PostStatusDraft || created.IsValidated || created.PublishAt != nil {
+			mt.Fatalf("expected an unvalidated draft without a publish time, got %+v", created)
+		}
+		inserted := mt.GetStartedEvent().Command.Lookup("documents", "0").Document()
+		if status := inserted.Lookup("status").StringValue(); status != constants.PostStatusDraft {
+			mt.Fatalf("expected a draft to be saved, got %s", inserted)
+		}
+	})
+
+	mt.Run("a publish time in the past is refused", func(mt *mtest.T) {
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		publishAt := time.Now().Add(-time.Minute)
+		post := models.Posts{UserID: author, Content: "club fair on friday", PublishAt: &publishAt}
+		if _, err := posts.CreatePost(context.Background(), post); err != repository.ErrPublishAtPast {
+			mt.Fatalf("expected the publish time to be refused, got %v", err)
+		}
+		if started := mt.GetAllStartedEvents(); len(started) != 0 {
+			mt.Fatalf("expected no post to be saved, got %v", started)
+		}
+	})
+}
+
+func TestGetDrafts(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("only the unpublished posts of the author are listed", func(mt *mtest.T) {
+		author := primitive.NewObjectID()
+		mt.AddMockResponses(noDocument("db.posts"))
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		if _, err := posts.GetDrafts(context.Background(), author, 1); err != nil {
+			mt.Fatal(err)
+		}
+		filter := findFilter(mt, "posts")
+		if owner, ok := filter.Lookup("user_id").ObjectIDOK(); !ok || owner != author {
+			mt.Fatalf("expected the drafts of the author, got %s", filter)
+		}
+		statuses, err := filter.Lookup("status", "$in").Array().Values()
+		if err != nil || len(statuses) != 2 || statuses[0].StringValue() != constants.PostStatusDraft || statuses[1].StringValue() != constants.PostStatusScheduled {
+			mt.Fatalf("expected drafts and scheduled posts, got %s", filter)
+		}
+	})
+}
+
+func TestSchedulePost(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	post := models.Posts{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Content: "club fair on friday", Status: constants.PostStatusPublished}
+	noMatch := mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil})
+
+	mt.Run("a time in the past is refused", func(mt *mtest.T) {
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		if _, err := posts.SchedulePost(context.Background(), post.UserID, post.ID, time.Now()); err != repository.ErrPublishAtPast {
+			mt.Fatalf("expected the publish time to be refused, got %v", err)
+		}
+		if started := mt.GetAllStartedEvents(); len(started) != 0 {
+			mt.Fatalf("expected the post to be left alone, got %v", started)
+		}
+	})
+
+	mt.Run("a published post can not be scheduled", func(mt *mtest.T) {
+		mt.AddMockResponses(noMatch, document(mt.T, "db.posts", post))
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		if _, err := posts.SchedulePost(context.Background(), post.UserID, post.ID, time.Now().Add(time.Hour)); err != repository.ErrPostNotDraft {
+			mt.Fatalf("expected the post not to be a draft, got %v", err)
+		}
+	})
+
+	mt.Run("a post of someone else is not found", func(mt *mtest.T) {
+		mt.AddMockResponses(noMatch, noDocument("db.posts"))
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		if _, err := posts.SchedulePost(context.Background(), primitive.NewObjectID(), post.ID, time.Now().Add(time.Hour)); err != mongo.ErrNoDocuments {
+			mt.Fatalf("expected the post not to be found, got %v", err)
+		}
+	})
+}
+
+func TestCancelSchedule(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	post := models.Posts{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Content: "club fair on friday", Status: constants.PostStatusDraft}
+
+	mt.Run("a scheduled post goes back to the drafts", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: post}))
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		draft, err := posts.CancelSchedule(context.Background(), post.UserID, post.ID)
+		if err != nil || draft.Status != constants.PostStatusDraft {
+			mt.Fatalf("expected a draft, got %s %v", draft.Status, err)
+		}
+		command := mt.GetStartedEvent().Command
+		if status := command.Lookup("query", "status").StringValue(); status != constants.PostStatusScheduled {
+			mt.Fatalf("expected only a scheduled post to be cancelled, got %s", command)
+		}
+		if _, err := command.LookupErr("update", "$unset", "publish_at"); err != nil {
+			mt.Fatalf("expected the publish time to be removed, got %s", command)
+		}
+	})
+
+	mt.Run("a draft is not scheduled", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}), document(mt.T, "db.posts", post))
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		if _, err := posts.CancelSchedule(context.Background(), post.UserID, post.ID); err != repository.ErrPostNotScheduled {
+			mt.Fatalf("expected the post not to be scheduled, got %v", err)
+		}
+	})
+}
+
+func TestPublishScheduledPost(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	publishAt := time.Now().Add(-time.Second).Truncate(time.Millisecond)
+	post := models.Posts{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Content: "club fair on friday", Status: constants.PostStatusScheduled, PublishAt: &publishAt}
+
+	mt.Run("the task moderates and publishes the post", func(mt *mtest.T) {
+		mt.AddMockResponses(document(mt.T, "db.posts", post), updated(1))
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), moderation{accept: true}, nil)
+
+		published, err := posts.PublishPost(context.Background(), post.ID, nil, &publishAt)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if published.Status != constants.PostStatusPublished || !published.IsValidated || published.PublishAt != nil {
+			mt.Fatalf("expected a validated published post, got %+v", published)
+		}
+		filter := findFilter(mt, "posts")
+		if at, ok := filter.Lookup("publish_at").TimeOK(); !ok || !at.Equal(publishAt) {
+			mt.Fatalf("expected the post of the queued time, got %s", filter)
+		}
+		updates := sentUpdates(mt)
+		if len(updates) != 1 || updates[0].Lookup("u", "$set", "status").StringValue() != constants.PostStatusPublished {
+			mt.Fatalf("expected the post to be published, got %v", updates)
+		}
+	})
+
+	mt.Run("a task of a rescheduled post does nothing", func(mt *mtest.T) {
+		mt.AddMockResponses(noDocument("db.posts"))
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), moderation{accept: true}, nil)
+
+		if _, err := posts.PublishPost(context.Background(), post.ID, nil, &publishAt); err != repository.ErrPostNotScheduled {
+			mt.Fatalf("expected the post not to be scheduled for that time, got %v", err)
+		}
+		if updates := sentUpdates(mt); len(updates) != 0 {
+			mt.Fatalf("expected the post to be left alone, got %v", updates)
+		}
+	})
+
+	mt.Run("a post edited during moderation is a conflict", func(mt *mtest.T) {
+		mt.AddMockResponses(document(mt.T, "db.posts", post), updated(0))
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), moderation{accept: true}, nil)
+
+		if _, err := posts.PublishPost(context.Background(), post.ID, nil, &publishAt); err != repository.ErrPostEditConflict {
+			mt.Fatalf("expected an edit conflict, got %v", err)
+		}
+	})
+}
+
+// audienceClause returns the clause of the audience filter that lets the kind through
+func audienceClause(mt *mtest.T, audience bson.Raw, kind string) bson.Raw {
+	mt.Helper()
+	clauses, _ := audience.Lookup("$or").Array().Values()
+	for _, value := range clauses {
+		clause := value.Document()
+		if name, ok := clause.Lookup("audience").StringValueOK(); ok && name == kind {
+			return clause
+		}
+		in, _ := clause.Lookup("audience", "$in").ArrayOK()
+		names, _ := in.Values()
+		for _, name := range names {
+			if name.Type == bson.TypeString && name.StringValue() == kind {
+				return clause
+			}
+		}
+	}
+	mt.Fatalf("expected a clause for the %s audience, got %s", kind, audience)
+	return nil
+}
+
+// expectAudience checks each kind of audience lets through the posts the viewer is for
+func expectAudience(mt *mtest.T, audience bson.Raw, viewer models.UserView, connects []primitive.ObjectID) {
+	mt.Helper()
+	groups := []primitive.ObjectID{}
+	for _, id := range []*primitive.ObjectID{viewer.UniversityID, viewer.SchoolID, viewer.DepartmentID} {
+		if id != nil {
+			groups = append(groups, *id)
+		}
+	}
+
+	tests := []struct {
+		kind  string
+		field string
+		want  []primitive.ObjectID
+	}{
+		{constants.PostAudiencePublic, "", nil},
+		{constants.PostAudienceUniversity, "audience_ids", groups},
+		{constants.PostAudienceSchool, "audience_ids", groups},
+		{constants.PostAudienceDepartment, "audience_ids", groups},
+		{constants.PostAudienceConnections, "user_id", connects},
+	}
+	for _, tt := range tests {
+		clause := audienceClause(mt, audience, tt.kind)
+		if tt.field == "" {
+			continue
+		}
+		values, err := clause.Lookup(tt.field, "$in").Array().Values()
+		if err != nil || len(values) != len(tt.want) {
+			mt.Fatalf("expected the %s audience to match %v, got %s", tt.kind, tt.want, clause)
+		}
+		for i, value := range values {
+			if value.ObjectID() != tt.want[i] {
+				mt.Fatalf("expected the %s audience to match %v, got %s", tt.kind, tt.want, clause)
+			}
+		}
+	}
+
+	var authored bool
+	clauses, _ := audience.Lookup("$or").Array().Values()
+	for _, value := range clauses {
+		if id, ok := value.Document().Lookup("user_id").ObjectIDOK(); ok && id == viewer.ID {
+			authored = true
+		}
+	}
+	if !authored {
+		mt.Fatalf("expected the author to see their own posts, got %s", audience)
+	}
+}
+
+func TestPostAudienceForViewer(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	university, school, department := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	viewer := models.UserView{ID: primitive.NewObjectID(), UniversityID: &university, SchoolID: &school, DepartmentID: &department}
+	friend := primitive.NewObjectID()
+	connect := models.Connects{ID: primitive.NewObjectID(), ConnectorID: friend, ConnecteeID: viewer.ID, Accepted: true}
+
+	mt.Run("a post is shown by id to the viewers it is for", func(mt *mtest.T) {
+		post := primitive.NewObjectID()
+		mt.AddMockResponses(
+			document(mt.T, "db.users", viewer),
+			document(mt.T, "db.connects", connect),
+			mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A{}}),
+		)
+		posts := repository.NewPostRepository(mt.DB, nil, repository.NewConnectRepository(mt.DB), *repository.NewUserRepository(mt.DB), nil, nil)
+
+		visible, err := posts.GetVisiblePostIDs(context.Background(), viewer.ID, []primitive.ObjectID{post})
+		if err != nil || len(visible) != 0 {
+			mt.Fatalf("expected the hidden post to be left out, got %v %v", visible, err)
+		}
+
+		started := mt.GetAllStartedEvents()
+		filter := started[len(started)-1].Command.Lookup("query").Document()
+		either, err := filter.Lookup("$or").Array().Values()
+		if err != nil || len(either) != 2 {
+			mt.Fatalf("expected the author or the audience, got %s", filter)
+		}
+		if owner, ok := either[0].Document().Lookup("user_id").ObjectIDOK(); !ok || owner != viewer.ID {
+			mt.Fatalf("expected the author to see drafts and rejected posts, got %s", either[0])
+		}
+		shown := either[1].Document()
+		if validated, ok := shown.Lookup("is_validated").BooleanOK(); !ok || !validated {
+			mt.Fatalf("expected only validated posts for the others, got %s", shown)
+		}
+		expectAudience(mt, shown.Lookup("$and", "0").Document(), viewer, []primitive.ObjectID{friend})
+	})
+
+	mt.Run("the feed only has the posts the viewer is for", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			document(mt.T, "db.users", viewer),
+			document(mt.T, "db.connects", connect),
+			noDocument("db.post_likes"),
+			noDocument("db.posts"),
+			noDocument("db.posts"),
+		)
+		posts := repository.NewPostRepository(mt.DB, nil, repository.NewConnectRepository(mt.DB), *repository.NewUserRepository(mt.DB), nil, nil)
+
+		if _, err := posts.GetRecomendedPosts(context.Background(), viewer.ID.Hex(), 1); err != nil {
+			mt.Fatal(err)
+		}
+
+		started := mt.GetAllStartedEvents()
+		pipeline := started[len(started)-1].Command.Lookup("pipeline", "0", "$match").Document()
+		expectAudience(mt, pipeline.Lookup("$and", "1").Document(), viewer, []primitive.ObjectID{friend})
+	})
+
+	mt.Run("a viewer outside a university only gets public and connections posts", func(mt *mtest.T) {
+		outsider := models.UserView{ID: primitive.NewObjectID()}
+		mt.AddMockResponses(
+			document(mt.T, "db.users", outsider),
+			noDocument("db.connects"),
+			mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A{}}),
+		)
+		posts := repository.NewPostRepository(mt.DB, nil, repository.NewConnectRepository(mt.DB), *repository.NewUserRepository(mt.DB), nil, nil)
+
+		if _, err := posts.GetVisiblePostIDs(context.Background(), outsider.ID, []primitive.ObjectID{primitive.NewObjectID()}); err != nil {
+			mt.Fatal(err)
+		}
+		started := mt.GetAllStartedEvents()
+		filter := started[len(started)-1].Command.Lookup("query").Document()
+		expectAudience(mt, filter.Lookup("$or", "1", "$and", "0").Document(), outsider, []primitive.ObjectID{})
+	})
+}
+
+func TestCreatePostAudience(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	university, school, department := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	author := models.UserView{ID: primitive.NewObjectID(), UniversityID: &university, SchoolID: &school, DepartmentID: &department}
+
+	tests := []struct {
+		audience string
+		author   models.UserView
+		want     []primitive.ObjectID
+		err      error
+	}{
+		{constants.PostAudienceUniversity, author, []primitive.ObjectID{university}, nil},
+		{constants.PostAudienceSchool, author, []primitive.ObjectID{school}, nil},
+		{constants.PostAudienceDepartment, author, []primitive.ObjectID{department}, nil},
+		{constants.PostAudienceSchool, models.UserView{ID: author.ID, UniversityID: &university}, nil, repository.ErrAudienceUnavailable},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.audience, func(mt *mtest.T) {
+			mt.AddMockResponses(document(mt.T, "db.users", tt.author), mtest.CreateSuccessResponse())
+			posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+			post := models.Posts{UserID: author.ID, Content: "exam moved", Audience: tt.audience, Status: constants.PostStatusDraft}
+			created, err := posts.CreatePost(context.Background(), post)
+			if err != tt.err {
+				mt.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			if err == nil && (len(created.AudienceIDs) != 1 || created.AudienceIDs[0] != tt.want[0]) {
+				mt.Fatalf("expected the audience %v, got %v", tt.want, created.AudienceIDs)
+			}
+		})
+	}
+
+	mt.Run("public and connections posts keep no groups", func(mt *mtest.T) {
+		for _, audience := range []string{"", constants.PostAudienceConnections} {
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+			posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+			post := models.Posts{UserID: author.ID, Content: "exam moved", Audience: audience, Status: constants.PostStatusDraft}
+			created, err := posts.CreatePost(context.Background(), post)
+			if err != nil || len(created.AudienceIDs) != 0 || created.Audience == "" {
+				mt.Fatalf("expected an audience without groups, got %q %v %v", created.Audience, created.AudienceIDs, err)
+			}
+		}
+	})
+
+	mt.Run("an unknown audience is refused", func(mt *mtest.T) {
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		post := models.Posts{UserID: author.ID, Content: "exam moved", Audience: "friends"}
+		if _, err := posts.CreatePost(context.Background(), post); err != repository.ErrInvalidAudience {
+			mt.Fatalf("expected the audience to be refused, got %v", err)
+		}
+	})
+}
+
+func TestGetAudienceMembers(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	author, friend, stranger := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	mt.Run("only the connections hear of a connections post", func(mt *mtest.T) {
+		mt.AddMockResponses(document(mt.T, "db.connects", models.Connects{ID: primitive.NewObjectID(), ConnectorID: author, ConnecteeID: friend, Accepted: true}))
+		posts := repository.NewPostRepository(mt.DB, nil, repository.NewConnectRepository(mt.DB), *repository.NewUserRepository(mt.DB), nil, nil)
+
+		post := models.Posts{UserID: author, Audience: constants.PostAudienceConnections}
+		members, err := posts.GetAudienceMembers(context.Background(), post, []primitive.ObjectID{friend, stranger})
+		if err != nil || len(members) != 1 || members[0] != friend {
+			mt.Fatalf("expected only the connection, got %v %v", members, err)
+		}
+	})
+
+	mt.Run("only the department hears of a department post", func(mt *mtest.T) {
+		department := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A{friend}}))
+		posts := repository.NewPostRepository(mt.DB, nil, nil, *repository.NewUserRepository(mt.DB), nil, nil)
+
+		post := models.Posts{UserID: author, Audience: constants.PostAudienceDepartment, AudienceIDs: []primitive.ObjectID{department}}
+		if _, err := posts.GetAudienceMembers(context.Background(), post, []primitive.ObjectID{friend, stranger}); err != nil {
+			mt.Fatal(err)
+		}
+		query := mt.GetStartedEvent().Command.Lookup("query").Document()
+		ids, err := query.Lookup("$or", "0", "department_id", "$in").Array().Values()
+		if err != nil || len(ids) != 1 || ids[0].ObjectID() != department {
+			mt.Fatalf("expected the users of the department, got %s", query)
+		}
+	})
+}
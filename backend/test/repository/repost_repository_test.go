@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// moderation accepts or declines every post
+type moderation struct {
+	repository.GeminiRepository
+	accept bool
+}
+
+func (m moderation) EvaluatePost(ctx context.Context, post string) (bool, error) {
+	return m.accept, nil
+}
+
+func TestRepostCount(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	original := models.Posts{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Content: "original", IsValidated: true}
+
+	tests := []struct {
+		name    string
+		content string
+		accept  bool
+		counted bool
+	}{
+		{"plain repost counts", "", false, true},
+		{"quote that passed moderation counts", "well said", true, true},
+		{"quote the moderation declined does not count", "spam", false, false},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			responses := []bson.D{document(mt.T, "db.posts", original), mtest.CreateSuccessResponse()}
+			if tt.counted {
+				responses = append(responses, updated(1))
+			}
+			mt.AddMockResponses(responses...)
+			reposts := repository.NewRepostRepository(mt.DB, moderation{accept: tt.accept})
+
+			repost := models.Posts{UserID: primitive.NewObjectID(), RepostOf: &original.ID, Content: tt.content}
+			_, reposted, err := reposts.Repost(context.Background(), repost)
+			if err != nil {
+				mt.Fatal(err)
+			}
+
+			updates := sentUpdates(mt)
+			if !tt.counted {
+				if len(updates) != 0 || reposted.Reposts != 0 {
+					mt.Fatalf("expected the repost not to be counted, got %v", updates)
+				}
+				return
+			}
+			if len(updates) != 1 || updates[0].Lookup("u", "$inc", "reposts").Int32() != 1 || reposted.Reposts != 1 {
+				mt.Fatalf("expected the repost to be counted once, got %v", updates)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// distinct answers a distinct with the given ids
+func distinct(ids ...primitive.ObjectID) bson.D {
+	values := bson.A{}
+	for _, id := range ids {
+		values = append(values, id)
+	}
+	return mtest.CreateSuccessResponse(bson.E{Key: "values", Value: values})
+}
+
+func TestResolvePermission(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	userID := primitive.NewObjectID()
+	university := primitive.NewObjectID()
+	school, otherSchool := primitive.NewObjectID(), primitive.NewObjectID()
+	department, sibling, otherDepartment := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	verifier := models.Roles{Name: "verifier", Permissions: []string{string(constants.PermPostsVerify)}}
+
+	assignment := func(role string, universityID, schoolID, departmentID *primitive.ObjectID) models.RoleAssignments {
+		return models.RoleAssignments{
+			ID:           primitive.NewObjectID(),
+			UserID:       userID,
+			Role:         role,
+			UniversityID: universityID,
+			SchoolID:     schoolID,
+			DepartmentID: departmentID,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		responses func(mt *mtest.T) []bson.D
+		granted   bool
+		global    bool
+		allowed   []primitive.ObjectID
+		refused   []primitive.ObjectID
+	}{
+		{
+			name: "global role holds the permission",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{document(mt.T, "db.roles", bson.M{"n": 1})}
+			},
+			granted: true,
+			global:  true,
+		},
+		{
+			name: "department grant applies to that department only",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{
+					noDocument("db.roles"),
+					document(mt.T, "db.role_assignments", assignment("verifier", nil, nil, &department)),
+					document(mt.T, "db.roles", verifier),
+				}
+			},
+			granted: true,
+			allowed: []primitive.ObjectID{department},
+			refused: []primitive.ObjectID{sibling, otherDepartment},
+		},
+		{
+			name: "school grant expands to the departments of the school",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{
+					noDocument("db.roles"),
+					document(mt.T, "db.role_assignments", assignment("verifier", nil, &school, nil)),
+					document(mt.T, "db.roles", verifier),
+					distinct(department, sibling),
+				}
+			},
+			granted: true,
+			allowed: []primitive.ObjectID{department, sibling},
+			refused: []primitive.ObjectID{otherDepartment},
+		},
+		{
+			name: "university grant expands through its schools",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{
+					noDocument("db.roles"),
+					document(mt.T, "db.role_assignments", assignment("verifier", &university, nil, nil)),
+					document(mt.T, "db.roles", verifier),
+					distinct(school, otherSchool),
+					distinct(department, sibling, otherDepartment),
+				}
+			},
+			granted: true,
+			allowed: []primitive.ObjectID{department, sibling, otherDepartment},
+			refused: []primitive.ObjectID{primitive.NewObjectID()},
+		},
+		{
+			name: "grant of a role without the permission",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{
+					noDocument("db.roles"),
+					document(mt.T, "db.role_assignments", assignment("moderator", nil, nil, &department)),
+					noDocument("db.roles"),
+				}
+			},
+			refused: []primitive.ObjectID{department},
+		},
+		{
+			name: "unscoped grant is global",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{
+					noDocument("db.roles"),
+					document(mt.T, "db.role_assignments",
+						assignment("verifier", nil, nil, &department),
+						assignment("verifier", nil, nil, nil),
+					),
+					document(mt.T, "db.roles", verifier),
+				}
+			},
+			granted: true,
+			global:  true,
+		},
+		{
+			name: "no grants",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{noDocument("db.roles"), noDocument("db.role_assignments")}
+			},
+			refused: []primitive.ObjectID{department},
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses(mt)...)
+			roles := repository.NewRoleRepository(mt.DB)
+
+			scope, granted, err := roles.ResolvePermission(context.Background(), userID.Hex(), "student", constants.PermPostsVerify)
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if granted != tt.granted || scope.Global != tt.global {
+				mt.Fatalf("expected granted %t global %t, got %t %+v", tt.granted, tt.global, granted, scope)
+			}
+			for _, id := range tt.allowed {
+				if !scope.AllowsDepartment(id) {
+					mt.Fatalf("expected department %s in the scope %+v", id.Hex(), scope)
+				}
+			}
+			for _, id := range tt.refused {
+				if scope.AllowsDepartment(id) {
+					mt.Fatalf("expected department %s outside the scope %+v", id.Hex(), scope)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/hashing"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// noDocument answers a find with an empty cursor
+func noDocument(ns string) bson.D {
+	return mtest.CreateCursorResponse(0, ns, mtest.FirstBatch)
+}
+
+// document answers a find with the given documents
+func document(t *testing.T, ns string, values ...interface{}) bson.D {
+	t.Helper()
+	docs := make([]bson.D, 0, len(values))
+	for _, value := range values {
+		raw, err := bson.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc bson.D
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+	return mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, docs...)
+}
+
+func updated(n int32) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+}
+
+// sentUpdates returns the update statements the repository sent, in order
+func sentUpdates(mt *mtest.T) []bson.Raw {
+	var updates []bson.Raw
+	for _, event := range mt.GetAllStartedEvents() {
+		if event.CommandName != "update" {
+			continue
+		}
+		values, _ := event.Command.Lookup("updates").Array().Values()
+		for _, value := range values {
+			updates = append(updates, value.Document())
+		}
+	}
+	return updates
+}
+
+func TestRefreshSession(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	const token = "current-refresh-token"
+	sessionID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+	session := models.Sessions{
+		ID:           sessionID,
+		UserID:       userID,
+		RefreshToken: hashing.HashToken(token),
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}
+	revoked := session
+	revoked.Revoked = true
+	expired := session
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	impersonated := session
+	impersonated.ImpersonatorID = &userID
+	rotated := session
+	rotated.RefreshToken = hashing.HashToken("newer-refresh-token")
+	rotated.UsedRefreshTokens = []string{hashing.HashToken(token)}
+
+	tests := []struct {
+		name      string
+		responses func(mt *mtest.T) []bson.D
+		err       error
+		// the update the refresh must send to the session, nil when it sends none
+		update func(t *testing.T, update bson.Raw)
+	}{
+		{
+			name: "valid token is rotated",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{
+					document(mt.T, "db.sessions", session),
+					document(mt.T, "db.users", models.User{ID: userID, Role: "student"}),
+					updated(1),
+				}
+			},
+			update: func(t *testing.T, update bson.Raw) {
+				filter := update.Lookup("q", "refresh_token").StringValue()
+				pushed := update.Lookup("u", "$push", "used_refresh_tokens").StringValue()
+				if filter != hashing.HashToken(token) || pushed != hashing.HashToken(token) {
+					t.Fatalf("expected the old token to be matched and kept as used, got %s", update)
+				}
+				if update.Lookup("u", "$set", "refresh_token").StringValue() == hashing.HashToken(token) {
+					t.Fatal("expected a new refresh token")
+				}
+			},
+		},
+		{
+			name: "reused rotated token revokes the session family",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{
+					noDocument("db.sessions"),
+					document(mt.T, "db.sessions", rotated),
+					updated(1),
+				}
+			},
+			err: repository.ErrRefreshTokenReused,
+			update: func(t *testing.T, update bson.Raw) {
+				if update.Lookup("q", "_id").ObjectID() != sessionID || !update.Lookup("u", "$set", "revoked").Boolean() {
+					t.Fatalf("expected the session to be revoked, got %s", update)
+				}
+			},
+		},
+		{
+			name: "unknown token",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{noDocument("db.sessions"), noDocument("db.sessions")}
+			},
+			err: repository.ErrInvalidRefreshToken,
+		},
+		{
+			name: "revoked session",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{document(mt.T, "db.sessions", revoked)}
+			},
+			err: repository.ErrInvalidRefreshToken,
+		},
+		{
+			name: "expired session",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{document(mt.T, "db.sessions", expired)}
+			},
+			err: repository.ErrInvalidRefreshToken,
+		},
+		{
+			name: "impersonation session",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{document(mt.T, "db.sessions", impersonated)}
+			},
+			err: repository.ErrInvalidRefreshToken,
+		},
+		{
+			name: "concurrent refresh with the same token loses",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{
+					document(mt.T, "db.sessions", session),
+					document(mt.T, "db.users", models.User{ID: userID, Role: "student"}),
+					updated(0),
+				}
+			},
+			err: repository.ErrInvalidRefreshToken,
+			update: func(t *testing.T, update bson.Raw) {
+				if update.Lookup("q", "refresh_token").StringValue() != hashing.HashToken(token) {
+					t.Fatalf("expected the rotation to match the current token, got %s", update)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses(mt)...)
+			sessions := repository.NewSessionRepository(mt.DB)
+
+			tokens, err := sessions.RefreshSession(context.Background(), token, models.SessionDevice{Device: "test"})
+			if err != tt.err {
+				mt.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			if err == nil && (tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.RefreshToken == token) {
+				mt.Fatalf("expected new tokens, got %+v", tokens)
+			}
+
+			updates := sentUpdates(mt)
+			if tt.update == nil {
+				if len(updates) != 0 {
+					mt.Fatalf("expected the session to be left alone, got %v", updates)
+				}
+				return
+			}
+			if len(updates) != 1 {
+				mt.Fatalf("expected one update of the session, got %v", updates)
+			}
+			tt.update(mt.T, updates[0])
+		})
+	}
+}
+
+func TestIsSessionActiveUpdatesLastSeen(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	sessionID := primitive.NewObjectID()
+
+	tests := []struct {
+		name      string
+		responses func(mt *mtest.T) []bson.D
+		active    bool
+		touched   bool
+	}{
+		{
+			name: "a session seen a while ago is moved to now",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{
+					document(mt.T, "db.sessions", models.Sessions{ID: sessionID, LastSeenAt: time.Now().Add(-10 * time.Minute)}),
+					updated(1),
+				}
+			},
+			active:  true,
+			touched: true,
+		},
+		{
+			name: "a session seen just now is not written again",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{document(mt.T, "db.sessions", models.Sessions{ID: sessionID, LastSeenAt: time.Now()})}
+			},
+			active: true,
+		},
+		{
+			name: "a revoked or expired session is not active",
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{noDocument("db.sessions")}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses(mt)...)
+			sessions := repository.NewSessionRepository(mt.DB)
+
+			active, err := sessions.IsSessionActive(context.Background(), sessionID.Hex())
+			if err != nil || active != tt.active {
+				mt.Fatalf("expected active=%t, got %t %v", tt.active, active, err)
+			}
+			updates := sentUpdates(mt)
+			if touched := len(updates) == 1; touched != tt.touched || len(updates) > 1 {
+				mt.Fatalf("expected touched=%t, got %v", tt.touched, updates)
+			}
+			if tt.touched {
+				if _, err := updates[0].LookupErr("u", "$set", "last_seen_at"); err != nil {
+					mt.Fatalf("expected last_seen_at to be set, got %s", updates[0])
+				}
+			}
+		})
+	}
+}
+
+func TestRevokeUserSession(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	userID, sessionID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	mt.Run("the user's own session is revoked", func(mt *mtest.T) {
+		mt.AddMockResponses(updated(1))
+		sessions := repository.NewSessionRepository(mt.DB)
+
+		if err := sessions.RevokeUserSession(context.Background(), userID, sessionID); err != nil {
+			mt.Fatal(err)
+		}
+		updates := sentUpdates(mt)
+		if len(updates) != 1 {
+			mt.Fatalf("expected one update, got %v", updates)
+		}
+		if owner, ok := updates[0].Lookup("q", "user_id").ObjectIDOK(); !ok || owner != userID {
+			mt.Fatalf("expected only a session of the user to match, got %s", updates[0])
+		}
+		if !updates[0].Lookup("u", "$set", "revoked").Boolean() {
+			mt.Fatalf("expected the session to be revoked, got %s", updates[0])
+		}
+	})
+
+	mt.Run("a session of another user or already revoked is not found", func(mt *mtest.T) {
+		mt.AddMockResponses(updated(0))
+		sessions := repository.NewSessionRepository(mt.DB)
+
+		if err := sessions.RevokeUserSession(context.Background(), userID, sessionID); err != mongo.ErrNoDocuments {
+			mt.Fatalf("expected no session, got %v", err)
+		}
+	})
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	userID, current := primitive.NewObjectID(), primitive.NewObjectID()
+
+	mt.Run("log out other devices keeps the current session", func(mt *mtest.T) {
+		mt.AddMockResponses(updated(2))
+		sessions := repository.NewSessionRepository(mt.DB)
+
+		revoked, err := sessions.RevokeAllSessions(context.Background(), userID, current)
+		if err != nil || revoked != 2 {
+			mt.Fatalf("expected 2 sessions revoked, got %d %v", revoked, err)
+		}
+		update := sentUpdates(mt)[0]
+		if kept, ok := update.Lookup("q", "_id", "$ne").ObjectIDOK(); !ok || kept != current {
+			mt.Fatalf("expected the current session to be kept, got %s", update)
+		}
+	})
+
+	mt.Run("log out everywhere revokes every session", func(mt *mtest.T) {
+		mt.AddMockResponses(updated(3))
+		sessions := repository.NewSessionRepository(mt.DB)
+
+		if _, err := sessions.RevokeAllSessions(context.Background(), userID, primitive.NilObjectID); err != nil {
+			mt.Fatal(err)
+		}
+		update := sentUpdates(mt)[0]
+		if _, err := update.LookupErr("q", "_id"); err == nil {
+			mt.Fatalf("expected no session to be kept, got %s", update)
+		}
+		if owner, ok := update.Lookup("q", "user_id").ObjectIDOK(); !ok || owner != userID {
+			mt.Fatalf("expected only the sessions of the user, got %s", update)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/chera-mihiretu/IKnow/repository"
+)
+
+func TestTagExtractorCallsService(t *testing.T) {
+	var received map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/extract-tags" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		json.NewEncoder(w).Encode(map[string][]string{"tags": {"Machine Learning", "machine learning", " #Python "}})
+	}))
+	defer server.Close()
+
+	extractor := repository.NewTagExtractorRepository(server.URL, server.Client(), repository.NewLocalTagExtractor())
+	tags, err := extractor.ExtractTags(context.Background(), "Study group\nWe are learning python on friday")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received["title"] != "Study group" || received["body"] != "We are learning python on friday" {
+		t.Errorf("unexpected request %v", received)
+	}
+	if want := []string{"machine learning", "python"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("expected %v, got %v", want, tags)
+	}
+}
+
+func TestTagExtractorFallsBackWhenServiceFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	content := "Calculus exam tips: calculus practice and more calculus, the exam is on Monday"
+	local := repository.NewLocalTagExtractor()
+	want, err := local.ExtractTags(context.Background(), content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) == 0 || want[0] != "calculus" || want[1] != "exam" {
+		t.Fatalf("unexpected local tags %v", want)
+	}
+
+	extractor := repository.NewTagExtractorRepository(server.URL, server.Client(), local)
+	for i := 0; i < 3; i++ {
+		tags, err := extractor.ExtractTags(context.Background(), content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tags, want) {
+			t.Errorf("expected the local tags %v, got %v", want, tags)
+		}
+	}
+}
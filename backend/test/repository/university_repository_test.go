@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/validation"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetUniversityByEmail(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	aau := models.University{ID: primitive.NewObjectID(), Name: "AAU", EmailDomains: []string{"aau.edu.et"}}
+	students := models.University{ID: primitive.NewObjectID(), Name: "AAU students", EmailDomains: []string{"student.aau.edu.et"}}
+
+	mt.Run("a sub domain matches the most specific registered domain", func(mt *mtest.T) {
+		mt.AddMockResponses(document(mt.T, "db.universities", aau, students))
+		universities := repository.NewUniversityRepository(mt.DB)
+
+		university, err := universities.GetUniversityByEmail(context.Background(), "Alice@Student.AAU.edu.et")
+		if err != nil || university.ID != students.ID {
+			mt.Fatalf("expected %s, got %s %v", students.Name, university.Name, err)
+		}
+		candidates, _ := mt.GetStartedEvent().Command.Lookup("filter", "email_domains", "$in").Array().Values()
+		if len(candidates) != 4 || candidates[0].StringValue() != "student.aau.edu.et" {
+			mt.Fatalf("expected the domain and its parents, got %v", candidates)
+		}
+	})
+
+	mt.Run("a domain no university registered is not allowed", func(mt *mtest.T) {
+		mt.AddMockResponses(noDocument("db.universities"))
+		universities := repository.NewUniversityRepository(mt.DB)
+
+		if _, err := universities.GetUniversityByEmail(context.Background(), "alice@gmail.com"); err != repository.ErrEmailDomainNotAllowed {
+			mt.Fatalf("expected the domain to be refused, got %v", err)
+		}
+	})
+
+	mt.Run("an address without a domain is not allowed", func(mt *mtest.T) {
+		universities := repository.NewUniversityRepository(mt.DB)
+
+		if _, err := universities.GetUniversityByEmail(context.Background(), "alice"); err != repository.ErrEmailDomainNotAllowed {
+			mt.Fatalf("expected the address to be refused, got %v", err)
+		}
+	})
+}
+
+func TestRegisterUserWithEmailDomain(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("an address outside the registered domains can not sign up", func(mt *mtest.T) {
+		mt.AddMockResponses(noDocument("db.users"), noDocument("db.universities"))
+		auth := repository.NewAuthRepository(mt.DB, repository.NewUniversityRepository(mt.DB), nil, nil, nil)
+
+		err := auth.RegisterUserWithEmail(context.Background(), models.User{Email: "alice@gmail.com"})
+		if err != repository.ErrEmailDomainNotAllowed {
+			mt.Fatalf("expected the domain to be refused, got %v", err)
+		}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "insert" {
+				mt.Fatalf("expected no pending sign up, got %s", event.Command)
+			}
+		}
+	})
+}
+
+func TestEmailDomainAdministration(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	university := models.University{ID: primitive.NewObjectID(), Name: "AAU", EmailDomains: []string{"aau.edu.et"}}
+	afterUpdate := mtest.CreateSuccessResponse(bson.E{Key: "value", Value: university})
+
+	mt.Run("an admin adds a domain, normalized", func(mt *mtest.T) {
+		mt.AddMockResponses(noDocument("db.universities"), afterUpdate)
+		universities := repository.NewUniversityRepository(mt.DB)
+
+		if _, err := universities.AddEmailDomain(context.Background(), university.ID, " @AAU.edu.et "); err != nil {
+			mt.Fatal(err)
+		}
+		started := mt.GetAllStartedEvents()
+		last := started[len(started)-1]
+		if added := last.Command.Lookup("update", "$addToSet", "email_domains").StringValue(); added != "aau.edu.et" {
+			mt.Fatalf("expected the normalized domain to be added, got %s", last.Command)
+		}
+	})
+
+	mt.Run("a domain of another university can not be added", func(mt *mtest.T) {
+		mt.AddMockResponses(document(mt.T, "db.universities", bson.M{"n": 1}))
+		universities := repository.NewUniversityRepository(mt.DB)
+
+		if _, err := universities.AddEmailDomain(context.Background(), university.ID, "aau.edu.et"); err != repository.ErrEmailDomainTaken {
+			mt.Fatalf("expected the domain to be taken, got %v", err)
+		}
+	})
+
+	mt.Run("an invalid domain can not be added", func(mt *mtest.T) {
+		universities := repository.NewUniversityRepository(mt.DB)
+
+		if _, err := universities.AddEmailDomain(context.Background(), university.ID, "not a domain"); err != validation.ErrInvalidEmailDomain {
+			mt.Fatalf("expected the domain to be invalid, got %v", err)
+		}
+	})
+
+	mt.Run("an admin removes a domain", func(mt *mtest.T) {
+		mt.AddMockResponses(afterUpdate)
+		universities := repository.NewUniversityRepository(mt.DB)
+
+		if _, err := universities.RemoveEmailDomain(context.Background(), university.ID, "AAU.edu.et"); err != nil {
+			mt.Fatal(err)
+		}
+		if removed := mt.GetStartedEvent().Command.Lookup("update", "$pull", "email_domains").StringValue(); removed != "aau.edu.et" {
+			mt.Fatalf("expected the normalized domain to be removed, got %s", mt.GetStartedEvent().Command)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestUpdateMePlacement(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	university, other := primitive.NewObjectID(), primitive.NewObjectID()
+	school, department := primitive.NewObjectID(), primitive.NewObjectID()
+	me := models.UserView{ID: primitive.NewObjectID(), UniversityID: &university}
+
+	tests := []struct {
+		name      string
+		user      models.User
+		responses func(mt *mtest.T) []bson.D
+		want      error
+	}{
+		{
+			name:      "the university from the email domain can not be changed",
+			user:      models.User{ID: me.ID, UniversityID: &other, SchoolID: &school},
+			responses: func(mt *mtest.T) []bson.D { return nil },
+			want:      repository.ErrUniversityReadOnly,
+		},
+		{
+			name: "a school of another university is rejected",
+			user: models.User{ID: me.ID, UniversityID: &university, SchoolID: &school},
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{noDocument("db.schools")}
+			},
+			want: repository.ErrSchoolNotInUniversity,
+		},
+		{
+			name: "a department of another school is rejected",
+			user: models.User{ID: me.ID, UniversityID: &university, SchoolID: &school, DepartmentID: &department},
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{document(mt.T, "db.schools", bson.M{"n": 1}), noDocument("db.departments")}
+			},
+			want: repository.ErrDepartmentNotInSchool,
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(append([]bson.D{document(mt.T, "db.users", me)}, tt.responses(mt)...)...)
+			users := repository.NewUserRepository(mt.DB)
+
+			if _, err := users.UpdateMe(context.Background(), tt.user); err != tt.want {
+				mt.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			if updates := sentUpdates(mt); len(updates) != 0 {
+				mt.Fatalf("expected the user to be left alone, got %v", updates)
+			}
+		})
+	}
+
+	mt.Run("the school and the department of the university are kept", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			document(mt.T, "db.users", me),
+			document(mt.T, "db.schools", bson.M{"n": 1}),
+			document(mt.T, "db.departments", bson.M{"n": 1}),
+			updated(1),
+		)
+		users := repository.NewUserRepository(mt.DB)
+
+		user := models.User{ID: me.ID, UniversityID: &university, SchoolID: &school, DepartmentID: &department}
+		if _, err := users.UpdateMe(context.Background(), user); err != nil {
+			mt.Fatal(err)
+		}
+
+		updates := sentUpdates(mt)
+		if len(updates) != 1 {
+			mt.Fatalf("expected one update, got %v", updates)
+		}
+		set := updates[0].Lookup("u", "$set").Document()
+		if id, ok := set.Lookup("department_id").ObjectIDOK(); !ok || id != department {
+			mt.Fatalf("expected the department to be set, got %s", set)
+		}
+	})
+}
+
+func TestCompleteUserPlacement(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	university, other := primitive.NewObjectID(), primitive.NewObjectID()
+	school, department := primitive.NewObjectID(), primitive.NewObjectID()
+	me := models.UserView{ID: primitive.NewObjectID(), UniversityID: &university}
+
+	mt.Run("the university from the email domain can not be changed", func(mt *mtest.T) {
+		mt.AddMockResponses(document(mt.T, "db.users", me))
+		users := repository.NewUserRepository(mt.DB)
+
+		user := models.User{ID: me.ID, UniversityID: &other, SchoolID: &school}
+		if _, err := users.CompleteUser(context.Background(), user); err != repository.ErrUniversityReadOnly {
+			mt.Fatalf("expected the university to be read only, got %v", err)
+		}
+		if updates := sentUpdates(mt); len(updates) != 0 {
+			mt.Fatalf("expected the user to be left alone, got %v", updates)
+		}
+	})
+
+	mt.Run("a school of another university is rejected", func(mt *mtest.T) {
+		mt.AddMockResponses(document(mt.T, "db.users", me), noDocument("db.schools"))
+		users := repository.NewUserRepository(mt.DB)
+
+		user := models.User{ID: me.ID, UniversityID: &university, SchoolID: &school}
+		if _, err := users.CompleteUser(context.Background(), user); err != repository.ErrSchoolNotInUniversity {
+			mt.Fatalf("expected the school to be rejected, got %v", err)
+		}
+		if updates := sentUpdates(mt); len(updates) != 0 {
+			mt.Fatalf("expected the user to be left alone, got %v", updates)
+		}
+	})
+
+	mt.Run("a department of another school is rejected", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			document(mt.T, "db.users", me),
+			document(mt.T, "db.schools", bson.M{"n": 1}),
+			noDocument("db.departments"),
+		)
+		users := repository.NewUserRepository(mt.DB)
+
+		user := models.User{ID: me.ID, UniversityID: &university, SchoolID: &school, DepartmentID: &department}
+		if _, err := users.CompleteUser(context.Background(), user); err != repository.ErrDepartmentNotInSchool {
+			mt.Fatalf("expected the department to be rejected, got %v", err)
+		}
+		if updates := sentUpdates(mt); len(updates) != 0 {
+			mt.Fatalf("expected the user to be left alone, got %v", updates)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCreateVerificationRequest(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	request := models.VerificationRequests{UserID: primitive.NewObjectID(), Type: constants.VerificationTypeTeacher}
+
+	tests := []struct {
+		name      string
+		request   models.VerificationRequests
+		responses func(mt *mtest.T) []bson.D
+		want      error
+	}{
+		{
+			name:    "a request is queued as pending",
+			request: request,
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{noDocument("db.users"), noDocument("db.verification_requests"), mtest.CreateSuccessResponse()}
+			},
+		},
+		{
+			name:      "an unknown type is refused",
+			request:   models.VerificationRequests{UserID: request.UserID, Type: "admin"},
+			responses: func(mt *mtest.T) []bson.D { return nil },
+			want:      repository.ErrInvalidVerificationType,
+		},
+		{
+			name:    "a verified teacher can not ask again",
+			request: request,
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{document(mt.T, "db.users", bson.M{"n": 1})}
+			},
+			want: repository.ErrAlreadyVerified,
+		},
+		{
+			name:    "a second pending request is refused",
+			request: request,
+			responses: func(mt *mtest.T) []bson.D {
+				return []bson.D{noDocument("db.users"), document(mt.T, "db.verification_requests", bson.M{"n": 1})}
+			},
+			want: repository.ErrVerificationPending,
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.responses(mt)...)
+			requests := repository.NewVerificationRequestRepository(mt.DB)
+
+			created, err := requests.CreateRequest(context.Background(), tt.request)
+			if err != tt.want {
+				mt.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			if err == nil && created.Status != constants.VerificationStatusPending {
+				mt.Fatalf("expected a pending request, got %s", created.Status)
+			}
+		})
+	}
+}
+
+func TestReviewVerificationRequest(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	reviewer := primitive.NewObjectID()
+	request := models.VerificationRequests{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Type: constants.VerificationTypeTeacher}
+	reviewed := func(request models.VerificationRequests, status string) bson.D {
+		request.Status = status
+		return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: request})
+	}
+
+	mt.Run("approving a teacher flags the user and promotes students", func(mt *mtest.T) {
+		mt.AddMockResponses(reviewed(request, constants.VerificationStatusApproved), updated(1), updated(1))
+		requests := repository.NewVerificationRequestRepository(mt.DB)
+
+		if _, err := requests.ReviewRequest(context.Background(), request.ID, reviewer, true, "staff card checked"); err != nil {
+			mt.Fatal(err)
+		}
+		updates := sentUpdates(mt)
+		if len(updates) != 2 {
+			mt.Fatalf("expected the flags and the role to be updated, got %v", updates)
+		}
+		flags := updates[0].Lookup("u", "$set").Document()
+		if !flags.Lookup("is_teacher").Boolean() || !flags.Lookup("blue_badge").Boolean() {
+			mt.Fatalf("expected the teacher flags, got %s", flags)
+		}
+		if role := updates[1].Lookup("q", "role").StringValue(); role != string(constants.UserRoleStudent) {
+			mt.Fatalf("expected only a student to be promoted, got %s", updates[1])
+		}
+		if role := updates[1].Lookup("u", "$set", "role").StringValue(); role != string(constants.UserRoleTeacher) {
+			mt.Fatalf("expected the teacher role, got %s", updates[1])
+		}
+	})
+
+	mt.Run("approving a blue badge only gives the badge", func(mt *mtest.T) {
+		badge := request
+		badge.Type = constants.VerificationTypeBlueBadge
+		mt.AddMockResponses(reviewed(badge, constants.VerificationStatusApproved), updated(1))
+		requests := repository.NewVerificationRequestRepository(mt.DB)
+
+		if _, err := requests.ReviewRequest(context.Background(), badge.ID, reviewer, true, ""); err != nil {
+			mt.Fatal(err)
+		}
+		updates := sentUpdates(mt)
+		if len(updates) != 1 {
+			mt.Fatalf("expected only the badge to be set, got %v", updates)
+		}
+		if _, err := updates[0].LookupErr("u", "$set", "is_teacher"); err == nil {
+			mt.Fatalf("expected the user not to become a teacher, got %s", updates[0])
+		}
+	})
+
+	mt.Run("a rejection leaves the user alone", func(mt *mtest.T) {
+		mt.AddMockResponses(reviewed(request, constants.VerificationStatusRejected))
+		requests := repository.NewVerificationRequestRepository(mt.DB)
+
+		rejected, err := requests.ReviewRequest(context.Background(), request.ID, reviewer, false, "the document is unreadable")
+		if err != nil || rejected.Status != constants.VerificationStatusRejected {
+			mt.Fatalf("expected a rejected request, got %s %v", rejected.Status, err)
+		}
+		if updates := sentUpdates(mt); len(updates) != 0 {
+			mt.Fatalf("expected the user to be left alone, got %v", updates)
+		}
+	})
+
+	mt.Run("a reviewed request can not be reviewed again", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+			document(mt.T, "db.verification_requests", request),
+		)
+		requests := repository.NewVerificationRequestRepository(mt.DB)
+
+		if _, err := requests.ReviewRequest(context.Background(), request.ID, reviewer, true, ""); err != repository.ErrVerificationReviewed {
+			mt.Fatalf("expected the request to be reviewed already, got %v", err)
+		}
+		if updates := sentUpdates(mt); len(updates) != 0 {
+			mt.Fatalf("expected the user to be left alone, got %v", updates)
+		}
+	})
+}
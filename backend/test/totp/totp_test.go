@@ -0,0 +1,74 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/infrastructure/totp"
+)
+
+// rfc6238Secret is the SHA1 key of the test vectors of RFC 6238, appendix B
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+// the RFC codes have 8 digits, the last 6 are the codes of the authenticator apps
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		code, err := totp.Code(rfc6238Secret, totp.Step(time.Unix(vector.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := vector.code[len(vector.code)-totp.Digits:]; code != want {
+			t.Errorf("at %d expected %s, got %s", vector.unix, want, code)
+		}
+	}
+}
+
+func TestValidateAcceptsClockSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	for _, tc := range []struct {
+		name   string
+		offset int64
+		valid  bool
+	}{
+		{"current step", 0, true},
+		{"previous step", -1, true},
+		{"next step", 1, true},
+		{"two steps back", -2, false},
+		{"two steps ahead", 2, false},
+	} {
+		step := totp.Step(now) + tc.offset
+		code, err := totp.Code(rfc6238Secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matched, ok := totp.Validate(rfc6238Secret, code, now)
+		if ok != tc.valid || (ok && matched != step) {
+			t.Errorf("%s: expected valid=%t for step %d, got %t at %d", tc.name, tc.valid, step, ok, matched)
+		}
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870822", "abcdef"} {
+		if _, ok := totp.Validate(rfc6238Secret, code, now); ok {
+			t.Errorf("expected %q to be rejected", code)
+		}
+	}
+	if _, ok := totp.Validate(rfc6238Secret, " 287 082 ", now); !ok {
+		t.Error("expected spaces in the code to be ignored")
+	}
+}
@@ -0,0 +1,302 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/middleware"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+)
+
+// loginRepositoryStub fails every login with the error of the test
+type loginRepositoryStub struct {
+	repository.AuthRepository
+	err error
+}
+
+func (s *loginRepositoryStub) LoginWithEmail(ctx context.Context, user models.User, device models.SessionDevice) (models.LoginResult, error) {
+	return models.LoginResult{}, s.err
+}
+
+// loginAttemptStub records the failures and locks on the first one
+type loginAttemptStub struct {
+	repository.LoginAttemptRepository
+	failedAccounts []string
+	unlockTokens   int
+}
+
+func (s *loginAttemptStub) CheckLogin(ctx context.Context, account, ip string) error {
+	return nil
+}
+
+func (s *loginAttemptStub) RecordFailure(ctx context.Context, account, ip string) (models.LoginFailure, error) {
+	s.failedAccounts = append(s.failedAccounts, account)
+	return models.LoginFailure{AccountLocked: account != "", AccountFailures: 1}, nil
+}
+
+func (s *loginAttemptStub) CreateUnlockToken(ctx context.Context, account string) (string, error) {
+	s.unlockTokens++
+	// an error keeps the lock email from being sent by the test
+	return "", context.Canceled
+}
+
+type auditLogStub struct {
+	actions []string
+}
+
+func (s *auditLogStub) CreateAuditLog(ctx context.Context, auditLog models.AuditLogs) error {
+	s.actions = append(s.actions, auditLog.Action)
+	return nil
+}
+
+func TestFailedLoginOnlyLocksExistingAccounts(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		loginErr    error
+		wantAccount string
+		wantLocked  bool
+	}{
+		{"wrong password", repository.ErrWrongCredentials, "alice@example.com", true},
+		{"unknown email", repository.ErrUserNotFound, "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := &loginAttemptStub{}
+			audit := &auditLogStub{}
+			auth := usecases.NewAuthUseCase(&loginRepositoryStub{err: tc.loginErr}, attempts, audit, nil, nil)
+
+			_, err := auth.LoginWithEmail(context.Background(), models.User{Email: "alice@example.com"}, models.SessionDevice{IPAddress: "10.0.0.1"})
+			if err != tc.loginErr {
+				t.Fatalf("expected %v, got %v", tc.loginErr, err)
+			}
+			if len(attempts.failedAccounts) != 1 || attempts.failedAccounts[0] != tc.wantAccount {
+				t.Fatalf("expected the failure counted for %q, got %q", tc.wantAccount, attempts.failedAccounts)
+			}
+			if locked := attempts.unlockTokens > 0; locked != tc.wantLocked {
+				t.Fatalf("expected locked=%t, got %t with audit %v", tc.wantLocked, locked, audit.actions)
+			}
+		})
+	}
+}
+
+// resendRepositoryStub records the addresses a verification email is sent to
+type resendRepositoryStub struct {
+	repository.AuthRepository
+	sent []string
+}
+
+func (s *resendRepositoryStub) ResendVerificationEmail(ctx context.Context, email string) error {
+	s.sent = append(s.sent, email)
+	return nil
+}
+
+// emailLimitStub answers every email limit check with the error of the test
+type emailLimitStub struct {
+	repository.LoginAttemptRepository
+	err error
+}
+
+func (s *emailLimitStub) CheckVerificationResend(ctx context.Context, account, ip string) error {
+	return s.err
+}
+
+func TestResendVerificationEmailLimited(t *testing.T) {
+	throttle := &repository.ThrottledError{Reason: "too many verification emails requested", RetryAfter: time.Minute}
+
+	for _, tc := range []struct {
+		name     string
+		checkErr error
+		wantErr  error
+		wantSent bool
+	}{
+		{"under the limit", nil, nil, true},
+		{"over the limit", throttle, throttle, false},
+		{"redis down", errors.New("connection refused"), nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			authRepo := &resendRepositoryStub{}
+			auth := usecases.NewAuthUseCase(authRepo, &emailLimitStub{err: tc.checkErr}, &auditLogStub{}, nil, nil)
+
+			err := auth.ResendVerificationEmail(context.Background(), "alice@example.com", "10.0.0.1")
+			if err != tc.wantErr {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+			if sent := len(authRepo.sent) > 0; sent != tc.wantSent {
+				t.Fatalf("expected sent=%t, got %q", tc.wantSent, authRepo.sent)
+			}
+		})
+	}
+}
+
+// magicLinkRepositoryStub records the links sent and the logins that reach the database
+type magicLinkRepositoryStub struct {
+	repository.AuthRepository
+	sent   []string
+	logins int
+	err    error
+}
+
+func (s *magicLinkRepositoryStub) SendMagicLink(ctx context.Context, email string) error {
+	s.sent = append(s.sent, email)
+	return nil
+}
+
+func (s *magicLinkRepositoryStub) LoginWithMagicLink(ctx context.Context, token string, device models.SessionDevice) (models.LoginResult, error) {
+	s.logins++
+	return models.LoginResult{}, s.err
+}
+
+// lockoutStub answers the login checks with the errors of the test and records the outcomes
+type lockoutStub struct {
+	repository.LoginAttemptRepository
+	loginErr  error
+	linkErr   error
+	succeeded []string
+	failed    []string
+	unlocked  string
+	unlockErr error
+}
+
+func (s *lockoutStub) CheckLogin(ctx context.Context, account, ip string) error {
+	return s.loginErr
+}
+
+func (s *lockoutStub) CheckMagicLink(ctx context.Context, account, ip string) error {
+	return s.linkErr
+}
+
+func (s *lockoutStub) RecordSuccess(ctx context.Context, account string) error {
+	s.succeeded = append(s.succeeded, account)
+	return nil
+}
+
+func (s *lockoutStub) RecordFailure(ctx context.Context, account, ip string) (models.LoginFailure, error) {
+	s.failed = append(s.failed, account)
+	return models.LoginFailure{}, nil
+}
+
+func (s *lockoutStub) Unlock(ctx context.Context, token string) (string, error) {
+	return s.unlocked, s.unlockErr
+}
+
+func TestSendMagicLinkLockedOut(t *testing.T) {
+	locked := &repository.ThrottledError{Locked: true, Reason: "account temporarily locked", RetryAfter: time.Minute}
+	delayed := &repository.ThrottledError{Reason: "too many failed logins", RetryAfter: time.Second}
+	limited := &repository.ThrottledError{Reason: "too many login links requested", RetryAfter: time.Minute}
+
+	for _, tc := range []struct {
+		name     string
+		attempts *lockoutStub
+		wantErr  error
+	}{
+		{"a locked account gets no link", &lockoutStub{loginErr: locked}, locked},
+		{"a delayed account gets no link", &lockoutStub{loginErr: delayed}, delayed},
+		{"too many links", &lockoutStub{linkErr: limited}, limited},
+		{"redis down", &lockoutStub{loginErr: errors.New("connection refused"), linkErr: errors.New("connection refused")}, nil},
+		{"a link is sent", &lockoutStub{}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			authRepo := &magicLinkRepositoryStub{}
+			auth := usecases.NewAuthUseCase(authRepo, tc.attempts, &auditLogStub{}, nil, nil)
+
+			err := auth.SendMagicLink(context.Background(), "alice@example.com", "10.0.0.1")
+			if err != tc.wantErr {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+			if sent := len(authRepo.sent) > 0; sent != (tc.wantErr == nil) {
+				t.Fatalf("expected sent=%t, got %q", tc.wantErr == nil, authRepo.sent)
+			}
+		})
+	}
+}
+
+func TestLoginWithMagicLinkGuarded(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	token, err := middleware.GenerateMagicLinkToken("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("a locked account can not log in with a valid link", func(t *testing.T) {
+		locked := &repository.ThrottledError{Locked: true, Reason: "account temporarily locked", RetryAfter: time.Minute}
+		authRepo := &magicLinkRepositoryStub{}
+		auth := usecases.NewAuthUseCase(authRepo, &lockoutStub{loginErr: locked}, &auditLogStub{}, nil, nil)
+
+		if _, err := auth.LoginWithMagicLink(context.Background(), token, models.SessionDevice{IPAddress: "10.0.0.1"}); err != locked {
+			t.Fatalf("expected the account to be locked, got %v", err)
+		}
+		if authRepo.logins != 0 {
+			t.Fatal("expected the link not to be redeemed while locked")
+		}
+	})
+
+	t.Run("a login clears the failures of the account", func(t *testing.T) {
+		attempts := &lockoutStub{}
+		auth := usecases.NewAuthUseCase(&magicLinkRepositoryStub{}, attempts, &auditLogStub{}, nil, nil)
+
+		if _, err := auth.LoginWithMagicLink(context.Background(), token, models.SessionDevice{IPAddress: "10.0.0.1"}); err != nil {
+			t.Fatal(err)
+		}
+		if len(attempts.succeeded) != 1 || attempts.succeeded[0] != "alice@example.com" {
+			t.Fatalf("expected the failures of the account to be cleared, got %q", attempts.succeeded)
+		}
+	})
+
+	t.Run("a replayed link is refused", func(t *testing.T) {
+		attempts := &lockoutStub{}
+		auth := usecases.NewAuthUseCase(&magicLinkRepositoryStub{err: repository.ErrInvalidMagicLink}, attempts, &auditLogStub{}, nil, nil)
+
+		if _, err := auth.LoginWithMagicLink(context.Background(), token, models.SessionDevice{IPAddress: "10.0.0.1"}); err != repository.ErrInvalidMagicLink {
+			t.Fatalf("expected the link to be refused, got %v", err)
+		}
+		if len(attempts.succeeded) != 0 {
+			t.Fatalf("expected the failures to be kept, got %q", attempts.succeeded)
+		}
+	})
+
+	t.Run("a token of another purpose is refused", func(t *testing.T) {
+		verification, err := middleware.GenerateVerficationToken("alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		authRepo := &magicLinkRepositoryStub{}
+		auth := usecases.NewAuthUseCase(authRepo, &lockoutStub{}, &auditLogStub{}, nil, nil)
+
+		if _, err := auth.LoginWithMagicLink(context.Background(), verification, models.SessionDevice{}); err != repository.ErrInvalidMagicLink {
+			t.Fatalf("expected the token to be refused, got %v", err)
+		}
+		if authRepo.logins != 0 {
+			t.Fatal("expected no link to be looked up")
+		}
+	})
+}
+
+func TestUnlockAccount(t *testing.T) {
+	t.Run("the unlock is audited", func(t *testing.T) {
+		audit := &auditLogStub{}
+		auth := usecases.NewAuthUseCase(&magicLinkRepositoryStub{}, &lockoutStub{unlocked: "alice@example.com"}, audit, nil, nil)
+
+		if err := auth.UnlockAccount(context.Background(), "token"); err != nil {
+			t.Fatal(err)
+		}
+		if len(audit.actions) != 1 || audit.actions[0] != constants.AuditAccountUnlocked {
+			t.Fatalf("expected the unlock to be audited, got %v", audit.actions)
+		}
+	})
+
+	t.Run("an unknown token unlocks nothing", func(t *testing.T) {
+		audit := &auditLogStub{}
+		auth := usecases.NewAuthUseCase(&magicLinkRepositoryStub{}, &lockoutStub{unlockErr: repository.ErrInvalidUnlockToken}, audit, nil, nil)
+
+		if err := auth.UnlockAccount(context.Background(), "token"); err != repository.ErrInvalidUnlockToken {
+			t.Fatalf("expected the token to be refused, got %v", err)
+		}
+		if len(audit.actions) != 0 {
+			t.Fatalf("expected nothing audited, got %v", audit.actions)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package usecases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type impersonatedUserStub struct {
+	repository.UserRepository
+	user models.User
+}
+
+func (s *impersonatedUserStub) GetUserByIdNoneView(ctx context.Context, userID string) (models.User, error) {
+	return s.user, nil
+}
+
+// impersonationSessionStub counts the impersonation sessions it was asked to open
+type impersonationSessionStub struct {
+	repository.SessionRepository
+	opened int
+}
+
+func (s *impersonationSessionStub) CreateImpersonationSession(ctx context.Context, user models.User, impersonatorID primitive.ObjectID, reason string, allowWrites bool, ttl time.Duration, device models.SessionDevice) (models.ImpersonationSession, error) {
+	s.opened++
+	return models.ImpersonationSession{SessionID: primitive.NewObjectID(), UserID: user.ID, ImpersonatorID: impersonatorID}, nil
+}
+
+func TestStartImpersonation(t *testing.T) {
+	admin := primitive.NewObjectID()
+	for _, tc := range []struct {
+		name    string
+		userID  primitive.ObjectID
+		role    constants.UserRole
+		reason  string
+		minutes int
+		err     error
+	}{
+		{"student", primitive.NewObjectID(), constants.UserRoleStudent, "support ticket", 0, nil},
+		{"admin", primitive.NewObjectID(), constants.UserRoleAdmin, "support ticket", 0, nil},
+		{"super admin", primitive.NewObjectID(), constants.UserRoleSuperAdmin, "support ticket", 0, usecases.ErrImpersonateAdmin},
+		{"self", admin, constants.UserRoleStudent, "support ticket", 0, usecases.ErrImpersonateSelf},
+		{"no reason", primitive.NewObjectID(), constants.UserRoleStudent, "  ", 0, usecases.ErrImpersonationReason},
+		{"too long", primitive.NewObjectID(), constants.UserRoleStudent, "support ticket", usecases.MaxImpersonationMinutes + 1, usecases.ErrImpersonationDuration},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sessions := &impersonationSessionStub{}
+			users := &impersonatedUserStub{user: models.User{ID: tc.userID, Role: string(tc.role)}}
+			impersonation := usecases.NewImpersonationUsecase(sessions, users, &auditLogStub{})
+
+			_, err := impersonation.StartImpersonation(context.Background(), admin, tc.userID, tc.reason, tc.minutes, false, models.SessionDevice{})
+			if err != tc.err {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if opened := sessions.opened == 1; opened != (tc.err == nil) {
+				t.Fatalf("expected a session only without an error, opened %d", sessions.opened)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package usecases
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/chera-mihiretu/IKnow/usecases"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type handleUsersStub struct {
+	repository.UserRepository
+	users []models.UserView
+}
+
+func (s *handleUsersStub) GetUsersByHandles(ctx context.Context, handles []string) ([]models.UserView, error) {
+	return s.users, nil
+}
+
+type connectionsStub struct {
+	repository.ConnectRepository
+	connected map[primitive.ObjectID]bool
+}
+
+func (s *connectionsStub) IsConnected(ctx context.Context, connect models.Connects) (bool, error) {
+	return s.connected[connect.ConnecteeID], nil
+}
+
+func TestResolveMentionsRespectsMentionSetting(t *testing.T) {
+	author := primitive.NewObjectID()
+	friend := primitive.NewObjectID()
+	users := []models.UserView{
+		{ID: primitive.NewObjectID(), Handle: "open"},
+		{ID: primitive.NewObjectID(), Handle: "hidden", MentionsFrom: constants.MentionsFromNobody},
+		{ID: friend, Handle: "friend", MentionsFrom: constants.MentionsFromConnections},
+		{ID: primitive.NewObjectID(), Handle: "stranger", MentionsFrom: constants.MentionsFromConnections},
+		{ID: author, Handle: "myself", MentionsFrom: constants.MentionsFromNobody},
+	}
+	mentions := usecases.NewMentionUsecase(&handleUsersStub{users: users}, &connectionsStub{connected: map[primitive.ObjectID]bool{friend: true}}, nil)
+
+	resolved, err := mentions.ResolveMentions(context.Background(), author, "@open @hidden @Friend @stranger @myself")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	for _, mention := range resolved {
+		got[mention.Handle] = mention.Offset
+	}
+	want := map[string]int{"open": 0, "friend": 14, "myself": 32}
+	if len(got) != len(want) {
+		t.Fatalf("expected the mentions %v, got %v", want, got)
+	}
+	for handle, offset := range want {
+		if got[handle] != offset {
+			t.Fatalf("expected the mentions %v, got %v", want, got)
+		}
+	}
+}
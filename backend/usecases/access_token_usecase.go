@@ -0,0 +1,131 @@
+package usecases
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxAccessTokenDays = 365
+
+type AccessTokenUsecase interface {
+	CreateToken(ctx context.Context, userID, createdBy primitive.ObjectID, name string, scopes []string, expiresInDays int) (models.AccessTokens, string, error)
+	GetUserTokens(ctx context.Context, userID primitive.ObjectID) ([]models.AccessTokens, error)
+	RevokeToken(ctx context.Context, userID, tokenID, revokedBy primitive.ObjectID) error
+	AuthenticateAccessToken(ctx context.Context, token, clientIP string) (models.AccessTokenPrincipal, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type accessTokenUsecase struct {
+	accessTokenRepository repository.AccessTokenRepository
+	auditLogRepository    repository.AuditLogRepository
+}
+
+func NewAccessTokenUsecase(accessTokenRepository repository.AccessTokenRepository, auditLogRepository repository.AuditLogRepository) AccessTokenUsecase {
+	return &accessTokenUsecase{
+		accessTokenRepository: accessTokenRepository,
+		auditLogRepository:    auditLogRepository,
+	}
+}
+
+// CreateToken makes a token for userID, a token that never expires is made when expiresInDays is 0.
+// The scopes only narrow what the user can do, the permissions of the user are still checked
+func (a *accessTokenUsecase) CreateToken(ctx context.Context, userID, createdBy primitive.ObjectID, name string, scopes []string, expiresInDays int) (models.AccessTokens, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return models.AccessTokens{}, "", repository.ErrAccessTokenName
+	}
+	if expiresInDays < 0 || expiresInDays > maxAccessTokenDays {
+		return models.AccessTokens{}, "", repository.ErrAccessTokenExpiry
+	}
+
+	seen := map[string]bool{}
+	var granted []string
+	for _, scope := range scopes {
+		if !constants.IsTokenScope(constants.Permission(scope)) {
+			return models.AccessTokens{}, "", repository.ErrAccessTokenScopes
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			granted = append(granted, scope)
+		}
+	}
+	if len(granted) == 0 {
+		return models.AccessTokens{}, "", repository.ErrAccessTokenScopes
+	}
+
+	token := models.AccessTokens{
+		UserID:    userID,
+		CreatedBy: createdBy,
+		Name:      name,
+		Scopes:    granted,
+	}
+	if expiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, expiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	created, rawToken, err := a.accessTokenRepository.CreateToken(ctx, token)
+	if err != nil {
+		return models.AccessTokens{}, "", err
+	}
+	a.audit(ctx, constants.AuditAccessTokenCreated, createdBy, userID, map[string]interface{}{
+		"token_id": created.ID.Hex(),
+		"name":     created.Name,
+		"scopes":   created.Scopes,
+	})
+	return created, rawToken, nil
+}
+
+func (a *accessTokenUsecase) GetUserTokens(ctx context.Context, userID primitive.ObjectID) ([]models.AccessTokens, error) {
+	return a.accessTokenRepository.GetUserTokens(ctx, userID)
+}
+
+func (a *accessTokenUsecase) RevokeToken(ctx context.Context, userID, tokenID, revokedBy primitive.ObjectID) error {
+	if err := a.accessTokenRepository.RevokeToken(ctx, userID, tokenID); err != nil {
+		return err
+	}
+	a.audit(ctx, constants.AuditAccessTokenRevoked, revokedBy, userID, map[string]interface{}{
+		"token_id": tokenID.Hex(),
+	})
+	return nil
+}
+
+// AuthenticateAccessToken is used by the auth middleware, the role is read from the user
+// on every request so a role change applies to the tokens right away
+func (a *accessTokenUsecase) AuthenticateAccessToken(ctx context.Context, token, clientIP string) (models.AccessTokenPrincipal, error) {
+	accessToken, user, err := a.accessTokenRepository.Authenticate(ctx, token, clientIP)
+	if err != nil {
+		return models.AccessTokenPrincipal{}, err
+	}
+	return models.AccessTokenPrincipal{
+		UserID:  user.ID.Hex(),
+		Role:    user.Role,
+		TokenID: accessToken.ID.Hex(),
+		Scopes:  accessToken.Scopes,
+	}, nil
+}
+
+func (a *accessTokenUsecase) EnsureIndexes(ctx context.Context) error {
+	return a.accessTokenRepository.EnsureIndexes(ctx)
+}
+
+func (a *accessTokenUsecase) audit(ctx context.Context, action string, actorID, userID primitive.ObjectID, details map[string]interface{}) {
+	err := a.auditLogRepository.CreateAuditLog(ctx, models.AuditLogs{
+		UserID:     actorID,
+		Action:     action,
+		TargetType: constants.AuditTargetUser,
+		TargetID:   userID,
+		Details:    details,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		log.Println("Could not write audit log:", err)
+	}
+}
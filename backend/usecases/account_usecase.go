@@ -0,0 +1,117 @@
+package usecases
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/hibiken/asynq"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AccountUsecase interface {
+	ScheduleDeletion(ctx context.Context, userID primitive.ObjectID, password string) (time.Time, error)
+	CancelDeletion(ctx context.Context, userID primitive.ObjectID) error
+	PurgeDueAccounts(ctx context.Context) (int, error)
+	HandlePurgeAccountsTask(ctx context.Context, task *asynq.Task) error
+	ExportUserData(ctx context.Context, userID primitive.ObjectID) (models.AccountExport, error)
+}
+
+type accountUsecase struct {
+	accountRepository  repository.AccountRepository
+	auditLogRepository repository.AuditLogRepository
+	storage            StorageUseCase
+}
+
+func NewAccountUsecase(
+	accountRepository repository.AccountRepository,
+	auditLogRepository repository.AuditLogRepository,
+	storage StorageUseCase,
+) AccountUsecase {
+	return &accountUsecase{
+		accountRepository:  accountRepository,
+		auditLogRepository: auditLogRepository,
+		storage:            storage,
+	}
+}
+
+func (a *accountUsecase) ScheduleDeletion(ctx context.Context, userID primitive.ObjectID, password string) (time.Time, error) {
+	scheduledAt, err := a.accountRepository.ScheduleDeletion(ctx, userID, password)
+	if err != nil {
+		return time.Time{}, err
+	}
+	a.audit(ctx, constants.AuditAccountDeletionScheduled, userID, map[string]interface{}{
+		"scheduled_at": scheduledAt,
+	})
+	return scheduledAt, nil
+}
+
+func (a *accountUsecase) CancelDeletion(ctx context.Context, userID primitive.ObjectID) error {
+	if err := a.accountRepository.CancelDeletion(ctx, userID); err != nil {
+		return err
+	}
+	a.audit(ctx, constants.AuditAccountDeletionCancelled, userID, nil)
+	return nil
+}
+
+// HandlePurgeAccountsTask runs on the accounts queue every hour, a run that fails is tried
+// again by the queue and one that was missed is caught up by the next
+func (a *accountUsecase) HandlePurgeAccountsTask(ctx context.Context, task *asynq.Task) error {
+	purged, err := a.PurgeDueAccounts(ctx)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		log.Println("Purged", purged, "deleted accounts")
+	}
+	return nil
+}
+
+// PurgeDueAccounts deletes the accounts whose grace period is over, an account that fails
+// is logged and tried again on the next run
+func (a *accountUsecase) PurgeDueAccounts(ctx context.Context) (int, error) {
+	userIDs, err := a.accountRepository.GetDueDeletions(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, userID := range userIDs {
+		files, err := a.accountRepository.PurgeUser(ctx, userID)
+		if err != nil {
+			log.Println("Could not purge account", userID.Hex(), ":", err)
+			continue
+		}
+		if len(files) > 0 {
+			if err := a.storage.DeleteFile(files); err != nil {
+				log.Println("Could not delete the files of account", userID.Hex(), ":", err)
+			}
+		}
+		a.audit(ctx, constants.AuditAccountDeleted, userID, map[string]interface{}{
+			"files": len(files),
+		})
+		purged++
+	}
+	return purged, nil
+}
+
+func (a *accountUsecase) ExportUserData(ctx context.Context, userID primitive.ObjectID) (models.AccountExport, error) {
+	return a.accountRepository.ExportUserData(ctx, userID)
+}
+
+func (a *accountUsecase) audit(ctx context.Context, action string, userID primitive.ObjectID, details map[string]interface{}) {
+	err := a.auditLogRepository.CreateAuditLog(ctx, models.AuditLogs{
+		UserID:     userID,
+		Action:     action,
+		TargetType: constants.AuditTargetUser,
+		TargetID:   userID,
+		Details:    details,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		log.Println("Could not write audit log:", err)
+	}
+}
@@ -2,50 +2,312 @@ package usecases
 
 import (
 	"context"
+	"log"
+	"time"
 
+	"github.com/chera-mihiretu/IKnow/domain/constants"
 	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/email"
+	"github.com/chera-mihiretu/IKnow/infrastructure/middleware"
 	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type AuthUseCase interface {
 	RegisterUserEmail(ctx context.Context, user models.User) error
-	LoginWithEmail(ctx context.Context, user models.User) (string, error)
-	SignInWithGoogle(ctx context.Context, user models.User) (string, error)
+	LoginWithEmail(ctx context.Context, user models.User, device models.SessionDevice) (models.LoginResult, error)
+	SignInWithProvider(ctx context.Context, identity models.UserIdentities, device models.SessionDevice) (models.LoginResult, error)
+	LinkProvider(ctx context.Context, userID primitive.ObjectID, identity models.UserIdentities) (models.UserIdentities, error)
+	StartProviderLink(ctx context.Context, userID primitive.ObjectID, provider string) (string, error)
+	FinishProviderLink(ctx context.Context, nonce string, identity models.UserIdentities) (models.UserIdentities, error)
+	UnlinkProvider(ctx context.Context, userID primitive.ObjectID, provider string) error
+	GetLinkedAccounts(ctx context.Context, userID primitive.ObjectID) ([]models.UserIdentities, error)
+	Logout(ctx context.Context, userID, sessionID primitive.ObjectID) error
+	LogoutAllSessions(ctx context.Context, userID, exceptSessionID primitive.ObjectID) (int64, error)
 	VerifyEmail(ctx context.Context, token models.EmailVerification) error
-	ForgotPassword(ctx context.Context, user models.User) error
+	ForgotPassword(ctx context.Context, user models.User, clientIP string) error
 	ResetPassword(ctx context.Context, user models.User, token models.EmailVerification) error
+	UnlockAccount(ctx context.Context, token string) error
+	ResendVerificationEmail(ctx context.Context, email, clientIP string) error
+	SendMagicLink(ctx context.Context, email, clientIP string) error
+	LoginWithMagicLink(ctx context.Context, token string, device models.SessionDevice) (models.LoginResult, error)
+	EnsureIndexes(ctx context.Context) error
 }
 
 type authUseCase struct {
-	AuthRepository repository.AuthRepository
+	AuthRepository         repository.AuthRepository
+	loginAttemptRepository repository.LoginAttemptRepository
+	auditLogRepository     repository.AuditLogRepository
+	identityRepository     repository.IdentityRepository
+	invitationRepository   repository.InvitationRepository
 }
 
-func NewAuthUseCase(repository repository.AuthRepository) AuthUseCase {
+func NewAuthUseCase(
+	repository repository.AuthRepository,
+	loginAttemptRepository repository.LoginAttemptRepository,
+	auditLogRepository repository.AuditLogRepository,
+	identityRepository repository.IdentityRepository,
+	invitationRepository repository.InvitationRepository,
+) AuthUseCase {
 	return &authUseCase{
-		AuthRepository: repository,
+		AuthRepository:         repository,
+		loginAttemptRepository: loginAttemptRepository,
+		auditLogRepository:     auditLogRepository,
+		identityRepository:     identityRepository,
+		invitationRepository:   invitationRepository,
 	}
 }
 
+// RegisterUserEmail signs the user up, with an invite code the user is placed where the
+// invitation says instead of only in the university of the email domain. The code is only
+// checked here, VerifyEmail takes the use so unverified sign ups can not use it up
 func (auth *authUseCase) RegisterUserEmail(ctx context.Context, user models.User) error {
+	if user.InviteCode == "" {
+		return auth.AuthRepository.RegisterUserWithEmail(ctx, user)
+	}
+
+	invitation, err := auth.invitationRepository.CheckInvitation(ctx, user.InviteCode, user.Email)
+	if err != nil {
+		return err
+	}
+	user.InvitationID = &invitation.ID
+	user.UniversityID = &invitation.UniversityID
+	user.SchoolID = invitation.SchoolID
+	user.DepartmentID = invitation.DepartmentID
+	if invitation.AcedemicYear > 0 {
+		user.AcedemicYear = invitation.AcedemicYear
+	}
+
 	return auth.AuthRepository.RegisterUserWithEmail(ctx, user)
 }
 
-func (auth *authUseCase) SignInWithGoogle(ctx context.Context, user models.User) (string, error) {
-	return auth.AuthRepository.SignInWithGoogle(ctx, user)
+func (auth *authUseCase) SignInWithProvider(ctx context.Context, identity models.UserIdentities, device models.SessionDevice) (models.LoginResult, error) {
+	return auth.AuthRepository.SignInWithProvider(ctx, identity, device)
+}
+
+func (auth *authUseCase) LinkProvider(ctx context.Context, userID primitive.ObjectID, identity models.UserIdentities) (models.UserIdentities, error) {
+	linked, err := auth.identityRepository.LinkIdentity(ctx, userID, identity)
+	if err != nil {
+		return models.UserIdentities{}, err
+	}
+	auth.audit(ctx, constants.AuditProviderLinked, constants.AuditTargetUser, map[string]interface{}{
+		"user_id":  userID.Hex(),
+		"provider": identity.Provider,
+	})
+	return linked, nil
+}
+
+// StartProviderLink returns the nonce the callback of the provider finishes the link with
+func (auth *authUseCase) StartProviderLink(ctx context.Context, userID primitive.ObjectID, provider string) (string, error) {
+	return auth.identityRepository.StartLink(ctx, userID, provider)
+}
+
+// FinishProviderLink links the provider account to the user that started the link, the
+// nonce can not be used again
+func (auth *authUseCase) FinishProviderLink(ctx context.Context, nonce string, identity models.UserIdentities) (models.UserIdentities, error) {
+	userID, err := auth.identityRepository.ConsumeLink(ctx, nonce, identity.Provider)
+	if err != nil {
+		return models.UserIdentities{}, err
+	}
+	return auth.LinkProvider(ctx, userID, identity)
+}
+
+func (auth *authUseCase) UnlinkProvider(ctx context.Context, userID primitive.ObjectID, provider string) error {
+	if err := auth.identityRepository.UnlinkIdentity(ctx, userID, provider); err != nil {
+		return err
+	}
+	auth.audit(ctx, constants.AuditProviderUnlinked, constants.AuditTargetUser, map[string]interface{}{
+		"user_id":  userID.Hex(),
+		"provider": provider,
+	})
+	return nil
+}
+
+func (auth *authUseCase) GetLinkedAccounts(ctx context.Context, userID primitive.ObjectID) ([]models.UserIdentities, error) {
+	return auth.identityRepository.GetUserIdentities(ctx, userID)
+}
+
+func (auth *authUseCase) LoginWithEmail(ctx context.Context, user models.User, device models.SessionDevice) (models.LoginResult, error) {
+	return auth.guardLogin(ctx, user.Email, device.IPAddress, func() (models.LoginResult, error) {
+		return auth.AuthRepository.LoginWithEmail(ctx, user, device)
+	})
+}
+
+// guardLogin wraps a login attempt with the brute force protection, every login path
+// that checks a secret of the user must go through it so they share the same counters
+func (auth *authUseCase) guardLogin(ctx context.Context, account, clientIP string, attempt func() (models.LoginResult, error)) (models.LoginResult, error) {
+	if err := auth.loginAttemptRepository.CheckLogin(ctx, account, clientIP); err != nil {
+		if _, throttled := err.(*repository.ThrottledError); throttled {
+			return models.LoginResult{}, err
+		}
+		// redis being down should not lock everybody out, the password is still checked
+		log.Println("Could not check login attempts:", err)
+	}
+
+	result, err := attempt()
+	if err == nil {
+		if err := auth.loginAttemptRepository.RecordSuccess(ctx, account); err != nil {
+			log.Println("Could not reset login attempts:", err)
+		}
+		return result, nil
+	}
+	if err != repository.ErrUserNotFound && err != repository.ErrWrongCredentials {
+		return result, err
+	}
+
+	// only accounts that exist are counted, locking an email nobody has would send the
+	// lock email to any address and tell which ones are registered
+	if err == repository.ErrUserNotFound {
+		account = ""
+	}
+	failure, recordErr := auth.loginAttemptRepository.RecordFailure(ctx, account, clientIP)
+	if recordErr != nil {
+		log.Println("Could not record failed login:", recordErr)
+		return result, err
+	}
+	if failure.AccountLocked {
+		auth.onAccountLocked(ctx, account, clientIP, failure)
+	}
+	if failure.IPBlocked {
+		auth.audit(ctx, constants.AuditIPBlocked, constants.AuditTargetIP, map[string]interface{}{
+			"ip":       clientIP,
+			"failures": failure.IPFailures,
+		})
+	}
+	return result, err
+}
+
+func (auth *authUseCase) onAccountLocked(ctx context.Context, account, clientIP string, failure models.LoginFailure) {
+	auth.audit(ctx, constants.AuditAccountLocked, constants.AuditTargetUser, map[string]interface{}{
+		"email":        account,
+		"ip":           clientIP,
+		"failures":     failure.AccountFailures,
+		"locked_until": failure.LockedUntil,
+	})
+
+	token, err := auth.loginAttemptRepository.CreateUnlockToken(ctx, account)
+	if err != nil {
+		log.Println("Could not create unlock token:", err)
+		return
+	}
+	go func() {
+		if err := email.SendAccountLockedEmail(account, token); err != nil {
+			log.Println("Could not send account locked email:", err)
+		}
+	}()
+}
+
+func (auth *authUseCase) audit(ctx context.Context, action, targetType string, details map[string]interface{}) {
+	err := auth.auditLogRepository.CreateAuditLog(ctx, models.AuditLogs{
+		UserID:     primitive.NilObjectID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   primitive.NilObjectID,
+		Details:    details,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		log.Println("Could not write audit log:", err)
+	}
+}
+
+func (auth *authUseCase) UnlockAccount(ctx context.Context, token string) error {
+	account, err := auth.loginAttemptRepository.Unlock(ctx, token)
+	if err != nil {
+		return err
+	}
+	auth.audit(ctx, constants.AuditAccountUnlocked, constants.AuditTargetUser, map[string]interface{}{
+		"email": account,
+	})
+	return nil
+}
+
+func (auth *authUseCase) Logout(ctx context.Context, userID, sessionID primitive.ObjectID) error {
+	return auth.AuthRepository.Logout(ctx, userID, sessionID)
 }
 
-func (auth *authUseCase) LoginWithEmail(ctx context.Context, user models.User) (string, error) {
-	return auth.AuthRepository.LoginWithEmail(ctx, user)
+func (auth *authUseCase) LogoutAllSessions(ctx context.Context, userID, exceptSessionID primitive.ObjectID) (int64, error) {
+	return auth.AuthRepository.LogoutAllSessions(ctx, userID, exceptSessionID)
 }
 
+// VerifyEmail redeems the invite code of the sign up before the user is created, the use
+// is given back when the user could not be created
 func (auth *authUseCase) VerifyEmail(ctx context.Context, token models.EmailVerification) error {
-	return auth.AuthRepository.VerifyEmail(ctx, token)
+	user, err := auth.AuthRepository.GetUnverifiedUser(ctx, token)
+	if err != nil {
+		return err
+	}
+	if user.InviteCode == "" {
+		return auth.AuthRepository.VerifyEmail(ctx, token)
+	}
+
+	invitation, err := auth.invitationRepository.Redeem(ctx, user.InviteCode, user.ID, user.Email)
+	if err != nil {
+		return err
+	}
+	if err := auth.AuthRepository.VerifyEmail(ctx, token); err != nil {
+		if cancelErr := auth.invitationRepository.CancelRedemption(ctx, invitation.ID, user.ID); cancelErr != nil {
+			log.Println("Could not give back the invitation use:", cancelErr)
+		}
+		return err
+	}
+	return nil
 }
 
-func (auth *authUseCase) ForgotPassword(ctx context.Context, user models.User) error {
+func (auth *authUseCase) ForgotPassword(ctx context.Context, user models.User, clientIP string) error {
+	if err := auth.loginAttemptRepository.CheckPasswordReset(ctx, user.Email, clientIP); err != nil {
+		if _, throttled := err.(*repository.ThrottledError); throttled {
+			return err
+		}
+		log.Println("Could not check password reset attempts:", err)
+	}
 	return auth.AuthRepository.ForgotPassword(ctx, user)
 }
 
 func (auth *authUseCase) ResetPassword(ctx context.Context, user models.User, token models.EmailVerification) error {
 	return auth.AuthRepository.ResetPassword(ctx, user, token)
 }
+
+func (auth *authUseCase) ResendVerificationEmail(ctx context.Context, email, clientIP string) error {
+	if err := auth.loginAttemptRepository.CheckVerificationResend(ctx, email, clientIP); err != nil {
+		if _, throttled := err.(*repository.ThrottledError); throttled {
+			return err
+		}
+		log.Println("Could not check verification resend attempts:", err)
+	}
+	return auth.AuthRepository.ResendVerificationEmail(ctx, email)
+}
+
+// SendMagicLink is refused while the account or the ip is locked out, like a password login
+func (auth *authUseCase) SendMagicLink(ctx context.Context, email, clientIP string) error {
+	if err := auth.loginAttemptRepository.CheckLogin(ctx, email, clientIP); err != nil {
+		if _, throttled := err.(*repository.ThrottledError); throttled {
+			return err
+		}
+		log.Println("Could not check login attempts:", err)
+	}
+	if err := auth.loginAttemptRepository.CheckMagicLink(ctx, email, clientIP); err != nil {
+		if _, throttled := err.(*repository.ThrottledError); throttled {
+			return err
+		}
+		log.Println("Could not check login link attempts:", err)
+	}
+	return auth.AuthRepository.SendMagicLink(ctx, email)
+}
+
+func (auth *authUseCase) LoginWithMagicLink(ctx context.Context, token string, device models.SessionDevice) (models.LoginResult, error) {
+	account, err := middleware.MagicLinkTokenValidate(token)
+	if err != nil {
+		return models.LoginResult{}, repository.ErrInvalidMagicLink
+	}
+	return auth.guardLogin(ctx, account, device.IPAddress, func() (models.LoginResult, error) {
+		return auth.AuthRepository.LoginWithMagicLink(ctx, token, device)
+	})
+}
+
+func (auth *authUseCase) EnsureIndexes(ctx context.Context) error {
+	if err := auth.AuthRepository.EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	return auth.identityRepository.EnsureIndexes(ctx)
+}
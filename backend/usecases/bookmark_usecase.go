@@ -0,0 +1,74 @@
+package usecases
+
+import (
+	"context"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type BookmarkUsecase interface {
+	AddBookmark(ctx context.Context, bookmark models.Bookmarks) (models.Bookmarks, error)
+	RemoveBookmark(ctx context.Context, userID primitive.ObjectID, targetType string, targetID primitive.ObjectID) error
+	GetBookmarks(ctx context.Context, userID primitive.ObjectID, targetType string, folderID *primitive.ObjectID, page int) ([]models.Bookmarks, error)
+	CheckListOfBookmarks(ctx context.Context, userID primitive.ObjectID, targetType string, targetIDs []primitive.ObjectID) (map[primitive.ObjectID]bool, error)
+	CreateFolder(ctx context.Context, folder models.BookmarkFolders) (models.BookmarkFolders, error)
+	GetFolders(ctx context.Context, userID primitive.ObjectID) ([]models.BookmarkFolders, error)
+	RenameFolder(ctx context.Context, userID, folderID primitive.ObjectID, name string) (models.BookmarkFolders, error)
+	DeleteFolder(ctx context.Context, userID, folderID primitive.ObjectID) error
+	EnsureIndexes(ctx context.Context) error
+}
+
+type bookmarkUsecase struct {
+	bookmarkRepository repository.BookmarkRepository
+}
+
+func NewBookmarkUsecase(bookmarkRepository repository.BookmarkRepository) BookmarkUsecase {
+	return &bookmarkUsecase{bookmarkRepository: bookmarkRepository}
+}
+
+func (b *bookmarkUsecase) AddBookmark(ctx context.Context, bookmark models.Bookmarks) (models.Bookmarks, error) {
+	return b.bookmarkRepository.AddBookmark(ctx, bookmark)
+}
+
+func (b *bookmarkUsecase) RemoveBookmark(ctx context.Context, userID primitive.ObjectID, targetType string, targetID primitive.ObjectID) error {
+	return b.bookmarkRepository.RemoveBookmark(ctx, userID, targetType, targetID)
+}
+
+func (b *bookmarkUsecase) GetBookmarks(ctx context.Context, userID primitive.ObjectID, targetType string, folderID *primitive.ObjectID, page int) ([]models.Bookmarks, error) {
+	return b.bookmarkRepository.GetBookmarks(ctx, userID, targetType, folderID, page)
+}
+
+// CheckListOfBookmarks tells which of the targets the user saved, in one query for a whole page
+func (b *bookmarkUsecase) CheckListOfBookmarks(ctx context.Context, userID primitive.ObjectID, targetType string, targetIDs []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	bookmarks, err := b.bookmarkRepository.CheckListOfBookmarks(ctx, userID, targetType, targetIDs)
+	if err != nil {
+		return nil, err
+	}
+	saved := make(map[primitive.ObjectID]bool, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		saved[bookmark.TargetID] = true
+	}
+	return saved, nil
+}
+
+func (b *bookmarkUsecase) CreateFolder(ctx context.Context, folder models.BookmarkFolders) (models.BookmarkFolders, error) {
+	return b.bookmarkRepository.CreateFolder(ctx, folder)
+}
+
+func (b *bookmarkUsecase) GetFolders(ctx context.Context, userID primitive.ObjectID) ([]models.BookmarkFolders, error) {
+	return b.bookmarkRepository.GetFolders(ctx, userID)
+}
+
+func (b *bookmarkUsecase) RenameFolder(ctx context.Context, userID, folderID primitive.ObjectID, name string) (models.BookmarkFolders, error) {
+	return b.bookmarkRepository.RenameFolder(ctx, userID, folderID, name)
+}
+
+func (b *bookmarkUsecase) DeleteFolder(ctx context.Context, userID, folderID primitive.ObjectID) error {
+	return b.bookmarkRepository.DeleteFolder(ctx, userID, folderID)
+}
+
+func (b *bookmarkUsecase) EnsureIndexes(ctx context.Context) error {
+	return b.bookmarkRepository.EnsureIndexes(ctx)
+}
@@ -0,0 +1,100 @@
+package usecases
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type BotUsecase interface {
+	CreateBot(ctx context.Context, ownerID primitive.ObjectID, name string) (models.User, error)
+	GetBots(ctx context.Context, page int) ([]models.User, error)
+	DeleteBot(ctx context.Context, botID, deletedBy primitive.ObjectID) error
+	CreateBotToken(ctx context.Context, botID, createdBy primitive.ObjectID, name string, scopes []string, expiresInDays int) (models.AccessTokens, string, error)
+	GetBotTokens(ctx context.Context, botID primitive.ObjectID) ([]models.AccessTokens, error)
+	RevokeBotToken(ctx context.Context, botID, tokenID, revokedBy primitive.ObjectID) error
+}
+
+type botUsecase struct {
+	botRepository      repository.BotRepository
+	accessTokenUsecase AccessTokenUsecase
+	auditLogRepository repository.AuditLogRepository
+}
+
+func NewBotUsecase(
+	botRepository repository.BotRepository,
+	accessTokenUsecase AccessTokenUsecase,
+	auditLogRepository repository.AuditLogRepository,
+) BotUsecase {
+	return &botUsecase{
+		botRepository:      botRepository,
+		accessTokenUsecase: accessTokenUsecase,
+		auditLogRepository: auditLogRepository,
+	}
+}
+
+func (b *botUsecase) CreateBot(ctx context.Context, ownerID primitive.ObjectID, name string) (models.User, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return models.User{}, repository.ErrBotName
+	}
+	bot, err := b.botRepository.CreateBot(ctx, ownerID, name)
+	if err != nil {
+		return models.User{}, err
+	}
+	b.audit(ctx, constants.AuditBotCreated, ownerID, bot.ID, map[string]interface{}{"name": bot.Name})
+	return bot, nil
+}
+
+func (b *botUsecase) GetBots(ctx context.Context, page int) ([]models.User, error) {
+	return b.botRepository.GetBots(ctx, page)
+}
+
+func (b *botUsecase) DeleteBot(ctx context.Context, botID, deletedBy primitive.ObjectID) error {
+	if err := b.botRepository.DeleteBot(ctx, botID); err != nil {
+		return err
+	}
+	b.audit(ctx, constants.AuditBotDeleted, deletedBy, botID, nil)
+	return nil
+}
+
+func (b *botUsecase) CreateBotToken(ctx context.Context, botID, createdBy primitive.ObjectID, name string, scopes []string, expiresInDays int) (models.AccessTokens, string, error) {
+	if _, err := b.botRepository.GetBotByID(ctx, botID); err != nil {
+		return models.AccessTokens{}, "", err
+	}
+	return b.accessTokenUsecase.CreateToken(ctx, botID, createdBy, name, scopes, expiresInDays)
+}
+
+func (b *botUsecase) GetBotTokens(ctx context.Context, botID primitive.ObjectID) ([]models.AccessTokens, error) {
+	if _, err := b.botRepository.GetBotByID(ctx, botID); err != nil {
+		return nil, err
+	}
+	return b.accessTokenUsecase.GetUserTokens(ctx, botID)
+}
+
+func (b *botUsecase) RevokeBotToken(ctx context.Context, botID, tokenID, revokedBy primitive.ObjectID) error {
+	if _, err := b.botRepository.GetBotByID(ctx, botID); err != nil {
+		return err
+	}
+	return b.accessTokenUsecase.RevokeToken(ctx, botID, tokenID, revokedBy)
+}
+
+func (b *botUsecase) audit(ctx context.Context, action string, actorID, botID primitive.ObjectID, details map[string]interface{}) {
+	err := b.auditLogRepository.CreateAuditLog(ctx, models.AuditLogs{
+		UserID:     actorID,
+		Action:     action,
+		TargetType: constants.AuditTargetUser,
+		TargetID:   botID,
+		Details:    details,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		log.Println("Could not write audit log:", err)
+	}
+}
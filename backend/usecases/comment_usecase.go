@@ -2,6 +2,7 @@ package usecases
 
 import (
 	"context"
+	"log"
 
 	"github.com/chera-mihiretu/IKnow/domain/models"
 	"github.com/chera-mihiretu/IKnow/repository"
@@ -19,11 +20,13 @@ type CommentUsecase interface {
 }
 
 type commentUsecase struct {
-	repo repository.CommentRepository
+	repo           repository.CommentRepository
+	postRepository repository.PostRepository
+	mentionUsecase MentionUsecase
 }
 
-func NewCommentUsecase(repo repository.CommentRepository) CommentUsecase {
-	return &commentUsecase{repo: repo}
+func NewCommentUsecase(repo repository.CommentRepository, postRepository repository.PostRepository, mentionUsecase MentionUsecase) CommentUsecase {
+	return &commentUsecase{repo: repo, postRepository: postRepository, mentionUsecase: mentionUsecase}
 }
 
 func (u *commentUsecase) GetCommentByID(ctx context.Context, commentID primitive.ObjectID) (models.Comments, error) {
@@ -35,19 +38,71 @@ func (u *commentUsecase) GetComments(ctx context.Context, postID primitive.Objec
 }
 
 func (u *commentUsecase) AddComment(ctx context.Context, comment models.Comments) (models.Comments, error) {
-	return u.repo.AddComment(ctx, comment)
+	mentions, err := u.mentionUsecase.ResolveMentions(ctx, comment.UserID, comment.Content)
+	if err != nil {
+		return models.Comments{}, err
+	}
+	comment.Mentions = mentions
+
+	comment, err = u.repo.AddComment(ctx, comment)
+	if err != nil {
+		return models.Comments{}, err
+	}
+	go u.notifyMentions(context.Background(), comment, nil)
+	return comment, nil
 }
 
 func (u *commentUsecase) DeleteComment(ctx context.Context, commentID, userID primitive.ObjectID) error {
 	return u.repo.DeleteComment(ctx, commentID, userID)
 }
 
+// EditComment resolves the mentions of the new content again, only the users the edit
+// newly mentions are told
 func (u *commentUsecase) EditComment(ctx context.Context, commentID, userID primitive.ObjectID, content string) (models.Comments, error) {
-	return u.repo.EditComment(ctx, commentID, userID, content)
+	previous, err := u.repo.GetCommentByID(ctx, commentID)
+	if err != nil {
+		return models.Comments{}, err
+	}
+	mentions, err := u.mentionUsecase.ResolveMentions(ctx, userID, content)
+	if err != nil {
+		return models.Comments{}, err
+	}
+
+	updated, err := u.repo.EditComment(ctx, commentID, userID, content, mentions)
+	if err != nil {
+		return models.Comments{}, err
+	}
+	go u.notifyMentions(context.Background(), updated, previous.Mentions)
+	return updated, nil
 }
 
 func (u *commentUsecase) AddReply(ctx context.Context, reply models.Comments) (models.Comments, error) {
-	return u.repo.AddReply(ctx, reply)
+	mentions, err := u.mentionUsecase.ResolveMentions(ctx, reply.UserID, reply.Content)
+	if err != nil {
+		return models.Comments{}, err
+	}
+	reply.Mentions = mentions
+
+	reply, err = u.repo.AddReply(ctx, reply)
+	if err != nil {
+		return models.Comments{}, err
+	}
+	go u.notifyMentions(context.Background(), reply, nil)
+	return reply, nil
+}
+
+// notifyMentions tells the mentioned users who are in the audience of the post of the comment
+func (u *commentUsecase) notifyMentions(ctx context.Context, comment models.Comments, previous []models.Mentions) {
+	if len(comment.Mentions) == 0 {
+		return
+	}
+	post, err := u.postRepository.GetPostByID(ctx, comment.PostID.Hex())
+	if err != nil {
+		log.Println("Could not get the post to notify the mentions of comment", comment.ID.Hex(), err)
+		return
+	}
+	mentions := audienceMentions(ctx, u.postRepository, post, comment.Mentions)
+	u.mentionUsecase.NotifyMentions(ctx, comment.UserID, comment.PostID, mentions, previous)
 }
 
 func (u *commentUsecase) GetReply(ctx context.Context, commentID primitive.ObjectID, page int) ([]models.Comments, error) {
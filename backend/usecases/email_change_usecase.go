@@ -0,0 +1,49 @@
+package usecases
+
+import (
+	"context"
+	"log"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EmailChangeUsecase interface {
+	RequestEmailChange(ctx context.Context, userID primitive.ObjectID, newEmail, password string) (models.EmailChanges, error)
+	ConfirmEmailChange(ctx context.Context, token string) (models.EmailChanges, error)
+	RevertEmailChange(ctx context.Context, token string) (models.EmailChanges, error)
+}
+
+type emailChangeUsecase struct {
+	emailChangeRepository repository.EmailChangeRepository
+	authRepository        repository.AuthRepository
+}
+
+func NewEmailChangeUsecase(emailChangeRepository repository.EmailChangeRepository, authRepository repository.AuthRepository) EmailChangeUsecase {
+	return &emailChangeUsecase{
+		emailChangeRepository: emailChangeRepository,
+		authRepository:        authRepository,
+	}
+}
+
+func (e *emailChangeUsecase) RequestEmailChange(ctx context.Context, userID primitive.ObjectID, newEmail, password string) (models.EmailChanges, error) {
+	return e.emailChangeRepository.RequestEmailChange(ctx, userID, newEmail, password)
+}
+
+func (e *emailChangeUsecase) ConfirmEmailChange(ctx context.Context, token string) (models.EmailChanges, error) {
+	return e.emailChangeRepository.ConfirmEmailChange(ctx, token)
+}
+
+// RevertEmailChange sends a password reset link to the restored address, the password can
+// not log in again until it is reset
+func (e *emailChangeUsecase) RevertEmailChange(ctx context.Context, token string) (models.EmailChanges, error) {
+	change, err := e.emailChangeRepository.RevertEmailChange(ctx, token)
+	if err != nil {
+		return change, err
+	}
+	if err := e.authRepository.ForgotPassword(ctx, models.User{Email: change.OldEmail}); err != nil {
+		log.Println("Could not send the password reset of a reverted email change:", err)
+	}
+	return change, nil
+}
@@ -0,0 +1,50 @@
+package usecases
+
+import (
+	"context"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// the errors ChangeHandle and GetUserByHandle return, the controllers answer with them
+var (
+	ErrInvalidHandle  = repository.ErrInvalidHandle
+	ErrHandleReserved = repository.ErrHandleReserved
+	ErrHandleTaken    = repository.ErrHandleTaken
+	ErrHandleCooldown = repository.ErrHandleCooldown
+	ErrHandleNotFound = repository.ErrHandleNotFound
+	ErrUserNotFound   = repository.ErrUserNotFound
+)
+
+type HandleUsecase interface {
+	GetUserByHandle(ctx context.Context, handle string) (models.UserView, error)
+	ChangeHandle(ctx context.Context, userID primitive.ObjectID, handle string) (models.UserView, error)
+	GenerateMissingHandles(ctx context.Context) (int, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type handleUsecase struct {
+	handleRepository repository.HandleRepository
+}
+
+func NewHandleUsecase(handleRepository repository.HandleRepository) HandleUsecase {
+	return &handleUsecase{handleRepository: handleRepository}
+}
+
+func (h *handleUsecase) GetUserByHandle(ctx context.Context, handle string) (models.UserView, error) {
+	return h.handleRepository.GetUserByHandle(ctx, handle)
+}
+
+func (h *handleUsecase) ChangeHandle(ctx context.Context, userID primitive.ObjectID, handle string) (models.UserView, error) {
+	return h.handleRepository.ChangeHandle(ctx, userID, handle)
+}
+
+func (h *handleUsecase) GenerateMissingHandles(ctx context.Context) (int, error) {
+	return h.handleRepository.GenerateMissingHandles(ctx)
+}
+
+func (h *handleUsecase) EnsureIndexes(ctx context.Context) error {
+	return h.handleRepository.EnsureIndexes(ctx)
+}
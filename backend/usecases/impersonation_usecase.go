@@ -0,0 +1,162 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DefaultImpersonationMinutes = 30
+	MaxImpersonationMinutes     = 120
+)
+
+var (
+	ErrImpersonateSelf       = errors.New("you can not impersonate yourself")
+	ErrImpersonateAdmin      = errors.New("super admins can not be impersonated")
+	ErrImpersonationReason   = errors.New("a reason of at most 500 characters is required")
+	ErrImpersonationDuration = errors.New("the duration must be between 1 and 120 minutes")
+)
+
+type ImpersonationUsecase interface {
+	StartImpersonation(ctx context.Context, impersonatorID, userID primitive.ObjectID, reason string, minutes int, allowWrites bool, device models.SessionDevice) (models.ImpersonationSession, error)
+	GetActiveImpersonations(ctx context.Context) ([]models.ImpersonationSession, error)
+	EndImpersonation(ctx context.Context, endedBy, sessionID primitive.ObjectID) error
+	RecordImpersonatedRequest(ctx context.Context, request models.ImpersonatedRequest)
+}
+
+type impersonationUsecase struct {
+	sessionRepository  repository.SessionRepository
+	userRepository     repository.UserRepository
+	auditLogRepository repository.AuditLogRepository
+}
+
+func NewImpersonationUsecase(
+	sessionRepository repository.SessionRepository,
+	userRepository repository.UserRepository,
+	auditLogRepository repository.AuditLogRepository,
+) ImpersonationUsecase {
+	return &impersonationUsecase{
+		sessionRepository:  sessionRepository,
+		userRepository:     userRepository,
+		auditLogRepository: auditLogRepository,
+	}
+}
+
+// StartImpersonation opens a time boxed session for the admin to see the platform as the user
+func (i *impersonationUsecase) StartImpersonation(ctx context.Context, impersonatorID, userID primitive.ObjectID, reason string, minutes int, allowWrites bool, device models.SessionDevice) (models.ImpersonationSession, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len(reason) > 500 {
+		return models.ImpersonationSession{}, ErrImpersonationReason
+	}
+	if minutes == 0 {
+		minutes = DefaultImpersonationMinutes
+	}
+	if minutes < 1 || minutes > MaxImpersonationMinutes {
+		return models.ImpersonationSession{}, ErrImpersonationDuration
+	}
+	if impersonatorID == userID {
+		return models.ImpersonationSession{}, ErrImpersonateSelf
+	}
+
+	user, err := i.userRepository.GetUserByIdNoneView(ctx, userID.Hex())
+	if err == mongo.ErrNoDocuments {
+		return models.ImpersonationSession{}, repository.ErrUserNotFound
+	}
+	if err != nil {
+		return models.ImpersonationSession{}, err
+	}
+	if user.Role == string(constants.UserRoleSuperAdmin) {
+		return models.ImpersonationSession{}, ErrImpersonateAdmin
+	}
+
+	session, err := i.sessionRepository.CreateImpersonationSession(ctx, user, impersonatorID, reason, allowWrites, time.Duration(minutes)*time.Minute, device)
+	if err != nil {
+		return models.ImpersonationSession{}, err
+	}
+	i.audit(ctx, constants.AuditImpersonationStarted, impersonatorID, userID, map[string]interface{}{
+		"session_id":   session.SessionID.Hex(),
+		"reason":       reason,
+		"allow_writes": allowWrites,
+		"expires_at":   session.ExpiresAt,
+		"ip_address":   device.IPAddress,
+	})
+	return session, nil
+}
+
+func (i *impersonationUsecase) GetActiveImpersonations(ctx context.Context) ([]models.ImpersonationSession, error) {
+	sessions, err := i.sessionRepository.GetActiveImpersonations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]models.ImpersonationSession, 0, len(sessions))
+	for _, session := range sessions {
+		views = append(views, models.ImpersonationSession{
+			SessionID:      session.ID,
+			UserID:         session.UserID,
+			ImpersonatorID: *session.ImpersonatorID,
+			Reason:         session.ImpersonationReason,
+			AllowWrites:    session.AllowWrites,
+			ExpiresAt:      session.ExpiresAt,
+			CreatedAt:      session.CreatedAt,
+		})
+	}
+	return views, nil
+}
+
+// EndImpersonation ends the session before it expires, any admin allowed to impersonate can end it
+func (i *impersonationUsecase) EndImpersonation(ctx context.Context, endedBy, sessionID primitive.ObjectID) error {
+	session, err := i.sessionRepository.EndImpersonation(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	i.audit(ctx, constants.AuditImpersonationEnded, endedBy, session.UserID, map[string]interface{}{
+		"session_id":      session.ID.Hex(),
+		"impersonator_id": session.ImpersonatorID.Hex(),
+	})
+	return nil
+}
+
+// RecordImpersonatedRequest writes one audit log per request made with an impersonation token
+func (i *impersonationUsecase) RecordImpersonatedRequest(ctx context.Context, request models.ImpersonatedRequest) {
+	impersonatorID, err := primitive.ObjectIDFromHex(request.ImpersonatorID)
+	if err != nil {
+		log.Println("Invalid impersonator id in token:", request.ImpersonatorID)
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(request.UserID)
+	if err != nil {
+		log.Println("Invalid user id in impersonation token:", request.UserID)
+		return
+	}
+	i.audit(ctx, constants.AuditImpersonatedRequest, impersonatorID, userID, map[string]interface{}{
+		"session_id": request.SessionID,
+		"method":     request.Method,
+		"path":       request.Path,
+		"ip_address": request.IPAddress,
+		"blocked":    request.Blocked,
+	})
+}
+
+func (i *impersonationUsecase) audit(ctx context.Context, action string, impersonatorID, userID primitive.ObjectID, details map[string]interface{}) {
+	err := i.auditLogRepository.CreateAuditLog(ctx, models.AuditLogs{
+		UserID:     impersonatorID,
+		Action:     action,
+		TargetType: constants.AuditTargetUser,
+		TargetID:   userID,
+		Details:    details,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		log.Println("Could not write audit log:", err)
+	}
+}
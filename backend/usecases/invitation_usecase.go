@@ -0,0 +1,367 @@
+package usecases
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/infrastructure/validation"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DefaultInvitationDays = 14
+	MaxInvitationDays     = 90
+	MaxInvitationUses     = 1000
+	MaxBulkInviteRows     = 1000
+)
+
+type InvitationUsecase interface {
+	CreateInvitation(ctx context.Context, createdBy primitive.ObjectID, invitation models.Invitations, expiresInDays int, scope models.AccessScope) (models.Invitations, error)
+	BulkInvite(ctx context.Context, createdBy primitive.ObjectID, template models.Invitations, expiresInDays int, file io.Reader, scope models.AccessScope) (models.BulkInviteResult, error)
+	GetInvitations(ctx context.Context, page int, scope models.AccessScope) ([]models.Invitations, error)
+	RevokeInvitation(ctx context.Context, revokedBy, invitationID primitive.ObjectID, scope models.AccessScope) error
+	GetRedemptions(ctx context.Context, invitationID primitive.ObjectID, scope models.AccessScope) ([]models.InvitationRedemptions, error)
+	PreviewInvitation(ctx context.Context, code string) (models.InvitationPreview, error)
+	RedeemInvitation(ctx context.Context, userID primitive.ObjectID, code string) (models.Invitations, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type invitationUsecase struct {
+	invitationRepository repository.InvitationRepository
+	userRepository       repository.UserRepository
+	auditLogRepository   repository.AuditLogRepository
+}
+
+func NewInvitationUsecase(
+	invitationRepository repository.InvitationRepository,
+	userRepository repository.UserRepository,
+	auditLogRepository repository.AuditLogRepository,
+) InvitationUsecase {
+	return &invitationUsecase{
+		invitationRepository: invitationRepository,
+		userRepository:       userRepository,
+		auditLogRepository:   auditLogRepository,
+	}
+}
+
+// CreateInvitation makes a code for a cohort, or a single use one when it is sent to an email
+func (i *invitationUsecase) CreateInvitation(ctx context.Context, createdBy primitive.ObjectID, invitation models.Invitations, expiresInDays int, scope models.AccessScope) (models.Invitations, error) {
+	if invitation.Email != "" {
+		normalized, err := validation.NormalizeEmail(invitation.Email)
+		if err != nil {
+			return models.Invitations{}, repository.ErrInvitationAddress
+		}
+		invitation.Email = normalized
+		invitation.MaxUses = 1
+	}
+	if invitation.MaxUses == 0 {
+		invitation.MaxUses = 1
+	}
+	if invitation.MaxUses < 1 || invitation.MaxUses > MaxInvitationUses {
+		return models.Invitations{}, repository.ErrInvitationUses
+	}
+	if err := i.prepare(ctx, createdBy, &invitation, expiresInDays, scope); err != nil {
+		return models.Invitations{}, err
+	}
+
+	created, err := i.invitationRepository.CreateInvitations(ctx, []models.Invitations{invitation})
+	if err != nil {
+		return models.Invitations{}, err
+	}
+	invitation = created[0]
+	if invitation.Email != "" {
+		if _, err := i.invitationRepository.EnqueueInvitationEmails(ctx, created); err != nil {
+			log.Println("Could not queue the invitation email:", err)
+		}
+	}
+	i.audit(ctx, constants.AuditInvitationCreated, createdBy, invitation.ID, map[string]interface{}{
+		"university_id": invitation.UniversityID,
+		"department_id": invitation.DepartmentID,
+		"max_uses":      invitation.MaxUses,
+		"email":         invitation.Email,
+	})
+	return invitation, nil
+}
+
+// BulkInvite reads a CSV with an email column and an optional acedemic_year column, every
+// new address gets a single use invitation emailed through the emails queue
+func (i *invitationUsecase) BulkInvite(ctx context.Context, createdBy primitive.ObjectID, template models.Invitations, expiresInDays int, file io.Reader, scope models.AccessScope) (models.BulkInviteResult, error) {
+	template.Email = ""
+	template.MaxUses = 1
+	if err := i.prepare(ctx, createdBy, &template, expiresInDays, scope); err != nil {
+		return models.BulkInviteResult{}, err
+	}
+
+	rows, err := readInviteCSV(file)
+	if err != nil {
+		return models.BulkInviteResult{}, err
+	}
+
+	result := models.BulkInviteResult{Skipped: []models.BulkInviteSkip{}}
+	seen := map[string]bool{}
+	yearErrors := map[int]error{}
+	invitations := []models.Invitations{}
+	emails := []string{}
+	for _, row := range rows {
+		address, err := validation.NormalizeEmail(row.email)
+		if err != nil {
+			result.Skipped = append(result.Skipped, models.BulkInviteSkip{Row: row.line, Email: row.email, Reason: err.Error()})
+			continue
+		}
+		if seen[address] {
+			result.Skipped = append(result.Skipped, models.BulkInviteSkip{Row: row.line, Email: address, Reason: "duplicate email"})
+			continue
+		}
+		seen[address] = true
+
+		invitation := template
+		invitation.Email = address
+		if row.year != 0 {
+			invitation.AcedemicYear = row.year
+			if _, checked := yearErrors[row.year]; !checked {
+				yearErrors[row.year] = i.invitationRepository.ValidateBinding(ctx, invitation)
+			}
+			if err := yearErrors[row.year]; err != nil {
+				result.Skipped = append(result.Skipped, models.BulkInviteSkip{Row: row.line, Email: address, Reason: err.Error()})
+				continue
+			}
+		}
+		invitations = append(invitations, invitation)
+		emails = append(emails, address)
+	}
+
+	registered, err := i.invitationRepository.GetRegisteredEmails(ctx, emails)
+	if err != nil {
+		return models.BulkInviteResult{}, err
+	}
+	pending := invitations[:0]
+	for _, invitation := range invitations {
+		if registered[invitation.Email] {
+			result.Skipped = append(result.Skipped, models.BulkInviteSkip{Email: invitation.Email, Reason: "already has an account"})
+			continue
+		}
+		pending = append(pending, invitation)
+	}
+
+	created, err := i.invitationRepository.CreateInvitations(ctx, pending)
+	if err != nil {
+		return models.BulkInviteResult{}, err
+	}
+	queued, err := i.invitationRepository.EnqueueInvitationEmails(ctx, created)
+	if err != nil {
+		log.Println("Could not queue all the invitation emails:", err)
+		for _, invitation := range created[queued:] {
+			result.Skipped = append(result.Skipped, models.BulkInviteSkip{Email: invitation.Email, Reason: "the email could not be queued, revoke and invite again"})
+		}
+	}
+	result.Invited = queued
+
+	i.audit(ctx, constants.AuditInvitationsInvited, createdBy, primitive.NilObjectID, map[string]interface{}{
+		"university_id": template.UniversityID,
+		"department_id": template.DepartmentID,
+		"invited":       result.Invited,
+		"skipped":       len(result.Skipped),
+	})
+	return result, nil
+}
+
+// prepare fills what every invitation needs and checks the admin may invite there
+func (i *invitationUsecase) prepare(ctx context.Context, createdBy primitive.ObjectID, invitation *models.Invitations, expiresInDays int, scope models.AccessScope) error {
+	if expiresInDays == 0 {
+		expiresInDays = DefaultInvitationDays
+	}
+	if expiresInDays < 1 || expiresInDays > MaxInvitationDays {
+		return repository.ErrInvitationExpiry
+	}
+	if !invitationInScope(*invitation, scope) {
+		return repository.ErrInvitationOutOfScope
+	}
+	if err := i.invitationRepository.ValidateBinding(ctx, *invitation); err != nil {
+		return err
+	}
+	invitation.CreatedBy = createdBy
+	invitation.ExpiresAt = time.Now().AddDate(0, 0, expiresInDays)
+	invitation.RevokedAt = nil
+	return nil
+}
+
+// invitationInScope is true when the scope covers the narrowest place the invitation is bound
+// to, a school or university invitation needs a grant on the whole school or university
+func invitationInScope(invitation models.Invitations, scope models.AccessScope) bool {
+	switch {
+	case invitation.DepartmentID != nil:
+		return scope.AllowsDepartment(*invitation.DepartmentID)
+	case invitation.SchoolID != nil:
+		return scope.AllowsSchool(*invitation.SchoolID)
+	default:
+		return scope.AllowsUniversity(invitation.UniversityID)
+	}
+}
+
+type inviteRow struct {
+	line  int
+	email string
+	year  int
+}
+
+func readInviteCSV(file io.Reader) ([]inviteRow, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, repository.ErrInvitationCSV
+	}
+	emailColumn, yearColumn := -1, -1
+	for index, name := range header {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) {
+		case "email":
+			emailColumn = index
+		case "acedemic_year", "academic_year", "year":
+			yearColumn = index
+		}
+	}
+	if emailColumn < 0 {
+		return nil, repository.ErrInvitationCSV
+	}
+
+	rows := []inviteRow{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, repository.ErrInvitationCSV
+		}
+		if len(rows) == MaxBulkInviteRows {
+			return nil, repository.ErrInvitationCSV
+		}
+		row := inviteRow{line: line}
+		if emailColumn < len(record) {
+			row.email = strings.TrimSpace(record[emailColumn])
+		}
+		if yearColumn >= 0 && yearColumn < len(record) && strings.TrimSpace(record[yearColumn]) != "" {
+			year, err := strconv.Atoi(strings.TrimSpace(record[yearColumn]))
+			if err != nil || year < 1 {
+				year = -1 // rejected by the binding check
+			}
+			row.year = year
+		}
+		if row.email == "" && row.year == 0 {
+			continue // blank line
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func (i *invitationUsecase) GetInvitations(ctx context.Context, page int, scope models.AccessScope) ([]models.Invitations, error) {
+	return i.invitationRepository.GetInvitations(ctx, page, scope)
+}
+
+func (i *invitationUsecase) RevokeInvitation(ctx context.Context, revokedBy, invitationID primitive.ObjectID, scope models.AccessScope) error {
+	if _, err := i.scopedInvitation(ctx, invitationID, scope); err != nil {
+		return err
+	}
+	if err := i.invitationRepository.RevokeInvitation(ctx, invitationID); err != nil {
+		return err
+	}
+	i.audit(ctx, constants.AuditInvitationRevoked, revokedBy, invitationID, nil)
+	return nil
+}
+
+func (i *invitationUsecase) GetRedemptions(ctx context.Context, invitationID primitive.ObjectID, scope models.AccessScope) ([]models.InvitationRedemptions, error) {
+	if _, err := i.scopedInvitation(ctx, invitationID, scope); err != nil {
+		return nil, err
+	}
+	return i.invitationRepository.GetRedemptions(ctx, invitationID)
+}
+
+// scopedInvitation hides the invitations outside the scope as if they did not exist
+func (i *invitationUsecase) scopedInvitation(ctx context.Context, invitationID primitive.ObjectID, scope models.AccessScope) (models.Invitations, error) {
+	invitation, err := i.invitationRepository.GetInvitationByID(ctx, invitationID)
+	if err != nil {
+		return models.Invitations{}, err
+	}
+	if !invitationInScope(invitation, scope) {
+		return models.Invitations{}, repository.ErrInvitationNotFound
+	}
+	return invitation, nil
+}
+
+func (i *invitationUsecase) PreviewInvitation(ctx context.Context, code string) (models.InvitationPreview, error) {
+	invitation, err := i.invitationRepository.GetInvitationByCode(ctx, code)
+	if err != nil {
+		return models.InvitationPreview{}, err
+	}
+	return models.InvitationPreview{
+		UniversityID: invitation.UniversityID,
+		SchoolID:     invitation.SchoolID,
+		DepartmentID: invitation.DepartmentID,
+		AcedemicYear: invitation.AcedemicYear,
+		Email:        invitation.Email,
+		ExpiresAt:    invitation.ExpiresAt,
+	}, nil
+}
+
+// RedeemInvitation places an existing account, one made with a login provider for example,
+// where the invitation says instead of going through CompleteUser
+func (i *invitationUsecase) RedeemInvitation(ctx context.Context, userID primitive.ObjectID, code string) (models.Invitations, error) {
+	user, err := i.userRepository.GetUserByIdNoneView(ctx, userID.Hex())
+	if err == mongo.ErrNoDocuments {
+		return models.Invitations{}, repository.ErrUserNotFound
+	}
+	if err != nil {
+		return models.Invitations{}, err
+	}
+
+	invitation, err := i.invitationRepository.GetInvitationByCode(ctx, code)
+	if err != nil {
+		return models.Invitations{}, err
+	}
+	if user.UniversityID != nil && *user.UniversityID != invitation.UniversityID {
+		return models.Invitations{}, repository.ErrInvitationUniversity
+	}
+
+	invitation, err = i.invitationRepository.Redeem(ctx, code, user.ID, user.Email)
+	if err != nil {
+		return models.Invitations{}, err
+	}
+	if err := i.invitationRepository.ApplyInvitation(ctx, user.ID, invitation); err != nil {
+		if cancelErr := i.invitationRepository.CancelRedemption(ctx, invitation.ID, user.ID); cancelErr != nil {
+			log.Println("Could not give back the invitation use:", cancelErr)
+		}
+		return models.Invitations{}, err
+	}
+	return invitation, nil
+}
+
+func (i *invitationUsecase) EnsureIndexes(ctx context.Context) error {
+	return i.invitationRepository.EnsureIndexes(ctx)
+}
+
+func (i *invitationUsecase) audit(ctx context.Context, action string, actorID, invitationID primitive.ObjectID, details map[string]interface{}) {
+	err := i.auditLogRepository.CreateAuditLog(ctx, models.AuditLogs{
+		UserID:     actorID,
+		Action:     action,
+		TargetType: constants.AuditTargetInvitation,
+		TargetID:   invitationID,
+		Details:    details,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		log.Println("Could not write audit log:", err)
+	}
+}
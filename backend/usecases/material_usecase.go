@@ -16,6 +16,7 @@ type MaterialUseCase interface {
 	UpdateMaterial(ctx context.Context, material models.Materials) (models.Materials, error)
 	DeleteMaterial(ctx context.Context, userID primitive.ObjectID, id primitive.ObjectID) error
 	GetMaterialsInTree(ctx context.Context, departmentID primitive.ObjectID, year int, semester int) ([]models.Materials, error)
+	GetMaterialsWithListOfId(ctx context.Context, materialIDs []primitive.ObjectID) ([]models.Materials, error)
 }
 
 type materialUseCase struct {
@@ -40,6 +41,9 @@ func (m *materialUseCase) DeleteMaterial(ctx context.Context, userID primitive.O
 func (m *materialUseCase) GetMaterialsInTree(ctx context.Context, departmentID primitive.ObjectID, year int, semester int) ([]models.Materials, error) {
 	return m.materialRepository.GetMaterialsInTree(ctx, departmentID, year, semester)
 }
+func (m *materialUseCase) GetMaterialsWithListOfId(ctx context.Context, materialIDs []primitive.ObjectID) ([]models.Materials, error) {
+	return m.materialRepository.GetMaterialsWithListOfId(ctx, materialIDs)
+}
 func NewMaterialUseCase(materialRepository repository.MaterialsRepository) MaterialUseCase {
 	return &materialUseCase{
 		materialRepository: materialRepository,
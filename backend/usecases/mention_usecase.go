@@ -0,0 +1,157 @@
+package usecases
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxMentions keeps one post from notifying half of the university
+const MaxMentions = 20
+
+// an @ inside a word is an email address, not a mention
+var mentionPattern = regexp.MustCompile(`(^|[^\w@])@([A-Za-z0-9_]{3,30})\b`)
+
+type MentionUsecase interface {
+	ResolveMentions(ctx context.Context, authorID primitive.ObjectID, content string) ([]models.Mentions, error)
+	NotifyMentions(ctx context.Context, authorID, contentID primitive.ObjectID, mentions, previous []models.Mentions)
+}
+
+type mentionUsecase struct {
+	userRepository      repository.UserRepository
+	connectRepository   repository.ConnectRepository
+	notificationUsecase NotificationUsecase
+}
+
+func NewMentionUsecase(userRepository repository.UserRepository, connectRepository repository.ConnectRepository, notificationUsecase NotificationUsecase) MentionUsecase {
+	return &mentionUsecase{
+		userRepository:      userRepository,
+		connectRepository:   connectRepository,
+		notificationUsecase: notificationUsecase,
+	}
+}
+
+// ResolveMentions finds the @handles of the content the author can mention, a handle nobody
+// has, of an account that is being deleted or of a user who does not take mentions from the
+// author stays plain text
+func (m *mentionUsecase) ResolveMentions(ctx context.Context, authorID primitive.ObjectID, content string) ([]models.Mentions, error) {
+	matches := mentionPattern.FindAllStringSubmatchIndex(content, -1)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	handles := make([]string, 0, len(matches))
+	seen := map[string]bool{}
+	for _, match := range matches {
+		handle := strings.ToLower(content[match[4]:match[5]])
+		if !seen[handle] && len(handles) < MaxMentions {
+			seen[handle] = true
+			handles = append(handles, handle)
+		}
+	}
+
+	users, err := m.userRepository.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		return nil, err
+	}
+	byHandle := make(map[string]models.UserView, len(users))
+	for _, user := range users {
+		mentionable, err := m.mentionable(ctx, authorID, user)
+		if err != nil {
+			return nil, err
+		}
+		if mentionable {
+			byHandle[strings.ToLower(user.Handle)] = user
+		}
+	}
+
+	mentions := []models.Mentions{}
+	for _, match := range matches {
+		user, ok := byHandle[strings.ToLower(content[match[4]:match[5]])]
+		if !ok {
+			continue
+		}
+		// the @ is right before the handle, offsets count characters for the clients
+		at := match[4] - 1
+		mentions = append(mentions, models.Mentions{
+			UserID: user.ID,
+			Handle: user.Handle,
+			Offset: utf8.RuneCountInString(content[:at]),
+			Length: utf8.RuneCountInString(content[at:match[5]]),
+		})
+	}
+	if len(mentions) == 0 {
+		return nil, nil
+	}
+	return mentions, nil
+}
+
+// mentionable checks the mention setting of the user, users can always mention themselves
+func (m *mentionUsecase) mentionable(ctx context.Context, authorID primitive.ObjectID, user models.UserView) (bool, error) {
+	if user.ID == authorID {
+		return true, nil
+	}
+	switch user.MentionsFrom {
+	case constants.MentionsFromNobody:
+		return false, nil
+	case constants.MentionsFromConnections:
+		return m.connectRepository.IsConnected(ctx, models.Connects{ConnectorID: authorID, ConnecteeID: user.ID})
+	}
+	return true, nil
+}
+
+// NotifyMentions tells every mentioned user once, the ones in previous were told about an
+// earlier version of the content already
+func (m *mentionUsecase) NotifyMentions(ctx context.Context, authorID, contentID primitive.ObjectID, mentions, previous []models.Mentions) {
+	notified := map[primitive.ObjectID]bool{authorID: true}
+	for _, mention := range previous {
+		notified[mention.UserID] = true
+	}
+
+	for _, mention := range mentions {
+		if notified[mention.UserID] {
+			continue
+		}
+		notified[mention.UserID] = true
+		err := m.notificationUsecase.SendNotification(ctx, &models.Notifications{
+			ID:        primitive.NewObjectID(),
+			UserID:    authorID,
+			To:        mention.UserID,
+			Type:      string(constants.MentionedYou),
+			Content:   constants.MentionedYouMessage,
+			ContentID: &contentID,
+			IsRead:    false,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			log.Println("Could not notify the mention of", mention.UserID.Hex(), err)
+		}
+	}
+}
+
+// NewMentionViews pairs the mentions with their users keyed by the hex of their id, a
+// mention of a user that is gone is dropped
+func NewMentionViews(mentions []models.Mentions, users map[string]models.UserView) []models.MentionView {
+	views := make([]models.MentionView, 0, len(mentions))
+	for _, mention := range mentions {
+		user, ok := users[mention.UserID.Hex()]
+		if !ok {
+			continue
+		}
+		views = append(views, models.MentionView{
+			User:   user,
+			Handle: mention.Handle,
+			Offset: mention.Offset,
+			Length: mention.Length,
+		})
+	}
+	return views
+}
@@ -0,0 +1,57 @@
+package usecases
+
+import (
+	"context"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MFAUsecase interface {
+	VerifyChallenge(ctx context.Context, challengeToken, code, recoveryCode string, device models.SessionDevice) (models.AuthTokens, error)
+	BeginEnrollment(ctx context.Context, userID primitive.ObjectID) (models.TOTPEnrollment, error)
+	ConfirmEnrollment(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error)
+	BeginChallengeEnrollment(ctx context.Context, challengeToken string) (models.TOTPEnrollment, error)
+	ConfirmChallengeEnrollment(ctx context.Context, challengeToken, code string, device models.SessionDevice) ([]string, models.AuthTokens, error)
+	DisableTwoFactor(ctx context.Context, userID primitive.ObjectID, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error)
+}
+
+type mfaUsecase struct {
+	mfaRepository repository.MFARepository
+}
+
+func NewMFAUsecase(mfaRepository repository.MFARepository) MFAUsecase {
+	return &mfaUsecase{
+		mfaRepository: mfaRepository,
+	}
+}
+
+func (m *mfaUsecase) VerifyChallenge(ctx context.Context, challengeToken, code, recoveryCode string, device models.SessionDevice) (models.AuthTokens, error) {
+	return m.mfaRepository.VerifyChallenge(ctx, challengeToken, code, recoveryCode, device)
+}
+
+func (m *mfaUsecase) BeginEnrollment(ctx context.Context, userID primitive.ObjectID) (models.TOTPEnrollment, error) {
+	return m.mfaRepository.BeginEnrollment(ctx, userID)
+}
+
+func (m *mfaUsecase) ConfirmEnrollment(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error) {
+	return m.mfaRepository.ConfirmEnrollment(ctx, userID, code)
+}
+
+func (m *mfaUsecase) BeginChallengeEnrollment(ctx context.Context, challengeToken string) (models.TOTPEnrollment, error) {
+	return m.mfaRepository.BeginChallengeEnrollment(ctx, challengeToken)
+}
+
+func (m *mfaUsecase) ConfirmChallengeEnrollment(ctx context.Context, challengeToken, code string, device models.SessionDevice) ([]string, models.AuthTokens, error) {
+	return m.mfaRepository.ConfirmChallengeEnrollment(ctx, challengeToken, code, device)
+}
+
+func (m *mfaUsecase) DisableTwoFactor(ctx context.Context, userID primitive.ObjectID, code string) error {
+	return m.mfaRepository.DisableTwoFactor(ctx, userID, code)
+}
+
+func (m *mfaUsecase) RegenerateRecoveryCodes(ctx context.Context, userID primitive.ObjectID, code string) ([]string, error) {
+	return m.mfaRepository.RegenerateRecoveryCodes(ctx, userID, code)
+}
@@ -0,0 +1,92 @@
+package usecases
+
+import (
+	"context"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const PollUpdateMessage = "poll-update"
+
+type PollUsecase interface {
+	Vote(ctx context.Context, postID, userID primitive.ObjectID, choices []int) (*models.PollView, error)
+	GetVotes(ctx context.Context, userID primitive.ObjectID, postIDs []primitive.ObjectID) (map[primitive.ObjectID][]int, error)
+	GetPollVotes(ctx context.Context, postID primitive.ObjectID) ([]models.PollVotes, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type pollUsecase struct {
+	pollRepository   repository.PollRepository
+	webSocketUsecase WebSocketUsecase
+}
+
+func NewPollUsecase(pollRepository repository.PollRepository, webSocketUsecase WebSocketUsecase) PollUsecase {
+	return &pollUsecase{
+		pollRepository:   pollRepository,
+		webSocketUsecase: webSocketUsecase,
+	}
+}
+
+// PostTopic is the socket topic the live updates of a post are sent on
+func PostTopic(postID primitive.ObjectID) string {
+	return "post:" + postID.Hex()
+}
+
+// NewPollView shows the poll to a viewer who chose the voted options
+func NewPollView(poll *models.Polls, voted []int) *models.PollView {
+	if poll == nil {
+		return nil
+	}
+	if voted == nil {
+		voted = []int{}
+	}
+	return &models.PollView{
+		Question:       poll.Question,
+		Options:        poll.Options,
+		MultipleChoice: poll.MultipleChoice,
+		Anonymous:      poll.Anonymous,
+		ClosesAt:       poll.ClosesAt,
+		Closed:         poll.ClosesAt != nil && !poll.ClosesAt.After(time.Now()),
+		Voters:         poll.Voters,
+		Voted:          voted,
+	}
+}
+
+// Vote counts the vote and pushes the new tallies to everyone watching the post
+func (p *pollUsecase) Vote(ctx context.Context, postID, userID primitive.ObjectID, choices []int) (*models.PollView, error) {
+	poll, err := p.pollRepository.Vote(ctx, postID, userID, choices)
+	if err != nil {
+		return nil, err
+	}
+
+	go p.webSocketUsecase.Broadcast(context.Background(), PostTopic(postID), models.PollUpdate{
+		Type:    PollUpdateMessage,
+		PostID:  postID,
+		Options: poll.Options,
+		Voters:  poll.Voters,
+	})
+	return NewPollView(&poll, choices), nil
+}
+
+func (p *pollUsecase) GetVotes(ctx context.Context, userID primitive.ObjectID, postIDs []primitive.ObjectID) (map[primitive.ObjectID][]int, error) {
+	votes, err := p.pollRepository.GetVotes(ctx, userID, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	voted := make(map[primitive.ObjectID][]int, len(votes))
+	for _, vote := range votes {
+		voted[vote.PostID] = vote.Options
+	}
+	return voted, nil
+}
+
+func (p *pollUsecase) GetPollVotes(ctx context.Context, postID primitive.ObjectID) ([]models.PollVotes, error) {
+	return p.pollRepository.GetPollVotes(ctx, postID)
+}
+
+func (p *pollUsecase) EnsureIndexes(ctx context.Context) error {
+	return p.pollRepository.EnsureIndexes(ctx)
+}
@@ -2,33 +2,63 @@ package usecases
 
 import (
 	"context"
+	"encoding/json"
+	"log"
+	"time"
 
+	"github.com/chera-mihiretu/IKnow/domain/constants"
 	"github.com/chera-mihiretu/IKnow/domain/models"
 	"github.com/chera-mihiretu/IKnow/repository"
+	"github.com/hibiken/asynq"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type PostUseCase interface {
 	GetPosts(ctx context.Context, userID string, page int) ([]models.Posts, error)
 	GetPostByID(ctx context.Context, id string) (models.Posts, error)
-	GetPostsByUserID(ctx context.Context, userID string, page int) ([]models.Posts, error)
+	GetPostsByUserID(ctx context.Context, userID string, viewerID primitive.ObjectID, page int) ([]models.Posts, error)
 	CreatePost(ctx context.Context, post models.Posts) (models.Posts, error)
-	UpdatePost(ctx context.Context, post models.Posts) (models.Posts, error)
+	UpdatePost(ctx context.Context, post models.Posts) (models.Posts, bool, error)
 	DeletePost(ctx context.Context, userID string, postID string) error
-	SearchPosts(ctx context.Context, query string, page int) ([]models.Posts, error)
+	SearchPosts(ctx context.Context, query string, viewerID primitive.ObjectID, page int) ([]models.Posts, error)
 	GetPostsWithListOfId(ctx context.Context, postIDs []primitive.ObjectID) ([]models.Posts, error)
-	GetUnverifiedPosts(ctx context.Context, page int) ([]models.Posts, error)
+	GetUnverifiedPosts(ctx context.Context, page int, scope models.AccessScope) ([]models.Posts, error)
 	VerifyPosts(ctx context.Context, postID primitive.ObjectID) (primitive.ObjectID, error)
 	RemoveUnverifiedPost(ctx context.Context, postID primitive.ObjectID) (primitive.ObjectID, error)
+	GetPostRevisions(ctx context.Context, postID primitive.ObjectID) ([]models.PostRevisions, error)
+	GetDrafts(ctx context.Context, userID primitive.ObjectID, page int) ([]models.Posts, error)
+	SchedulePost(ctx context.Context, userID, postID primitive.ObjectID, publishAt time.Time) (models.Posts, error)
+	CancelSchedule(ctx context.Context, userID, postID primitive.ObjectID) (models.Posts, error)
+	PublishPost(ctx context.Context, userID, postID primitive.ObjectID) (models.Posts, error)
+	HandlePublishPostTask(ctx context.Context, task *asynq.Task) error
+	GetPostsByTag(ctx context.Context, tag string, viewerID primitive.ObjectID, page int) ([]models.Posts, error)
+	CanView(ctx context.Context, viewerID, postID primitive.ObjectID) (bool, error)
+	GetVisiblePostIDs(ctx context.Context, viewerID primitive.ObjectID, postIDs []primitive.ObjectID) (map[primitive.ObjectID]bool, error)
+	EnsureIndexes(ctx context.Context) error
 }
 
 type postUseCase struct {
-	postRepository repository.PostRepository
+	postRepository      repository.PostRepository
+	connectRepository   repository.ConnectRepository
+	notificationUsecase NotificationUsecase
+	tagExtractor        repository.TagExtractorRepository
+	mentionUsecase      MentionUsecase
 }
 
-func NewPostUseCase(repository repository.PostRepository) PostUseCase {
+func NewPostUseCase(
+	repository repository.PostRepository,
+	connect repository.ConnectRepository,
+	notification NotificationUsecase,
+	tagExtractor repository.TagExtractorRepository,
+	mention MentionUsecase,
+) PostUseCase {
 	return &postUseCase{
-		postRepository: repository,
+		postRepository:      repository,
+		connectRepository:   connect,
+		notificationUsecase: notification,
+		tagExtractor:        tagExtractor,
+		mentionUsecase:      mention,
 	}
 }
 func (p *postUseCase) RemoveUnverifiedPost(ctx context.Context, postID primitive.ObjectID) (primitive.ObjectID, error) {
@@ -37,15 +67,37 @@ func (p *postUseCase) RemoveUnverifiedPost(ctx context.Context, postID primitive
 func (p *postUseCase) VerifyPosts(ctx context.Context, postID primitive.ObjectID) (primitive.ObjectID, error) {
 	return p.postRepository.VerifyPosts(ctx, postID)
 }
-func (p *postUseCase) GetUnverifiedPosts(ctx context.Context, page int) ([]models.Posts, error) {
-	return p.postRepository.GetUnverifiedPosts(ctx, page)
+func (p *postUseCase) GetUnverifiedPosts(ctx context.Context, page int, scope models.AccessScope) ([]models.Posts, error) {
+	return p.postRepository.GetUnverifiedPosts(ctx, page, scope)
 }
 func (p *postUseCase) GetPostsWithListOfId(ctx context.Context, postIDs []primitive.ObjectID) ([]models.Posts, error) {
 	return p.postRepository.GetPostsWithListOfId(ctx, postIDs)
 }
 
-func (p *postUseCase) GetPostsByUserID(ctx context.Context, userID string, page int) ([]models.Posts, error) {
-	return p.postRepository.GetPostsByUserID(ctx, userID, page)
+func (p *postUseCase) GetPostsByUserID(ctx context.Context, userID string, viewerID primitive.ObjectID, page int) ([]models.Posts, error) {
+	return p.postRepository.GetPostsByUserID(ctx, userID, viewerID, page)
+}
+
+// CanView is true when the viewer can see the post
+func (p *postUseCase) CanView(ctx context.Context, viewerID, postID primitive.ObjectID) (bool, error) {
+	visible, err := p.GetVisiblePostIDs(ctx, viewerID, []primitive.ObjectID{postID})
+	if err != nil {
+		return false, err
+	}
+	return visible[postID], nil
+}
+
+// GetVisiblePostIDs tells which of the posts the viewer can see
+func (p *postUseCase) GetVisiblePostIDs(ctx context.Context, viewerID primitive.ObjectID, postIDs []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	ids, err := p.postRepository.GetVisiblePostIDs(ctx, viewerID, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	visible := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		visible[id] = true
+	}
+	return visible, nil
 }
 
 func (p *postUseCase) GetPosts(ctx context.Context, userID string, page int) ([]models.Posts, error) {
@@ -55,15 +107,220 @@ func (p *postUseCase) GetPostByID(ctx context.Context, id string) (models.Posts,
 	return p.postRepository.GetPostByID(ctx, id)
 }
 func (p *postUseCase) CreatePost(ctx context.Context, post models.Posts) (models.Posts, error) {
-	return p.postRepository.CreatePost(ctx, post)
+	mentions, err := p.mentionUsecase.ResolveMentions(ctx, post.UserID, post.Content)
+	if err != nil {
+		return models.Posts{}, err
+	}
+	post.Mentions = mentions
+
+	post, err = p.postRepository.CreatePost(ctx, post)
+	if err != nil {
+		return models.Posts{}, err
+	}
+	// the tags given with the post are kept ahead of the extracted ones
+	go p.tagPost(post.ID, post.Content, post.Tags)
+	// drafts and scheduled posts tell the mentioned users when they are published
+	if isVisible(post) {
+		go p.notifyMentions(context.Background(), post, nil)
+	}
+	return post, nil
+}
+
+// UpdatePost edits the post, the bool tells whether the new content went through moderation again
+func (p *postUseCase) UpdatePost(ctx context.Context, post models.Posts) (models.Posts, bool, error) {
+	mentions, err := p.mentionUsecase.ResolveMentions(ctx, post.UserID, post.Content)
+	if err != nil {
+		return models.Posts{}, false, err
+	}
+	post.Mentions = mentions
+
+	previous, err := p.postRepository.GetPostByID(ctx, post.ID.Hex())
+	if err != nil {
+		return models.Posts{}, false, err
+	}
+	updated, err := p.postRepository.UpdatePost(ctx, post)
+	if err != nil {
+		return models.Posts{}, false, err
+	}
+	// the tags the author gave stay, only the extracted ones follow the new content
+	go p.tagPost(updated.ID, updated.Content, previous.AuthorTags)
+	// only the users the edit newly mentions are told
+	if isVisible(updated) {
+		go p.notifyMentions(context.Background(), updated, previous.Mentions)
+	}
+	// only a published edit that changed the content adds a revision and is moderated
+	return updated, updated.Revisions > previous.Revisions, nil
 }
-func (p *postUseCase) UpdatePost(ctx context.Context, post models.Posts) (models.Posts, error) {
-	return p.postRepository.UpdatePost(ctx, post)
+
+// isVisible is true for a published post that passed moderation
+func isVisible(post models.Posts) bool {
+	return post.IsValidated && post.Status != constants.PostStatusDraft && post.Status != constants.PostStatusScheduled
+}
+
+func (p *postUseCase) tagPost(postID primitive.ObjectID, content string, keep []string) {
+	tagPost(p.postRepository, p.tagExtractor, postID, content, keep)
+}
+
+// tagPost extracts the tags of the content in the background, it is slow on long posts
+func tagPost(postRepository repository.PostRepository, tagExtractor repository.TagExtractorRepository, postID primitive.ObjectID, content string, keep []string) {
+	if content == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tags, err := tagExtractor.ExtractTags(ctx, content)
+	if err != nil {
+		log.Println("Could not extract the tags of post", postID.Hex(), err)
+		return
+	}
+	tags = repository.NormalizeTags(append(append([]string{}, keep...), tags...))
+	if err := postRepository.SetTags(ctx, postID, content, tags); err != nil {
+		log.Println("Could not save the tags of post", postID.Hex(), err)
+	}
+}
+
+func (p *postUseCase) GetPostsByTag(ctx context.Context, tag string, viewerID primitive.ObjectID, page int) ([]models.Posts, error) {
+	return p.postRepository.GetPostsByTag(ctx, tag, viewerID, page)
+}
+func (p *postUseCase) GetPostRevisions(ctx context.Context, postID primitive.ObjectID) ([]models.PostRevisions, error) {
+	return p.postRepository.GetPostRevisions(ctx, postID)
 }
 func (p *postUseCase) DeletePost(ctx context.Context, userID string, postID string) error {
 	return p.postRepository.DeletePost(ctx, userID, postID)
 }
 
-func (p *postUseCase) SearchPosts(ctx context.Context, query string, page int) ([]models.Posts, error) {
-	return p.postRepository.SearchPosts(ctx, query, page)
+func (p *postUseCase) SearchPosts(ctx context.Context, query string, viewerID primitive.ObjectID, page int) ([]models.Posts, error) {
+	return p.postRepository.SearchPosts(ctx, query, viewerID, page)
+}
+
+func (p *postUseCase) GetDrafts(ctx context.Context, userID primitive.ObjectID, page int) ([]models.Posts, error) {
+	return p.postRepository.GetDrafts(ctx, userID, page)
+}
+
+func (p *postUseCase) SchedulePost(ctx context.Context, userID, postID primitive.ObjectID, publishAt time.Time) (models.Posts, error) {
+	return p.postRepository.SchedulePost(ctx, userID, postID, publishAt)
+}
+
+func (p *postUseCase) CancelSchedule(ctx context.Context, userID, postID primitive.ObjectID) (models.Posts, error) {
+	return p.postRepository.CancelSchedule(ctx, userID, postID)
+}
+
+// PublishPost publishes a draft or a scheduled post of the user right away
+func (p *postUseCase) PublishPost(ctx context.Context, userID, postID primitive.ObjectID) (models.Posts, error) {
+	post, err := p.postRepository.PublishPost(ctx, postID, &userID, nil)
+	if err != nil {
+		return models.Posts{}, err
+	}
+	go p.notifyPublished(context.Background(), post, false)
+	return post, nil
+}
+
+// HandlePublishPostTask runs on the posts queue at the time a post was scheduled for,
+// a post that was rescheduled, cancelled or deleted since is skipped
+func (p *postUseCase) HandlePublishPostTask(ctx context.Context, task *asynq.Task) error {
+	var payload models.PublishPostTask
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return err
+	}
+
+	post, err := p.postRepository.PublishPost(ctx, payload.PostID, nil, &payload.PublishAt)
+	if err == repository.ErrPostNotScheduled || err == repository.ErrPostEditConflict || err == mongo.ErrNoDocuments {
+		log.Println("Skipping the publish task of post", payload.PostID.Hex(), err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p.notifyPublished(ctx, post, true)
+	return nil
+}
+
+func (p *postUseCase) EnsureIndexes(ctx context.Context) error {
+	return p.postRepository.EnsureIndexes(ctx)
+}
+
+// notifyPublished tells the connections of the author about the post, or the author that
+// moderation blocked it
+func (p *postUseCase) notifyPublished(ctx context.Context, post models.Posts, scheduled bool) {
+	notify := func(from, to primitive.ObjectID, notificationType constants.NotificationType, message string) {
+		err := p.notificationUsecase.SendNotification(ctx, &models.Notifications{
+			ID:        primitive.NewObjectID(),
+			UserID:    from,
+			To:        to,
+			Type:      string(notificationType),
+			Content:   message,
+			ContentID: &post.ID,
+			IsRead:    false,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			log.Println("Could not send the notification of post", post.ID.Hex(), err)
+		}
+	}
+
+	if !post.IsValidated {
+		notify(post.UserID, post.UserID, constants.PostBlocked, constants.PostBlockedMessage)
+		return
+	}
+	if scheduled {
+		notify(primitive.NilObjectID, post.UserID, constants.ScheduledPostPublished, constants.ScheduledPostPublishedMessage)
+	}
+	p.notifyMentions(ctx, post, nil)
+
+	connects, err := p.connectRepository.GetConnects(ctx, post.UserID.Hex())
+	if err != nil {
+		log.Println("Could not get the connections to notify about post", post.ID.Hex(), err)
+		return
+	}
+	to := make([]primitive.ObjectID, 0, len(connects))
+	for _, connect := range connects {
+		if connect.ConnectorID == post.UserID {
+			to = append(to, connect.ConnecteeID)
+		} else {
+			to = append(to, connect.ConnectorID)
+		}
+	}
+	to, err = p.postRepository.GetAudienceMembers(ctx, post, to)
+	if err != nil {
+		log.Println("Could not get the audience to notify about post", post.ID.Hex(), err)
+		return
+	}
+	for _, id := range to {
+		notify(post.UserID, id, constants.ConnectionPosted, constants.ConnectionPostedMessage)
+	}
+}
+
+// notifyMentions tells the mentioned users who are in the audience of the post
+func (p *postUseCase) notifyMentions(ctx context.Context, post models.Posts, previous []models.Mentions) {
+	mentions := audienceMentions(ctx, p.postRepository, post, post.Mentions)
+	p.mentionUsecase.NotifyMentions(ctx, post.UserID, post.ID, mentions, previous)
+}
+
+// audienceMentions keeps the mentions of users the post is for, the content they are
+// mentioned in is on the post and a user outside its audience can not open it
+func audienceMentions(ctx context.Context, postRepository repository.PostRepository, post models.Posts, mentions []models.Mentions) []models.Mentions {
+	if len(mentions) == 0 {
+		return nil
+	}
+	userIDs := make([]primitive.ObjectID, 0, len(mentions))
+	for _, mention := range mentions {
+		userIDs = append(userIDs, mention.UserID)
+	}
+	members, err := postRepository.GetAudienceMembers(ctx, post, userIDs)
+	if err != nil {
+		log.Println("Could not get the audience to notify the mentions of post", post.ID.Hex(), err)
+		return nil
+	}
+	inAudience := make(map[primitive.ObjectID]bool, len(members))
+	for _, id := range members {
+		inAudience[id] = true
+	}
+	kept := make([]models.Mentions, 0, len(mentions))
+	for _, mention := range mentions {
+		if inAudience[mention.UserID] {
+			kept = append(kept, mention)
+		}
+	}
+	return kept
 }
@@ -11,8 +11,9 @@ import (
 type ReportUseCase interface {
 	ReportPost(ctx context.Context, report models.Report) (models.Report, error)
 	ReportJob(ctx context.Context, report models.Report) (models.Report, error)
-	GetReportedPosts(ctx context.Context, page int) ([]models.Report, error)
-	GetReportedJobs(ctx context.Context, page int) ([]models.Report, error)
+	GetReportedPosts(ctx context.Context, page int, scope models.AccessScope) ([]models.Report, error)
+	GetReportedJobs(ctx context.Context, page int, scope models.AccessScope) ([]models.Report, error)
+	GetReportByID(ctx context.Context, reportID primitive.ObjectID) (models.Report, error)
 
 	GetReportAnalytics(ctx context.Context) (models.ReportAnalytics, error)
 	TakeActionOnReport(ctx context.Context, reportID primitive.ObjectID, actionType models.ReportAction) (models.ActionTaken, error)
@@ -32,12 +33,16 @@ func (r *reportUseCase) ReportPost(ctx context.Context, report models.Report) (m
 	return r.reportRepository.ReportPost(ctx, report)
 }
 
-func (r *reportUseCase) GetReportedPosts(ctx context.Context, page int) ([]models.Report, error) {
-	return r.reportRepository.GetReportedPosts(ctx, page)
+func (r *reportUseCase) GetReportedPosts(ctx context.Context, page int, scope models.AccessScope) ([]models.Report, error) {
+	return r.reportRepository.GetReportedPosts(ctx, page, scope)
 
 }
-func (r *reportUseCase) GetReportedJobs(ctx context.Context, page int) ([]models.Report, error) {
-	return r.reportRepository.GetReportedJobs(ctx, page)
+func (r *reportUseCase) GetReportedJobs(ctx context.Context, page int, scope models.AccessScope) ([]models.Report, error) {
+	return r.reportRepository.GetReportedJobs(ctx, page, scope)
+}
+
+func (r *reportUseCase) GetReportByID(ctx context.Context, reportID primitive.ObjectID) (models.Report, error) {
+	return r.reportRepository.GetReportByID(ctx, reportID)
 }
 
 func (r *reportUseCase) GetReportAnalytics(ctx context.Context) (models.ReportAnalytics, error) {
@@ -0,0 +1,116 @@
+package usecases
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RepostUsecase interface {
+	Repost(ctx context.Context, userID, postID primitive.ObjectID, content string) (models.Posts, error)
+	Unrepost(ctx context.Context, userID, postID primitive.ObjectID) error
+	GetReposted(ctx context.Context, userID primitive.ObjectID, postIDs []primitive.ObjectID) (map[primitive.ObjectID]bool, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+type repostUsecase struct {
+	repostRepository    repository.RepostRepository
+	postRepository      repository.PostRepository
+	notificationUsecase NotificationUsecase
+	mentionUsecase      MentionUsecase
+	tagExtractor        repository.TagExtractorRepository
+}
+
+func NewRepostUsecase(
+	repostRepository repository.RepostRepository,
+	postRepository repository.PostRepository,
+	notification NotificationUsecase,
+	mention MentionUsecase,
+	tagExtractor repository.TagExtractorRepository,
+) RepostUsecase {
+	return &repostUsecase{
+		repostRepository:    repostRepository,
+		postRepository:      postRepository,
+		notificationUsecase: notification,
+		mentionUsecase:      mention,
+		tagExtractor:        tagExtractor,
+	}
+}
+
+// Repost reposts the post, or quotes it when there is content
+func (r *repostUsecase) Repost(ctx context.Context, userID, postID primitive.ObjectID, content string) (models.Posts, error) {
+	repost := models.Posts{UserID: userID, RepostOf: &postID, Content: content}
+	mentions, err := r.mentionUsecase.ResolveMentions(ctx, userID, content)
+	if err != nil {
+		return models.Posts{}, err
+	}
+	repost.Mentions = mentions
+
+	repost, original, err := r.repostRepository.Repost(ctx, repost)
+	if err != nil {
+		return models.Posts{}, err
+	}
+	go tagPost(r.postRepository, r.tagExtractor, repost.ID, repost.Content, nil)
+	go r.notifyReposted(context.Background(), repost, original)
+	return repost, nil
+}
+
+// notifyReposted tells the author of the original about the repost, a quote moderation
+// blocked only goes back to its own author
+func (r *repostUsecase) notifyReposted(ctx context.Context, repost, original models.Posts) {
+	notify := func(to primitive.ObjectID, notificationType constants.NotificationType, message string) {
+		err := r.notificationUsecase.SendNotification(ctx, &models.Notifications{
+			ID:        primitive.NewObjectID(),
+			UserID:    repost.UserID,
+			To:        to,
+			Type:      string(notificationType),
+			Content:   message,
+			ContentID: &repost.ID,
+			IsRead:    false,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			log.Println("Could not send the notification of repost", repost.ID.Hex(), err)
+		}
+	}
+
+	if !repost.IsValidated {
+		notify(repost.UserID, constants.PostBlocked, constants.PostBlockedMessage)
+		return
+	}
+	if original.UserID != repost.UserID {
+		if repost.IsPlainRepost() {
+			notify(original.UserID, constants.RepostedYourPost, constants.RepostedYourPostMessage)
+		} else {
+			notify(original.UserID, constants.QuotedYourPost, constants.QuotedYourPostMessage)
+		}
+	}
+	// the author of the original was told about the quote already
+	r.mentionUsecase.NotifyMentions(ctx, repost.UserID, repost.ID, repost.Mentions, []models.Mentions{{UserID: original.UserID}})
+}
+
+func (r *repostUsecase) Unrepost(ctx context.Context, userID, postID primitive.ObjectID) error {
+	return r.repostRepository.Unrepost(ctx, userID, postID)
+}
+
+// GetReposted tells which of the posts the user reposted, in one query for a whole page
+func (r *repostUsecase) GetReposted(ctx context.Context, userID primitive.ObjectID, postIDs []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	ids, err := r.repostRepository.GetReposted(ctx, userID, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	reposted := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		reposted[id] = true
+	}
+	return reposted, nil
+}
+
+func (r *repostUsecase) EnsureIndexes(ctx context.Context) error {
+	return r.repostRepository.EnsureIndexes(ctx)
+}
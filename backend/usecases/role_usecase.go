@@ -0,0 +1,63 @@
+package usecases
+
+import (
+	"context"
+
+	"github.com/chera-mihiretu/IKnow/domain/constants"
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RoleUsecase interface {
+	SeedDefaultRoles(ctx context.Context) error
+	GetRoles(ctx context.Context) ([]models.Roles, error)
+	SaveRole(ctx context.Context, role models.Roles) (models.Roles, error)
+	DeleteRole(ctx context.Context, name string) error
+	AssignRole(ctx context.Context, assignment models.RoleAssignments) (models.RoleAssignments, error)
+	RemoveAssignment(ctx context.Context, id primitive.ObjectID) error
+	GetUserAssignments(ctx context.Context, userID primitive.ObjectID) ([]models.RoleAssignments, error)
+	ResolvePermission(ctx context.Context, userID, role string, permission constants.Permission) (models.AccessScope, bool, error)
+}
+
+type roleUsecase struct {
+	roleRepository repository.RoleRepository
+}
+
+func NewRoleUsecase(roleRepository repository.RoleRepository) RoleUsecase {
+	return &roleUsecase{
+		roleRepository: roleRepository,
+	}
+}
+
+func (r *roleUsecase) SeedDefaultRoles(ctx context.Context) error {
+	return r.roleRepository.SeedDefaultRoles(ctx)
+}
+
+func (r *roleUsecase) GetRoles(ctx context.Context) ([]models.Roles, error) {
+	return r.roleRepository.GetRoles(ctx)
+}
+
+func (r *roleUsecase) SaveRole(ctx context.Context, role models.Roles) (models.Roles, error) {
+	return r.roleRepository.SaveRole(ctx, role)
+}
+
+func (r *roleUsecase) DeleteRole(ctx context.Context, name string) error {
+	return r.roleRepository.DeleteRole(ctx, name)
+}
+
+func (r *roleUsecase) AssignRole(ctx context.Context, assignment models.RoleAssignments) (models.RoleAssignments, error) {
+	return r.roleRepository.AssignRole(ctx, assignment)
+}
+
+func (r *roleUsecase) RemoveAssignment(ctx context.Context, id primitive.ObjectID) error {
+	return r.roleRepository.RemoveAssignment(ctx, id)
+}
+
+func (r *roleUsecase) GetUserAssignments(ctx context.Context, userID primitive.ObjectID) ([]models.RoleAssignments, error) {
+	return r.roleRepository.GetUserAssignments(ctx, userID)
+}
+
+func (r *roleUsecase) ResolvePermission(ctx context.Context, userID, role string, permission constants.Permission) (models.AccessScope, bool, error) {
+	return r.roleRepository.ResolvePermission(ctx, userID, role, permission)
+}
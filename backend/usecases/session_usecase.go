@@ -0,0 +1,70 @@
+package usecases
+
+import (
+	"context"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SessionUsecase interface {
+	CreateSession(ctx context.Context, user models.User, device models.SessionDevice) (models.AuthTokens, error)
+	RefreshSession(ctx context.Context, refreshToken string, device models.SessionDevice) (models.AuthTokens, error)
+	RevokeSession(ctx context.Context, sessionID primitive.ObjectID) error
+	RevokeUserSession(ctx context.Context, userID, sessionID primitive.ObjectID) error
+	GetUserSessions(ctx context.Context, userID, currentSessionID primitive.ObjectID) ([]models.SessionView, error)
+	IsSessionActive(ctx context.Context, sessionID string) (bool, error)
+}
+
+type sessionUsecase struct {
+	sessionRepository repository.SessionRepository
+}
+
+func NewSessionUsecase(sessionRepository repository.SessionRepository) SessionUsecase {
+	return &sessionUsecase{
+		sessionRepository: sessionRepository,
+	}
+}
+
+func (s *sessionUsecase) CreateSession(ctx context.Context, user models.User, device models.SessionDevice) (models.AuthTokens, error) {
+	return s.sessionRepository.CreateSession(ctx, user, device)
+}
+
+func (s *sessionUsecase) RefreshSession(ctx context.Context, refreshToken string, device models.SessionDevice) (models.AuthTokens, error) {
+	return s.sessionRepository.RefreshSession(ctx, refreshToken, device)
+}
+
+func (s *sessionUsecase) RevokeUserSession(ctx context.Context, userID, sessionID primitive.ObjectID) error {
+	return s.sessionRepository.RevokeUserSession(ctx, userID, sessionID)
+}
+
+func (s *sessionUsecase) GetUserSessions(ctx context.Context, userID, currentSessionID primitive.ObjectID) ([]models.SessionView, error) {
+	sessions, err := s.sessionRepository.GetUserSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]models.SessionView, 0, len(sessions))
+	for _, session := range sessions {
+		views = append(views, models.SessionView{
+			ID:           session.ID,
+			Device:       session.Device,
+			UserAgent:    session.UserAgent,
+			IPAddress:    session.IPAddress,
+			Current:      session.ID == currentSessionID,
+			Impersonated: session.ImpersonatorID != nil,
+			LastSeenAt:   session.LastSeenAt,
+			CreatedAt:    session.CreatedAt,
+		})
+	}
+	return views, nil
+}
+
+func (s *sessionUsecase) RevokeSession(ctx context.Context, sessionID primitive.ObjectID) error {
+	return s.sessionRepository.RevokeSession(ctx, sessionID)
+}
+
+func (s *sessionUsecase) IsSessionActive(ctx context.Context, sessionID string) (bool, error) {
+	return s.sessionRepository.IsSessionActive(ctx, sessionID)
+}
@@ -14,6 +14,8 @@ type UniversityUsecase interface {
 	CreateUniversity(ctx context.Context, university models.University) (models.University, error)
 	UpdateUniversity(ctx context.Context, university models.University) (models.University, error)
 	DeleteUniversity(ctx context.Context, id primitive.ObjectID, userID primitive.ObjectID) error
+	AddEmailDomain(ctx context.Context, id primitive.ObjectID, domain string) (models.University, error)
+	RemoveEmailDomain(ctx context.Context, id primitive.ObjectID, domain string) (models.University, error)
 }
 
 type universityUsecase struct {
@@ -42,3 +44,11 @@ func (u *universityUsecase) UpdateUniversity(ctx context.Context, university mod
 func (u *universityUsecase) DeleteUniversity(ctx context.Context, id, userID primitive.ObjectID) error {
 	return u.universityRepo.DeleteUniversity(ctx, id, userID)
 }
+
+func (u *universityUsecase) AddEmailDomain(ctx context.Context, id primitive.ObjectID, domain string) (models.University, error) {
+	return u.universityRepo.AddEmailDomain(ctx, id, domain)
+}
+
+func (u *universityUsecase) RemoveEmailDomain(ctx context.Context, id primitive.ObjectID, domain string) (models.University, error) {
+	return u.universityRepo.RemoveEmailDomain(ctx, id, domain)
+}
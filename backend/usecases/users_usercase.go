@@ -8,8 +8,17 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// the errors UpdateMe and CompleteUser return for a university, school or department the
+// user can not be placed in
+var (
+	ErrUniversityReadOnly    = repository.ErrUniversityReadOnly
+	ErrSchoolNotInUniversity = repository.ErrSchoolNotInUniversity
+	ErrDepartmentNotInSchool = repository.ErrDepartmentNotInSchool
+)
+
 type UserUseCase interface {
 	GetUserById(ctx context.Context, userID string) (models.UserView, error)
+	GetMe(ctx context.Context, userID string) (models.MeView, error)
 	GetUserByIdNoneView(ctx context.Context, userID string) (models.User, error)
 
 	GetUserByEmail(ctx context.Context, email string) (models.UserView, error)
@@ -38,6 +47,10 @@ func (u *userUseCase) GetUserById(ctx context.Context, userID string) (models.Us
 	return u.userRepository.GetUserById(ctx, userID)
 }
 
+func (u *userUseCase) GetMe(ctx context.Context, userID string) (models.MeView, error) {
+	return u.userRepository.GetMe(ctx, userID)
+}
+
 // CompleteUser implements UserUseCase.
 func (u *userUseCase) CompleteUser(ctx context.Context, user models.User) (models.UserView, error) {
 	return u.userRepository.CompleteUser(ctx, user)
@@ -0,0 +1,47 @@
+package usecases
+
+import (
+	"context"
+
+	"github.com/chera-mihiretu/IKnow/domain/models"
+	"github.com/chera-mihiretu/IKnow/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type VerificationRequestUsecase interface {
+	CreateRequest(ctx context.Context, request models.VerificationRequests) (models.VerificationRequests, error)
+	GetRequests(ctx context.Context, page int, status string) ([]models.VerificationRequests, error)
+	GetUserRequests(ctx context.Context, userID primitive.ObjectID) ([]models.VerificationRequests, error)
+	GetRequestByID(ctx context.Context, id primitive.ObjectID) (models.VerificationRequests, error)
+	ReviewRequest(ctx context.Context, id, reviewerID primitive.ObjectID, approve bool, notes string) (models.VerificationRequests, error)
+}
+
+type verificationRequestUsecase struct {
+	verificationRequestRepository repository.VerificationRequestRepository
+}
+
+func NewVerificationRequestUsecase(verificationRequestRepository repository.VerificationRequestRepository) VerificationRequestUsecase {
+	return &verificationRequestUsecase{
+		verificationRequestRepository: verificationRequestRepository,
+	}
+}
+
+func (v *verificationRequestUsecase) CreateRequest(ctx context.Context, request models.VerificationRequests) (models.VerificationRequests, error) {
+	return v.verificationRequestRepository.CreateRequest(ctx, request)
+}
+
+func (v *verificationRequestUsecase) GetRequests(ctx context.Context, page int, status string) ([]models.VerificationRequests, error) {
+	return v.verificationRequestRepository.GetRequests(ctx, page, status)
+}
+
+func (v *verificationRequestUsecase) GetUserRequests(ctx context.Context, userID primitive.ObjectID) ([]models.VerificationRequests, error) {
+	return v.verificationRequestRepository.GetUserRequests(ctx, userID)
+}
+
+func (v *verificationRequestUsecase) GetRequestByID(ctx context.Context, id primitive.ObjectID) (models.VerificationRequests, error) {
+	return v.verificationRequestRepository.GetRequestByID(ctx, id)
+}
+
+func (v *verificationRequestUsecase) ReviewRequest(ctx context.Context, id, reviewerID primitive.ObjectID, approve bool, notes string) (models.VerificationRequests, error) {
+	return v.verificationRequestRepository.ReviewRequest(ctx, id, reviewerID, approve, notes)
+}
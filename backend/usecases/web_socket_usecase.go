@@ -11,6 +11,9 @@ type WebSocketUsecase interface {
 	AddConnection(connection *models.SocketConnection)
 	RemoveConnection(userID string)
 	SendMessage(ctx context.Context, message *models.Notifications)
+	Subscribe(userID, topic string)
+	Unsubscribe(userID, topic string)
+	Broadcast(ctx context.Context, topic string, message interface{})
 }
 
 type webSocketUsecase struct {
@@ -34,3 +37,15 @@ func (u *webSocketUsecase) RemoveConnection(userID string) {
 func (u *webSocketUsecase) SendMessage(ctx context.Context, message *models.Notifications) {
 	u.webSocketRepository.SendMessage(ctx, message)
 }
+
+func (u *webSocketUsecase) Subscribe(userID, topic string) {
+	u.webSocketRepository.Subscribe(userID, topic)
+}
+
+func (u *webSocketUsecase) Unsubscribe(userID, topic string) {
+	u.webSocketRepository.Unsubscribe(userID, topic)
+}
+
+func (u *webSocketUsecase) Broadcast(ctx context.Context, topic string, message interface{}) {
+	u.webSocketRepository.Broadcast(ctx, topic, message)
+}